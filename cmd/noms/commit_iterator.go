@@ -11,6 +11,11 @@ import (
 	"github.com/attic-labs/noms/go/types"
 )
 
+// LogIterator returns the commits that 'noms log' shows, one at a time.
+type LogIterator interface {
+	Next() (LogNode, bool)
+}
+
 type CommitIterator struct {
 	db       datas.Database
 	branches branchList
@@ -77,6 +82,29 @@ func (iter *CommitIterator) Next() (LogNode, bool) {
 	return node, true
 }
 
+// RangeIterator returns the commits that are ancestors of one commit but not of
+// another, as ordered by datas.CommitsBetween. Its LogNodes don't describe a
+// graph.
+type RangeIterator struct {
+	db   datas.Database
+	refs []types.Ref
+}
+
+// Initialize a new RangeIterator with the commits reachable from |to| but not
+// from |from|.
+func NewRangeIterator(db datas.Database, from, to types.Struct) *RangeIterator {
+	return &RangeIterator{db: db, refs: datas.CommitsBetween(types.NewRef(from), types.NewRef(to), db)}
+}
+
+func (iter *RangeIterator) Next() (LogNode, bool) {
+	if len(iter.refs) == 0 {
+		return LogNode{}, false
+	}
+	cr := iter.refs[0]
+	iter.refs = iter.refs[1:]
+	return LogNode{cr: cr, commit: iter.db.ReadValue(cr.TargetHash()).(types.Struct), lastCommit: len(iter.refs) == 0}, true
+}
+
 type LogNode struct {
 	cr               types.Ref    // typed ref of commit to be printed
 	commit           types.Struct // commit that needs to be printed
@@ -0,0 +1,195 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// logDateFormats are the formats that --since and --until accept, and that the
+// date in the meta of a commit is parsed with.
+var logDateFormats = []string{spec.CommitMetaDateFormat, time.RFC3339, "2006-01-02"}
+
+func parseLogDate(str string) (time.Time, bool) {
+	for _, format := range logDateFormats {
+		if t, err := time.Parse(format, str); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// logFilter decides which commits 'noms log' shows. The zero logFilter shows
+// them all.
+type logFilter struct {
+	since, until time.Time
+	grep         *regexp.Regexp
+	meta         map[string]string
+
+	// If changed is set, only the commits that changed the value at path are
+	// shown.
+	changed bool
+	path    types.Path
+	db      datas.Database
+}
+
+// newLogFilter builds a logFilter from the arguments of the flags of 'noms
+// log', which may be empty.
+func newLogFilter(since, until, grep, meta string) (logFilter, error) {
+	f := logFilter{}
+	var ok bool
+	if since != "" {
+		if f.since, ok = parseLogDate(since); !ok {
+			return f, fmt.Errorf("Invalid date for --since: %s", since)
+		}
+	}
+	if until != "" {
+		if f.until, ok = parseLogDate(until); !ok {
+			return f, fmt.Errorf("Invalid date for --until: %s", until)
+		}
+	}
+	if grep != "" {
+		var err error
+		if f.grep, err = regexp.Compile(grep); err != nil {
+			return f, fmt.Errorf("Invalid regular expression for --grep: %s", err)
+		}
+	}
+	if meta != "" {
+		f.meta = map[string]string{}
+		for _, m := range strings.Split(meta, ",") {
+			kv := strings.SplitN(m, "=", 2)
+			if len(kv) != 2 {
+				return f, fmt.Errorf("Unable to parse meta value: %s", m)
+			}
+			if !types.IsValidStructFieldName(kv[0]) {
+				return f, fmt.Errorf("Invalid meta key: %s", kv[0])
+			}
+			f.meta[kv[0]] = kv[1]
+		}
+	}
+	return f, nil
+}
+
+func (f logFilter) isEmpty() bool {
+	return f.since.IsZero() && f.until.IsZero() && f.grep == nil && len(f.meta) == 0 && !f.changed
+}
+
+func (f logFilter) match(commit types.Struct) bool {
+	meta := types.EmptyStruct
+	if m, ok := commit.MaybeGet(datas.MetaField); ok {
+		meta = m.(types.Struct)
+	}
+	if !f.since.IsZero() || !f.until.IsZero() {
+		date, ok := parseLogDate(metaString(meta, "date"))
+		if !ok || (!f.since.IsZero() && date.Before(f.since)) || (!f.until.IsZero() && date.After(f.until)) {
+			return false
+		}
+	}
+	if f.grep != nil && !f.grep.MatchString(metaString(meta, "message")) {
+		return false
+	}
+	for k, v := range f.meta {
+		if _, ok := meta.MaybeGet(k); !ok || metaString(meta, k) != v {
+			return false
+		}
+	}
+	if f.changed {
+		return f.changedValue(commit)
+	}
+	return true
+}
+
+// changedValue returns true if the value at f.path in |commit| differs from
+// that in each of its parents. If it's the same as in one of them, the change
+// was made there rather than by |commit|, as in a merge.
+func (f logFilter) changedValue(commit types.Struct) bool {
+	parents := commit.Get(datas.ParentsField).(types.Set)
+	if parents.Empty() {
+		return f.path.Resolve(commit) != nil
+	}
+	changed := true
+	parents.IterAll(func(v types.Value) {
+		if changed && !valueChanged(f.path, v.(types.Ref).TargetValue(f.db), commit) {
+			changed = false
+		}
+	})
+	return changed
+}
+
+// valueChanged returns true if the values at |path| in |a| and |b| differ. It
+// compares the values along the way to the end of |path| by hash, and stops as
+// soon as they're the same, since everything in them is then the same too.
+func valueChanged(path types.Path, a, b types.Value) bool {
+	for i, part := range path {
+		if a == nil || b == nil {
+			a, b = path[i:].Resolve(a), path[i:].Resolve(b)
+			break
+		}
+		if a.Equals(b) {
+			return false
+		}
+		a, b = part.Resolve(a), part.Resolve(b)
+	}
+	if a == nil || b == nil {
+		return a != nil || b != nil
+	}
+	return !a.Equals(b)
+}
+
+// metaString returns the field |name| of |meta| as it was given on the command
+// line when the commit was made: the string itself if it's a String, and
+// otherwise encoded.
+func metaString(meta types.Struct, name string) string {
+	v, ok := meta.MaybeGet(name)
+	if !ok {
+		return ""
+	}
+	if s, ok := v.(types.String); ok {
+		return string(s)
+	}
+	return types.EncodedValue(v)
+}
+
+// FilterIterator returns the LogNodes of another LogIterator whose commits a
+// logFilter matches. Its LogNodes don't describe a graph.
+type FilterIterator struct {
+	iter   LogIterator
+	filter logFilter
+	next   LogNode
+	ok     bool
+}
+
+// Initialize a new FilterIterator with the commits returned by |iter| that
+// |filter| matches.
+func NewFilterIterator(iter LogIterator, filter logFilter) *FilterIterator {
+	fi := &FilterIterator{iter: iter, filter: filter}
+	fi.next, fi.ok = fi.find()
+	return fi
+}
+
+func (iter *FilterIterator) find() (LogNode, bool) {
+	for ln, ok := iter.iter.Next(); ok; ln, ok = iter.iter.Next() {
+		if iter.filter.match(ln.commit) {
+			return ln, true
+		}
+	}
+	return LogNode{}, false
+}
+
+func (iter *FilterIterator) Next() (LogNode, bool) {
+	if !iter.ok {
+		return LogNode{}, false
+	}
+	ln := iter.next
+	iter.next, iter.ok = iter.find()
+	return LogNode{cr: ln.cr, commit: ln.commit, lastCommit: !iter.ok}, true
+}
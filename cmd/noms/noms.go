@@ -17,17 +17,32 @@ import (
 )
 
 var commands = []*util.Command{
+	nomsBisect,
+	nomsBlame,
+	nomsCherryPick,
 	nomsCommit,
+	nomsCommitGraph,
+	nomsCompact,
 	nomsConfig,
 	nomsDiff,
 	nomsDs,
+	nomsFetch,
+	nomsFsck,
+	nomsGC,
 	nomsLog,
 	nomsMerge,
+	nomsMergeBase,
 	nomsMigrate,
+	nomsPull,
+	nomsPush,
+	nomsRebase,
+	nomsReflog,
+	nomsRemote,
 	nomsRoot,
 	nomsServe,
 	nomsShow,
 	nomsSync,
+	nomsTag,
 	nomsVersion,
 }
 
@@ -0,0 +1,166 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+const (
+	// bisectCommitEnv is the environment variable that holds the absolute path
+	// of the commit being tested, e.g. 'ldb::#sha1', when the command is run.
+	bisectCommitEnv = "NOMS_BISECT_COMMIT"
+
+	// bisectSkipCode is the exit status with which the command says that the
+	// commit can't be tested, as with 'git bisect run'.
+	bisectSkipCode = 125
+)
+
+var nomsBisect = &util.Command{
+	Run:       runBisect,
+	UsageLine: "bisect [options] <database> <good> <bad> <command> [<arg>...]",
+	Short:     "Finds the commit that broke something by binary search",
+	Long:      "Binary-searches the history between a good and a bad commit for the first bad one, following the first parent of each commit from <bad> back to <good>. At each step, runs <command> with the absolute path of the commit to test, e.g. 'ldb::#sha1', in the " + bisectCommitEnv + " environment variable. If <command> exits with status 0 the commit is good, with 125 it can't be tested and is skipped, and with any other status it's bad. <good> must be an ancestor of <bad>. Each of <good> and <bad> is an absolute path within <database>, e.g. a dataset name or #<hash>. Put -- before <command> if it has options of its own.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database and commit arguments.",
+	Flags:     setupBisectFlags,
+	Nargs:     4,
+}
+
+func setupBisectFlags() *flag.FlagSet {
+	bisectFlagSet := flag.NewFlagSet("bisect", flag.ExitOnError)
+	verbose.RegisterVerboseFlags(bisectFlagSet)
+	return bisectFlagSet
+}
+
+func runBisect(args []string) int {
+	cfg := config.NewResolver()
+	dbSpec := cfg.ResolveDbSpec(args[0])
+	db, err := cfg.GetDatabase(args[0])
+	d.CheckError(err)
+	defer db.Close()
+
+	good, bad := types.NewRef(resolveCommit(db, args[1])), types.NewRef(resolveCommit(db, args[2]))
+	checkIfTrue(good.TargetHash() == bad.TargetHash(), "%s and %s are the same commit", args[1], args[2])
+	checkIfTrue(!datas.IsAncestor(good, bad, db), "%s is not an ancestor of %s", args[1], args[2])
+
+	b := newBisection(good, bad, db)
+	test := func(r types.Ref) bisectVerdict {
+		cmd := exec.Command(args[3], args[4:]...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s%s#%s", bisectCommitEnv, dbSpec, spec.Separator, r.TargetHash()))
+		err := cmd.Run()
+		if err == nil {
+			return bisectGood
+		}
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			d.CheckErrorNoUsage(fmt.Errorf("Unable to run %s: %s", args[3], err))
+		}
+		if exitErr.ExitCode() == bisectSkipCode {
+			return bisectSkip
+		}
+		return bisectBad
+	}
+	b.run(os.Stdout, test)
+	b.write(os.Stdout, db)
+	return 0
+}
+
+type bisectVerdict int
+
+const (
+	bisectGood bisectVerdict = iota
+	bisectBad
+	bisectSkip
+)
+
+func (v bisectVerdict) String() string {
+	return [...]string{"good", "bad", "skipped"}[v]
+}
+
+// bisection is a binary search for the first bad commit. Its candidates are
+// the commits from the bad one back to, but not including, the good one, by
+// way of the first parent of each, newest first. All of those up to lo are
+// known to be bad, and all of those from hi on are known to be good, with
+// hi == len(candidates) standing for the good commit itself.
+type bisection struct {
+	candidates []types.Ref
+	skipped    map[int]bool
+	lo, hi     int
+}
+
+func newBisection(good, bad types.Ref, vr types.ValueReader) *bisection {
+	between := hash.HashSet{}
+	for _, r := range datas.CommitsBetween(good, bad, vr) {
+		between.Insert(r.TargetHash())
+	}
+	b := &bisection{skipped: map[int]bool{}}
+	for _, r := range datas.FirstParentHistory(bad, vr) {
+		if !between.Has(r.TargetHash()) {
+			break
+		}
+		b.candidates = append(b.candidates, r)
+	}
+	b.hi = len(b.candidates)
+	return b
+}
+
+// next returns the index of the candidate to test next: the one nearest the
+// middle of those that aren't known to be good or bad, and haven't been
+// skipped. It returns false once there are none.
+func (b *bisection) next() (int, bool) {
+	mid := (b.lo + b.hi) / 2
+	for offset := 0; offset < b.hi-b.lo; offset++ {
+		for _, i := range []int{mid + offset, mid - offset} {
+			if i > b.lo && i < b.hi && !b.skipped[i] {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (b *bisection) run(w io.Writer, test func(r types.Ref) bisectVerdict) {
+	for i, ok := b.next(); ok; i, ok = b.next() {
+		r := b.candidates[i]
+		fmt.Fprintf(w, "Testing #%s (%d commits left)\n", r.TargetHash(), b.hi-b.lo-1)
+		v := test(r)
+		fmt.Fprintf(w, "#%s is %s\n", r.TargetHash(), v)
+		switch v {
+		case bisectGood:
+			b.hi = i
+		case bisectBad:
+			b.lo = i
+		case bisectSkip:
+			b.skipped[i] = true
+		}
+	}
+}
+
+// write reports the first bad commit, or the commits it may be if some of
+// them were skipped.
+func (b *bisection) write(w io.Writer, vr types.ValueReader) {
+	if b.hi-b.lo == 1 {
+		commit := b.candidates[b.lo].TargetValue(vr).(types.Struct)
+		fmt.Fprintf(w, "#%s is the first bad commit%s\n", commit.Hash(), metaSummary(commit))
+		return
+	}
+	fmt.Fprintln(w, "The first bad commit could be any of:")
+	for i := b.lo; i < b.hi; i++ {
+		fmt.Fprintf(w, "#%s\n", b.candidates[i].TargetHash())
+	}
+}
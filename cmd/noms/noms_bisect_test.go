@@ -0,0 +1,56 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+type nomsBisectTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func TestNomsBisect(t *testing.T) {
+	suite.Run(t, &nomsBisectTestSuite{})
+}
+
+func (s *nomsBisectTestSuite) TestBisect() {
+	sp, err := spec.ForDatabase(spec.CreateDatabaseSpecString("nbs", s.DBDir))
+	s.NoError(err)
+	defer sp.Close()
+
+	ds := sp.GetDatabase().GetDataset("ingest")
+	hashes := []string{}
+	for i := 0; i < 8; i++ {
+		ds, err = addCommit(ds, fmt.Sprintf("%d", i))
+		s.NoError(err)
+		hashes = append(hashes, ds.Head().Hash().String())
+	}
+	dbSpec := spec.CreateDatabaseSpecString("nbs", s.DBDir)
+
+	// The commits from the fifth on are bad, and |skip| can't be tested.
+	script := func(skip string) string {
+		return fmt.Sprintf(`case "$NOMS_BISECT_COMMIT" in %s::#%s) exit 125;; *%s|*%s|*%s|*%s) exit 1;; esac`,
+			dbSpec, skip, hashes[4], hashes[5], hashes[6], hashes[7])
+	}
+
+	stdout, _ := s.MustRun(main, []string{"bisect", dbSpec, "#" + hashes[0], "ingest", "--", "sh", "-c", script("")})
+	s.True(strings.HasSuffix(stdout, "#"+hashes[4]+" is the first bad commit\n"), stdout)
+	s.NotContains(stdout, "Testing #"+hashes[0])
+	s.NotContains(stdout, "Testing #"+hashes[7])
+
+	stdout, _ = s.MustRun(main, []string{"bisect", dbSpec, "#" + hashes[0], "ingest", "--", "sh", "-c", script(hashes[4])})
+	s.Contains(stdout, "#"+hashes[4]+" is skipped\n")
+	s.True(strings.HasSuffix(stdout, "The first bad commit could be any of:\n#"+hashes[5]+"\n#"+hashes[4]+"\n"), stdout)
+
+	_, _, err2 := s.Run(main, []string{"bisect", dbSpec, "ingest", "#" + hashes[0], "true"})
+	s.NotNil(err2)
+}
@@ -0,0 +1,260 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/outputpager"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsBlame = &util.Command{
+	Run:       runBlame,
+	UsageLine: "blame <path-spec>",
+	Short:     "Shows the commit that last changed each entry of a value",
+	Long:      "Shows, for each entry of the Map, Set or List, or each field of the Struct, at a path within a commit, e.g. 'ldb::ds.value[\"users\"]', the newest commit that changed it to what it is now, along with the meta of that commit. If the value at the path is of another kind, the commit that last changed the value itself is shown. See Spelling Values at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the <path-spec> parameter.",
+	Flags:     setupBlameFlags,
+	Nargs:     1,
+}
+
+func setupBlameFlags() *flag.FlagSet {
+	blameFlagSet := flag.NewFlagSet("blame", flag.ExitOnError)
+	outputpager.RegisterOutputpagerFlags(blameFlagSet)
+	verbose.RegisterVerboseFlags(blameFlagSet)
+	return blameFlagSet
+}
+
+func runBlame(args []string) int {
+	cfg := config.NewResolver()
+	sp, err := spec.ForPath(cfg.ResolvePathSpec(args[0]))
+	d.CheckErrorNoUsage(err)
+	defer sp.Close()
+
+	pinned, ok := sp.Pin()
+	if !ok {
+		d.CheckErrorNoUsage(fmt.Errorf("Cannot resolve spec: %s", args[0]))
+	}
+	defer pinned.Close()
+	db := pinned.GetDatabase()
+
+	path := pinned.Path.Path
+	if len(path) == 0 {
+		path = types.MustParsePath(".value")
+	}
+	head, ok := db.ReadValue(pinned.Path.Hash).(types.Struct)
+	if !ok || !datas.IsCommitType(head.Type()) {
+		d.CheckErrorNoUsage(fmt.Errorf("%s does not reference a Commit object", args[0]))
+	}
+	v := path.Resolve(head)
+	if v == nil {
+		d.CheckErrorNoUsage(fmt.Errorf("%s not found", args[0]))
+	}
+
+	b := newBlame(v, path)
+	iter := NewCommitIterator(db, head)
+	for ln, ok := iter.Next(); ok && b.unresolved > 0; ln, ok = iter.Next() {
+		b.visit(ln.commit, db)
+	}
+
+	pgr := outputpager.Start()
+	defer pgr.Stop()
+	b.write(pgr.Writer)
+	return 0
+}
+
+// blameEntry is one of the entries of the value being blamed, and the commit
+// that changed it to what it is now, once that's known.
+type blameEntry struct {
+	key    types.Value
+	label  string
+	value  types.Value
+	commit types.Struct
+	found  bool
+}
+
+// blame works out which commits last changed the entries of a value, visiting
+// the commits in its history newest first. An entry is blamed on the first
+// commit visited in which it's as it is now, but not in any of the parents.
+type blame struct {
+	path       types.Path
+	kind       types.NomsKind
+	entries    []*blameEntry
+	unresolved int
+}
+
+func newBlame(v types.Value, path types.Path) *blame {
+	b := &blame{path: path, kind: v.Type().Kind()}
+	add := func(key types.Value, label string) {
+		b.entries = append(b.entries, &blameEntry{key: key, label: label, value: b.entry(v, key)})
+	}
+	switch v := v.(type) {
+	case types.Map:
+		v.IterAll(func(k, _ types.Value) {
+			add(k, keyLabel(k))
+		})
+	case types.Set:
+		v.IterAll(func(k types.Value) {
+			add(k, keyLabel(k))
+		})
+	case types.List:
+		v.IterAll(func(_ types.Value, i uint64) {
+			add(types.Number(i), fmt.Sprintf("[%d]", i))
+		})
+	case types.Struct:
+		v.Type().Desc.(types.StructDesc).IterFields(func(name string, _ *types.Type, _ bool) {
+			add(types.String(name), "."+name)
+		})
+	default:
+		b.kind = types.ValueKind
+		add(nil, path.String())
+	}
+	b.unresolved = len(b.entries)
+	return b
+}
+
+// keyLabel describes a key of a Map or an element of a Set as a path does.
+func keyLabel(k types.Value) string {
+	if types.IsPrimitiveKind(k.Type().Kind()) {
+		return "[" + types.EncodedValue(k) + "]"
+	}
+	return "[#" + k.Hash().String() + "]"
+}
+
+// entry returns the entry |key| of |v|, or nil if it has none. If the value
+// being blamed isn't a collection or a Struct, its only entry is itself.
+func (b *blame) entry(v types.Value, key types.Value) types.Value {
+	if v == nil {
+		return nil
+	}
+	if b.kind == types.ValueKind {
+		return v
+	}
+	if v.Type().Kind() != b.kind {
+		return nil
+	}
+	switch v := v.(type) {
+	case types.Map:
+		e, _ := v.MaybeGet(key)
+		return e
+	case types.Set:
+		if v.Has(key) {
+			return key
+		}
+	case types.List:
+		if i := uint64(key.(types.Number)); i < v.Len() {
+			return v.Get(i)
+		}
+	case types.Struct:
+		e, _ := v.MaybeGet(string(key.(types.String)))
+		return e
+	}
+	return nil
+}
+
+// visit blames |commit| for the entries that are as they are now in it, but
+// not in any of its parents.
+func (b *blame) visit(commit types.Struct, vr types.ValueReader) {
+	candidates := []*blameEntry{}
+	for _, e := range b.entries {
+		if !e.found {
+			candidates = append(candidates, e)
+		}
+	}
+	cur := b.path.Resolve(commit)
+	parents := commit.Get(datas.ParentsField).(types.Set)
+	parents.IterAll(func(p types.Value) {
+		if len(candidates) == 0 {
+			return
+		}
+		parent := p.(types.Ref).TargetValue(vr)
+		if !valueChanged(b.path, parent, commit) {
+			candidates = nil
+			return
+		}
+		candidates = b.changed(candidates, cur, b.path.Resolve(parent))
+	})
+	for _, e := range candidates {
+		if v := b.entry(cur, e.key); v != nil && v.Equals(e.value) {
+			e.commit, e.found = commit, true
+			b.unresolved--
+		}
+	}
+}
+
+// changed returns those of |candidates| that differ between |cur| and |last|.
+// Maps and Sets are compared with Diff, which skips the parts of them that
+// are the same without reading them.
+func (b *blame) changed(candidates []*blameEntry, cur, last types.Value) []*blameEntry {
+	changedKeys := hash.HashSet{}
+	isChanged := func(e *blameEntry) bool {
+		before, after := b.entry(last, e.key), b.entry(cur, e.key)
+		if before == nil || after == nil {
+			return before != nil || after != nil
+		}
+		return !before.Equals(after)
+	}
+	if cur != nil && last != nil && cur.Type().Kind() == b.kind && last.Type().Kind() == b.kind && (b.kind == types.MapKind || b.kind == types.SetKind) {
+		changes := make(chan types.ValueChanged)
+		closeChan := make(chan struct{})
+		defer close(closeChan)
+		go func() {
+			defer close(changes)
+			if b.kind == types.MapKind {
+				cur.(types.Map).Diff(last.(types.Map), changes, closeChan)
+			} else {
+				cur.(types.Set).Diff(last.(types.Set), changes, closeChan)
+			}
+		}()
+		for change := range changes {
+			changedKeys.Insert(change.V.Hash())
+		}
+		isChanged = func(e *blameEntry) bool {
+			return changedKeys.Has(e.key.Hash())
+		}
+	}
+
+	changed := []*blameEntry{}
+	for _, e := range candidates {
+		if isChanged(e) {
+			changed = append(changed, e)
+		}
+	}
+	return changed
+}
+
+func (b *blame) write(w io.Writer) {
+	for _, e := range b.entries {
+		fmt.Fprintf(w, "%s %s%s\n", e.commit.Hash(), e.label, metaSummary(e.commit))
+	}
+}
+
+// metaSummary describes the meta of |commit| on one line, after a space, or
+// returns "" if it has none.
+func metaSummary(commit types.Struct) string {
+	m, ok := commit.MaybeGet(datas.MetaField)
+	if !ok {
+		return ""
+	}
+	meta := m.(types.Struct)
+	fields := []string{}
+	meta.Type().Desc.(types.StructDesc).IterFields(func(name string, _ *types.Type, _ bool) {
+		fields = append(fields, fmt.Sprintf("%s: %s", name, types.EncodedValue(meta.Get(name))))
+	})
+	if len(fields) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", strings.Join(fields, ", "))
+}
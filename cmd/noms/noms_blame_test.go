@@ -0,0 +1,68 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+type nomsBlameTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func TestNomsBlame(t *testing.T) {
+	suite.Run(t, &nomsBlameTestSuite{})
+}
+
+func (s *nomsBlameTestSuite) TestBlame() {
+	sp, err := spec.ForDatabase(spec.CreateDatabaseSpecString("nbs", s.DBDir))
+	s.NoError(err)
+	defer sp.Close()
+
+	db := sp.GetDatabase()
+	m := func(kv ...interface{}) types.Map {
+		vals := []types.Value{}
+		for i := 0; i < len(kv); i += 2 {
+			vals = append(vals, types.String(kv[i].(string)), types.Number(kv[i+1].(int)))
+		}
+		return types.NewMap(vals...)
+	}
+	mainDs, err := db.CommitValue(db.GetDataset("main"), m("bob", 1, "alice", 1))
+	s.NoError(err)
+	h0 := mainDs.Head().Hash().String()
+	meta := types.NewStruct("Meta", types.StructData{"message": types.String("Fix bob")})
+	mainDs, err = db.Commit(mainDs, m("bob", 2, "alice", 1), datas.CommitOptions{Meta: meta})
+	s.NoError(err)
+	h1 := mainDs.Head().Hash().String()
+	topic, err := db.Commit(db.GetDataset("topic"), m("bob", 2, "alice", 1, "dave", 1), datas.CommitOptions{Parents: types.NewSet(mainDs.HeadRef())})
+	s.NoError(err)
+	ht := topic.Head().Hash().String()
+	mainDs, err = db.CommitValue(mainDs, m("bob", 2, "alice", 2, "carol", 1))
+	s.NoError(err)
+	h2 := mainDs.Head().Hash().String()
+	mainDs, err = db.Commit(mainDs, m("bob", 2, "alice", 2, "carol", 1, "dave", 1), datas.CommitOptions{Parents: types.NewSet(mainDs.HeadRef(), topic.HeadRef())})
+	s.NoError(err)
+
+	stdout, _ := s.MustRun(main, []string{"blame", spec.CreateValueSpecString("nbs", s.DBDir, "main")})
+	s.Equal(h2+" [\"alice\"]\n"+
+		h1+" [\"bob\"] (message: \"Fix bob\")\n"+
+		h2+" [\"carol\"]\n"+
+		ht+" [\"dave\"]\n", stdout)
+
+	stdout, _ = s.MustRun(main, []string{"blame", spec.CreateValueSpecString("nbs", s.DBDir, "main.value[\"alice\"]")})
+	s.Equal(h2+" .value[\"alice\"]\n", stdout)
+
+	stdout, _ = s.MustRun(main, []string{"blame", spec.CreateValueSpecString("nbs", s.DBDir, "#"+h1+".value")})
+	s.Equal(h0+" [\"alice\"]\n"+h1+" [\"bob\"] (message: \"Fix bob\")\n", stdout)
+
+	_, _, err2 := s.Run(main, []string{"blame", spec.CreateValueSpecString("nbs", s.DBDir, "main.value[\"erin\"]")})
+	s.NotNil(err2)
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/status"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsCherryPick = &util.Command{
+	Run:       runCherryPick,
+	UsageLine: "cherry-pick [options] <database> <commit> <dataset>",
+	Short:     "Replays the change made by a commit on top of the head of a dataset",
+	Long:      "Replays the diff between <commit> and its parent on top of the head of <dataset>, and commits the result with the meta of <commit>. Conflicting changes are resolved according to --policy, as in 'noms merge'. <commit> is an absolute path within <database>, e.g. a dataset name or #<hash>.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database and commit arguments.",
+	Flags:     setupCherryPickFlags,
+	Nargs:     3,
+}
+
+func setupCherryPickFlags() *flag.FlagSet {
+	cherryPickFlagSet := flag.NewFlagSet("cherry-pick", flag.ExitOnError)
+	registerReplayPolicyFlag(cherryPickFlagSet)
+	verbose.RegisterVerboseFlags(cherryPickFlagSet)
+	return cherryPickFlagSet
+}
+
+func runCherryPick(args []string) int {
+	cfg := config.NewResolver()
+	db, err := cfg.GetDatabase(args[0])
+	d.CheckError(err)
+	defer db.Close()
+
+	commit := resolveCommit(db, args[1])
+	ds := resolveDataset(db, args[2])
+	head, ok := ds.MaybeHead()
+	checkIfTrue(!ok, "Dataset %s has no data", ds.ID())
+	headRef := ds.HeadRef()
+
+	pc := newMergeProgressChan()
+	value, meta := replayCommit(db, commit, head, decideResolveFunc(resolver), pc)
+	close(pc)
+
+	ds, err = db.Commit(ds, value, datas.CommitOptions{Parents: types.NewSet(headRef), Meta: meta})
+	d.CheckErrorNoUsage(err)
+	if !verbose.Quiet() {
+		status.Done()
+	}
+	fmt.Printf("New head #%s (was #%s)\n", ds.HeadRef().TargetHash(), headRef.TargetHash())
+	return 0
+}
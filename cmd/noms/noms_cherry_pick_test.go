@@ -0,0 +1,73 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+type nomsCherryPickTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func TestNomsCherryPick(t *testing.T) {
+	suite.Run(t, &nomsCherryPickTestSuite{})
+}
+
+func (s *nomsCherryPickTestSuite) TearDownTest() {
+	s.NoError(os.RemoveAll(s.DBDir))
+}
+
+func (s *nomsCherryPickTestSuite) TestCherryPick() {
+	sp, err := spec.ForDatabase(s.DBDir)
+	s.NoError(err)
+	defer sp.Close()
+	db := sp.GetDatabase()
+
+	meta := types.NewStruct("Meta", types.StructData{"desc": types.String("fix")})
+	ds, err := db.CommitValue(db.GetDataset("main"), types.NewMap(types.String("a"), types.Number(1)))
+	s.NoError(err)
+	base := ds.HeadRef()
+	_, err = db.CommitValue(ds, types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(2)))
+	s.NoError(err)
+	fix, err := db.Commit(db.GetDataset("fix"), types.NewMap(types.String("a"), types.Number(1), types.String("c"), types.Number(3)), datas.CommitOptions{Parents: types.NewSet(base), Meta: meta})
+	s.NoError(err)
+	mainHead := db.GetDataset("main").HeadRef()
+	db.Close()
+
+	stdout, _ := s.MustRun(main, []string{"cherry-pick", s.DBDir, "#" + fix.HeadRef().TargetHash().String(), "main"})
+	s.Contains(stdout, "(was #"+mainHead.TargetHash().String()+")")
+
+	sp, err = spec.ForDataset(spec.CreateValueSpecString("nbs", s.DBDir, "main"))
+	s.NoError(err)
+	defer sp.Close()
+	head := sp.GetDataset().Head()
+	s.True(types.NewMap(types.String("a"), types.Number(1), types.String("b"), types.Number(2), types.String("c"), types.Number(3)).Equals(head.Get(datas.ValueField)))
+	s.True(types.NewSet(mainHead).Equals(head.Get(datas.ParentsField)))
+	s.True(meta.Equals(head.Get(datas.MetaField)))
+}
+
+func (s *nomsCherryPickTestSuite) TestCherryPickRootCommit() {
+	sp, err := spec.ForDatabase(s.DBDir)
+	s.NoError(err)
+	defer sp.Close()
+	db := sp.GetDatabase()
+	_, err = db.CommitValue(db.GetDataset("main"), types.Number(1))
+	s.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("other"), types.Number(2))
+	s.NoError(err)
+	db.Close()
+
+	_, stderr, recovered := s.Run(main, []string{"cherry-pick", s.DBDir, "other", "main"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "because it has 0 parents")
+}
@@ -0,0 +1,51 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	dropCommitGraph bool
+
+	nomsCommitGraph = &util.Command{
+		Run:       runCommitGraph,
+		UsageLine: "commit-graph [--drop] <database>",
+		Short:     "Builds or drops the commit-graph index of a database",
+		Long:      "Adds a commit-graph index to the database, or brings the one it has up to date, e.g. after an older version of noms has committed to it. The index records the height, parents and date of every commit in the history of the datasets, and speeds up commands that walk the commit graph, like log, merge, merge-base and pull, particularly over the network. Once a database has one, it's kept up to date as datasets move. With --drop, removes the index instead.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database argument.",
+		Flags:     setupCommitGraphFlags,
+		Nargs:     1,
+	}
+)
+
+func setupCommitGraphFlags() *flag.FlagSet {
+	commitGraphFlagSet := flag.NewFlagSet("commit-graph", flag.ExitOnError)
+	commitGraphFlagSet.BoolVar(&dropCommitGraph, "drop", false, "remove the commit-graph index")
+	verbose.RegisterVerboseFlags(commitGraphFlagSet)
+	return commitGraphFlagSet
+}
+
+func runCommitGraph(args []string) int {
+	cfg := config.NewResolver()
+	db, err := cfg.GetDatabase(args[0])
+	d.CheckError(err)
+	defer db.Close()
+
+	if dropCommitGraph {
+		d.CheckErrorNoUsage(db.DropCommitGraph())
+		fmt.Printf("Dropped commit-graph index of %s\n", args[0])
+		return 0
+	}
+	d.CheckErrorNoUsage(db.BuildCommitGraph())
+	fmt.Printf("Built commit-graph index of %s\n", args[0])
+	return 0
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+type nomsCommitGraphTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func TestNomsCommitGraph(t *testing.T) {
+	suite.Run(t, &nomsCommitGraphTestSuite{})
+}
+
+func (s *nomsCommitGraphTestSuite) hasCommitGraph() bool {
+	root, _ := s.MustRun(main, []string{"root", s.DBDir})
+	stdout, _ := s.MustRun(main, []string{"show", s.DBDir + "::#" + strings.TrimSpace(root)})
+	return strings.Contains(stdout, datas.CommitGraphKey)
+}
+
+func (s *nomsCommitGraphTestSuite) TestCommitGraph() {
+	sp, err := spec.ForDatabase(s.DBDir)
+	s.NoError(err)
+	db := sp.GetDatabase()
+	ds, err := addCommit(db.GetDataset("main"), "1")
+	s.NoError(err)
+	base := ds.HeadRef()
+	_, err = addBranchedDataset(db.GetDataset("topic"), ds, "2")
+	s.NoError(err)
+	_, err = addCommit(ds, "3")
+	s.NoError(err)
+	sp.Close()
+
+	stdout, _ := s.MustRun(main, []string{"commit-graph", s.DBDir})
+	s.Equal("Built commit-graph index of "+s.DBDir+"\n", stdout)
+	s.True(s.hasCommitGraph())
+
+	stdout, _ = s.MustRun(main, []string{"merge-base", s.DBDir, "main", "topic"})
+	s.Equal(base.TargetHash().String()+"\n", stdout)
+	stdout, _ = s.MustRun(main, []string{"ds", s.DBDir})
+	s.Equal("main\ntopic\n", stdout)
+
+	stdout, _ = s.MustRun(main, []string{"commit-graph", "--drop", s.DBDir})
+	s.Equal("Dropped commit-graph index of "+s.DBDir+"\n", stdout)
+	s.False(s.hasCommitGraph())
+}
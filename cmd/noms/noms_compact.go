@@ -0,0 +1,98 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/nbs"
+	"github.com/attic-labs/noms/go/util/verbose"
+	humanize "github.com/dustin/go-humanize"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	compactAll            bool
+	compactFanIn          int
+	compactMinTableSize   string
+	compactMaxTableSize   string
+	compactByReachability bool
+
+	nomsCompact = &util.Command{
+		Run:       runCompact,
+		UsageLine: "compact [options] <db-spec>",
+		Short:     "Merge the tables of a database into fewer, larger ones",
+		Long:      "Merges the tables that a database's chunks are stored in, the way it's done in the background, and reports how many were merged. Tables are grouped into tiers by size: those smaller than --min-table-size are in the first, and each tier after that holds tables up to --fan-in times larger than those of the one before. Any tier with at least --fan-in tables is merged into a single table. With --all, all the tables are merged into one. Only nbs, aws and blob databases are supported.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database argument.",
+		Flags:     setupCompactFlags,
+		Nargs:     1,
+	}
+)
+
+func setupCompactFlags() *flag.FlagSet {
+	compactFlagSet := flag.NewFlagSet("compact", flag.ExitOnError)
+	compactFlagSet.BoolVar(&compactAll, "all", false, "merge all the tables into one")
+	compactFlagSet.IntVar(&compactFanIn, "fan-in", nbs.DefaultCompactionPolicy.FanIn, "how many tables of a tier it takes to merge them")
+	compactFlagSet.StringVar(&compactMinTableSize, "min-table-size", humanize.IBytes(nbs.DefaultCompactionPolicy.MinTableBytes), "the size below which tables are all in the first tier")
+	compactFlagSet.StringVar(&compactMaxTableSize, "max-table-size", "", "the size of tables that are never merged")
+	compactFlagSet.BoolVar(&compactByReachability, "group-by-reachability", false, "write chunks in the order in which they're reached from the values that refer to them, rather than in the order they were written")
+	verbose.RegisterVerboseFlags(compactFlagSet)
+	return compactFlagSet
+}
+
+func runCompact(args []string) int {
+	policy := nbs.CompactAllPolicy
+	if !compactAll {
+		policy = parseCompactionPolicy(compactFanIn, compactMinTableSize, compactMaxTableSize, "")
+	}
+	policy.GroupByReachability = compactByReachability
+
+	cfg := config.NewResolver()
+	cs, err := cfg.GetChunkStore(args[0])
+	d.CheckErrorNoUsage(err)
+
+	store, ok := cs.(*nbs.NomsBlockStore)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "compact is not supported for %s\n", args[0])
+		return 1
+	}
+	defer store.Close()
+
+	stats, err := store.Compact(policy)
+	if err == nbs.ErrCompactionConflict {
+		fmt.Fprintln(os.Stderr, "Database was modified during compaction, try again")
+		return 1
+	}
+	d.CheckErrorNoUsage(err)
+
+	if stats.TablesCompacted == 0 {
+		fmt.Printf("Nothing to compact: %d tables\n", stats.TablesBefore)
+		return 0
+	}
+	fmt.Printf("Compacted %d tables, holding %s of chunk data, into %d: %d tables before, %d tables after\n",
+		stats.TablesCompacted, humanize.Bytes(stats.BytesCompacted), stats.TablesWritten, stats.TablesBefore, stats.TablesAfter)
+	return 0
+}
+
+// parseCompactionPolicy returns the CompactionPolicy described by the flags
+// --<prefix>fan-in, --<prefix>min-table-size and --<prefix>max-table-size,
+// whose values are given.
+func parseCompactionPolicy(fanIn int, minTableSize, maxTableSize, prefix string) nbs.CompactionPolicy {
+	policy := nbs.CompactionPolicy{FanIn: fanIn}
+	var err error
+	policy.MinTableBytes, err = humanize.ParseBytes(minTableSize)
+	d.CheckError(err)
+	if maxTableSize != "" {
+		policy.MaxTableBytes, err = humanize.ParseBytes(maxTableSize)
+		d.CheckError(err)
+	}
+	if policy.FanIn < 2 || policy.MinTableBytes == 0 {
+		d.CheckError(fmt.Errorf("--%sfan-in must be at least 2, and --%smin-table-size more than 0", prefix, prefix))
+	}
+	return policy
+}
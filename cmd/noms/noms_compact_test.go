@@ -0,0 +1,57 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsCompact(t *testing.T) {
+	suite.Run(t, &nomsCompactTestSuite{})
+}
+
+type nomsCompactTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsCompactTestSuite) TestCompact() {
+	sp, err := spec.ForDataset(spec.CreateValueSpecString("nbs", s.DBDir, "compact"))
+	s.NoError(err)
+
+	db := sp.GetDatabase()
+	ds := sp.GetDataset()
+	for _, v := range []string{"a", "b", "c"} {
+		ds, err = db.CommitValue(ds, types.String(v))
+		s.NoError(err)
+	}
+	head := ds.HeadRef().TargetHash()
+	sp.Close()
+
+	dbSpec := spec.CreateDatabaseSpecString("nbs", s.DBDir)
+	stdout, _ := s.MustRun(main, []string{"compact", "--fan-in", "3", dbSpec})
+	s.True(strings.HasPrefix(stdout, "Compacted "), stdout)
+	s.True(strings.HasSuffix(stdout, " tables after\n"), stdout)
+
+	s.MustRun(main, []string{"compact", "--all", dbSpec})
+	stdout, _ = s.MustRun(main, []string{"compact", "--all", dbSpec})
+	s.Equal("Nothing to compact: 1 tables\n", stdout)
+
+	sp, err = spec.ForDataset(spec.CreateValueSpecString("nbs", s.DBDir, "compact"))
+	s.NoError(err)
+	defer sp.Close()
+	s.Equal(head, sp.GetDataset().HeadRef().TargetHash())
+	s.True(types.String("c").Equals(sp.GetDataset().HeadValue()))
+}
+
+func (s *nomsCompactTestSuite) TestCompactUnsupported() {
+	_, stderr, _ := s.Run(main, []string{"compact", "mem"})
+	s.Contains(stderr, "compact is not supported")
+}
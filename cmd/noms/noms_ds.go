@@ -5,23 +5,32 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/attic-labs/noms/cmd/util"
 	"github.com/attic-labs/noms/go/config"
 	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/nomdl"
+	"github.com/attic-labs/noms/go/spec"
 	"github.com/attic-labs/noms/go/types"
 	"github.com/attic-labs/noms/go/util/verbose"
 	flag "github.com/juju/gnuflag"
 )
 
 var toDelete string
+var toRestore string
+var schemaOf string
+var clearSchemaOf string
 
 var nomsDs = &util.Command{
 	Run:       runDs,
-	UsageLine: "ds [<database> | -d <dataset>]",
+	UsageLine: "ds [<database> | -d <dataset> | --restore <dataset>@<n> | --schema <dataset> [<type>] | --clear-schema <dataset>]",
 	Short:     "Noms dataset management",
-	Long:      "See Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database and dataset arguments.",
+	Long:      "With --schema, shows the schema of a dataset, or, if a type is given in Noms type syntax (e.g. 'Map<String, struct Row {name: String}>'), sets it: from then on, only values of that type can be committed to the dataset. With --clear-schema, any value can be committed again.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database and dataset arguments.",
 	Flags:     setupDsFlags,
 	Nargs:     0,
 }
@@ -29,13 +38,27 @@ var nomsDs = &util.Command{
 func setupDsFlags() *flag.FlagSet {
 	dsFlagSet := flag.NewFlagSet("ds", flag.ExitOnError)
 	dsFlagSet.StringVar(&toDelete, "d", "", "dataset to delete")
+	dsFlagSet.StringVar(&toRestore, "restore", "", "dataset to restore from entry <n> of 'noms reflog', given as <dataset>@<n>")
+	dsFlagSet.StringVar(&schemaOf, "schema", "", "dataset to show or set the schema of")
+	dsFlagSet.StringVar(&clearSchemaOf, "clear-schema", "", "dataset to clear the schema of")
 	verbose.RegisterVerboseFlags(dsFlagSet)
 	return dsFlagSet
 }
 
 func runDs(args []string) int {
 	cfg := config.NewResolver()
-	if toDelete != "" {
+	if toRestore != "" {
+		return restoreDataset(cfg, toRestore)
+	} else if schemaOf != "" {
+		return datasetSchema(cfg, schemaOf, args)
+	} else if clearSchemaOf != "" {
+		db, set, err := cfg.GetDataset(clearSchemaOf)
+		d.CheckError(err)
+		defer db.Close()
+
+		d.CheckErrorNoUsage(db.SetSchema(set.ID(), nil))
+		fmt.Printf("Cleared schema of %s\n", clearSchemaOf)
+	} else if toDelete != "" {
 		db, set, err := cfg.GetDataset(toDelete)
 		d.CheckError(err)
 		defer db.Close()
@@ -64,3 +87,83 @@ func runDs(args []string) int {
 	}
 	return 0
 }
+
+// datasetSchema prints the schema of the dataset |str|, or, if |args| holds a
+// type in Noms type syntax, makes that its schema.
+func datasetSchema(cfg *config.Resolver, str string, args []string) int {
+	if len(args) > 1 {
+		d.CheckError(errors.New("Expected at most one type"))
+	}
+	db, set, err := cfg.GetDataset(str)
+	d.CheckError(err)
+	defer db.Close()
+
+	if len(args) == 0 {
+		if schema := db.Schema(set.ID()); schema != nil {
+			fmt.Println(schema.Describe())
+		} else {
+			fmt.Printf("%s has no schema\n", str)
+		}
+		return 0
+	}
+
+	schema, err := nomdl.ParseType(args[0])
+	d.CheckErrorNoUsage(err)
+	d.CheckErrorNoUsage(db.SetSchema(set.ID(), schema))
+	fmt.Printf("Set schema of %s to %s\n", str, schema.Describe())
+	return 0
+}
+
+// restoreDataset sets the head of a dataset to the one it had in the root
+// recorded by entry <n> of the database's root log. |str| is of the form
+// <dataset>@<n>.
+func restoreDataset(cfg *config.Resolver, str string) int {
+	at := strings.LastIndex(str, "@")
+	if at == -1 {
+		d.CheckErrorNoUsage(fmt.Errorf("Expected <dataset>@<n>, but got %s", str))
+	}
+	n, err := strconv.Atoi(str[at+1:])
+	if err != nil || n < 0 {
+		d.CheckErrorNoUsage(fmt.Errorf("Invalid reflog entry: %s", str[at+1:]))
+	}
+
+	path := cfg.ResolvePathSpec(str[:at])
+	sep := strings.LastIndex(path, spec.Separator)
+	if sep == -1 {
+		d.CheckErrorNoUsage(fmt.Errorf("Expected <dataset>@<n>, but got %s", str))
+	}
+	dbSpec, dsID := path[:sep], path[sep+len(spec.Separator):]
+
+	rl, err := getRootLogger(cfg, dbSpec)
+	d.CheckErrorNoUsage(err)
+	log := rl.RootLog()
+	if n >= len(log) {
+		rl.Close()
+		d.CheckErrorNoUsage(fmt.Errorf("Reflog of %s has only %d entries", dbSpec, len(log)))
+	}
+	entry := log[n]
+
+	db := datas.NewDatabase(rl)
+	defer db.Close()
+
+	root, ok := db.ReadValue(entry.To).(types.Map)
+	if !ok {
+		d.CheckErrorNoUsage(fmt.Errorf("Root #%s of reflog entry @%d is missing or invalid", entry.To, n))
+	}
+	head, ok := root.MaybeGet(types.String(dsID))
+	if !ok {
+		d.CheckErrorNoUsage(fmt.Errorf("Dataset %s not found in reflog entry @%d", dsID, n))
+	}
+
+	ds := db.GetDataset(dsID)
+	oldHead, hadHead := ds.MaybeHeadRef()
+	_, err = db.SetHead(ds, head.(types.Ref))
+	d.CheckErrorNoUsage(err)
+
+	if hadHead {
+		fmt.Printf("Restored %s to #%s (was #%s)\n", dsID, head.(types.Ref).TargetHash(), oldHead.TargetHash())
+	} else {
+		fmt.Printf("Restored %s to #%s\n", dsID, head.(types.Ref).TargetHash())
+	}
+	return 0
+}
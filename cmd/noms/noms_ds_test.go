@@ -83,3 +83,34 @@ func (s *nomsDsTestSuite) TestNomsDs() {
 	rtnVal, _ = s.MustRun(main, []string{"ds", dbSpec})
 	s.Equal("", rtnVal)
 }
+
+func (s *nomsDsTestSuite) TestNomsDsSchema() {
+	dir := s.DBDir
+	datasetName := spec.CreateValueSpecString("nbs", dir, "ds")
+
+	rtnVal, _ := s.MustRun(main, []string{"ds", "--schema", datasetName})
+	s.Equal(datasetName+" has no schema\n", rtnVal)
+
+	rtnVal, _ = s.MustRun(main, []string{"ds", "--schema", datasetName, "List<Number | String>"})
+	s.Equal("Set schema of "+datasetName+" to List<Number | String>\n", rtnVal)
+	rtnVal, _ = s.MustRun(main, []string{"ds", "--schema", datasetName})
+	s.Equal("List<Number | String>\n", rtnVal)
+
+	sp, err := spec.ForDataset(datasetName)
+	s.NoError(err)
+	db := sp.GetDatabase()
+	_, err = db.CommitValue(sp.GetDataset(), types.NewList(types.Number(1), types.String("a")))
+	s.NoError(err)
+	_, err = db.CommitValue(sp.GetDataset(), types.NewList(types.Bool(true)))
+	s.IsType(datas.SchemaError{}, err)
+	sp.Close()
+
+	// The head no longer matches a narrower schema.
+	_, _, recovered := s.Run(main, []string{"ds", "--schema", datasetName, "List<Number>"})
+	s.NotNil(recovered)
+
+	rtnVal, _ = s.MustRun(main, []string{"ds", "--clear-schema", datasetName})
+	s.Equal("Cleared schema of "+datasetName+"\n", rtnVal)
+	rtnVal, _ = s.MustRun(main, []string{"ds", "--schema", datasetName})
+	s.Equal(datasetName+" has no schema\n", rtnVal)
+}
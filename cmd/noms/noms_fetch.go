@@ -0,0 +1,47 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsFetch = &util.Command{
+	Run:       runFetch,
+	UsageLine: "fetch [options] <database> <remote> [<dataset>...]",
+	Short:     "Copies datasets from a remote into tracking datasets",
+	Long:      "Copies the given datasets, or all of them, from the remote called <remote> of <database> into <database>, as the tracking datasets <remote>/<dataset>. Tracking datasets are always set to the remote's heads, even if that isn't a fast-forward. See 'noms remote' for how to configure remotes.",
+	Flags:     setupFetchFlags,
+	Nargs:     2,
+}
+
+func setupFetchFlags() *flag.FlagSet {
+	fetchFlagSet := flag.NewFlagSet("fetch", flag.ExitOnError)
+	fetchFlagSet.IntVar(&p, "p", 512, "parallelism")
+	verbose.RegisterVerboseFlags(fetchFlagSet)
+	return fetchFlagSet
+}
+
+func runFetch(args []string) int {
+	cfg := config.NewResolver()
+	localDB, remoteDB := getRemoteDatabases(cfg, args[0], args[1])
+	defer localDB.Close()
+	defer remoteDB.Close()
+
+	dsNames := args[2:]
+	if len(dsNames) == 0 {
+		remoteDB.Datasets().IterAll(func(k, v types.Value) {
+			dsNames = append(dsNames, string(k.(types.String)))
+		})
+	}
+	for _, dsName := range dsNames {
+		fetchDataset(localDB, remoteDB, args[1], dsName)
+	}
+	return 0
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsFsck = &util.Command{
+	Run:       runFsck,
+	UsageLine: "fsck <db-spec>",
+	Short:     "Verify the integrity of a database",
+	Long:      "Walks every chunk reachable from the root of the database, checking that it is present, that its data matches its hash and that the Refs pointing at it have the right height, and that every dataset head and parent is a commit. For nbs and aws databases, the checksum of every record in every table is verified first; if any tables are damaged, the walk reads chunks one at a time, so that those that can't be read are reported as problems along with the rest. A JSON report of any problems is written to stdout, and the exit status is non-zero if any were found.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Flags:     setupFsckFlags,
+	Nargs:     1,
+}
+
+func setupFsckFlags() *flag.FlagSet {
+	return flag.NewFlagSet("fsck", flag.ExitOnError)
+}
+
+type fsckProblem struct {
+	Kind     string `json:"kind"`
+	Hash     string `json:"hash"`
+	Referrer string `json:"referrer,omitempty"`
+	Detail   string `json:"detail"`
+}
+
+type fsckTableDamage struct {
+	Table   string `json:"table"`
+	Chunk   string `json:"chunk,omitempty"`
+	Problem string `json:"problem"`
+}
+
+type fsckReport struct {
+	Root          string            `json:"root"`
+	Chunks        uint64            `json:"chunks"`
+	Problems      []fsckProblem     `json:"problems"`
+	DamagedTables []fsckTableDamage `json:"damagedTables"`
+}
+
+func runFsck(args []string) int {
+	cfg := config.NewResolver()
+	cs, err := cfg.GetChunkStore(args[0])
+	d.CheckErrorNoUsage(err)
+
+	report := fsckReport{Problems: []fsckProblem{}, DamagedTables: []fsckTableDamage{}}
+	var db datas.Database
+	if cs == nil {
+		// Remote databases don't expose their ChunkStore.
+		db, err = cfg.GetDatabase(args[0])
+		d.CheckErrorNoUsage(err)
+	} else {
+		db = datas.NewDatabase(cs)
+	}
+	defer db.Close()
+
+	r := db.Fsck()
+	report.Root, report.Chunks = r.Root.String(), r.Chunks
+	for _, p := range r.Problems {
+		fp := fsckProblem{Kind: p.Kind, Hash: p.Hash.String(), Detail: p.Detail}
+		if !p.Referrer.IsEmpty() {
+			fp.Referrer = p.Referrer.String()
+		}
+		report.Problems = append(report.Problems, fp)
+	}
+	for _, td := range r.DamagedTables {
+		report.DamagedTables = append(report.DamagedTables, fsckTableDamage{td.Table, td.Chunk, td.Problem})
+	}
+	return printFsckReport(report)
+}
+
+func printFsckReport(report fsckReport) int {
+	out, err := json.MarshalIndent(report, "", "  ")
+	d.PanicIfError(err)
+	fmt.Println(string(out))
+
+	if len(report.Problems) > 0 || len(report.DamagedTables) > 0 {
+		return 1
+	}
+	return 0
+}
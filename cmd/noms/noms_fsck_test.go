@@ -0,0 +1,86 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsFsck(t *testing.T) {
+	suite.Run(t, &nomsFsckTestSuite{})
+}
+
+type nomsFsckTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsFsckTestSuite) commit(dir string) {
+	sp, err := spec.ForDataset(spec.CreateValueSpecString("nbs", dir, "fsck"))
+	s.NoError(err)
+	defer sp.Close()
+	_, err = sp.GetDatabase().CommitValue(sp.GetDataset(), types.String("hello"))
+	s.NoError(err)
+}
+
+func (s *nomsFsckTestSuite) TestFsck() {
+	dir := filepath.Join(s.TempDir, "ok")
+	s.NoError(os.Mkdir(dir, 0777))
+	s.commit(dir)
+
+	stdout, _ := s.MustRun(main, []string{"fsck", spec.CreateDatabaseSpecString("nbs", dir)})
+	var report fsckReport
+	s.NoError(json.Unmarshal([]byte(stdout), &report))
+	s.Equal(uint64(2), report.Chunks)
+	s.Empty(report.Problems)
+	s.Empty(report.DamagedTables)
+}
+
+func (s *nomsFsckTestSuite) TestFsckDamagedTable() {
+	dir := filepath.Join(s.TempDir, "damaged")
+	s.NoError(os.Mkdir(dir, 0777))
+	s.commit(dir)
+	files, err := ioutil.ReadDir(dir)
+	s.NoError(err)
+	s.commit(dir)
+
+	// Flip every bit of every chunk record in the tables of the first commit, leaving their indices and footers intact.
+	for _, fi := range files {
+		if fi.Name() == "manifest" || fi.Name() == "LOCK" {
+			continue
+		}
+		p := filepath.Join(dir, fi.Name())
+		data, err := ioutil.ReadFile(p)
+		s.NoError(err)
+		count := int(binary.BigEndian.Uint32(data[len(data)-20:]))
+		for i := 0; i < len(data)-20-28*count; i++ {
+			data[i] ^= 0xff
+		}
+		s.NoError(ioutil.WriteFile(p, data, 0666))
+	}
+
+	stdout, _, recovered := s.Run(main, []string{"fsck", spec.CreateDatabaseSpecString("nbs", dir)})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	var report fsckReport
+	s.NoError(json.Unmarshal([]byte(stdout), &report))
+	s.NotEmpty(report.DamagedTables)
+
+	// The new root and commit are still checked, and the first commit, which is their parent, is reported as unreadable.
+	s.Equal(uint64(2), report.Chunks)
+	if s.Len(report.Problems, 1) {
+		s.Equal(datas.FsckUnreadable, report.Problems[0].Kind)
+		s.NotEmpty(report.Problems[0].Referrer)
+	}
+}
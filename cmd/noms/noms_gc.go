@@ -0,0 +1,61 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/nbs"
+	humanize "github.com/dustin/go-humanize"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsGC = &util.Command{
+	Run:       runGC,
+	UsageLine: "gc <db-spec>",
+	Short:     "Remove chunks that are no longer reachable from the root of a database",
+	Long:      "Rewrites the database so that it contains only the chunks reachable from its current root, or from the roots recorded in 'noms reflog' in the last --keep-reflog, so that datasets can still be restored from them with 'noms ds --restore'. Older reflog entries are removed, and the chunks only they reach, e.g. those of datasets deleted or moved before then, are freed. With --keep-reflog=0, only the current root is kept. Only nbs, aws and blob databases are supported. On aws, the old tables are left in S3 and should be expired using a bucket lifecycle policy. On blob, they're left in the object store.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Flags:     setupGCFlags,
+	Nargs:     1,
+}
+
+var gcKeepReflog time.Duration
+
+func setupGCFlags() *flag.FlagSet {
+	gcFlagSet := flag.NewFlagSet("gc", flag.ExitOnError)
+	gcFlagSet.DurationVar(&gcKeepReflog, "keep-reflog", nbs.DefaultKeepRootLog, "how long to keep the roots recorded in the reflog, e.g. 24h")
+	return gcFlagSet
+}
+
+func runGC(args []string) int {
+	cfg := config.NewResolver()
+	cs, err := cfg.GetChunkStore(args[0])
+	d.CheckErrorNoUsage(err)
+
+	store, ok := cs.(*nbs.NomsBlockStore)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "gc is not supported for %s\n", args[0])
+		return 1
+	}
+	defer store.Close()
+
+	stats, err := store.GCOpts(nbs.GCOptions{KeepRootLog: gcKeepReflog})
+	if err == nbs.ErrGCConflict {
+		fmt.Fprintln(os.Stderr, "Database was modified during gc, try again")
+		return 1
+	}
+	d.CheckErrorNoUsage(err)
+
+	fmt.Printf("Removed %s chunks: %s chunks in %d tables before, %s chunks in %d tables after\n",
+		humanize.Comma(int64(stats.ChunksBefore-stats.ChunksAfter)),
+		humanize.Comma(int64(stats.ChunksBefore)), stats.TablesBefore,
+		humanize.Comma(int64(stats.ChunksAfter)), stats.TablesAfter)
+	return 0
+}
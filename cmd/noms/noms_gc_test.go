@@ -0,0 +1,81 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsGC(t *testing.T) {
+	suite.Run(t, &nomsGCTestSuite{})
+}
+
+type nomsGCTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsGCTestSuite) TestGC() {
+	sp, err := spec.ForDataset(spec.CreateValueSpecString("nbs", s.DBDir, "gc"))
+	s.NoError(err)
+
+	db := sp.GetDatabase()
+	garbage := db.WriteValue(types.String("unreferenced"))
+	ds, err := db.CommitValue(sp.GetDataset(), types.String("hello"))
+	s.NoError(err)
+	ds, err = db.CommitValue(ds, types.String("goodbye"))
+	s.NoError(err)
+	head := ds.HeadRef().TargetHash()
+	sp.Close()
+
+	stdout, _ := s.MustRun(main, []string{"gc", spec.CreateDatabaseSpecString("nbs", s.DBDir)})
+	s.True(strings.HasPrefix(stdout, "Removed "), stdout)
+
+	sp, err = spec.ForDataset(spec.CreateValueSpecString("nbs", s.DBDir, "gc"))
+	s.NoError(err)
+	defer sp.Close()
+	s.Equal(head, sp.GetDataset().HeadRef().TargetHash())
+	s.True(types.String("goodbye").Equals(sp.GetDataset().HeadValue()))
+	s.Nil(sp.GetDatabase().ReadValue(garbage.TargetHash()))
+}
+
+func (s *nomsGCTestSuite) TestGCFreesDeletedDataset() {
+	sp, err := spec.ForDataset(spec.CreateValueSpecString("nbs", s.DBDir, "gc-deleted"))
+	s.NoError(err)
+	db := sp.GetDatabase()
+	ds, err := db.CommitValue(sp.GetDataset(), types.String("deleted"))
+	s.NoError(err)
+	deleted := ds.HeadRef().TargetHash()
+	_, err = db.Delete(ds)
+	s.NoError(err)
+	sp.Close()
+
+	readable := func() bool {
+		sp, err := spec.ForDatabase(spec.CreateDatabaseSpecString("nbs", s.DBDir))
+		s.NoError(err)
+		defer sp.Close()
+		return sp.GetDatabase().ReadValue(deleted) != nil
+	}
+
+	// The deleted dataset can still be restored from the reflog...
+	s.MustRun(main, []string{"gc", spec.CreateDatabaseSpecString("nbs", s.DBDir)})
+	s.True(readable())
+
+	// ...until its entries are no longer kept.
+	s.MustRun(main, []string{"gc", "--keep-reflog=0", spec.CreateDatabaseSpecString("nbs", s.DBDir)})
+	s.False(readable())
+	stdout, _ := s.MustRun(main, []string{"reflog", spec.CreateDatabaseSpecString("nbs", s.DBDir)})
+	s.Empty(stdout)
+}
+
+func (s *nomsGCTestSuite) TestGCUnsupported() {
+	_, stderr, _ := s.Run(main, []string{"gc", "mem"})
+	s.Contains(stderr, "gc is not supported")
+}
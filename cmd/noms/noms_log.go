@@ -6,6 +6,7 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -35,15 +36,20 @@ var (
 	oneline    bool
 	showGraph  bool
 	showValue  bool
+	logSince   string
+	logUntil   string
+	logGrep    string
+	logMeta    string
+	logChanged bool
 )
 
 const parallelism = 16
 
 var nomsLog = &util.Command{
 	Run:       runLog,
-	UsageLine: "log [options] <path-spec>",
+	UsageLine: "log [options] [<path-spec>..]<path-spec>",
 	Short:     "Displays the history of a path",
-	Long:      "Displays the history of a path. See Spelling Values at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the <path-spec> parameter.",
+	Long:      "Displays the history of a path. Given a range <from>..<to>, displays only the commits that are ancestors of <to> but not of <from>, newest first; <to> is in the same database as <from> unless it says otherwise, e.g. 'noms log ldb::stable..dev'. The commits can also be filtered by their meta, with --since, --until, --grep and --meta, and with --changed, limited to those that changed the value at the path, e.g. 'noms log --changed ldb::ds.value.users[\"bob\"]' to see when a record changed. See Spelling Values at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the <path-spec> parameter.",
 	Flags:     setupLogFlags,
 	Nargs:     1,
 }
@@ -56,23 +62,63 @@ func setupLogFlags() *flag.FlagSet {
 	logFlagSet.BoolVar(&oneline, "oneline", false, "show a summary of each commit on a single line")
 	logFlagSet.BoolVar(&showGraph, "graph", false, "show ascii-based commit hierarchy on left side of output")
 	logFlagSet.BoolVar(&showValue, "show-value", false, "show commit value rather than diff information")
+	logFlagSet.StringVar(&logSince, "since", "", "only show commits whose meta date is at or after this iso8601-formatted date")
+	logFlagSet.StringVar(&logUntil, "until", "", "only show commits whose meta date is at or before this iso8601-formatted date")
+	logFlagSet.StringVar(&logGrep, "grep", "", "only show commits whose meta message matches this regular expression")
+	logFlagSet.StringVar(&logMeta, "meta", "", "'<key>=<value>[,<key>=<value>...]' - only show commits whose meta has these fields, with these human-readable encoded values")
+	logFlagSet.BoolVar(&logChanged, "changed", false, "only show commits that changed the value at the path")
 	outputpager.RegisterOutputpagerFlags(logFlagSet)
 	verbose.RegisterVerboseFlags(logFlagSet)
 	return logFlagSet
 }
 
+// rangeSeparatorIndex returns the index of the ".." that separates the start
+// of a range from its end in |arg|, or -1 if |arg| isn't a range. Only the
+// part after the start's database is searched, so that relative paths to
+// databases, such as ../db, aren't mistaken for ranges.
+func rangeSeparatorIndex(arg string) int {
+	start := 0
+	if sep := strings.Index(arg, spec.Separator); sep != -1 {
+		start = sep + len(spec.Separator)
+	}
+	if i := strings.Index(arg[start:], ".."); i != -1 {
+		return start + i
+	}
+	return -1
+}
+
 func runLog(args []string) int {
 	useColor = shouldUseColor()
 	cfg := config.NewResolver()
 
-	resolved := cfg.ResolvePathSpec(args[0])
+	from, to := "", args[0]
+	if i := rangeSeparatorIndex(args[0]); i != -1 {
+		from, to = cfg.ResolvePathSpec(args[0][:i]), args[0][i+len(".."):]
+		if !strings.Contains(to, spec.Separator) {
+			if sep := strings.LastIndex(from, spec.Separator); sep != -1 {
+				to = from[:sep+len(spec.Separator)] + to
+			}
+		}
+		if showGraph {
+			d.CheckErrorNoUsage(errors.New("-graph can't be used with a range"))
+		}
+	}
+
+	filter, err := newLogFilter(logSince, logUntil, logGrep, logMeta)
+	d.CheckErrorNoUsage(err)
+	filter.changed = logChanged
+	if showGraph && !filter.isEmpty() {
+		d.CheckErrorNoUsage(errors.New("-graph can't be used with filters"))
+	}
+
+	resolved := cfg.ResolvePathSpec(to)
 	sp, err := spec.ForPath(resolved)
 	d.CheckErrorNoUsage(err)
 	defer sp.Close()
 
 	pinned, ok := sp.Pin()
 	if !ok {
-		fmt.Fprintf(os.Stderr, "Cannot resolve spec: %s\n", args[0])
+		fmt.Fprintf(os.Stderr, "Cannot resolve spec: %s\n", to)
 		return 1
 	}
 	defer pinned.Close()
@@ -89,7 +135,15 @@ func runLog(args []string) int {
 		d.CheckError(fmt.Errorf("%s does not reference a Commit object", args[0]))
 	}
 
-	iter := NewCommitIterator(database, origCommit)
+	var iter LogIterator = NewCommitIterator(database, origCommit)
+	if from != "" {
+		fromCommit := resolveLogCommit(from, database)
+		iter = NewRangeIterator(database, fromCommit, origCommit)
+	}
+	if !filter.isEmpty() {
+		filter.path, filter.db = path, database
+		iter = NewFilterIterator(iter, filter)
+	}
 	displayed := 0
 	if maxCommits <= 0 {
 		maxCommits = math.MaxInt32
@@ -132,6 +186,24 @@ func runLog(args []string) int {
 	return 0
 }
 
+// resolveLogCommit returns the commit that |str|, the start of a range given to
+// 'noms log', refers to. Since the range is walked in |db|, it must be there.
+func resolveLogCommit(str string, db datas.Database) types.Struct {
+	sp, err := spec.ForPath(str)
+	d.CheckErrorNoUsage(err)
+	defer sp.Close()
+	pinned, ok := sp.Pin()
+	if !ok {
+		d.CheckErrorNoUsage(fmt.Errorf("Cannot resolve spec: %s", str))
+	}
+	defer pinned.Close()
+	commit, ok := db.ReadValue(pinned.Path.Hash).(types.Struct)
+	if !ok || !datas.IsCommitType(commit.Type()) {
+		d.CheckErrorNoUsage(fmt.Errorf("%s does not reference a Commit object in the same database", str))
+	}
+	return commit
+}
+
 // Prints the information for one commit in the log, including ascii graph on left side of commits if
 // -graph arg is true.
 func printCommit(node LogNode, path types.Path, w io.Writer, db datas.Database) (err error) {
@@ -5,6 +5,10 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/attic-labs/noms/go/datas"
@@ -127,6 +131,136 @@ func (s *nomsLogTestSuite) TestNArg() {
 	s.Contains(res, h1.String())
 }
 
+func (s *nomsLogTestSuite) TestNomsLogRange() {
+	sp, err := spec.ForDatabase(spec.CreateDatabaseSpecString("nbs", s.DBDir))
+	s.NoError(err)
+	defer sp.Close()
+
+	db := sp.GetDatabase()
+	stable, err := addCommit(db.GetDataset("stable"), "1")
+	s.NoError(err)
+	h1 := stable.Head().Hash()
+	dev, err := addBranchedDataset(db.GetDataset("dev"), stable, "2")
+	s.NoError(err)
+	h2 := dev.Head().Hash()
+	dev, err = addCommit(dev, "3")
+	s.NoError(err)
+	h3 := dev.Head().Hash()
+	_, err = addCommit(stable, "4")
+	s.NoError(err)
+
+	res, _ := s.MustRun(main, []string{"log", "--oneline", spec.CreateValueSpecString("nbs", s.DBDir, "stable") + "..dev"})
+	s.Equal(h3.String()+" (Parent: "+h2.String()+")\n"+h2.String()+" (Parent: "+h1.String()+")\n", res)
+
+	res, _ = s.MustRun(main, []string{"log", "--oneline", spec.CreateValueSpecString("nbs", s.DBDir, "dev") + ".." + spec.CreateValueSpecString("nbs", s.DBDir, "dev")})
+	s.Equal("", res)
+
+	_, _, err2 := s.Run(main, []string{"log", "--graph", spec.CreateValueSpecString("nbs", s.DBDir, "stable") + "..dev"})
+	s.NotNil(err2)
+}
+
+func (s *nomsLogTestSuite) TestNomsLogRelativePath() {
+	sp, err := spec.ForDatabase(spec.CreateDatabaseSpecString("nbs", s.DBDir))
+	s.NoError(err)
+	defer sp.Close()
+
+	db := sp.GetDatabase()
+	stable, err := addCommit(db.GetDataset("relStable"), "1")
+	s.NoError(err)
+	h1 := stable.Head().Hash()
+	dev, err := addBranchedDataset(db.GetDataset("relDev"), stable, "2")
+	s.NoError(err)
+	h2 := dev.Head().Hash()
+
+	cwd, err := os.Getwd()
+	s.NoError(err)
+	defer os.Chdir(cwd)
+	sub := filepath.Join(s.TempDir, "sub")
+	s.NoError(os.Mkdir(sub, 0777))
+	s.NoError(os.Chdir(sub))
+
+	res, _ := s.MustRun(main, []string{"log", "--oneline", "nbs:../db::relDev"})
+	s.Equal(h2.String()+" (Parent: "+h1.String()+")\n"+h1.String()+" (Parent: None)\n", res)
+
+	res, _ = s.MustRun(main, []string{"log", "--oneline", "nbs:../db::relStable..relDev"})
+	s.Equal(h2.String()+" (Parent: "+h1.String()+")\n", res)
+
+	res, _ = s.MustRun(main, []string{"log", "--oneline", "nbs:../db::relStable..nbs:../db::relDev"})
+	s.Equal(h2.String()+" (Parent: "+h1.String()+")\n", res)
+}
+
+func (s *nomsLogTestSuite) TestNomsLogFilters() {
+	sp, err := spec.ForDatabase(spec.CreateDatabaseSpecString("nbs", s.DBDir))
+	s.NoError(err)
+	defer sp.Close()
+
+	db := sp.GetDatabase()
+	ds := db.GetDataset("ds")
+	hashes := []string{}
+	commit := func(v types.Value, date, message, author string) {
+		meta := types.NewStruct("Meta", types.StructData{
+			"date":    types.String(date),
+			"message": types.String(message),
+			"author":  types.String(author),
+		})
+		ds, err = db.Commit(ds, v, datas.CommitOptions{Meta: meta})
+		s.NoError(err)
+		hashes = append(hashes, ds.Head().Hash().String())
+	}
+	record := func(bob, alice int) types.Value {
+		return types.NewMap(types.String("bob"), types.Number(bob), types.String("alice"), types.Number(alice))
+	}
+	commit(record(1, 1), "2016-11-01T10:00:00+0000", "Add bob and alice", "sam")
+	commit(record(2, 1), "2016-11-15T10:00:00+0000", "Fix bob", "kim")
+	commit(record(2, 2), "2016-12-01T10:00:00+0000", "Fix alice", "sam")
+	commit(record(3, 2), "2016-12-15T10:00:00+0000", "Bump bob", "kim")
+
+	log := func(args ...string) string {
+		res, _ := s.MustRun(main, append(append([]string{"log", "--oneline"}, args...), spec.CreateValueSpecString("nbs", s.DBDir, "ds")))
+		found := []string{}
+		for i := len(hashes) - 1; i >= 0; i-- {
+			if strings.Contains(res, hashes[i]+" ") {
+				found = append(found, fmt.Sprintf("%d", i))
+			}
+		}
+		return strings.Join(found, " ")
+	}
+	s.Equal("3 2 1 0", log())
+	s.Equal("2 1", log("--since", "2016-11-10", "--until", "2016-12-10"))
+	s.Equal("3 2", log("--since", "2016-12-01T10:00:00+0000"))
+	s.Equal("2 1", log("--grep", "^Fix"))
+	s.Equal("3 1", log("--meta", "author=kim"))
+	s.Equal("1", log("--meta", "author=kim", "--grep", "Fix"))
+	s.Equal("", log("--meta", "author=kim,reviewer=sam"))
+	s.Equal("3", log("-n", "1", "--meta", "author=kim"))
+
+	res, _ := s.MustRun(main, []string{"log", "--oneline", "--changed", spec.CreateValueSpecString("nbs", s.DBDir, "ds.value[\"bob\"]")})
+	s.Equal(3, strings.Count(res, "\n"))
+	s.Contains(res, hashes[3]+" ")
+	s.NotContains(res, hashes[2]+" ")
+
+	_, _, err2 := s.Run(main, []string{"log", "--since", "yesterday", spec.CreateValueSpecString("nbs", s.DBDir, "ds")})
+	s.NotNil(err2)
+	_, _, err2 = s.Run(main, []string{"log", "--graph", "--grep", "Fix", spec.CreateValueSpecString("nbs", s.DBDir, "ds")})
+	s.NotNil(err2)
+}
+
+func TestValueChanged(t *testing.T) {
+	assert := assert.New(t)
+	path := types.MustParsePath(".value.a")
+	a := types.NewStruct("", types.StructData{"value": types.NewStruct("", types.StructData{"a": types.Number(1)})})
+	b := types.NewStruct("", types.StructData{"value": types.NewStruct("", types.StructData{"a": types.Number(2)})})
+	c := types.NewStruct("", types.StructData{"value": types.NewStruct("", types.StructData{"a": types.Number(1), "b": types.Number(1)})})
+	empty := types.NewStruct("", types.StructData{"value": types.NewStruct("", types.StructData{})})
+
+	assert.True(valueChanged(path, a, b))
+	assert.False(valueChanged(path, a, c))
+	assert.False(valueChanged(path, a, a))
+	assert.True(valueChanged(path, a, empty))
+	assert.True(valueChanged(path, empty, a))
+	assert.False(valueChanged(path, empty, empty))
+}
+
 func (s *nomsLogTestSuite) TestEmptyCommit() {
 	sp, err := spec.ForDatabase(spec.CreateDatabaseSpecString("nbs", s.DBDir))
 	s.NoError(err)
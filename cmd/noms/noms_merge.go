@@ -76,18 +76,19 @@ func runMerge(args []string) int {
 }
 
 func resolveDatasets(db datas.Database, leftName, rightName, outName string) (leftDS, rightDS, outDS datas.Dataset) {
-	makeDS := func(dsName string) datas.Dataset {
-		if !datasetRe.MatchString(dsName) {
-			d.CheckErrorNoUsage(fmt.Errorf("Invalid dataset %s, must match %s", dsName, datas.DatasetRe.String()))
-		}
-		return db.GetDataset(dsName)
-	}
-	leftDS = makeDS(leftName)
-	rightDS = makeDS(rightName)
-	outDS = makeDS(outName)
+	leftDS = resolveDataset(db, leftName)
+	rightDS = resolveDataset(db, rightName)
+	outDS = resolveDataset(db, outName)
 	return
 }
 
+func resolveDataset(db datas.Database, dsName string) datas.Dataset {
+	if !datasetRe.MatchString(dsName) {
+		d.CheckErrorNoUsage(fmt.Errorf("Invalid dataset %s, must match %s", dsName, datas.DatasetRe.String()))
+	}
+	return db.GetDataset(dsName)
+}
+
 func getMergeCandidates(db datas.Database, leftDS, rightDS datas.Dataset) (left, right, ancestor types.Value) {
 	leftRef, ok := leftDS.MaybeHeadRef()
 	checkIfTrue(!ok, "Dataset %s has no data", leftDS.ID())
@@ -129,7 +130,10 @@ func newMergeProgressChan() chan struct{} {
 }
 
 func decidePolicy(policy string) merge.Policy {
-	var resolve merge.ResolveFunc
+	return merge.NewThreeWay(decideResolveFunc(policy))
+}
+
+func decideResolveFunc(policy string) (resolve merge.ResolveFunc) {
 	switch policy {
 	case "n", "N":
 		resolve = merge.None
@@ -144,7 +148,7 @@ func decidePolicy(policy string) merge.Policy {
 	default:
 		d.CheckErrorNoUsage(fmt.Errorf("Unsupported merge policy: %s. Choices are n, l, r and a.", policy))
 	}
-	return merge.NewThreeWay(resolve)
+	return
 }
 
 func cliResolve(in io.Reader, out io.Writer, aType, bType types.DiffChangeType, a, b types.Value, path types.Path) (change types.DiffChangeType, merged types.Value, ok bool) {
@@ -0,0 +1,62 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	isAncestor bool
+
+	nomsMergeBase = &util.Command{
+		Run:       runMergeBase,
+		UsageLine: "merge-base [options] <database> <commit> <commit>",
+		Short:     "Finds the best common ancestors of two commits",
+		Long:      "Prints the hashes of the best common ancestors of two commits, one per line: those that are ancestors of both, but not of another such commit. There's usually just one, but there can be more if, for example, each of two datasets has merged in the other. With --is-ancestor, prints nothing, and exits with status 0 if the first commit is an ancestor of the second, or the same commit, and 1 otherwise. Each <commit> is an absolute path within <database>, e.g. a dataset name or #<hash>.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database and commit arguments.",
+		Flags:     setupMergeBaseFlags,
+		Nargs:     3,
+	}
+)
+
+func setupMergeBaseFlags() *flag.FlagSet {
+	mergeBaseFlagSet := flag.NewFlagSet("merge-base", flag.ExitOnError)
+	mergeBaseFlagSet.BoolVar(&isAncestor, "is-ancestor", false, "check whether the first commit is an ancestor of the second")
+	verbose.RegisterVerboseFlags(mergeBaseFlagSet)
+	return mergeBaseFlagSet
+}
+
+func runMergeBase(args []string) int {
+	cfg := config.NewResolver()
+	db, err := cfg.GetDatabase(args[0])
+	d.CheckError(err)
+	defer db.Close()
+
+	a, b := types.NewRef(resolveCommit(db, args[1])), types.NewRef(resolveCommit(db, args[2]))
+	if isAncestor {
+		if datas.IsAncestor(a, b, db) {
+			return 0
+		}
+		return 1
+	}
+
+	bases := datas.MergeBases(a, b, db)
+	if len(bases) == 0 {
+		fmt.Printf("%s and %s have no common ancestor\n", args[1], args[2])
+		return 1
+	}
+	for _, r := range bases {
+		fmt.Println(r.TargetHash().String())
+	}
+	return 0
+}
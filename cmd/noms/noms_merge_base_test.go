@@ -0,0 +1,54 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+type nomsMergeBaseTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func TestNomsMergeBase(t *testing.T) {
+	suite.Run(t, &nomsMergeBaseTestSuite{})
+}
+
+func (s *nomsMergeBaseTestSuite) TestMergeBase() {
+	sp, err := spec.ForDatabase(s.DBDir)
+	s.NoError(err)
+	defer sp.Close()
+
+	db := sp.GetDatabase()
+	mainDs, err := addCommit(db.GetDataset("main"), "1")
+	s.NoError(err)
+	base := mainDs.HeadRef()
+	_, err = addBranchedDataset(db.GetDataset("topic"), mainDs, "2")
+	s.NoError(err)
+	mainDs, err = addCommit(mainDs, "3")
+	s.NoError(err)
+	_, err = db.CommitValue(db.GetDataset("other"), types.String("4"))
+	s.NoError(err)
+	db.Close()
+
+	stdout, _ := s.MustRun(main, []string{"merge-base", s.DBDir, "main", "topic"})
+	s.Equal(base.TargetHash().String()+"\n", stdout)
+	stdout, _ = s.MustRun(main, []string{"merge-base", s.DBDir, "#" + base.TargetHash().String(), "topic"})
+	s.Equal(base.TargetHash().String()+"\n", stdout)
+
+	stdout, _, err2 := s.Run(main, []string{"merge-base", s.DBDir, "main", "other"})
+	s.Equal(clienttest.ExitError{Code: 1}, err2)
+	s.Equal("main and other have no common ancestor\n", stdout)
+
+	_, _, err2 = s.Run(main, []string{"merge-base", "--is-ancestor", s.DBDir, "#" + base.TargetHash().String(), "topic"})
+	s.Nil(err2)
+	_, _, err2 = s.Run(main, []string{"merge-base", "--is-ancestor", s.DBDir, "topic", "main"})
+	s.Equal(clienttest.ExitError{Code: 1}, err2)
+}
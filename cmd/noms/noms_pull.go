@@ -0,0 +1,93 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/status"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsPull = &util.Command{
+	Run:       runPull,
+	UsageLine: "pull [options] [<database>::]<dataset> <remote>",
+	Short:     "Fetches a dataset from a remote and merges it into the local dataset",
+	Long:      "Fetches <dataset> from the remote called <remote> of <database> into the tracking dataset <remote>/<dataset>, and then fast-forwards <dataset> to it. If <dataset> has diverged from the remote, the two are merged as by 'noms merge', and conflicts are resolved according to --policy. See 'noms remote' for how to configure remotes.",
+	Flags:     setupPullFlags,
+	Nargs:     2,
+}
+
+func setupPullFlags() *flag.FlagSet {
+	pullFlagSet := flag.NewFlagSet("pull", flag.ExitOnError)
+	pullFlagSet.IntVar(&p, "p", 512, "parallelism")
+	pullFlagSet.StringVar(&resolver, "policy", "n", "conflict resolution policy for merging. Defaults to 'n', which means no resolution strategy will be applied. Supported values are 'l' (left, the local dataset), 'r' (right, the remote dataset) and 'p' (prompt).")
+	verbose.RegisterVerboseFlags(pullFlagSet)
+	return pullFlagSet
+}
+
+func runPull(args []string) int {
+	cfg := config.NewResolver()
+	dbStr, dsName := splitDatasetArg(args[0])
+	localDB, remoteDB := getRemoteDatabases(cfg, dbStr, args[1])
+	defer localDB.Close()
+	defer remoteDB.Close()
+
+	localDS := resolveDataset(localDB, dsName)
+	tracking := fetchDataset(localDB, remoteDB, args[1], dsName)
+	trackingRef := tracking.HeadRef()
+	localRef, ok := localDS.MaybeHeadRef()
+	if !ok {
+		_, err := localDB.SetHead(localDS, trackingRef)
+		checkPullCommit(err, dsName)
+		fmt.Printf("Created %s at #%s\n", dsName, trackingRef.TargetHash())
+		return 0
+	}
+
+	localDS, err := localDB.FastForward(localDS, trackingRef)
+	if err == nil {
+		if localRef.Equals(trackingRef) {
+			fmt.Printf("%s is up to date\n", dsName)
+		} else {
+			fmt.Printf("Fast-forwarded %s to #%s (was #%s)\n", dsName, trackingRef.TargetHash(), localRef.TargetHash())
+		}
+		return 0
+	} else if err != datas.ErrMergeNeeded {
+		d.CheckErrorNoUsage(err)
+	}
+	if ancestorRef, ok := datas.FindCommonAncestor(localRef, trackingRef, localDB); ok && ancestorRef.Equals(trackingRef) {
+		fmt.Printf("%s is up to date\n", dsName)
+		return 0
+	}
+
+	left, right, ancestor := getMergeCandidates(localDB, localDS, tracking)
+	pc := newMergeProgressChan()
+	merged, err := decidePolicy(resolver)(left, right, ancestor, localDB, pc)
+	d.CheckErrorNoUsage(err)
+	close(pc)
+
+	localDS, err = localDB.Commit(localDS, merged, datas.CommitOptions{Parents: types.NewSet(localRef, trackingRef)})
+	checkPullCommit(err, dsName)
+	if !verbose.Quiet() {
+		status.Done()
+	}
+	fmt.Printf("Merged %s into %s at #%s\n", tracking.ID(), dsName, localDS.HeadRef().TargetHash())
+	return 0
+}
+
+// checkPullCommit exits with a message if |err|, from moving the head of
+// |dsName|, isn't nil.
+func checkPullCommit(err error, dsName string) {
+	if err == datas.ErrMergeNeeded {
+		err = fmt.Errorf("%s was changed by someone else during the pull, try again", dsName)
+	}
+	d.CheckErrorNoUsage(err)
+}
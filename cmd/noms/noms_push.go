@@ -0,0 +1,65 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsPush = &util.Command{
+	Run:       runPush,
+	UsageLine: "push [options] [<database>::]<dataset> <remote>",
+	Short:     "Copies a dataset to a remote and fast-forwards it there",
+	Long:      "Copies <dataset> to the remote called <remote> of <database>, and fast-forwards the remote's dataset of the same name to it. The push is rejected if the remote's dataset has commits that the local one doesn't, in which case they should be pulled and merged first with 'noms pull'. See 'noms remote' for how to configure remotes.",
+	Flags:     setupPushFlags,
+	Nargs:     2,
+}
+
+func setupPushFlags() *flag.FlagSet {
+	pushFlagSet := flag.NewFlagSet("push", flag.ExitOnError)
+	pushFlagSet.IntVar(&p, "p", 512, "parallelism")
+	verbose.RegisterVerboseFlags(pushFlagSet)
+	return pushFlagSet
+}
+
+func runPush(args []string) int {
+	cfg := config.NewResolver()
+	dbStr, dsName := splitDatasetArg(args[0])
+	localDB, remoteDB := getRemoteDatabases(cfg, dbStr, args[1])
+	defer localDB.Close()
+	defer remoteDB.Close()
+
+	localDS := resolveDataset(localDB, dsName)
+	localRef, ok := localDS.MaybeHeadRef()
+	checkIfTrue(!ok, "Dataset %s has no data", dsName)
+	remoteDS := remoteDB.GetDataset(dsName)
+	remoteRef, remoteExists := remoteDS.MaybeHeadRef()
+	if remoteExists && remoteRef.Equals(localRef) {
+		fmt.Printf("%s/%s is up to date\n", args[1], dsName)
+		return 0
+	}
+
+	datas.PullWithFlush(localDB, remoteDB, localRef, remoteRef, p, nil)
+	_, err := remoteDB.FastForward(remoteDS, localRef)
+	if err == datas.ErrMergeNeeded {
+		d.CheckErrorNoUsage(fmt.Errorf("Push rejected: %s/%s has commits that %s doesn't. Use 'noms pull' to merge them first.", args[1], dsName, dsName))
+	}
+	d.CheckErrorNoUsage(err)
+	setTrackingHead(localDB, args[1], dsName, localRef)
+
+	if remoteExists {
+		fmt.Printf("Pushed %s to %s/%s #%s (was #%s)\n", dsName, args[1], dsName, localRef.TargetHash(), remoteRef.TargetHash())
+	} else {
+		fmt.Printf("Pushed %s to %s/%s #%s\n", dsName, args[1], dsName, localRef.TargetHash())
+	}
+	return 0
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/diff"
+	"github.com/attic-labs/noms/go/merge"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/status"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var (
+	rebaseOnto string
+
+	nomsRebase = &util.Command{
+		Run:       runRebase,
+		UsageLine: "rebase [options] <database> <dataset> --onto <commit>",
+		Short:     "Replays the commits of a dataset on top of another commit",
+		Long:      "Finds the commits in <dataset> that aren't ancestors of <commit>, replays the change each of them made on top of <commit>, oldest first, and makes the last replayed commit the new head of <dataset>. Each change is the diff between a commit and its parent, so merge commits can't be rebased. Conflicting changes are resolved according to --policy, as in 'noms merge'. <commit> is an absolute path within <database>, e.g. a dataset name or #<hash>.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database and commit arguments.",
+		Flags:     setupRebaseFlags,
+		Nargs:     2,
+	}
+)
+
+func setupRebaseFlags() *flag.FlagSet {
+	rebaseFlagSet := flag.NewFlagSet("rebase", flag.ExitOnError)
+	rebaseFlagSet.StringVar(&rebaseOnto, "onto", "", "commit to replay the dataset's commits on top of")
+	registerReplayPolicyFlag(rebaseFlagSet)
+	verbose.RegisterVerboseFlags(rebaseFlagSet)
+	return rebaseFlagSet
+}
+
+func runRebase(args []string) int {
+	if rebaseOnto == "" {
+		d.CheckErrorNoUsage(fmt.Errorf("--onto is required"))
+	}
+	cfg := config.NewResolver()
+	db, err := cfg.GetDatabase(args[0])
+	d.CheckError(err)
+	defer db.Close()
+
+	ds := resolveDataset(db, args[1])
+	headRef, ok := ds.MaybeHeadRef()
+	checkIfTrue(!ok, "Dataset %s has no data", ds.ID())
+	onto := resolveCommit(db, rebaseOnto)
+	ontoRef := types.NewRef(onto)
+
+	ancestorRef, ok := datas.FindCommonAncestor(headRef, ontoRef, db)
+	checkIfTrue(!ok, "Dataset %s and %s have no common ancestor", ds.ID(), rebaseOnto)
+	if ancestorRef.Equals(ontoRef) {
+		fmt.Printf("%s is already based on #%s\n", ds.ID(), ontoRef.TargetHash())
+		return 0
+	}
+
+	// Collect the commits to replay, newest first.
+	toReplay := []types.Struct{}
+	for r := headRef; !r.Equals(ancestorRef); {
+		commit := r.TargetValue(db).(types.Struct)
+		parents := commit.Get(datas.ParentsField).(types.Set)
+		checkIfTrue(parents.Len() != 1, "Can't rebase #%s, because it has %d parents", r.TargetHash(), parents.Len())
+		toReplay = append(toReplay, commit)
+		r = parents.First().(types.Ref)
+	}
+
+	resolve := decideResolveFunc(resolver)
+	pc := newMergeProgressChan()
+	newHeadRef := ontoRef
+	for i := len(toReplay) - 1; i >= 0; i-- {
+		value, meta := replayCommit(db, toReplay[i], onto, resolve, pc)
+		onto = datas.NewCommit(value, types.NewSet(newHeadRef), meta)
+		newHeadRef = db.WriteValue(onto)
+	}
+	close(pc)
+
+	// Only move the head if nobody else has since it was read, so that no commits are lost.
+	_, err = db.CompareAndSetHead(ds, newHeadRef)
+	if err == datas.ErrMergeNeeded {
+		err = fmt.Errorf("Dataset %s was changed by someone else during the rebase, try again", ds.ID())
+	}
+	d.CheckErrorNoUsage(err)
+	if !verbose.Quiet() {
+		status.Done()
+	}
+	fmt.Printf("Rebased %d commits onto #%s. New head #%s (was #%s)\n", len(toReplay), ontoRef.TargetHash(), newHeadRef.TargetHash(), headRef.TargetHash())
+	return 0
+}
+
+func registerReplayPolicyFlag(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&resolver, "policy", "n", "conflict resolution policy for replaying changes. Defaults to 'n', which means no resolution strategy will be applied. Supported values are 'l' (left, the value being replayed onto), 'r' (right, the replayed change) and 'p' (prompt).")
+}
+
+// resolveCommit returns the Commit at the absolute path |str| within |db|.
+func resolveCommit(db datas.Database, str string) types.Struct {
+	absPath, err := spec.NewAbsolutePath(str)
+	d.CheckErrorNoUsage(err)
+	commit := absPath.Resolve(db)
+	checkIfTrue(commit == nil, "Error resolving value: %s", str)
+	checkIfTrue(!datas.IsCommitType(commit.Type()), "%s is not a commit", str)
+	return commit.(types.Struct)
+}
+
+// replayCommit replays the change that |commit| made to the value of its
+// parent on top of the value of |onto|, and returns the result along with
+// the meta of |commit|, so that it can be committed on top of |onto|.
+func replayCommit(db datas.Database, commit, onto types.Struct, resolve merge.ResolveFunc, pc chan struct{}) (types.Value, types.Struct) {
+	parents := commit.Get(datas.ParentsField).(types.Set)
+	checkIfTrue(parents.Len() != 1, "Can't replay #%s, because it has %d parents", commit.Hash(), parents.Len())
+	parent := parents.First().(types.Ref).TargetValue(db).(types.Struct)
+
+	value, err := diff.Replay(onto.Get(datas.ValueField), commit.Get(datas.ValueField), parent.Get(datas.ValueField), db, resolve, pc)
+	d.CheckErrorNoUsage(err)
+	return value, commit.Get(datas.MetaField).(types.Struct)
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+type nomsRebaseTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func TestNomsRebase(t *testing.T) {
+	suite.Run(t, &nomsRebaseTestSuite{})
+}
+
+func (s *nomsRebaseTestSuite) TearDownTest() {
+	s.NoError(os.RemoveAll(s.DBDir))
+}
+
+func (s *nomsRebaseTestSuite) commit(db datas.Database, dsName string, data types.StructData, parents ...types.Value) types.Ref {
+	ds, err := db.Commit(db.GetDataset(dsName), types.NewStruct("", data), datas.CommitOptions{
+		Parents: types.NewSet(parents...),
+		Meta:    types.NewStruct("Meta", types.StructData{"desc": types.String(dsName)}),
+	})
+	s.NoError(err)
+	return ds.HeadRef()
+}
+
+func (s *nomsRebaseTestSuite) TestRebase() {
+	sp, err := spec.ForDatabase(s.DBDir)
+	s.NoError(err)
+	defer sp.Close()
+	db := sp.GetDatabase()
+
+	base := s.commit(db, "main", types.StructData{"a": types.Number(1), "b": types.Number(1), "c": types.Number(1)})
+	onto := s.commit(db, "main", types.StructData{"a": types.Number(2), "b": types.Number(1), "c": types.Number(1)}, base)
+	c1 := s.commit(db, "topic", types.StructData{"a": types.Number(1), "b": types.Number(2), "c": types.Number(1)}, base)
+	s.commit(db, "topic", types.StructData{"a": types.Number(1), "b": types.Number(2), "c": types.Number(2)}, c1)
+	db.Close()
+
+	stdout, _ := s.MustRun(main, []string{"rebase", s.DBDir, "topic", "--onto", "main"})
+	s.Contains(stdout, "Rebased 2 commits onto #"+onto.TargetHash().String())
+
+	sp, err = spec.ForDataset(spec.CreateValueSpecString("nbs", s.DBDir, "topic"))
+	s.NoError(err)
+	defer sp.Close()
+	head := sp.GetDataset().Head()
+	s.True(types.NewStruct("", types.StructData{"a": types.Number(2), "b": types.Number(2), "c": types.Number(2)}).Equals(head.Get(datas.ValueField)))
+	s.True(types.NewStruct("Meta", types.StructData{"desc": types.String("topic")}).Equals(head.Get(datas.MetaField)))
+
+	parent := head.Get(datas.ParentsField).(types.Set).First().(types.Ref).TargetValue(sp.GetDatabase()).(types.Struct)
+	s.True(types.NewStruct("", types.StructData{"a": types.Number(2), "b": types.Number(2), "c": types.Number(1)}).Equals(parent.Get(datas.ValueField)))
+	s.True(types.NewSet(onto).Equals(parent.Get(datas.ParentsField)))
+}
+
+func (s *nomsRebaseTestSuite) TestRebaseAlreadyBased() {
+	sp, err := spec.ForDatabase(s.DBDir)
+	s.NoError(err)
+	defer sp.Close()
+	db := sp.GetDatabase()
+
+	base := s.commit(db, "main", types.StructData{"a": types.Number(1)})
+	head := s.commit(db, "topic", types.StructData{"a": types.Number(2)}, base)
+	db.Close()
+
+	stdout, _ := s.MustRun(main, []string{"rebase", "--onto", "main", s.DBDir, "topic"})
+	s.Equal("topic is already based on #"+base.TargetHash().String()+"\n", stdout)
+
+	sp, err = spec.ForDataset(spec.CreateValueSpecString("nbs", s.DBDir, "topic"))
+	s.NoError(err)
+	defer sp.Close()
+	s.True(head.Equals(sp.GetDataset().HeadRef()))
+}
+
+func (s *nomsRebaseTestSuite) TestRebaseConflict() {
+	sp, err := spec.ForDatabase(s.DBDir)
+	s.NoError(err)
+	defer sp.Close()
+	db := sp.GetDatabase()
+
+	base := s.commit(db, "main", types.StructData{"a": types.Number(1)})
+	s.commit(db, "main", types.StructData{"a": types.Number(2)}, base)
+	s.commit(db, "topic", types.StructData{"a": types.Number(3)}, base)
+	db.Close()
+
+	_, stderr, recovered := s.Run(main, []string{"rebase", s.DBDir, "topic", "--onto", "main"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Conflict")
+
+	s.MustRun(main, []string{"rebase", "--policy=r", s.DBDir, "topic", "--onto", "main"})
+	sp, err = spec.ForDataset(spec.CreateValueSpecString("nbs", s.DBDir, "topic"))
+	s.NoError(err)
+	defer sp.Close()
+	s.True(types.NewStruct("", types.StructData{"a": types.Number(3)}).Equals(sp.GetDataset().HeadValue()))
+}
+
+func (s *nomsRebaseTestSuite) TestRebaseBadInput() {
+	_, stderr, recovered := s.Run(main, []string{"rebase", s.DBDir, "topic"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "--onto is required")
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsReflog = &util.Command{
+	Run:       runReflog,
+	UsageLine: "reflog <db-spec>",
+	Short:     "Lists recent changes to the root hash of a database",
+	Long:      "Lists recent changes to the root of a database, most recent first. Each entry is numbered, starting from @0, so that a dataset can be restored from the root it points to using 'noms ds --restore <dataset>@<n>'. Only the most recent 256 changes are kept, and 'noms gc' removes those older than its --keep-reflog. Remote databases are not supported.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Flags:     setupReflogFlags,
+	Nargs:     1,
+}
+
+func setupReflogFlags() *flag.FlagSet {
+	return flag.NewFlagSet("reflog", flag.ExitOnError)
+}
+
+func runReflog(args []string) int {
+	cfg := config.NewResolver()
+	rl, err := getRootLogger(cfg, args[0])
+	d.CheckErrorNoUsage(err)
+	defer rl.Close()
+
+	for i, e := range rl.RootLog() {
+		fmt.Printf("@%-3d %s  %s -> %s  %s\n", i, e.Time.Format(time.RFC3339), e.From, e.To, e.Reason)
+	}
+	return 0
+}
+
+type rootLoggingChunkStore interface {
+	chunks.ChunkStore
+	chunks.RootLogger
+}
+
+func getRootLogger(cfg *config.Resolver, dbSpec string) (rootLoggingChunkStore, error) {
+	cs, err := cfg.GetChunkStore(dbSpec)
+	if err != nil {
+		return nil, err
+	}
+	rl, ok := cs.(rootLoggingChunkStore)
+	if !ok {
+		if cs != nil {
+			cs.Close()
+		}
+		return nil, fmt.Errorf("reflog is not supported for %s", dbSpec)
+	}
+	return rl, nil
+}
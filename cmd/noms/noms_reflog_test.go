@@ -0,0 +1,64 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/nbs"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsReflog(t *testing.T) {
+	suite.Run(t, &nomsReflogTestSuite{})
+}
+
+type nomsReflogTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsReflogTestSuite) TestReflogAndRestore() {
+	db := datas.NewDatabase(nbs.NewLocalStore(s.DBDir, clienttest.DefaultMemTableSize))
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("first"))
+	s.NoError(err)
+	first := ds.HeadRef().TargetHash()
+	ds, err = db.CommitValue(ds, types.String("second"))
+	s.NoError(err)
+	second := ds.HeadRef().TargetHash()
+	_, err = db.Delete(ds)
+	s.NoError(err)
+	s.NoError(db.Close())
+
+	dbSpec := spec.CreateDatabaseSpecString("nbs", s.DBDir)
+	stdout, _ := s.MustRun(main, []string{"reflog", dbSpec})
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	s.Len(lines, 3)
+	s.True(strings.HasPrefix(lines[0], "@0 "), lines[0])
+	s.Contains(lines[0], "delete ds "+second.String())
+	s.Contains(lines[1], "commit ds "+second.String())
+	s.Contains(lines[2], "commit ds "+first.String())
+
+	// @0 is the root after the delete, so ds isn't there.
+	dsSpec := spec.CreateValueSpecString("nbs", s.DBDir, "ds")
+	_, stderr, recovered := s.Run(main, []string{"ds", "--restore", dsSpec + "@0"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Dataset ds not found in reflog entry @0")
+
+	stdout, _ = s.MustRun(main, []string{"ds", "--restore", dsSpec + "@2"})
+	s.Equal("Restored ds to #"+first.String()+"\n", stdout)
+	// The restore is itself logged, so the commit of "second" is now @2.
+	stdout, _ = s.MustRun(main, []string{"ds", "--restore", dsSpec + "@2"})
+	s.Equal("Restored ds to #"+second.String()+" (was #"+first.String()+")\n", stdout)
+
+	sp, err := spec.ForDataset(dsSpec)
+	s.NoError(err)
+	defer sp.Close()
+	s.True(types.String("second").Equals(sp.GetDataset().HeadValue()))
+}
@@ -0,0 +1,158 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var nomsRemote = &util.Command{
+	Run:       runRemote,
+	UsageLine: "remote [<database> | add <database> <name> <url> | rm <database> <name>]",
+	Short:     "List, add and remove the remotes of a database",
+	Long:      "Remotes are named upstreams of a database, which datasets can be fetched from and pushed to with 'noms fetch', 'noms pull' and 'noms push'. They're stored in .nomsconfig, under the database's alias, so <database> must be an alias or the url of a configured database. With no arguments, lists the remotes of the default database.",
+	Flags:     setupRemoteFlags,
+	Nargs:     0,
+}
+
+func setupRemoteFlags() *flag.FlagSet {
+	remoteFlagSet := flag.NewFlagSet("remote", flag.ExitOnError)
+	verbose.RegisterVerboseFlags(remoteFlagSet)
+	return remoteFlagSet
+}
+
+func runRemote(args []string) int {
+	cfg := config.NewResolver()
+	c := cfg.Config()
+	if c == nil {
+		d.CheckErrorNoUsage(config.NoConfig)
+	}
+
+	if len(args) > 0 && (args[0] == "add" || args[0] == "rm") {
+		if args[0] == "add" && len(args) != 4 || args[0] == "rm" && len(args) != 3 {
+			d.CheckErrorNoUsage(fmt.Errorf("Incorrect number of arguments"))
+		}
+		alias := getDbAlias(cfg, args[1])
+		if args[0] == "add" {
+			d.CheckErrorNoUsage(c.AddRemote(alias, args[2], cfg.ResolveDbSpec(args[3])))
+		} else {
+			d.CheckErrorNoUsage(c.RemoveRemote(alias, args[2]))
+		}
+		d.CheckErrorNoUsage(c.Save())
+		return 0
+	}
+
+	if len(args) > 1 {
+		d.CheckErrorNoUsage(fmt.Errorf("Incorrect number of arguments"))
+	}
+	dbStr := ""
+	if len(args) == 1 {
+		dbStr = args[0]
+	}
+	remotes := c.Db[getDbAlias(cfg, dbStr)].Remotes
+	names := make([]string, 0, len(remotes))
+	for name := range remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s %s\n", name, remotes[name].Url)
+	}
+	return 0
+}
+
+func getDbAlias(cfg *config.Resolver, str string) string {
+	alias, ok := cfg.DbAlias(str)
+	if !ok {
+		d.CheckErrorNoUsage(fmt.Errorf("Database %s isn't configured in %s", str, config.NomsConfigFile))
+	}
+	return alias
+}
+
+// splitDatasetArg splits |str|, of the form [<database>::]<dataset>, into the
+// unresolved database and the name of the dataset.
+func splitDatasetArg(str string) (dbStr, dsName string) {
+	if i := strings.LastIndex(str, spec.Separator); i != -1 {
+		return str[:i], str[i+len(spec.Separator):]
+	}
+	return "", str
+}
+
+// getRemoteDatabases opens the database |dbStr| and its remote called
+// |remote|.
+func getRemoteDatabases(cfg *config.Resolver, dbStr, remote string) (localDB, remoteDB datas.Database) {
+	remoteSpec, err := cfg.ResolveRemote(dbStr, remote)
+	d.CheckErrorNoUsage(err)
+	localDB, err = cfg.GetDatabase(dbStr)
+	d.CheckError(err)
+	remoteDB, err = cfg.GetDatabase(remoteSpec)
+	d.CheckError(err)
+	return
+}
+
+// trackingDatasetID returns the ID of the dataset in a local database that
+// tracks the dataset |dsName| of its remote called |remote|.
+func trackingDatasetID(remote, dsName string) string {
+	return remote + "/" + dsName
+}
+
+// fetchDataset copies the head of the dataset |dsName| from |remoteDB| into
+// |localDB|, and makes it the head of the corresponding tracking dataset. It
+// prints what it did, and returns the tracking dataset.
+func fetchDataset(localDB, remoteDB datas.Database, remote, dsName string) datas.Dataset {
+	remoteRef, ok := remoteDB.GetDataset(dsName).MaybeHeadRef()
+	checkIfTrue(!ok, "Remote %s has no dataset %s", remote, dsName)
+
+	trackingID := trackingDatasetID(remote, dsName)
+	tracking := localDB.GetDataset(trackingID)
+	trackingRef, ok := tracking.MaybeHeadRef()
+	if ok && trackingRef.Equals(remoteRef) {
+		fmt.Printf("%s is up to date\n", trackingID)
+		return tracking
+	}
+
+	hintRef := trackingRef
+	if !ok {
+		hintRef, _ = localDB.GetDataset(dsName).MaybeHeadRef()
+	}
+	datas.PullWithFlush(remoteDB, localDB, remoteRef, hintRef, p, nil)
+	tracking, err := localDB.SetHead(tracking, remoteRef)
+	checkTrackingUpdate(err, trackingID)
+
+	if ok {
+		fmt.Printf("Fetched %s #%s (was #%s)\n", trackingID, remoteRef.TargetHash(), trackingRef.TargetHash())
+	} else {
+		fmt.Printf("Fetched %s #%s\n", trackingID, remoteRef.TargetHash())
+	}
+	return tracking
+}
+
+// setTrackingHead records that the dataset |dsName| of |remote| is now at
+// |headRef|, e.g. after it's been pushed.
+func setTrackingHead(localDB datas.Database, remote, dsName string, headRef types.Ref) {
+	trackingID := trackingDatasetID(remote, dsName)
+	_, err := localDB.SetHead(localDB.GetDataset(trackingID), headRef)
+	checkTrackingUpdate(err, trackingID)
+}
+
+// checkTrackingUpdate exits with a message if |err|, from moving the head of
+// the tracking dataset |trackingID|, isn't nil.
+func checkTrackingUpdate(err error, trackingID string) {
+	if err == datas.ErrMergeNeeded {
+		err = fmt.Errorf("%s was changed by someone else at the same time, try again", trackingID)
+	}
+	d.CheckErrorNoUsage(err)
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/nbs"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+type nomsRemoteTestSuite struct {
+	clienttest.ClientTestSuite
+	cwd string
+}
+
+func TestNomsRemote(t *testing.T) {
+	suite.Run(t, &nomsRemoteTestSuite{})
+}
+
+// SetupTest makes DBDir the default database of a .nomsconfig in the working
+// directory, with DBDir2 as its remote called "origin".
+func (s *nomsRemoteTestSuite) SetupTest() {
+	var err error
+	s.cwd, err = os.Getwd()
+	s.NoError(err)
+
+	home := filepath.Join(s.TempDir, "home")
+	c := &config.Config{Db: map[string]config.DbConfig{
+		config.DefaultDbAlias: {
+			Url:     "nbs:" + s.DBDir,
+			Remotes: map[string]config.RemoteConfig{"origin": {Url: "nbs:" + s.DBDir2}},
+		},
+	}}
+	_, err = c.WriteTo(home)
+	s.NoError(err)
+	s.NoError(os.Chdir(home))
+}
+
+func (s *nomsRemoteTestSuite) TearDownTest() {
+	s.NoError(os.Chdir(s.cwd))
+	for _, dir := range []string{s.DBDir, s.DBDir2} {
+		s.NoError(os.RemoveAll(dir))
+		s.NoError(os.Mkdir(dir, 0777))
+	}
+}
+
+func (s *nomsRemoteTestSuite) commit(dir, dsName string, v types.Value) types.Ref {
+	db := datas.NewDatabase(nbs.NewLocalStore(dir, clienttest.DefaultMemTableSize))
+	defer db.Close()
+	ds, err := db.CommitValue(db.GetDataset(dsName), v)
+	s.NoError(err)
+	return ds.HeadRef()
+}
+
+func (s *nomsRemoteTestSuite) headRef(dir, dsName string) types.Ref {
+	db := datas.NewDatabase(nbs.NewLocalStore(dir, clienttest.DefaultMemTableSize))
+	defer db.Close()
+	r, ok := db.GetDataset(dsName).MaybeHeadRef()
+	s.True(ok, "%s has no head", dsName)
+	return r
+}
+
+func (s *nomsRemoteTestSuite) TestRemote() {
+	stdout, _ := s.MustRun(main, []string{"remote"})
+	s.Equal("origin nbs:"+s.DBDir2+"\n", stdout)
+
+	s.MustRun(main, []string{"remote", "add", "default", "backup", "nbs:" + s.TempDir + "/backup"})
+	stdout, _ = s.MustRun(main, []string{"remote", "nbs:" + s.DBDir})
+	s.Equal("backup nbs:"+s.TempDir+"/backup\norigin nbs:"+s.DBDir2+"\n", stdout)
+
+	_, stderr, recovered := s.Run(main, []string{"remote", "add", "default", "backup", "nbs:" + s.TempDir + "/other"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Remote backup already exists")
+
+	_, stderr, recovered = s.Run(main, []string{"remote", "add", "default", "a/b", "nbs:" + s.TempDir + "/other"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Invalid remote name a/b")
+
+	s.MustRun(main, []string{"remote", "rm", "default", "origin"})
+	stdout, _ = s.MustRun(main, []string{"remote"})
+	s.Equal("backup nbs:"+s.TempDir+"/backup\n", stdout)
+}
+
+func (s *nomsRemoteTestSuite) TestFetch() {
+	mainRef := s.commit(s.DBDir2, "main", types.Number(1))
+	otherRef := s.commit(s.DBDir2, "other", types.Number(2))
+
+	stdout, _ := s.MustRun(main, []string{"fetch", "", "origin"})
+	s.Contains(stdout, "Fetched origin/main #"+mainRef.TargetHash().String())
+	s.Contains(stdout, "Fetched origin/other #"+otherRef.TargetHash().String())
+	s.True(mainRef.Equals(s.headRef(s.DBDir, "origin/main")))
+	s.True(otherRef.Equals(s.headRef(s.DBDir, "origin/other")))
+
+	newRef := s.commit(s.DBDir2, "main", types.Number(3))
+	stdout, _ = s.MustRun(main, []string{"fetch", "", "origin", "main"})
+	s.Equal("Fetched origin/main #"+newRef.TargetHash().String()+" (was #"+mainRef.TargetHash().String()+")\n", stdout)
+
+	stdout, _ = s.MustRun(main, []string{"fetch", "", "origin", "main"})
+	s.Equal("origin/main is up to date\n", stdout)
+
+	_, stderr, recovered := s.Run(main, []string{"fetch", "", "upstream"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Database default has no remote called upstream")
+}
+
+func (s *nomsRemoteTestSuite) TestPullAndPush() {
+	data := func(a, b float64) types.Struct {
+		return types.NewStruct("", types.StructData{"a": types.Number(a), "b": types.Number(b)})
+	}
+	s.commit(s.DBDir2, "main", data(1, 1))
+
+	// Pulling into a missing dataset creates it.
+	stdout, _ := s.MustRun(main, []string{"pull", "main", "origin"})
+	s.Contains(stdout, "Created main")
+
+	// Local commits can be pushed, since they descend from the remote head.
+	localRef := s.commit(s.DBDir, "main", data(2, 1))
+	stdout, _ = s.MustRun(main, []string{"push", "main", "origin"})
+	s.Contains(stdout, "Pushed main to origin/main #"+localRef.TargetHash().String())
+	s.True(localRef.Equals(s.headRef(s.DBDir2, "main")))
+	s.True(localRef.Equals(s.headRef(s.DBDir, "origin/main")))
+
+	// Once the remote has moved on, pushing is rejected but pulling merges.
+	remoteRef := s.commit(s.DBDir2, "main", data(2, 2))
+	localRef = s.commit(s.DBDir, "main", data(3, 1))
+	_, stderr, recovered := s.Run(main, []string{"push", "main", "origin"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Push rejected")
+	s.True(remoteRef.Equals(s.headRef(s.DBDir2, "main")))
+
+	stdout, _ = s.MustRun(main, []string{"pull", "main", "origin"})
+	s.Contains(stdout, "Merged origin/main into main")
+	db := datas.NewDatabase(nbs.NewLocalStore(s.DBDir, clienttest.DefaultMemTableSize))
+	head := db.GetDataset("main").Head()
+	s.True(data(3, 2).Equals(head.Get(datas.ValueField)))
+	s.True(types.NewSet(localRef, remoteRef).Equals(head.Get(datas.ParentsField)))
+	db.Close()
+
+	stdout, _ = s.MustRun(main, []string{"push", "main", "origin"})
+	s.Contains(stdout, "Pushed main to origin/main")
+
+	// Pulling when the remote is behind does nothing.
+	s.commit(s.DBDir, "main", data(4, 2))
+	stdout, _ = s.MustRun(main, []string{"pull", "main", "origin"})
+	s.Contains(stdout, "main is up to date")
+}
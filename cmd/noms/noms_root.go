@@ -7,10 +7,11 @@ package main
 import (
 	"fmt"
 	"os"
-
 	"strings"
+	"time"
 
 	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/config"
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/datas"
@@ -90,6 +91,9 @@ Continue?
 		fmt.Fprintln(os.Stderr, "Optimistic concurrency failure")
 		return 1
 	}
+	if rl, ok := rt.(chunks.RootLogger); ok {
+		rl.LogRoot(chunks.RootLogEntry{Time: time.Now(), From: currRoot, To: h, Reason: "root --update"})
+	}
 
 	fmt.Printf("Success. Previous root was: %s\n", currRoot)
 	return 0
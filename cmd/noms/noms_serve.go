@@ -5,28 +5,51 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/attic-labs/noms/cmd/util"
 	"github.com/attic-labs/noms/go/config"
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/nbs"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
 	"github.com/attic-labs/noms/go/util/profile"
 	"github.com/attic-labs/noms/go/util/verbose"
+	humanize "github.com/dustin/go-humanize"
 	flag "github.com/juju/gnuflag"
 )
 
 var (
-	port int
+	port        int
+	authFile    string
+	tlsCert     string
+	tlsKey      string
+	tlsClientCA string
+	readOnly    bool
+	datasets    string
+	preCommit   string
+	postCommit  string
+
+	serveCompactInterval     time.Duration
+	serveCompactFanIn        int
+	serveCompactMinTableSize string
+	serveCompactMaxTableSize string
 )
 
 var nomsServe = &util.Command{
 	Run:       runServe,
 	UsageLine: "serve [options] <database>",
 	Short:     "Serves a Noms database over HTTP",
-	Long:      "See Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database argument.",
+	Long:      "By default, anyone who can connect can read and write the database. With --auth, clients must identify themselves with one of the credentials listed in the given file, one per line, in the form:\n\n  token <token> read|write [<dataset-pattern>...]\n  basic <user>:<bcrypt hash of password> read|write [<dataset-pattern>...]\n  cert <client certificate common name> read|write [<dataset-pattern>...]\n\nClients with read access can only read. Clients with write access can also write, but if any dataset patterns (e.g. staging/*) are given, can only change the datasets and tags that match one of them.\n\nWith --tls-cert and --tls-key, the database is served over HTTPS. With --tls-client-ca as well, clients must present a certificate signed by one of the given CAs; combined with --auth, the certificate's common name then identifies the client.\n\nWith --read-only, nothing can be written to the database. With --datasets, the database is read-only and clients can only see the datasets (and tags, as @tag:<tag>) matching one of the given comma-separated patterns, e.g. --datasets='public/*,@tag:release-*', along with their history.\n\nWith --pre-commit-hook, the given executable is run before any client moves the head of a dataset, with the dataset, the hash of the new head commit and the hash of the current head (empty if the dataset is new) as arguments. If it exits with a non-zero status, the change is refused and its output is returned to the client as the error. With --post-commit-hook, the given executable is run with the same arguments after the head has moved.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database argument.",
 	Flags:     setupServeFlags,
 	Nargs:     0,
 }
@@ -34,6 +57,18 @@ var nomsServe = &util.Command{
 func setupServeFlags() *flag.FlagSet {
 	serveFlagSet := flag.NewFlagSet("serve", flag.ExitOnError)
 	serveFlagSet.IntVar(&port, "port", 8000, "port to listen on for HTTP requests")
+	serveFlagSet.StringVar(&authFile, "auth", "", "file listing the credentials of the clients allowed to connect")
+	serveFlagSet.StringVar(&tlsCert, "tls-cert", "", "PEM encoded certificate to serve HTTPS with")
+	serveFlagSet.StringVar(&tlsKey, "tls-key", "", "PEM encoded private key of --tls-cert")
+	serveFlagSet.StringVar(&tlsClientCA, "tls-client-ca", "", "PEM bundle of the CAs that client certificates must be signed by")
+	serveFlagSet.BoolVar(&readOnly, "read-only", false, "refuse all writes")
+	serveFlagSet.StringVar(&datasets, "datasets", "", "comma-separated patterns of the only datasets to serve, read-only")
+	serveFlagSet.StringVar(&preCommit, "pre-commit-hook", "", "executable to run before a dataset's head moves, which can refuse the change")
+	serveFlagSet.StringVar(&postCommit, "post-commit-hook", "", "executable to run after a dataset's head moves")
+	serveFlagSet.DurationVar(&serveCompactInterval, "compact-interval", 0, "how often to merge tables in the background, e.g. 1m, rather than while writing")
+	serveFlagSet.IntVar(&serveCompactFanIn, "compact-fan-in", nbs.DefaultCompactionPolicy.FanIn, "how many tables of a tier it takes to merge them in the background")
+	serveFlagSet.StringVar(&serveCompactMinTableSize, "compact-min-table-size", humanize.IBytes(nbs.DefaultCompactionPolicy.MinTableBytes), "the size below which tables are all in the first tier of background compaction")
+	serveFlagSet.StringVar(&serveCompactMaxTableSize, "compact-max-table-size", "", "the size of tables that are never merged in the background")
 	verbose.RegisterVerboseFlags(serveFlagSet)
 	profile.RegisterProfileFlags(serveFlagSet)
 	return serveFlagSet
@@ -45,9 +80,56 @@ func runServe(args []string) int {
 	if len(args) > 0 {
 		db = args[0]
 	}
-	cs, err := cfg.GetChunkStore(db)
+	opts := spec.SpecOptions{}
+	if serveCompactInterval > 0 {
+		opts.CompactionInterval = serveCompactInterval
+		opts.CompactionPolicy = parseCompactionPolicy(serveCompactFanIn, serveCompactMinTableSize, serveCompactMaxTableSize, "compact-")
+	}
+	cs, err := cfg.GetChunkStoreOpts(db, opts)
 	d.CheckError(err)
 	server := datas.NewRemoteDatabaseServer(cs, port)
+	server.ReadOnly = readOnly
+	if datasets != "" {
+		server.Datasets = strings.Split(datasets, ",")
+		for _, pattern := range server.Datasets {
+			if _, err := path.Match(pattern, ""); err != nil {
+				d.CheckErrorNoUsage(fmt.Errorf("Invalid dataset pattern %s", pattern))
+			}
+		}
+	}
+	if authFile != "" {
+		creds, err := datas.ReadCredentialsFile(authFile)
+		d.CheckErrorNoUsage(err)
+		server.Auth = creds
+	}
+	if tlsCert != "" || tlsKey != "" {
+		if tlsCert == "" || tlsKey == "" {
+			d.CheckErrorNoUsage(errors.New("--tls-cert and --tls-key must be given together"))
+		}
+		server.TLSConfig, err = datas.NewServerTLSConfig(tlsCert, tlsKey, tlsClientCA)
+		d.CheckErrorNoUsage(err)
+	} else if tlsClientCA != "" {
+		d.CheckErrorNoUsage(errors.New("--tls-client-ca requires --tls-cert and --tls-key"))
+	}
+	if preCommit != "" {
+		server.Hooks.PreCommit = append(server.Hooks.PreCommit, func(vr types.ValueReader, datasetID string, commit types.Struct, currentHead types.Ref) error {
+			out, err := runCommitHook(preCommit, datasetID, commit, currentHead)
+			if err != nil {
+				if msg := strings.TrimSpace(string(out)); msg != "" {
+					return errors.New(msg)
+				}
+				return fmt.Errorf("%s: %s", preCommit, err)
+			}
+			return nil
+		})
+	}
+	if postCommit != "" {
+		server.Hooks.PostCommit = append(server.Hooks.PostCommit, func(vr types.ValueReader, datasetID string, commit types.Struct, previousHead types.Ref) {
+			if out, err := runCommitHook(postCommit, datasetID, commit, previousHead); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n%s", postCommit, err, out)
+			}
+		})
+	}
 
 	// Shutdown server gracefully so that profile may be written
 	c := make(chan os.Signal, 1)
@@ -64,3 +146,13 @@ func runServe(args []string) int {
 	})
 	return 0
 }
+
+// runCommitHook runs the executable |hook| with the arguments described in
+// nomsServe's help, and returns its combined output.
+func runCommitHook(hook, datasetID string, commit types.Struct, head types.Ref) ([]byte, error) {
+	headHash := ""
+	if head != (types.Ref{}) {
+		headHash = head.TargetHash().String()
+	}
+	return exec.Command(hook, datasetID, commit.Hash().String(), headHash).CombinedOutput()
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsServe(t *testing.T) {
+	suite.Run(t, &nomsServeTestSuite{})
+}
+
+type nomsServeTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+// writeTestCert creates a certificate for |cn|, signed by |parent|, or
+// self-signed if |parent| is nil, and writes it and its key to dir/name.pem
+// and dir/name.key.
+func writeTestCert(dir, name, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	d.PanicIfError(err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	d.PanicIfError(err)
+	cert, err := x509.ParseCertificate(der)
+	d.PanicIfError(err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	d.PanicIfError(err)
+
+	d.PanicIfError(ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	d.PanicIfError(ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return cert, key
+}
+
+func (s *nomsServeTestSuite) TestMutualTLSClient() {
+	ca, caKey := writeTestCert(s.TempDir, "ca", "Test CA", nil, nil)
+	writeTestCert(s.TempDir, "server", "server", ca, caKey)
+	writeTestCert(s.TempDir, "client", "client", ca, caKey)
+	file := func(name string) string { return filepath.Join(s.TempDir, name) }
+
+	cs := chunks.NewMemoryStore()
+	db := datas.NewDatabase(cs)
+	_, err := db.CommitValue(db.GetDataset("ds"), types.String("hello"))
+	s.NoError(err)
+	server := datas.NewRemoteDatabaseServer(cs, 0)
+	server.TLSConfig, err = datas.NewServerTLSConfig(file("server.pem"), file("server.key"), file("ca.pem"))
+	s.NoError(err)
+	ready := make(chan struct{})
+	server.Ready = func() { close(ready) }
+	go server.Run()
+	<-ready
+	defer server.Stop()
+	url := fmt.Sprintf("https://127.0.0.1:%d", server.Port())
+
+	// Without a client certificate, the server refuses to talk.
+	defer os.Unsetenv(spec.CACertFileEnvVar)
+	os.Setenv(spec.CACertFileEnvVar, file("ca.pem"))
+	_, _, recovered := s.Run(main, []string{"ds", url})
+	s.NotNil(recovered)
+
+	defer os.Unsetenv(spec.ClientCertFileEnvVar)
+	defer os.Unsetenv(spec.ClientKeyFileEnvVar)
+	os.Setenv(spec.ClientCertFileEnvVar, file("client.pem"))
+	os.Setenv(spec.ClientKeyFileEnvVar, file("client.key"))
+	stdout, _ := s.MustRun(main, []string{"ds", url})
+	s.Equal("ds\n", stdout)
+
+	stdout, _ = s.MustRun(main, []string{"show", url + "::ds.value"})
+	s.Equal("\"hello\"\n", stdout)
+}
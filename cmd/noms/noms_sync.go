@@ -13,6 +13,7 @@ import (
 	"github.com/attic-labs/noms/go/config"
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
 	"github.com/attic-labs/noms/go/types"
 	"github.com/attic-labs/noms/go/util/profile"
 	"github.com/attic-labs/noms/go/util/status"
@@ -22,14 +23,16 @@ import (
 )
 
 var (
-	p int
+	p           int
+	syncDepth   int
+	syncSubtree string
 )
 
 var nomsSync = &util.Command{
 	Run:       runSync,
 	UsageLine: "sync [options] <source-object> <dest-dataset>",
 	Short:     "Moves datasets between or within databases",
-	Long:      "See Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the object and dataset arguments.",
+	Long:      "With --depth, the sync is shallow: only the commit at <source-object> and --depth-1 generations of its ancestors are copied, along with everything reachable from --subtree within each of them. The destination, which must be an nbs database, records the source database as its upstream, and fetches any other chunks from there when they're needed.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the object and dataset arguments.",
 	Flags:     setupSyncFlags,
 	Nargs:     2,
 }
@@ -37,6 +40,8 @@ var nomsSync = &util.Command{
 func setupSyncFlags() *flag.FlagSet {
 	syncFlagSet := flag.NewFlagSet("sync", flag.ExitOnError)
 	syncFlagSet.IntVar(&p, "p", 512, "parallelism")
+	syncFlagSet.IntVar(&syncDepth, "depth", 0, "number of commits to copy, starting from the source commit; 0 copies everything")
+	syncFlagSet.StringVar(&syncSubtree, "subtree", "", "path within each copied commit, e.g. .value, whose chunks are all copied by a shallow sync")
 	verbose.RegisterVerboseFlags(syncFlagSet)
 	profile.RegisterProfileFlags(syncFlagSet)
 	return syncFlagSet
@@ -52,6 +57,28 @@ func runSync(args []string) int {
 		d.CheckErrorNoUsage(fmt.Errorf("Object not found: %s", args[0]))
 	}
 
+	var subtree types.Path
+	if syncDepth < 0 {
+		d.CheckErrorNoUsage(fmt.Errorf("--depth must not be negative"))
+	} else if syncDepth > 0 {
+		if !datas.IsCommitType(sourceObj.Type()) {
+			d.CheckErrorNoUsage(fmt.Errorf("Shallow sync requires a commit, but %s is a %s", args[0], sourceObj.Type().Describe()))
+		}
+		if syncSubtree != "" {
+			subtree, err = types.ParsePath(syncSubtree)
+			d.CheckErrorNoUsage(err)
+		}
+
+		// Record the upstream before the sink is opened, so that the sink can fetch the chunks that the shallow sync leaves behind.
+		sourceSpec, err := spec.ForPath(cfg.ResolvePathSpec(args[0]))
+		d.CheckErrorNoUsage(err)
+		sinkSpec, err := spec.ForDataset(cfg.ResolvePathSpec(args[1]))
+		d.CheckErrorNoUsage(err)
+		d.CheckErrorNoUsage(sinkSpec.SetUpstream(sourceSpec))
+	} else if syncSubtree != "" {
+		d.CheckErrorNoUsage(fmt.Errorf("--subtree requires --depth"))
+	}
+
 	sinkDB, sinkDataset, err := cfg.GetDataset(args[1])
 	d.CheckError(err)
 	defer sinkDB.Close()
@@ -84,7 +111,11 @@ func runSync(args []string) int {
 	nonFF := false
 	err = d.Try(func() {
 		defer profile.MaybeStartProfile().Stop()
-		datas.PullWithFlush(sourceStore, sinkDB, sourceRef, sinkRef, p, progressCh)
+		if syncDepth > 0 {
+			datas.PullShallow(sourceStore, sinkDB, sourceRef, syncDepth, subtree, progressCh)
+		} else {
+			datas.PullWithFlush(sourceStore, sinkDB, sourceRef, sinkRef, p, progressCh)
+		}
 
 		var err error
 		sinkDataset, err = sinkDB.FastForward(sinkDataset, sourceRef)
@@ -140,3 +140,48 @@ func (s *nomsSyncTestSuite) TestRewind() {
 	s.True(types.Number(42).Equals(dest.HeadValue()))
 	db.Close()
 }
+
+func (s *nomsSyncTestSuite) TestSyncShallow() {
+	defer s.NoError(os.RemoveAll(s.DBDir2))
+
+	sourceDB := datas.NewDatabase(nbs.NewLocalStore(s.DBDir, clienttest.DefaultMemTableSize))
+	src := sourceDB.GetDataset("src")
+	src, err := sourceDB.CommitValue(src, types.Number(42))
+	s.NoError(err)
+	parentRef := src.HeadRef()
+	src, err = sourceDB.CommitValue(src, types.Number(43))
+	s.NoError(err)
+	headRef := src.HeadRef()
+	sourceDB.Close()
+
+	sourceDataset := spec.CreateValueSpecString("nbs", s.DBDir, "src")
+	sinkDatasetSpec := spec.CreateValueSpecString("nbs", s.DBDir2, "dest")
+	s.MustRun(main, []string{"sync", "--depth", "1", sourceDataset, sinkDatasetSpec})
+
+	cs := nbs.NewLocalStore(s.DBDir2, clienttest.DefaultMemTableSize)
+	s.True(cs.Has(headRef.TargetHash()))
+	s.False(cs.Has(parentRef.TargetHash()))
+	cs.Close()
+
+	// The parent wasn't copied, but can be read from the upstream.
+	sp, err := spec.ForDataset(sinkDatasetSpec)
+	s.NoError(err)
+	s.Equal("nbs:"+s.DBDir, sp.Upstream())
+	dest := sp.GetDataset()
+	s.True(headRef.Equals(dest.HeadRef()))
+	parent := dest.Head().Get(datas.ParentsField).(types.Set).First().(types.Ref).TargetValue(sp.GetDatabase())
+	s.True(types.Number(42).Equals(parent.(types.Struct).Get(datas.ValueField)))
+	sp.Close()
+
+	// A database can only have one upstream.
+	otherDir := s.DBDir2 + "-other"
+	s.NoError(os.Mkdir(otherDir, 0777))
+	defer os.RemoveAll(otherDir)
+	otherDB := datas.NewDatabase(nbs.NewLocalStore(otherDir, clienttest.DefaultMemTableSize))
+	_, err = otherDB.CommitValue(otherDB.GetDataset("other"), types.Number(1))
+	s.NoError(err)
+	otherDB.Close()
+	_, stderr, recovered := s.Run(main, []string{"sync", "--depth", "1", spec.CreateValueSpecString("nbs", otherDir, "other"), sinkDatasetSpec})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "already fetches chunks from")
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/attic-labs/noms/cmd/util"
+	"github.com/attic-labs/noms/go/config"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/verbose"
+	flag "github.com/juju/gnuflag"
+)
+
+var tagToDelete string
+
+var nomsTag = &util.Command{
+	Run:       runTag,
+	UsageLine: "tag [<database> | [options] <database>::<tag> <commit> | -d <database>::<tag>]",
+	Short:     "Create, list and delete tags",
+	Long:      "Tags are immutable names for commits. With just a database, lists its tags. With a tag and a commit, creates the tag, which can then be used wherever a dataset can be read from as @tag:<tag>, e.g. <database>::@tag:release-1.2.value. The commit is an absolute path within the same database, e.g. a dataset name or #<hash>.\n\nSee Spelling Objects at https://github.com/attic-labs/noms/blob/master/doc/spelling.md for details on the database and commit arguments.",
+	Flags:     setupTagFlags,
+	Nargs:     0,
+}
+
+func setupTagFlags() *flag.FlagSet {
+	tagFlagSet := flag.NewFlagSet("tag", flag.ExitOnError)
+	tagFlagSet.StringVar(&tagToDelete, "d", "", "tag to delete")
+	spec.RegisterCommitMetaFlags(tagFlagSet)
+	verbose.RegisterVerboseFlags(tagFlagSet)
+	return tagFlagSet
+}
+
+func runTag(args []string) int {
+	cfg := config.NewResolver()
+	if tagToDelete != "" {
+		db, name := getTagDatabase(cfg, tagToDelete)
+		defer db.Close()
+
+		r, ok := db.Tags().MaybeGet(types.String(name))
+		if !ok {
+			d.CheckErrorNoUsage(fmt.Errorf("Tag %s not found", name))
+		}
+		commitRef := r.(types.Ref).TargetValue(db).(types.Struct).Get(datas.TagCommitField).(types.Ref)
+		d.CheckErrorNoUsage(db.DeleteTag(name))
+
+		fmt.Printf("Deleted tag %s (was #%s)\n", name, commitRef.TargetHash())
+	} else if len(args) == 2 {
+		db, name := getTagDatabase(cfg, args[0])
+		defer db.Close()
+
+		absPath, err := spec.NewAbsolutePath(args[1])
+		d.CheckError(err)
+		commit := absPath.Resolve(db)
+		if commit == nil {
+			d.CheckErrorNoUsage(fmt.Errorf("Error resolving value: %s", args[1]))
+		}
+		if !datas.IsCommitType(commit.Type()) {
+			d.CheckErrorNoUsage(fmt.Errorf("%s is not a commit", args[1]))
+		}
+
+		meta, err := spec.CreateCommitMetaStruct(db, "", "", nil, nil)
+		d.CheckErrorNoUsage(err)
+		commitRef := types.NewRef(commit)
+		d.CheckErrorNoUsage(db.CreateTag(name, commitRef, meta))
+
+		fmt.Printf("Tagged #%s as %s\n", commitRef.TargetHash(), name)
+	} else {
+		dbSpec := ""
+		if len(args) >= 1 {
+			dbSpec = args[0]
+		}
+		db, err := cfg.GetDatabase(dbSpec)
+		d.CheckError(err)
+		defer db.Close()
+
+		db.Tags().IterAll(func(k, v types.Value) {
+			commitRef := v.(types.Ref).TargetValue(db).(types.Struct).Get(datas.TagCommitField).(types.Ref)
+			fmt.Printf("%s #%s\n", k.(types.String), commitRef.TargetHash())
+		})
+	}
+	return 0
+}
+
+// getTagDatabase splits |str|, of the form <database>::<tag>, into the
+// database and the name of the tag.
+func getTagDatabase(cfg *config.Resolver, str string) (datas.Database, string) {
+	path := cfg.ResolvePathSpec(str)
+	sep := strings.LastIndex(path, spec.Separator)
+	if sep == -1 {
+		d.CheckErrorNoUsage(fmt.Errorf("Expected <database>::<tag>, but got %s", str))
+	}
+	name := path[sep+len(spec.Separator):]
+	if !datas.TagNameFullRe.MatchString(name) {
+		d.CheckErrorNoUsage(fmt.Errorf("Invalid tag name: %s", name))
+	}
+	db, err := cfg.GetDatabase(path[:sep])
+	d.CheckError(err)
+	return db, name
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/spec"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/clienttest"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestNomsTag(t *testing.T) {
+	suite.Run(t, &nomsTagTestSuite{})
+}
+
+type nomsTagTestSuite struct {
+	clienttest.ClientTestSuite
+}
+
+func (s *nomsTagTestSuite) TestTag() {
+	sp, err := spec.ForDataset(spec.CreateValueSpecString("nbs", s.DBDir, "ds"))
+	s.NoError(err)
+	db := sp.GetDatabase()
+	ds, err := db.CommitValue(sp.GetDataset(), types.String("first"))
+	s.NoError(err)
+	first := ds.HeadRef().TargetHash()
+	ds, err = db.CommitValue(ds, types.String("second"))
+	s.NoError(err)
+	second := ds.HeadRef().TargetHash()
+	sp.Close()
+
+	dbSpec := spec.CreateDatabaseSpecString("nbs", s.DBDir)
+	tagSpec := dbSpec + spec.Separator + "release-1.2"
+
+	stdout, _ := s.MustRun(main, []string{"tag", "--message", "first release", tagSpec, "#" + first.String()})
+	s.Equal("Tagged #"+first.String()+" as release-1.2\n", stdout)
+	stdout, _ = s.MustRun(main, []string{"tag", spec.CreateValueSpecString("nbs", s.DBDir, "latest"), "ds"})
+	s.Equal("Tagged #"+second.String()+" as latest\n", stdout)
+
+	_, stderr, recovered := s.Run(main, []string{"tag", tagSpec, "ds"})
+	s.Equal(clienttest.ExitError{1}, recovered)
+	s.Contains(stderr, "Tag already exists")
+
+	stdout, _ = s.MustRun(main, []string{"tag", dbSpec})
+	s.Equal("latest #"+second.String()+"\nrelease-1.2 #"+first.String()+"\n", stdout)
+
+	// Tags aren't datasets, but can be read from like them.
+	stdout, _ = s.MustRun(main, []string{"ds", dbSpec})
+	s.Equal("ds\n", stdout)
+	stdout, _ = s.MustRun(main, []string{"show", spec.CreateValueSpecString("nbs", s.DBDir, "@tag:release-1.2.value")})
+	s.Equal("\"first\"\n", stdout)
+
+	stdout, _ = s.MustRun(main, []string{"tag", "-d", tagSpec})
+	s.Equal("Deleted tag release-1.2 (was #"+first.String()+")\n", stdout)
+	stdout, _ = s.MustRun(main, []string{"tag", dbSpec})
+	s.Equal("latest #"+second.String()+"\n", stdout)
+}
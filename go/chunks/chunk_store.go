@@ -6,6 +6,7 @@ package chunks
 
 import (
 	"io"
+	"time"
 
 	"github.com/attic-labs/noms/go/hash"
 )
@@ -38,6 +39,30 @@ type RootTracker interface {
 	UpdateRoot(current, last hash.Hash) bool
 }
 
+// RootLogSize is the maximum number of entries that a RootLogger should keep.
+// Older entries are discarded as new ones are logged.
+const RootLogSize = 256
+
+// RootLogEntry records a single successful UpdateRoot(), from root |From| to
+// root |To|, along with when and why it happened.
+type RootLogEntry struct {
+	Time     time.Time
+	From, To hash.Hash
+	Reason   string
+}
+
+// RootLogger is implemented by RootTrackers that keep a bounded, append-only
+// log of the transitions of their root, so that a root that's been
+// overwritten by mistake can be found again.
+type RootLogger interface {
+	// LogRoot appends |e| to the log, discarding the oldest entry if the log
+	// already holds RootLogSize entries.
+	LogRoot(e RootLogEntry)
+
+	// RootLog returns the entries in the log, most recent first.
+	RootLog() []RootLogEntry
+}
+
 // ChunkSource is a place to get chunks from.
 type ChunkSource interface {
 	// Get the Chunk for the value of the hash in the store. If the hash is
@@ -4,7 +4,11 @@
 
 package chunks
 
-import "github.com/attic-labs/noms/go/hash"
+import (
+	"sync"
+
+	"github.com/attic-labs/noms/go/hash"
+)
 
 type memoryRootTracker hash.Hash
 
@@ -20,3 +24,28 @@ func (ms *memoryRootTracker) UpdateRoot(current, last hash.Hash) bool {
 	*ms = memoryRootTracker(current)
 	return true
 }
+
+// memoryRootLog implements RootLogger for MemoryStore.
+type memoryRootLog struct {
+	logMu   sync.Mutex
+	entries []RootLogEntry
+}
+
+func (ml *memoryRootLog) LogRoot(e RootLogEntry) {
+	ml.logMu.Lock()
+	defer ml.logMu.Unlock()
+	ml.entries = append(ml.entries, e)
+	if len(ml.entries) > RootLogSize {
+		ml.entries = ml.entries[len(ml.entries)-RootLogSize:]
+	}
+}
+
+func (ml *memoryRootLog) RootLog() []RootLogEntry {
+	ml.logMu.Lock()
+	defer ml.logMu.Unlock()
+	log := make([]RootLogEntry, len(ml.entries))
+	for i, e := range ml.entries {
+		log[len(log)-1-i] = e
+	}
+	return log
+}
@@ -16,6 +16,7 @@ import (
 type MemoryStore struct {
 	data map[hash.Hash]Chunk
 	memoryRootTracker
+	memoryRootLog
 	mu sync.RWMutex
 }
 
@@ -11,6 +11,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 
 	"github.com/BurntSushi/toml"
 	"github.com/attic-labs/noms/go/spec"
@@ -22,6 +24,13 @@ type Config struct {
 }
 
 type DbConfig struct {
+	Url     string
+	Remotes map[string]RemoteConfig
+}
+
+// RemoteConfig describes a named upstream of a database, which datasets can be
+// fetched from and pushed to.
+type RemoteConfig struct {
 	Url string
 }
 
@@ -32,6 +41,11 @@ const (
 
 var NoConfig = errors.New(fmt.Sprintf("no %s found", NomsConfigFile))
 
+// RemoteNameRe matches legal remote names. The datasets fetched from a remote
+// are tracked locally as <remote>/<dataset>, so remote names can't contain
+// slashes.
+var RemoteNameRe = regexp.MustCompile(`^[a-zA-Z0-9\-_]+$`)
+
 // Find the closest directory containing .nomsconfig starting
 // in cwd and then searching up ancestor tree.
 // Look first looking in cwd and then up through its ancestors
@@ -91,6 +105,87 @@ func (c *Config) WriteTo(configHome string) (string, error) {
 	return file, nil
 }
 
+// Save writes the config back to the file it was read from. The urls of
+// databases and remotes that are unchanged are written as they were in the
+// file, so relative paths stay relative.
+func (c *Config) Save() error {
+	if c.File == "" {
+		return fmt.Errorf("Config wasn't read from a file")
+	}
+	data, err := ioutil.ReadFile(c.File)
+	if err != nil {
+		return err
+	}
+	orig, err := NewConfig(string(data))
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(c.File)
+	unqualify := func(url, origURL string) string {
+		if origURL != "" && absDbSpec(dir, origURL) == url {
+			return origURL
+		}
+		return url
+	}
+	saved := &Config{Db: map[string]DbConfig{}}
+	for alias, db := range c.Db {
+		od := orig.Db[alias]
+		sd := DbConfig{Url: unqualify(db.Url, od.Url)}
+		if len(db.Remotes) > 0 {
+			sd.Remotes = map[string]RemoteConfig{}
+			for name, r := range db.Remotes {
+				sd.Remotes[name] = RemoteConfig{unqualify(r.Url, od.Remotes[name].Url)}
+			}
+		}
+		saved.Db[alias] = sd
+	}
+	_, err = saved.WriteTo(dir)
+	return err
+}
+
+// AddRemote adds a remote called |name|, at |url|, to the database with alias
+// |alias|. A relative path in |url| is relative to the working directory.
+func (c *Config) AddRemote(alias, name, url string) error {
+	db, ok := c.Db[alias]
+	if !ok {
+		return fmt.Errorf("No database with alias %s", alias)
+	}
+	if !RemoteNameRe.MatchString(name) {
+		return fmt.Errorf("Invalid remote name %s, must match %s", name, RemoteNameRe.String())
+	}
+	if _, ok := db.Remotes[name]; ok {
+		return fmt.Errorf("Remote %s already exists", name)
+	}
+	if _, err := spec.ForDatabase(url); err != nil {
+		return err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if db.Remotes == nil {
+		db.Remotes = map[string]RemoteConfig{}
+	}
+	db.Remotes[name] = RemoteConfig{absDbSpec(cwd, url)}
+	c.Db[alias] = db
+	return nil
+}
+
+// RemoveRemote removes the remote called |name| from the database with alias
+// |alias|.
+func (c *Config) RemoveRemote(alias, name string) error {
+	db, ok := c.Db[alias]
+	if !ok {
+		return fmt.Errorf("No database with alias %s", alias)
+	}
+	if _, ok := db.Remotes[name]; !ok {
+		return fmt.Errorf("No remote called %s", name)
+	}
+	delete(db.Remotes, name)
+	return nil
+}
+
 // Replace relative directory in path part of spec with an absolute
 // directory. Assumes the path is relative to the location of the config file
 func absDbSpec(configHome string, url string) string {
@@ -114,10 +209,13 @@ func qualifyPaths(configPath string, c *Config) (*Config, error) {
 		return nil, err
 	}
 	dir := filepath.Dir(file)
-	qc := *c
-	qc.File = file
+	qc := Config{file, map[string]DbConfig{}}
 	for k, r := range c.Db {
-		qc.Db[k] = DbConfig{absDbSpec(dir, r.Url)}
+		remotes := map[string]RemoteConfig{}
+		for name, rc := range r.Remotes {
+			remotes[name] = RemoteConfig{absDbSpec(dir, rc.Url)}
+		}
+		qc.Db[k] = DbConfig{absDbSpec(dir, r.Url), remotes}
 	}
 	return &qc, nil
 }
@@ -136,6 +234,15 @@ func (c *Config) writeableString() string {
 	for k, r := range c.Db {
 		buffer.WriteString(fmt.Sprintf("[db.%s]\n", k))
 		buffer.WriteString(fmt.Sprintf("\t"+`url = "%s"`+"\n", r.Url))
+		names := make([]string, 0, len(r.Remotes))
+		for name := range r.Remotes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			buffer.WriteString(fmt.Sprintf("[db.%s.remotes.%s]\n", k, name))
+			buffer.WriteString(fmt.Sprintf("\t"+`url = "%s"`+"\n", r.Remotes[name].Url))
+		}
 	}
 	return buffer.String()
 }
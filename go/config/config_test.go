@@ -29,32 +29,32 @@ var (
 	ldbConfig = &Config{
 		"",
 		map[string]DbConfig{
-			DefaultDbAlias: {nbsSpec},
-			remoteAlias:    {httpSpec},
+			DefaultDbAlias: {Url: nbsSpec},
+			remoteAlias:    {Url: httpSpec},
 		},
 	}
 
 	httpConfig = &Config{
 		"",
 		map[string]DbConfig{
-			DefaultDbAlias: {httpSpec},
-			remoteAlias:    {nbsSpec},
+			DefaultDbAlias: {Url: httpSpec},
+			remoteAlias:    {Url: nbsSpec},
 		},
 	}
 
 	memConfig = &Config{
 		"",
 		map[string]DbConfig{
-			DefaultDbAlias: {memSpec},
-			remoteAlias:    {httpSpec},
+			DefaultDbAlias: {Url: memSpec},
+			remoteAlias:    {Url: httpSpec},
 		},
 	}
 
 	ldbAbsConfig = &Config{
 		"",
 		map[string]DbConfig{
-			DefaultDbAlias: {nbsAbsSpec},
-			remoteAlias:    {httpSpec},
+			DefaultDbAlias: {Url: nbsAbsSpec},
+			remoteAlias:    {Url: httpSpec},
 		},
 	}
 )
@@ -199,3 +199,35 @@ func TestCwd(t *testing.T) {
 
 	assert.Equal(cwd, abs)
 }
+
+func TestRemotes(t *testing.T) {
+	assert := assert.New(t)
+	path := getPaths(assert, "home.remotes")
+	writeConfig(assert, &Config{"", map[string]DbConfig{
+		DefaultDbAlias: {nbsSpec, map[string]RemoteConfig{remoteAlias: {httpSpec}}},
+	}}, path.home)
+	assert.NoError(os.Chdir(path.home))
+
+	c, err := FindNomsConfig()
+	assert.NoError(err)
+	assert.Equal(httpSpec, c.Db[DefaultDbAlias].Remotes[remoteAlias].Url)
+
+	assert.NoError(c.AddRemote(DefaultDbAlias, "backup", nbsSpec))
+	assert.Error(c.AddRemote(DefaultDbAlias, "backup", nbsSpec))
+	assert.Error(c.AddRemote(DefaultDbAlias, "a/b", nbsSpec))
+	assert.Error(c.AddRemote("nonexistent", "backup", nbsSpec))
+	assert.NoError(c.RemoveRemote(DefaultDbAlias, remoteAlias))
+	assert.Error(c.RemoveRemote(DefaultDbAlias, remoteAlias))
+	assert.NoError(c.Save())
+
+	c, err = FindNomsConfig()
+	assert.NoError(err)
+	remotes := c.Db[DefaultDbAlias].Remotes
+	assert.Len(remotes, 1)
+	assertDbSpecsEquiv(assert, nbsSpec, remotes["backup"].Url)
+
+	// The relative path of the database is saved as it was written.
+	data, err := ioutil.ReadFile(path.config)
+	assert.NoError(err)
+	assert.Contains(string(data), `url = "`+nbsSpec+`"`)
+}
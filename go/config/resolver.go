@@ -6,6 +6,7 @@ package config
 
 import (
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/attic-labs/noms/go/chunks"
@@ -84,6 +85,51 @@ func (r *Resolver) ResolvePathSpec(str string) string {
 	return str
 }
 
+// Config returns the config that the Resolver was created from, or nil if no
+// .nomsconfig file was found.
+func (r *Resolver) Config() *Config {
+	return r.config
+}
+
+// DbAlias returns the alias under which the database |str| is configured:
+// |str| itself if it's an alias, the default alias if |str| is empty, or
+// otherwise the alias whose url is |str|.
+func (r *Resolver) DbAlias(str string) (string, bool) {
+	if r.config == nil {
+		return "", false
+	}
+	if str == "" {
+		str = DefaultDbAlias
+	}
+	if _, ok := r.config.Db[str]; ok {
+		return str, true
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+	for alias, db := range r.config.Db {
+		if db.Url == absDbSpec(cwd, str) {
+			return alias, true
+		}
+	}
+	return "", false
+}
+
+// ResolveRemote returns the database spec of the remote called |name| of the
+// database |str|, which is resolved as by DbAlias().
+func (r *Resolver) ResolveRemote(str, name string) (string, error) {
+	alias, ok := r.DbAlias(str)
+	if !ok {
+		return "", fmt.Errorf("Database %s has no remotes; configure it in %s first", str, NomsConfigFile)
+	}
+	remote, ok := r.config.Db[alias].Remotes[name]
+	if !ok {
+		return "", fmt.Errorf("Database %s has no remote called %s", alias, name)
+	}
+	return r.verbose(name, remote.Url), nil
+}
+
 // Resolve string to database spec. If a config is present,
 //   - resolve a db alias to its db spec
 //   - resolve "" to the default db spec
@@ -97,7 +143,13 @@ func (r *Resolver) GetDatabase(str string) (datas.Database, error) {
 
 // Resolve string to a chunkstore. Like ResolveDatabase, but returns the underlying ChunkStore
 func (r *Resolver) GetChunkStore(str string) (chunks.ChunkStore, error) {
-	sp, err := spec.ForDatabase(r.verbose(str, r.ResolveDbSpec(str)))
+	return r.GetChunkStoreOpts(str, spec.SpecOptions{})
+}
+
+// GetChunkStoreOpts is like GetChunkStore, but customizes the ChunkStore with
+// |opts|.
+func (r *Resolver) GetChunkStoreOpts(str string, opts spec.SpecOptions) (chunks.ChunkStore, error) {
+	sp, err := spec.ForDatabaseOpts(r.verbose(str, r.ResolveDbSpec(str)), opts)
 	if err != nil {
 		return nil, err
 	}
@@ -32,8 +32,8 @@ var (
 	rtestConfig = &Config{
 		"",
 		map[string]DbConfig{
-			DefaultDbAlias: {localSpec},
-			remoteAlias:    {remoteSpec},
+			DefaultDbAlias: {Url: localSpec},
+			remoteAlias:    {Url: remoteSpec},
 		},
 	}
 
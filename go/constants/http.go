@@ -5,12 +5,15 @@
 package constants
 
 const (
-	RootPath       = "/root/"
-	GetRefsPath    = "/getRefs/"
-	GetBlobPath    = "/getBlob/"
-	HasRefsPath    = "/hasRefs/"
-	WriteValuePath = "/writeValue/"
-	BasePath       = "/"
+	RootPath        = "/root/"
+	GetRefsPath     = "/getRefs/"
+	GetBlobPath     = "/getBlob/"
+	HasRefsPath     = "/hasRefs/"
+	WriteValuePath  = "/writeValue/"
+	WatchPath       = "/watch/"
+	CommitGraphPath = "/commitGraph/"
+	CompactionPath  = "/compaction/"
+	BasePath        = "/"
 
 	GraphQLPath = "/graphql/"
 )
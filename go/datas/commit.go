@@ -5,10 +5,8 @@
 package datas
 
 import (
-	"sort"
 
 	"github.com/attic-labs/noms/go/d"
-	"github.com/attic-labs/noms/go/hash"
 	"github.com/attic-labs/noms/go/types"
 )
 
@@ -67,54 +65,20 @@ func FindCommonAncestor(c1, c2 types.Ref, vr types.ValueReader) (a types.Ref, ok
 		d.Panic("FindCommonAncestor() called on %s", c2.Type().Describe())
 	}
 
-	c1Q, c2Q := &types.RefByHeight{c1}, &types.RefByHeight{c2}
-	for !c1Q.Empty() && !c2Q.Empty() {
-		c1Ht, c2Ht := c1Q.MaxHeight(), c2Q.MaxHeight()
-		if c1Ht == c2Ht {
-			c1Parents, c2Parents := c1Q.PopRefsOfHeight(c1Ht), c2Q.PopRefsOfHeight(c2Ht)
-			if common := findCommonRef(c1Parents, c2Parents); (common != types.Ref{}) {
-				return common, true
-			}
-			parentsToQueue(c1Parents, c1Q, vr)
-			parentsToQueue(c2Parents, c2Q, vr)
-		} else if c1Ht > c2Ht {
-			parentsToQueue(c1Q.PopRefsOfHeight(c1Ht), c1Q, vr)
-		} else {
-			parentsToQueue(c2Q.PopRefsOfHeight(c2Ht), c2Q, vr)
+	// The first Commit reached from both is the tallest common ancestor.
+	w := newGraphWalk(vr)
+	w.start(c1, fromA)
+	w.start(c2, fromB)
+	for w.any(fromA, 0) && w.any(fromB, 0) {
+		r, flags := w.next()
+		if flags == fromA|fromB {
+			return w.ref(r), true
 		}
+		w.pushParents(r, flags)
 	}
 	return
 }
 
-func parentsToQueue(refs types.RefSlice, q *types.RefByHeight, vr types.ValueReader) {
-	for _, r := range refs {
-		c := r.TargetValue(vr).(types.Struct)
-		p := c.Get(ParentsField).(types.Set)
-		p.IterAll(func(v types.Value) {
-			q.PushBack(v.(types.Ref))
-		})
-	}
-	sort.Sort(q)
-}
-
-func findCommonRef(a, b types.RefSlice) types.Ref {
-	toRefSet := func(s types.RefSlice) map[hash.Hash]types.Ref {
-		out := map[hash.Hash]types.Ref{}
-		for _, r := range s {
-			out[r.TargetHash()] = r
-		}
-		return out
-	}
-
-	aSet, bSet := toRefSet(a), toRefSet(b)
-	for s, r := range aSet {
-		if _, present := bSet[s]; present {
-			return r
-		}
-	}
-	return types.Ref{}
-}
-
 func makeCommitStructType(metaType, parentsType, valueType *types.Type) *types.Type {
 	return types.MakeStructType2("Commit",
 		types.StructField{
@@ -0,0 +1,320 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"sort"
+	"time"
+
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// The queries below walk the commit graph from the tallest Commits down. A
+// Commit is always taller than its parents, so once a Commit is reached, all
+// the Commits it could be reached from along the way have been visited, and
+// the flags it has collected from them are final. The walks only need the
+// hash, height, parents and date of each Commit, which they get from a
+// graphSource: the commit-graph index of the Database, if it has one, or
+// otherwise the Commits themselves.
+
+const (
+	fromA graphFlags = 1 << iota
+	fromB
+	stale
+)
+
+type graphFlags uint8
+
+// graphRef identifies a Commit in a walk of the commit graph.
+type graphRef struct {
+	h      hash.Hash
+	height uint64
+}
+
+// less orders graphRefs like types.HeightOrder orders Refs.
+func (r graphRef) less(other graphRef) bool {
+	if r.height == other.height {
+		return r.h.Less(other.h)
+	}
+	return r.height < other.height
+}
+
+// graphSource tells walks of the commit graph what they need to know about
+// the Commits in it.
+type graphSource interface {
+	// parents returns the parents of the Commit |r|.
+	parents(r graphRef) []graphRef
+
+	// date returns the date in the meta of the Commit |r|, if it has one.
+	date(r graphRef) (time.Time, bool)
+
+	// ref returns a Ref to the Commit |r|.
+	ref(r graphRef) types.Ref
+}
+
+// commitGraphReader is implemented by Databases, which can have a faster
+// graphSource than reading Commits.
+type commitGraphReader interface {
+	// commitGraphSource returns a graphSource that uses the commit-graph
+	// index of the Database, or nil if it doesn't have one.
+	commitGraphSource() graphSource
+}
+
+// newGraphSource returns the best graphSource for the Commits in |vr|.
+func newGraphSource(vr types.ValueReader) graphSource {
+	if cgr, ok := vr.(commitGraphReader); ok {
+		if src := cgr.commitGraphSource(); src != nil {
+			return src
+		}
+	}
+	return newCommitSource(vr)
+}
+
+// commitSource is a graphSource that reads the Commits.
+type commitSource struct {
+	vr   types.ValueReader
+	refs map[hash.Hash]types.Ref
+}
+
+func newCommitSource(vr types.ValueReader) *commitSource {
+	return &commitSource{vr, map[hash.Hash]types.Ref{}}
+}
+
+func (s *commitSource) commit(r graphRef) types.Struct {
+	return s.vr.ReadValue(r.h).(types.Struct)
+}
+
+func (s *commitSource) parents(r graphRef) []graphRef {
+	parents := []graphRef{}
+	s.commit(r).Get(ParentsField).(types.Set).IterAll(func(v types.Value) {
+		p := v.(types.Ref)
+		s.refs[p.TargetHash()] = p
+		parents = append(parents, graphRef{p.TargetHash(), p.Height()})
+	})
+	return parents
+}
+
+func (s *commitSource) date(r graphRef) (time.Time, bool) {
+	return commitDate(s.commit(r))
+}
+
+func (s *commitSource) ref(r graphRef) types.Ref {
+	if ref, ok := s.refs[r.h]; ok {
+		return ref
+	}
+	return types.NewRef(s.commit(r))
+}
+
+// graphWalk visits the Commits reachable from some starting points, tallest
+// first, passing the flags of the Commits each was reached from on to its
+// parents.
+type graphWalk struct {
+	src    graphSource
+	q      []graphRef
+	sorted bool
+	flags  map[hash.Hash]graphFlags
+	refs   map[hash.Hash]types.Ref
+}
+
+func newGraphWalk(vr types.ValueReader) *graphWalk {
+	return &graphWalk{src: newGraphSource(vr), flags: map[hash.Hash]graphFlags{}, refs: map[hash.Hash]types.Ref{}}
+}
+
+// start pushes the Commit referenced by |r|, which the caller passed in.
+func (w *graphWalk) start(r types.Ref, flags graphFlags) {
+	if !IsRefOfCommitType(r.Type()) {
+		d.Panic("Commit graph query called on %s", r.Type().Describe())
+	}
+	w.refs[r.TargetHash()] = r
+	w.push(graphRef{r.TargetHash(), r.Height()}, flags)
+}
+
+func (w *graphWalk) push(r graphRef, flags graphFlags) {
+	if _, ok := w.flags[r.h]; !ok {
+		w.q = append(w.q, r)
+		w.sorted = false
+	}
+	w.flags[r.h] |= flags
+}
+
+// next returns the tallest Commit that hasn't been visited yet, and the flags
+// it was reached with. The caller decides, with pushParents, which flags to
+// pass on to its parents.
+func (w *graphWalk) next() (graphRef, graphFlags) {
+	r := w.tallest()
+	w.q = w.q[:len(w.q)-1]
+	return r, w.flags[r.h]
+}
+
+// tallest returns the tallest Commit that hasn't been visited yet.
+func (w *graphWalk) tallest() graphRef {
+	if !w.sorted {
+		sort.Slice(w.q, func(i, j int) bool { return w.q[i].less(w.q[j]) })
+		w.sorted = true
+	}
+	return w.q[len(w.q)-1]
+}
+
+func (w *graphWalk) empty() bool {
+	return len(w.q) == 0
+}
+
+func (w *graphWalk) pushParents(r graphRef, flags graphFlags) {
+	for _, p := range w.src.parents(r) {
+		w.push(p, flags)
+	}
+}
+
+// any returns true if some Commit still to be visited has all of |flags| and
+// not |not|.
+func (w *graphWalk) any(flags, not graphFlags) bool {
+	for _, r := range w.q {
+		if f := w.flags[r.h]; f&flags == flags && f&not == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ref returns a Ref to the Commit |r|, preferring the one the caller passed in.
+func (w *graphWalk) ref(r graphRef) types.Ref {
+	if ref, ok := w.refs[r.h]; ok {
+		return ref
+	}
+	return w.src.ref(r)
+}
+
+// IsAncestor returns true if the Commit referenced by |a| is the one
+// referenced by |b| or one of its ancestors.
+func IsAncestor(a, b types.Ref, vr types.ValueReader) bool {
+	w := newGraphWalk(vr)
+	w.start(b, fromB)
+	for !w.empty() && w.tallest().height >= a.Height() {
+		r, _ := w.next()
+		if r.h == a.TargetHash() {
+			return true
+		}
+		if r.height > a.Height() {
+			w.pushParents(r, fromB)
+		}
+	}
+	return false
+}
+
+// MergeBases returns the best common ancestors of the Commits referenced by
+// |a| and |b|: those that are ancestors of both, but not of another such
+// Commit. Usually there's just one, which is what FindCommonAncestor returns,
+// but there can be more if, for example, each of two branches merged the other
+// one in. If |a| and |b| have no common ancestor, MergeBases returns none.
+func MergeBases(a, b types.Ref, vr types.ValueReader) []types.Ref {
+	w := newGraphWalk(vr)
+	w.start(a, fromA)
+	w.start(b, fromB)
+	bases := []types.Ref{}
+	for w.any(fromA, stale) && w.any(fromB, stale) {
+		r, flags := w.next()
+		if flags&(fromA|fromB) == fromA|fromB && flags&stale == 0 {
+			bases = append(bases, w.ref(r))
+			flags |= stale
+		}
+		w.pushParents(r, flags)
+	}
+	return bases
+}
+
+// CommitsBetween returns the Commits that are ancestors of the one referenced
+// by |b|, or |b| itself, but not of the one referenced by |a|, like the range
+// a..b in git. If |a| is the zero Ref, all of the history of |b| is returned.
+// The Commits are in topological order, children before their parents, and
+// otherwise newest first according to the date in their meta, if they have
+// one.
+func CommitsBetween(a, b types.Ref, vr types.ValueReader) []types.Ref {
+	w := newGraphWalk(vr)
+	if a != (types.Ref{}) {
+		w.start(a, fromA)
+	}
+	w.start(b, fromB)
+
+	between := []graphRef{}
+	for w.any(fromB, fromA) {
+		r, flags := w.next()
+		w.pushParents(r, flags)
+		if flags&fromA == 0 {
+			between = append(between, r)
+		}
+	}
+
+	// The Commits are already tallest first, which is a topological order.
+	// Commits of the same height can't be ancestors of each other, so they can
+	// be ordered by date.
+	sort.SliceStable(between, func(i, j int) bool {
+		if hi, hj := between[i].height, between[j].height; hi != hj {
+			return hi > hj
+		}
+		di, oki := w.src.date(between[i])
+		dj, okj := w.src.date(between[j])
+		return oki && okj && di.After(dj)
+	})
+	refs := make([]types.Ref, len(between))
+	for i, r := range between {
+		refs[i] = w.ref(r)
+	}
+	return refs
+}
+
+// FirstParentHistory returns the Commit referenced by |r| and its ancestors
+// along their first parents, newest first. Parents are a Set, so they have no
+// order of their own; the first parent is taken to be the tallest one, which
+// follows the longest line of history, and otherwise the first in the Set.
+func FirstParentHistory(r types.Ref, vr types.ValueReader) []types.Ref {
+	w := newGraphWalk(vr)
+	w.start(r, 0)
+	history := []types.Ref{}
+	for g := (graphRef{r.TargetHash(), r.Height()}); g != (graphRef{}); {
+		history = append(history, w.ref(g))
+		var first graphRef
+		for _, p := range w.src.parents(g) {
+			if first == (graphRef{}) || p.height > first.height {
+				first = p
+			}
+		}
+		g = first
+	}
+	return history
+}
+
+// commitDateFormat is the format of the date in the meta of the Commits made by
+// the noms command, see spec.CommitMetaDateFormat.
+const commitDateFormat = "2006-01-02T15:04:05-0700"
+
+func commitDate(commit types.Struct) (time.Time, bool) {
+	str, ok := commitDateString(commit)
+	if !ok {
+		return time.Time{}, false
+	}
+	return parseCommitDate(str)
+}
+
+// commitDateString returns the date in the meta of |commit| as it's stored, if
+// it has one.
+func commitDateString(commit types.Struct) (string, bool) {
+	meta, ok := commit.MaybeGet(MetaField)
+	if !ok {
+		return "", false
+	}
+	s, ok := meta.(types.Struct).MaybeGet("date")
+	if !ok {
+		return "", false
+	}
+	str, ok := s.(types.String)
+	return string(str), ok
+}
+
+func parseCommitDate(str string) (time.Time, bool) {
+	t, err := time.Parse(commitDateFormat, str)
+	return t, err == nil
+}
@@ -0,0 +1,279 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// CommitGraphKey is the key in the root Map of a Database that holds its
+// commit-graph index, if it has one. The index is a Map from the hash of every
+// Commit in the history of the datasets, as a String, to a
+// struct CommitGraphEntry {date: String, height: Number, parents: List<String>}
+// holding the date in the meta of the Commit, or "" if it has none, its height
+// and the hashes of its parents. Walks of the commit graph, like those of
+// FindCommonAncestor() and MergeBases(), use the index instead of reading the
+// Commits themselves. Since it holds hashes rather than Refs, reading it never
+// reads a Commit. Once a Database has an index, every update of its root that
+// moves a dataset adds the new Commits to it. Nothing is ever removed, as what
+// it records about a Commit can't change, and servers refuse entries that don't
+// match their Commits.
+const CommitGraphKey = "@commit-graph"
+
+const (
+	commitGraphEntryName = "CommitGraphEntry"
+	commitGraphDateField = "date"
+	heightField          = "height"
+)
+
+// commitGraphEntry is what the commit-graph index records about a Commit.
+type commitGraphEntry struct {
+	h       hash.Hash
+	height  uint64
+	parents []hash.Hash
+	date    string
+}
+
+func newCommitGraphEntry(r types.Ref, commit types.Struct) commitGraphEntry {
+	e := commitGraphEntry{h: r.TargetHash(), height: r.Height()}
+	commit.Get(ParentsField).(types.Set).IterAll(func(v types.Value) {
+		e.parents = append(e.parents, v.(types.Ref).TargetHash())
+	})
+	e.date, _ = commitDateString(commit)
+	return e
+}
+
+func (e commitGraphEntry) toStruct() types.Struct {
+	parents := make(types.ValueSlice, len(e.parents))
+	for i, p := range e.parents {
+		parents[i] = types.String(p.String())
+	}
+	return types.NewStruct(commitGraphEntryName, types.StructData{
+		commitGraphDateField: types.String(e.date),
+		heightField:          types.Number(e.height),
+		ParentsField:         types.NewList(parents...),
+	})
+}
+
+func commitGraphEntryFromStruct(h hash.Hash, s types.Struct) commitGraphEntry {
+	e := commitGraphEntry{
+		h:      h,
+		height: uint64(s.Get(heightField).(types.Number)),
+		date:   string(s.Get(commitGraphDateField).(types.String)),
+	}
+	s.Get(ParentsField).(types.List).IterAll(func(v types.Value, _ uint64) {
+		e.parents = append(e.parents, hash.Parse(string(v.(types.String))))
+	})
+	return e
+}
+
+// indexCommits adds |heads| and all of their ancestors that aren't in |index|
+// yet to it. It returns the new index and how many Commits were added.
+func indexCommits(vr types.ValueReader, index types.Map, heads ...types.Ref) (types.Map, int) {
+	added := 0
+	for len(heads) > 0 {
+		r := heads[len(heads)-1]
+		heads = heads[:len(heads)-1]
+		key := types.String(r.TargetHash().String())
+		if index.Has(key) {
+			continue
+		}
+		commit := r.TargetValue(vr).(types.Struct)
+		index = index.Set(key, newCommitGraphEntry(r, commit).toStruct())
+		added++
+		commit.Get(ParentsField).(types.Set).IterAll(func(v types.Value) {
+			heads = append(heads, v.(types.Ref))
+		})
+	}
+	return index, added
+}
+
+// commitGraphFromRoot returns the commit-graph index in |root|, the Map at the
+// root of a Database, if it has one.
+func commitGraphFromRoot(vr types.ValueReader, root types.Map) (types.Map, bool) {
+	if r, ok := root.MaybeGet(types.String(CommitGraphKey)); ok {
+		return r.(types.Ref).TargetValue(vr).(types.Map), true
+	}
+	return types.Map{}, false
+}
+
+// checkCommitGraph returns an error if the commit-graph index in |proposed|, the
+// Map at the root of a Database, has lost or changed any of the entries of the
+// one in |last|, or has entries that differ from those the server would build
+// from the Commits they describe. Any client that may write may update the
+// index, so it mustn't be able to forge the ancestry of datasets it can't.
+func checkCommitGraph(vr types.ValueReader, proposed, last types.Map) error {
+	index, ok := commitGraphFromRoot(vr, proposed)
+	if !ok {
+		return nil
+	}
+	lastIndex, ok := commitGraphFromRoot(vr, last)
+	if !ok {
+		lastIndex = types.NewMap()
+	}
+
+	changes := make(chan types.ValueChanged)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(changes)
+		index.Diff(lastIndex, changes, stop)
+	}()
+	for change := range changes {
+		key, ok := change.V.(types.String)
+		if !ok {
+			return fmt.Errorf("Commit-graph index has a key that isn't a String")
+		}
+		if change.ChangeType != types.DiffChangeAdded {
+			return fmt.Errorf("Commit-graph index entry for %s can't be changed", key)
+		}
+		h, ok := hash.MaybeParse(string(key))
+		if !ok {
+			return fmt.Errorf("Commit-graph index has an entry for %s, which isn't a hash", key)
+		}
+		commit, ok := vr.ReadValue(h).(types.Struct)
+		if !ok || !IsCommitType(commit.Type()) {
+			return fmt.Errorf("Commit-graph index has an entry for %s, which isn't a Commit", key)
+		}
+		if !newCommitGraphEntry(types.NewRef(commit), commit).toStruct().Equals(index.Get(key)) {
+			return fmt.Errorf("Commit-graph index entry for %s doesn't match the Commit", key)
+		}
+	}
+	return nil
+}
+
+// updateCommitGraph returns |root| with the Commits that the datasets in it
+// have moved to since |lastRootHash| added to its commit-graph index, if it
+// has one.
+func (dbc *databaseCommon) updateCommitGraph(root types.Map, lastRootHash hash.Hash) types.Map {
+	index, ok := commitGraphFromRoot(dbc, root)
+	if !ok {
+		return root
+	}
+	last := types.NewMap()
+	if !lastRootHash.IsEmpty() {
+		last = dbc.ReadValue(lastRootHash).(types.Map)
+	}
+	heads := []types.Ref{}
+	for _, change := range changedHeads(root, last) {
+		if change.NewHead != (types.Ref{}) {
+			heads = append(heads, change.NewHead)
+		}
+	}
+	if index, added := indexCommits(dbc, index, heads...); added > 0 {
+		return root.Set(types.String(CommitGraphKey), types.ToRefOfValue(dbc.WriteValue(index)))
+	}
+	return root
+}
+
+// doBuildCommitGraph adds the commit-graph index to the root, or brings the one there up to date with the datasets, e.g. after they were moved by a client that doesn't maintain it. Like doCommit(), it retries if the root is changed concurrently by another writer.
+func (dbc *databaseCommon) doBuildCommitGraph() error {
+	defer dbc.resetRoot()
+
+	var err error
+	for err = ErrOptimisticLockFailed; err == ErrOptimisticLockFailed; {
+		currentRootHash, currentRoot := dbc.getRootAndDatasets()
+		index, ok := commitGraphFromRoot(dbc, currentRoot)
+		if !ok {
+			index = types.NewMap()
+		}
+		heads := []types.Ref{}
+		datasetsFromRoot(currentRoot).IterAll(func(k, v types.Value) {
+			heads = append(heads, v.(types.Ref))
+		})
+		index, added := indexCommits(dbc, index, heads...)
+		if ok && added == 0 {
+			return nil
+		}
+		indexRef := dbc.WriteValue(index) // will be orphaned if the tryUpdateRoot() below fails
+		err = dbc.tryUpdateRoot(currentRoot.Set(types.String(CommitGraphKey), types.ToRefOfValue(indexRef)), currentRootHash, fmt.Sprintf("build-commit-graph %s", indexRef.TargetHash()))
+	}
+	return err
+}
+
+// doDropCommitGraph removes the commit-graph index from the root. Like doCommit(), it retries if the root is changed concurrently by another writer.
+func (dbc *databaseCommon) doDropCommitGraph() error {
+	defer dbc.resetRoot()
+
+	var err error
+	for err = ErrOptimisticLockFailed; err == ErrOptimisticLockFailed; {
+		currentRootHash, currentRoot := dbc.getRootAndDatasets()
+		if !currentRoot.Has(types.String(CommitGraphKey)) {
+			return nil
+		}
+		err = dbc.tryUpdateRoot(currentRoot.Remove(types.String(CommitGraphKey)), currentRootHash, "drop-commit-graph")
+	}
+	return err
+}
+
+func (dbc *databaseCommon) commitGraphSource() graphSource {
+	index, ok := commitGraphFromRoot(dbc, dbc.rootMap())
+	if !ok {
+		return nil
+	}
+	return newIndexSource(dbc, func(h hash.Hash) (commitGraphEntry, bool) {
+		if v, ok := index.MaybeGet(types.String(h.String())); ok {
+			return commitGraphEntryFromStruct(h, v.(types.Struct)), true
+		}
+		return commitGraphEntry{}, false
+	})
+}
+
+// indexSource is a graphSource that looks Commits up in a commit-graph index,
+// and reads those that aren't in it, e.g. because they haven't been committed
+// yet.
+type indexSource struct {
+	*commitSource
+	lookup  func(h hash.Hash) (commitGraphEntry, bool)
+	entries map[hash.Hash]commitGraphEntry
+	missing hash.HashSet
+}
+
+func newIndexSource(vr types.ValueReader, lookup func(h hash.Hash) (commitGraphEntry, bool)) *indexSource {
+	return &indexSource{newCommitSource(vr), lookup, map[hash.Hash]commitGraphEntry{}, hash.HashSet{}}
+}
+
+func (s *indexSource) entry(h hash.Hash) (commitGraphEntry, bool) {
+	if e, ok := s.entries[h]; ok {
+		return e, true
+	}
+	if s.missing.Has(h) {
+		return commitGraphEntry{}, false
+	}
+	e, ok := s.lookup(h)
+	if ok {
+		s.entries[h] = e
+	} else {
+		s.missing.Insert(h)
+	}
+	return e, ok
+}
+
+func (s *indexSource) parents(r graphRef) []graphRef {
+	e, ok := s.entry(r.h)
+	if !ok {
+		return s.commitSource.parents(r)
+	}
+	parents := make([]graphRef, len(e.parents))
+	for i, h := range e.parents {
+		p, ok := s.entry(h)
+		if !ok {
+			return s.commitSource.parents(r)
+		}
+		parents[i] = graphRef{h, p.height}
+	}
+	return parents
+}
+
+func (s *indexSource) date(r graphRef) (time.Time, bool) {
+	if e, ok := s.entry(r.h); ok {
+		return parseCommitDate(e.date)
+	}
+	return s.commitSource.date(r)
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func testCommitGraphIndex(assert *assert.Assertions, db Database) {
+	refs := buildGraph(db)
+	_, err := db.SetHead(db.GetDataset("g"), refs["g"])
+	assert.NoError(err)
+	_, err = db.SetHead(db.GetDataset("h"), refs["h"])
+	assert.NoError(err)
+	_, ok := newGraphSource(db).(*commitSource)
+	assert.True(ok)
+
+	assert.NoError(db.BuildCommitGraph())
+	assert.False(db.Datasets().Has(types.String(CommitGraphKey)))
+	assert.True(db.Fsck().OK())
+	src, ok := newGraphSource(db).(*indexSource)
+	if assert.True(ok) {
+		e, ok := src.entry(refs["g"].TargetHash())
+		assert.True(ok)
+		assert.Equal(uint64(5), e.height)
+		assert.Len(e.parents, 2)
+		assert.Equal("2016-12-01T10:00:06+0000", e.date)
+	}
+
+	bases := names(refs, MergeBases(refs["g"], refs["h"], db))
+	sort.Strings(bases)
+	assert.Equal([]string{"c", "f"}, bases)
+	assert.Equal([]string{"g", "f", "d", "e", "c", "b", "a"}, names(refs, CommitsBetween(types.Ref{}, refs["g"], db)))
+	assert.Equal([]string{"d", "c", "b", "a"}, names(refs, FirstParentHistory(refs["d"], db)))
+	a, ok := FindCommonAncestor(refs["d"], refs["f"], db)
+	assert.True(ok)
+	assert.True(refs["b"].Equals(a))
+
+	// Commits are added to the index as they're made.
+	ds, err := db.CommitValue(db.GetDataset("g"), types.String("i"))
+	assert.NoError(err)
+	_, ok = newGraphSource(db).(*indexSource).entry(ds.HeadRef().TargetHash())
+	assert.True(ok)
+	assert.True(IsAncestor(refs["a"], ds.HeadRef(), db))
+	assert.False(IsAncestor(refs["h"], ds.HeadRef(), db))
+
+	assert.NoError(db.DropCommitGraph())
+	_, ok = newGraphSource(db).(*commitSource)
+	assert.True(ok)
+}
+
+func TestLocalDatabaseCommitGraphIndex(t *testing.T) {
+	testCommitGraphIndex(assert.New(t), NewDatabase(chunks.NewTestStore()))
+}
+
+func TestRemoteDatabaseCommitGraphIndex(t *testing.T) {
+	hbs := NewHTTPBatchStoreForTest(chunks.NewTestStore())
+	testCommitGraphIndex(assert.New(t), &RemoteDatabaseClient{newDatabaseCommon(newCachingChunkHaver(hbs), types.NewValueStore(hbs), hbs)})
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+// buildGraph writes a commit graph in which a <- b <- c <- d and b <- e <- f
+// are lines of history, g merges f into d, and h merges c into f, so that c
+// and f are both merge bases of g and h. It returns Refs to the commits by
+// name. The commits are dated in alphabetical order.
+func buildGraph(vs types.ValueReadWriter) map[string]types.Ref {
+	refs := map[string]types.Ref{}
+	add := func(name string, parents ...string) {
+		set := types.NewSet()
+		for _, p := range parents {
+			set = set.Insert(refs[p])
+		}
+		meta := types.NewStruct("Meta", types.StructData{"date": types.String(fmt.Sprintf("2016-12-01T10:00:%02d+0000", len(refs)))})
+		refs[name] = vs.WriteValue(NewCommit(types.String(name), set, meta))
+	}
+	add("a")
+	add("b", "a")
+	add("c", "b")
+	add("d", "c")
+	add("e", "b")
+	add("f", "e")
+	add("g", "d", "f")
+	add("h", "f", "c")
+	return refs
+}
+
+func names(refs map[string]types.Ref, rs []types.Ref) []string {
+	byHash := map[hash.Hash]string{}
+	for name, r := range refs {
+		byHash[r.TargetHash()] = name
+	}
+	out := []string{}
+	for _, r := range rs {
+		out = append(out, byHash[r.TargetHash()])
+	}
+	return out
+}
+
+func TestIsAncestor(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	refs := buildGraph(vs)
+
+	assert.True(IsAncestor(refs["a"], refs["g"], vs))
+	assert.True(IsAncestor(refs["f"], refs["g"], vs))
+	assert.True(IsAncestor(refs["c"], refs["h"], vs))
+	assert.True(IsAncestor(refs["d"], refs["d"], vs))
+	assert.False(IsAncestor(refs["d"], refs["h"], vs))
+	assert.False(IsAncestor(refs["g"], refs["a"], vs))
+	assert.False(IsAncestor(refs["e"], refs["d"], vs))
+}
+
+func TestMergeBases(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	refs := buildGraph(vs)
+
+	bases := names(refs, MergeBases(refs["g"], refs["h"], vs))
+	sort.Strings(bases)
+	assert.Equal([]string{"c", "f"}, bases)
+	assert.Equal([]string{"b"}, names(refs, MergeBases(refs["d"], refs["f"], vs)))
+	assert.Equal([]string{"d"}, names(refs, MergeBases(refs["d"], refs["g"], vs)))
+	assert.Equal([]string{"a"}, names(refs, MergeBases(refs["a"], refs["a"], vs)))
+
+	other := vs.WriteValue(NewCommit(types.String("other"), types.NewSet(), types.EmptyStruct))
+	assert.Empty(MergeBases(refs["g"], other, vs))
+}
+
+func TestCommitsBetween(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	refs := buildGraph(vs)
+
+	assert.Equal([]string{"g", "d", "c"}, names(refs, CommitsBetween(refs["f"], refs["g"], vs)))
+	assert.Equal([]string{"h", "f", "e"}, names(refs, CommitsBetween(refs["d"], refs["h"], vs)))
+	assert.Empty(CommitsBetween(refs["g"], refs["d"], vs))
+	// d and f are the same height, but f is newer.
+	assert.Equal([]string{"g", "f", "d", "e", "c", "b", "a"}, names(refs, CommitsBetween(types.Ref{}, refs["g"], vs)))
+}
+
+func TestFirstParentHistory(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	refs := buildGraph(vs)
+
+	assert.Equal([]string{"d", "c", "b", "a"}, names(refs, FirstParentHistory(refs["d"], vs)))
+	assert.Equal([]string{"a"}, names(refs, FirstParentHistory(refs["a"], vs)))
+	assert.Len(FirstParentHistory(refs["g"], vs), 5)
+}
+
+func TestCommitGraphOverDatabase(t *testing.T) {
+	assert := assert.New(t)
+	db := NewDatabase(chunks.NewTestStore())
+	ds1, err := db.CommitValue(db.GetDataset("ds1"), types.String("a"))
+	assert.NoError(err)
+	ds2, err := db.Commit(db.GetDataset("ds2"), types.String("b"), CommitOptions{Parents: types.NewSet(ds1.HeadRef())})
+	assert.NoError(err)
+
+	assert.True(IsAncestor(ds1.HeadRef(), ds2.HeadRef(), db))
+	bases := MergeBases(ds1.HeadRef(), ds2.HeadRef(), db)
+	if assert.Len(bases, 1) {
+		assert.Equal(ds1.HeadRef().TargetHash(), bases[0].TargetHash())
+	}
+	between := CommitsBetween(ds1.HeadRef(), ds2.HeadRef(), db)
+	if assert.Len(between, 1) {
+		assert.Equal(ds2.HeadRef().TargetHash(), between[0].TargetHash())
+	}
+}
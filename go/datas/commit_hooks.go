@@ -0,0 +1,95 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/attic-labs/noms/go/types"
+)
+
+// PreCommitHook is called before the head of the dataset |datasetID| is moved
+// from |currentHead|, which is the zero Ref if the dataset doesn't exist yet,
+// to |commit|. Returning an error vetoes the move, and the error is returned by
+// the Commit(), FastForward() or SetHead() that attempted it. |vr| can be used
+// to read the values that |commit| refers to.
+type PreCommitHook func(vr types.ValueReader, datasetID string, commit types.Struct, currentHead types.Ref) error
+
+// PostCommitHook is called after the head of the dataset |datasetID| has been
+// moved from |previousHead|, which is the zero Ref if the dataset didn't exist,
+// to |commit|.
+type PostCommitHook func(vr types.ValueReader, datasetID string, commit types.Struct, previousHead types.Ref)
+
+// CommitHooks are run whenever a Database moves the head of a dataset, and by a
+// RemoteDatabaseServer whenever a client does. Heads are Refs from the root
+// Map, so they should be compared by TargetHash().
+type CommitHooks struct {
+	PreCommit  []PreCommitHook
+	PostCommit []PostCommitHook
+}
+
+// DatabaseOptions customize the behavior of a Database.
+type DatabaseOptions struct {
+	Hooks CommitHooks
+}
+
+func (hooks CommitHooks) isEmpty() bool {
+	return len(hooks.PreCommit) == 0 && len(hooks.PostCommit) == 0
+}
+
+func (hooks CommitHooks) preCommit(vr types.ValueReader, datasetID string, commit types.Struct, currentHead types.Ref) error {
+	for _, hook := range hooks.PreCommit {
+		if err := hook(vr, datasetID, commit, currentHead); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (hooks CommitHooks) postCommit(vr types.ValueReader, datasetID string, commit types.Struct, previousHead types.Ref) {
+	for _, hook := range hooks.PostCommit {
+		hook(vr, datasetID, commit, previousHead)
+	}
+}
+
+// changedHeads returns a HeadChange for each dataset whose head differs
+// between the root Maps |last| and |current|. Tags are ignored.
+func changedHeads(current, last types.Map) []HeadChange {
+	currentDatasets, lastDatasets := datasetsFromRoot(current), datasetsFromRoot(last)
+	diffChan := make(chan types.ValueChanged)
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	go func() {
+		defer close(diffChan)
+		currentDatasets.Diff(lastDatasets, diffChan, stopChan)
+	}()
+
+	changes := []HeadChange{}
+	for vc := range diffChan {
+		change := HeadChange{DatasetID: string(vc.V.(types.String))}
+		if r, ok := lastDatasets.MaybeGet(vc.V); ok {
+			change.OldHead = r.(types.Ref)
+		}
+		if r, ok := currentDatasets.MaybeGet(vc.V); ok {
+			change.NewHead = r.(types.Ref)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+type commitHooksKey struct{}
+
+// withCommitHooks returns a copy of |req| that carries |hooks|, for
+// handleRootPost to run.
+func withCommitHooks(req *http.Request, hooks CommitHooks) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), commitHooksKey{}, hooks))
+}
+
+func commitHooksFromRequest(req *http.Request) CommitHooks {
+	hooks, _ := req.Context().Value(commitHooksKey{}).(CommitHooks)
+	return hooks
+}
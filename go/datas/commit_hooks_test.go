@@ -0,0 +1,99 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+// hookRecorder vetoes commits whose value is types.String("veto"), and records
+// the HeadChanges that its post-commit hook sees.
+type hookRecorder struct {
+	changes []HeadChange
+}
+
+func (r *hookRecorder) hooks() CommitHooks {
+	return CommitHooks{
+		PreCommit: []PreCommitHook{func(vr types.ValueReader, datasetID string, commit types.Struct, currentHead types.Ref) error {
+			if commit.Get(ValueField).Equals(types.String("veto")) {
+				return errors.New("vetoed")
+			}
+			return nil
+		}},
+		PostCommit: []PostCommitHook{func(vr types.ValueReader, datasetID string, commit types.Struct, previousHead types.Ref) {
+			r.changes = append(r.changes, HeadChange{datasetID, previousHead, types.NewRef(commit)})
+		}},
+	}
+}
+
+func (r *hookRecorder) assertLastChange(assert *assert.Assertions, datasetID string, oldHead, newHead types.Ref) {
+	if assert.NotEmpty(r.changes) {
+		change := r.changes[len(r.changes)-1]
+		assert.Equal(datasetID, change.DatasetID)
+		assert.Equal(oldHead.TargetHash(), change.OldHead.TargetHash())
+		assert.Equal(newHead.TargetHash(), change.NewHead.TargetHash())
+	}
+}
+
+func testCommitHooks(assert *assert.Assertions, db Database, r *hookRecorder) {
+	ds, err := db.CommitValue(db.GetDataset("ds1"), types.String("a"))
+	assert.NoError(err)
+	first := ds.HeadRef()
+	r.assertLastChange(assert, "ds1", types.Ref{}, first)
+
+	ds, err = db.CommitValue(ds, types.String("b"))
+	assert.NoError(err)
+	second := ds.HeadRef()
+	r.assertLastChange(assert, "ds1", first, second)
+	assert.Len(r.changes, 2)
+
+	_, err = db.CommitValue(ds, types.String("veto"))
+	assert.Error(err)
+	assert.Contains(err.Error(), "vetoed")
+	assert.True(second.Equals(db.GetDataset("ds1").HeadRef()))
+
+	vetoed := db.WriteValue(NewCommit(types.String("veto"), types.NewSet(second), types.EmptyStruct))
+	_, err = db.FastForward(ds, vetoed)
+	assert.Error(err)
+	_, err = db.SetHead(ds, vetoed)
+	assert.Error(err)
+	assert.True(second.Equals(db.GetDataset("ds1").HeadRef()))
+	assert.Len(r.changes, 2)
+
+	ds, err = db.SetHead(ds, first)
+	assert.NoError(err)
+	r.assertLastChange(assert, "ds1", second, first)
+}
+
+func TestLocalDatabaseCommitHooks(t *testing.T) {
+	r := &hookRecorder{}
+	testCommitHooks(assert.New(t), NewDatabaseOpts(chunks.NewTestStore(), DatabaseOptions{r.hooks()}), r)
+}
+
+func TestRemoteDatabaseServerCommitHooks(t *testing.T) {
+	assert := assert.New(t)
+	r := &hookRecorder{}
+	server := NewRemoteDatabaseServer(chunks.NewMemoryStore(), 0)
+	server.Hooks = r.hooks()
+	ready := make(chan struct{})
+	server.Ready = func() { close(ready) }
+	go server.Run()
+	defer server.Stop()
+	<-ready
+
+	db := NewRemoteDatabase(fmt.Sprintf("http://localhost:%d", server.Port()), "")
+	testCommitHooks(assert, db, r)
+
+	_, err := db.CommitValue(db.GetDataset("ds2"), types.String("veto"))
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "Root update refused")
+	}
+}
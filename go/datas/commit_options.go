@@ -25,3 +25,11 @@ type CommitOptions struct {
 	// might also be called multiple times with different values.
 	Policy merge.Policy
 }
+
+// DatasetCommit describes one of the Commits made by CommitMany: the Value and
+// CommitOptions to commit to Dataset, just as if they were passed to Commit.
+type DatasetCommit struct {
+	Dataset Dataset
+	Value   types.Value
+	Options CommitOptions
+}
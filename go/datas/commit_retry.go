@@ -0,0 +1,86 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"time"
+
+	"github.com/attic-labs/noms/go/merge"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/jpillora/backoff"
+)
+
+// DefaultCommitAttempts is how many times CommitWithRetry tries to commit if
+// RetryOptions.MaxAttempts isn't set.
+const DefaultCommitAttempts = 10
+
+// RetryOptions is used to pass options into CommitWithRetry.
+type RetryOptions struct {
+	// Meta is used as the Meta of the Commit, as in CommitOptions.
+	Meta types.Struct
+
+	// Resolve, if provided, is used to merge the new value with the head of
+	// the Dataset if another writer has moved it in the meantime, using
+	// merge.ThreeWay. Changes in the new value are passed to it as |a| and
+	// those made by the other writer as |b|. If Resolve is nil, or can't
+	// resolve a conflict, the update is redone on top of the new head.
+	Resolve merge.ResolveFunc
+
+	// MaxAttempts is how many times to try to commit before giving up. If
+	// it's 0, DefaultCommitAttempts is used.
+	MaxAttempts int
+
+	// MinBackoff and MaxBackoff bound how long to wait between attempts. The
+	// wait starts at MinBackoff, then doubles, with some jitter, up to
+	// MaxBackoff. If they're 0, 10ms and 1s are used.
+	MinBackoff, MaxBackoff time.Duration
+}
+
+// CommitWithRetry commits the result of calling |update| with the value at the
+// head of |ds|, or nil if |ds| has no head yet, to |ds|. If another writer
+// moves the head in the meantime, the new value is merged with it as described
+// by opts.Resolve, or failing that, |update| is called again with the new head
+// and the commit retried, after a short wait. If |update| returns an error, or
+// committing fails for any other reason or opts.MaxAttempts times, that error
+// is returned. The newest snapshot of the Dataset is always returned.
+func CommitWithRetry(db Database, ds Dataset, update func(head types.Value) (types.Value, error), opts RetryOptions) (Dataset, error) {
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = DefaultCommitAttempts
+	}
+	b := &backoff.Backoff{
+		Min:    opts.MinBackoff,
+		Max:    opts.MaxBackoff,
+		Factor: 2,
+		Jitter: true,
+	}
+	if b.Min == 0 {
+		b.Min = 10 * time.Millisecond
+	}
+	if b.Max == 0 {
+		b.Max = time.Second
+	}
+	commitOpts := CommitOptions{Meta: opts.Meta}
+	if opts.Resolve != nil {
+		commitOpts.Policy = merge.NewThreeWay(opts.Resolve)
+	}
+
+	for attempt := 1; ; attempt++ {
+		var head types.Value
+		if c, ok := ds.MaybeHead(); ok {
+			head = c.Get(ValueField)
+		}
+		v, err := update(head)
+		if err != nil {
+			return ds, err
+		}
+
+		ds, err = db.Commit(ds, v, commitOpts)
+		if _, conflict := err.(*merge.ErrMergeConflict); (err != ErrMergeNeeded && !conflict) || attempt == maxAttempts {
+			return ds, err
+		}
+		time.Sleep(b.Duration())
+	}
+}
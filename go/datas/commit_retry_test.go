@@ -0,0 +1,81 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/merge"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+// concurrentSet returns an update func for CommitWithRetry that sets |k| to
+// |v| in the Map at the head, after the first |interruptions| of its calls
+// have had another writer to |cs| increment the key "other" in the meantime.
+func concurrentSet(assert *assert.Assertions, cs chunks.ChunkStore, k, v string, interruptions int, calls *int) func(types.Value) (types.Value, error) {
+	return func(head types.Value) (types.Value, error) {
+		*calls++
+		if *calls <= interruptions {
+			other := NewDatabase(cs)
+			ds := other.GetDataset("ds")
+			m := ds.HeadValue().(types.Map)
+			n, _ := m.MaybeGet(types.String("other"))
+			if n == nil {
+				n = types.Number(0)
+			}
+			_, err := other.CommitValue(ds, m.Set(types.String("other"), n.(types.Number)+1))
+			assert.NoError(err)
+		}
+		return head.(types.Map).Set(types.String(k), types.String(v)), nil
+	}
+}
+
+func TestCommitWithRetry(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	db := NewDatabase(cs)
+	opts := RetryOptions{MinBackoff: 1, MaxBackoff: 1}
+
+	calls := 0
+	ds, err := CommitWithRetry(db, db.GetDataset("ds"), func(head types.Value) (types.Value, error) {
+		calls++
+		assert.Nil(head)
+		return types.NewMap(), nil
+	}, opts)
+	assert.NoError(err)
+	assert.Equal(1, calls)
+
+	// Without a ResolveFunc, the update is redone on top of the new head.
+	calls = 0
+	ds, err = CommitWithRetry(db, ds, concurrentSet(assert, cs, "a", "1", 2, &calls), opts)
+	assert.NoError(err)
+	assert.Equal(3, calls)
+	assert.True(types.NewMap(types.String("a"), types.String("1"), types.String("other"), types.Number(2)).Equals(ds.HeadValue()))
+
+	// With one, it's merged.
+	calls = 0
+	opts.Resolve = merge.Ours
+	ds, err = CommitWithRetry(db, ds, concurrentSet(assert, cs, "b", "2", 1, &calls), opts)
+	assert.NoError(err)
+	assert.Equal(1, calls)
+	assert.True(types.NewMap(types.String("a"), types.String("1"), types.String("b"), types.String("2"), types.String("other"), types.Number(3)).Equals(ds.HeadValue()))
+
+	// Unresolved conflicts are retried too, up to MaxAttempts times.
+	calls = 0
+	opts.Resolve, opts.MaxAttempts = merge.None, 3
+	ds, err = CommitWithRetry(db, ds, concurrentSet(assert, cs, "other", "mine", 5, &calls), opts)
+	assert.IsType(&merge.ErrMergeConflict{}, err)
+	assert.Equal(3, calls)
+	assert.True(types.Number(6).Equals(ds.HeadValue().(types.Map).Get(types.String("other"))))
+
+	errUpdate := errors.New("update failed")
+	_, err = CommitWithRetry(db, ds, func(head types.Value) (types.Value, error) {
+		return nil, errUpdate
+	}, opts)
+	assert.Equal(errUpdate, err)
+}
@@ -31,11 +31,20 @@ type Database interface {
 	io.Closer
 
 	// Datasets returns the root of the database which is a
-	// Map<String, Ref<Commit>> where string is a datasetID.
+	// Map<String, Ref<Commit>> where string is a datasetID. Tags, schemas and
+	// the commit-graph index, which are stored alongside datasets in the
+	// root, are not included.
 	Datasets() types.Map
 
+	// Tags returns the tags in the database as a Map<String, Ref<Tag>>, where
+	// string is the name of the tag.
+	Tags() types.Map
+
 	// GetDataset returns a Dataset struct containing the current mapping of
-	// datasetID in the above Datasets Map.
+	// datasetID in the above Datasets Map. If datasetID is a tag name
+	// preceded by TagPrefix, the returned Dataset refers to the tagged
+	// Commit and can't be moved: Commit(), Delete(), SetHead() and
+	// FastForward() all fail with 'ErrTagImmutable'.
 	GetDataset(datasetID string) Dataset
 
 	// Commit updates the Commit that ds.ID() in this database points at. All
@@ -63,6 +72,16 @@ type Database interface {
 	// of a conflict, Commit returns an 'ErrMergeNeeded' error.
 	CommitValue(ds Dataset, v types.Value) (Dataset, error)
 
+	// CommitMany is like Commit, but makes a Commit in each of several
+	// Datasets with a single update to the root of the Database, so that
+	// either all of them are made or, if any of them can't be, none are.
+	// In particular, if the head of any of the Datasets has moved since it
+	// was read, and its Options have no Policy to merge with it, CommitMany
+	// returns an 'ErrMergeNeeded' error. Each Dataset may appear only once.
+	// The newest snapshots of the Datasets are always returned, in the same
+	// order as commits.
+	CommitMany(commits []DatasetCommit) ([]Dataset, error)
+
 	// Delete removes the Dataset named ds.ID() from the map at the root of
 	// the Database. The Dataset data is not necessarily cleaned up at this
 	// time, but may be garbage collected in the future.
@@ -84,6 +103,12 @@ type Database interface {
 	// Regardless, Datasets() is updated to match backing storage upon return.
 	SetHead(ds Dataset, newHeadRef types.Ref) (Dataset, error)
 
+	// CompareAndSetHead is like SetHead, but only moves the Head of ds if
+	// it's still the one ds was read with, so that commits made in the
+	// meantime aren't lost. Otherwise it returns an 'ErrMergeNeeded' error.
+	// Tools that rewrite history, like noms rebase, use it.
+	CompareAndSetHead(ds Dataset, newHeadRef types.Ref) (Dataset, error)
+
 	// FastForward takes a types.Ref to a Commit object and makes it the new
 	// Head of ds iff it is a descendant of the current Head. Intended to be
 	// used e.g. after a call to Pull(). If the update cannot be performed,
@@ -94,6 +119,55 @@ type Database interface {
 	// Regardless, Datasets() is updated to match backing storage upon return.
 	FastForward(ds Dataset, newHeadRef types.Ref) (Dataset, error)
 
+	// CreateTag adds an immutable tag called name, pointing at the Commit
+	// referenced by commitRef and annotated with meta. If meta is the zero
+	// value (types.Struct{}), then a fully initialized empty Struct is used.
+	// If there's already a tag with the same name, CreateTag returns an
+	// 'ErrTagExists' error.
+	CreateTag(name string, commitRef types.Ref, meta types.Struct) error
+
+	// DeleteTag removes the tag called name. If there's no such tag,
+	// DeleteTag returns an 'ErrTagNotFound' error.
+	DeleteTag(name string) error
+
+	// Schema returns the Type that the values committed to the dataset
+	// datasetID must be a subtype of, or nil if there's no such requirement.
+	Schema(datasetID string) *types.Type
+
+	// SetSchema requires the values committed to the dataset datasetID from
+	// now on to be subtypes of schema, or lifts the requirement if schema is
+	// nil. Commit(), SetHead() and FastForward() then fail with a
+	// SchemaError if the value of the new head wouldn't be. So does
+	// SetSchema() if the value of the current head isn't.
+	SetSchema(datasetID string, schema *types.Type) error
+
+	// BuildCommitGraph adds a commit-graph index to the database, or brings
+	// the one it has up to date with the datasets, e.g. after clients that
+	// don't maintain it have moved them. See CommitGraphKey. From then on,
+	// the index is updated whenever a dataset moves, and used instead of
+	// reading Commits by walks of the commit graph such as
+	// FindCommonAncestor() and MergeBases() on this database.
+	BuildCommitGraph() error
+
+	// DropCommitGraph removes the commit-graph index from the database, if
+	// it has one.
+	DropCommitGraph() error
+
+	// Watch sends a HeadChange on changes whenever the head of one of the
+	// datasets in datasetIDs, or of any dataset if there are none, moves
+	// after Watch is called. It blocks until closeChan is closed, and then
+	// returns nil, or until it can no longer follow the database, e.g.
+	// because the connection to a remote database was lost, and then returns
+	// the reason why.
+	Watch(changes chan<- HeadChange, closeChan <-chan struct{}, datasetIDs ...string) error
+
+	// Fsck walks every chunk reachable from the root of the database and
+	// checks that it is present, intact and consistent with the Refs that
+	// point to it, and that every dataset head and parent is a Commit. The
+	// tables of local databases backed by a NomsBlockStore are verified too.
+	// It returns a report of the problems it found, if any.
+	Fsck() FsckReport
+
 	// validatingBatchStore returns the BatchStore used to read and write
 	// groups of values to the database efficiently. This interface is a low-
 	// level detail of the database that should infrequently be needed by
@@ -106,3 +180,11 @@ type Database interface {
 func NewDatabase(cs chunks.ChunkStore) Database {
 	return newLocalDatabase(cs)
 }
+
+// NewDatabaseOpts is like NewDatabase, but customizes the Database with
+// |opts|, e.g. to run CommitHooks.
+func NewDatabaseOpts(cs chunks.ChunkStore, opts DatabaseOptions) Database {
+	ldb := newLocalDatabase(cs)
+	ldb.hooks = opts.Hooks
+	return ldb
+}
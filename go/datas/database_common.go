@@ -6,6 +6,9 @@ package datas
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/d"
@@ -18,7 +21,10 @@ type databaseCommon struct {
 	*types.ValueStore
 	cch      *cachingChunkHaver
 	rt       chunks.RootTracker
+	rl       chunks.RootLogger // if non-nil, successful root updates are logged here
+	hooks    CommitHooks
 	rootHash hash.Hash
+	root     *types.Map
 	datasets *types.Map
 }
 
@@ -31,25 +37,49 @@ func newDatabaseCommon(cch *cachingChunkHaver, vs *types.ValueStore, rt chunks.R
 	return databaseCommon{ValueStore: vs, cch: cch, rt: rt, rootHash: rt.Root()}
 }
 
-func (dbc *databaseCommon) Datasets() types.Map {
-	if dbc.datasets == nil {
+// rootMap returns the Map at the root of the database, which holds the
+// datasets, tags and schemas, and the commit-graph index if there is one.
+func (dbc *databaseCommon) rootMap() types.Map {
+	if dbc.root == nil {
 		if dbc.rootHash.IsEmpty() {
 			emptyMap := types.NewMap()
-			dbc.datasets = &emptyMap
+			dbc.root = &emptyMap
 		} else {
-			dbc.datasets = dbc.datasetsFromRef(dbc.rootHash)
+			dbc.root = dbc.datasetsFromRef(dbc.rootHash)
 		}
 	}
 
+	return *dbc.root
+}
+
+func (dbc *databaseCommon) Datasets() types.Map {
+	if dbc.datasets == nil {
+		datasets := datasetsFromRoot(dbc.rootMap())
+		dbc.datasets = &datasets
+	}
+
 	return *dbc.datasets
 }
 
+func (dbc *databaseCommon) Tags() types.Map {
+	return tagsFromRoot(dbc.rootMap())
+}
+
 func (dbc *databaseCommon) datasetsFromRef(datasetsRef hash.Hash) *types.Map {
 	c := dbc.ReadValue(datasetsRef).(types.Map)
 	return &c
 }
 
+// resetRoot discards the cached root Map, so that it's reread from the
+// RootTracker when next needed.
+func (dbc *databaseCommon) resetRoot() {
+	dbc.rootHash, dbc.root, dbc.datasets = dbc.rt.Root(), nil, nil
+}
+
 func getDataset(db Database, datasetID string) Dataset {
+	if IsTagID(datasetID) {
+		return getTagDataset(db, datasetID)
+	}
 	if !DatasetFullRe.MatchString(datasetID) {
 		d.Panic("Invalid dataset ID: %s", datasetID)
 	}
@@ -69,21 +99,51 @@ func (dbc *databaseCommon) Close() error {
 	return dbc.ValueStore.Close()
 }
 
-func (dbc *databaseCommon) doSetHead(ds Dataset, newHeadRef types.Ref) error {
-	if currentHeadRef, ok := ds.MaybeHeadRef(); ok && newHeadRef == currentHeadRef {
-		return nil
+// doSetHead makes |newHeadRef| the Head of |ds|, retrying if another process updates the root in the meantime. If |onlyIfUnchanged| is set, it instead returns an 'ErrMergeNeeded' error if the Head is no longer the one |ds| was read with.
+func (dbc *databaseCommon) doSetHead(ds Dataset, newHeadRef types.Ref, onlyIfUnchanged bool) error {
+	if IsTagID(ds.ID()) {
+		return ErrTagImmutable
 	}
 	commit := dbc.validateRefAsCommit(newHeadRef)
-	defer func() { dbc.rootHash, dbc.datasets = dbc.rt.Root(), nil }()
+	defer dbc.resetRoot()
 
-	currentRootHash, currentDatasets := dbc.getRootAndDatasets()
-	commitRef := dbc.WriteValue(commit) // will be orphaned if the tryUpdateRoot() below fails
+	var err error
+	for err = ErrOptimisticLockFailed; err == ErrOptimisticLockFailed; {
+		currentRootHash, currentDatasets := dbc.getRootAndDatasets()
+		var currentHead types.Ref
+		r, hasHead := currentDatasets.MaybeGet(types.String(ds.ID()))
+		if hasHead {
+			currentHead = r.(types.Ref)
+		}
+		if onlyIfUnchanged {
+			if headRef, ok := ds.MaybeHeadRef(); ok != hasHead || (ok && headRef.TargetHash() != currentHead.TargetHash()) {
+				return ErrMergeNeeded
+			}
+		}
+		if hasHead && currentHead.TargetHash() == newHeadRef.TargetHash() {
+			return nil
+		}
+		if err = checkSchema(ds.ID(), schemaFromRoot(dbc, currentDatasets, ds.ID()), commit); err != nil {
+			return err
+		}
+		if err = dbc.hooks.preCommit(dbc, ds.ID(), commit, currentHead); err != nil {
+			return err
+		}
+		commitRef := dbc.WriteValue(commit) // will be orphaned if the tryUpdateRoot() below fails
 
-	currentDatasets = currentDatasets.Set(types.String(ds.ID()), types.ToRefOfValue(commitRef))
-	return dbc.tryUpdateRoot(currentDatasets, currentRootHash)
+		currentDatasets = currentDatasets.Set(types.String(ds.ID()), types.ToRefOfValue(commitRef))
+		err = dbc.tryUpdateRoot(currentDatasets, currentRootHash, fmt.Sprintf("set-head %s %s", ds.ID(), commitRef.TargetHash()))
+		if err == nil {
+			dbc.hooks.postCommit(dbc, ds.ID(), commit, currentHead)
+		}
+	}
+	return err
 }
 
 func (dbc *databaseCommon) doFastForward(ds Dataset, newHeadRef types.Ref) error {
+	if IsTagID(ds.ID()) {
+		return ErrTagImmutable
+	}
 	if currentHeadRef, ok := ds.MaybeHeadRef(); ok && newHeadRef == currentHeadRef {
 		return nil
 	} else if newHeadRef.Height() <= currentHeadRef.Height() {
@@ -91,61 +151,150 @@ func (dbc *databaseCommon) doFastForward(ds Dataset, newHeadRef types.Ref) error
 	}
 
 	commit := dbc.validateRefAsCommit(newHeadRef)
-	return dbc.doCommit(ds.ID(), commit, nil)
+	return dbc.doCommit(ds.ID(), commit, nil, "fast-forward")
 }
 
 // doCommit manages concurrent access the single logical piece of mutable state: the current Root. doCommit is optimistic in that it is attempting to update head making the assumption that currentRootHash is the hash of the current head. The call to UpdateRoot below will return an 'ErrOptimisticLockFailed' error if that assumption fails (e.g. because of a race with another writer) and the entire algorithm must be tried again. This method will also fail and return an 'ErrMergeNeeded' error if the |commit| is not a descendent of the current dataset head
-func (dbc *databaseCommon) doCommit(datasetID string, commit types.Struct, mergePolicy merge.Policy) error {
+func (dbc *databaseCommon) doCommit(datasetID string, commit types.Struct, mergePolicy merge.Policy, reason string) error {
 	if !IsCommitType(commit.Type()) {
 		d.Panic("Can't commit a non-Commit struct to dataset %s", datasetID)
 	}
-	defer func() { dbc.rootHash, dbc.datasets = dbc.rt.Root(), nil }()
+	if IsTagID(datasetID) {
+		return ErrTagImmutable
+	}
+	defer dbc.resetRoot()
 
 	// This could loop forever, given enough simultaneous committers. BUG 2565
 	var err error
+	var newHead types.Struct
+	var currentHead types.Ref
 	for err = ErrOptimisticLockFailed; err == ErrOptimisticLockFailed; {
 		currentRootHash, currentDatasets := dbc.getRootAndDatasets()
-		commitRef := dbc.WriteValue(commit) // will be orphaned if the tryUpdateRoot() below fails
+		var commitRef types.Ref
+		newHead, commitRef, currentHead, err = dbc.prepareCommit(currentDatasets, datasetID, commit, mergePolicy)
+		if err != nil {
+			return err
+		}
+		currentDatasets = currentDatasets.Set(types.String(datasetID), types.ToRefOfValue(commitRef))
+		err = dbc.tryUpdateRoot(currentDatasets, currentRootHash, fmt.Sprintf("%s %s %s", reason, datasetID, commitRef.TargetHash()))
+	}
+	if err == nil {
+		dbc.hooks.postCommit(dbc, datasetID, newHead, currentHead)
+	}
+	return err
+}
+
+// prepareCommit works out what the head of |datasetID| in |currentDatasets| should become when |commit| is committed to it, merging with the current head using |mergePolicy| if |commit| doesn't descend from it, and writes it. It fails with 'ErrMergeNeeded' if that isn't possible, and with the reason why if the new head doesn't match the dataset's schema or is vetoed by a PreCommitHook. It returns the new head, a Ref to it and the current head, which is the zero Ref if the dataset doesn't exist yet.
+func (dbc *databaseCommon) prepareCommit(currentDatasets types.Map, datasetID string, commit types.Struct, mergePolicy merge.Policy) (newHead types.Struct, commitRef, currentHead types.Ref, err error) {
+	commitRef = dbc.WriteValue(commit) // will be orphaned if the tryUpdateRoot() that follows fails
+	newHead = commit
+
+	// First commit in dataset is always fast-forward, so go through all this iff there's already a Head for datasetID.
+	if r, hasHead := currentDatasets.MaybeGet(types.String(datasetID)); hasHead {
+		currentHead = r.(types.Ref)
+		head := r.(types.Ref).TargetValue(dbc)
+		currentHeadRef := types.NewRef(head)
+		ancestorRef, found := FindCommonAncestor(commitRef, currentHeadRef, dbc)
+		if !found {
+			err = ErrMergeNeeded
+			return
+		}
+
+		// This covers all cases where currentHeadRef is not an ancestor of commit, including the following edge cases:
+		//   - commit is a duplicate of currentHead.
+		//   - we hit an ErrOptimisticLockFailed and looped back around because some other process changed the Head out from under us.
+		if !currentHeadRef.Equals(ancestorRef) || currentHeadRef.Equals(commitRef) {
+			if mergePolicy == nil {
+				err = ErrMergeNeeded
+				return
+			}
 
-		// If there's nothing in the DB yet, skip all this logic.
-		if !currentRootHash.IsEmpty() {
-			r, hasHead := currentDatasets.MaybeGet(types.String(datasetID))
-
-			// First commit in dataset is always fast-forward, so go through all this iff there's already a Head for datasetID.
-			if hasHead {
-				head := r.(types.Ref).TargetValue(dbc)
-				currentHeadRef := types.NewRef(head)
-				ancestorRef, found := FindCommonAncestor(commitRef, currentHeadRef, dbc)
-				if !found {
-					return ErrMergeNeeded
-				}
-
-				// This covers all cases where currentHeadRef is not an ancestor of commit, including the following edge cases:
-				//   - commit is a duplicate of currentHead.
-				//   - we hit an ErrOptimisticLockFailed and looped back around because some other process changed the Head out from under us.
-				if !currentHeadRef.Equals(ancestorRef) || currentHeadRef.Equals(commitRef) {
-					if mergePolicy == nil {
-						return ErrMergeNeeded
-					}
-
-					ancestor, currentHead := dbc.validateRefAsCommit(ancestorRef), dbc.validateRefAsCommit(currentHeadRef)
-					merged, err := mergePolicy(commit.Get(ValueField), currentHead.Get(ValueField), ancestor.Get(ValueField), dbc, nil)
-					if err != nil {
-						return err
-					}
-					commitRef = dbc.WriteValue(NewCommit(merged, types.NewSet(commitRef, currentHeadRef), types.EmptyStruct))
-				}
+			ancestor, headCommit := dbc.validateRefAsCommit(ancestorRef), dbc.validateRefAsCommit(currentHeadRef)
+			var merged types.Value
+			if merged, err = mergePolicy(commit.Get(ValueField), headCommit.Get(ValueField), ancestor.Get(ValueField), dbc, nil); err != nil {
+				return
 			}
+			newHead = NewCommit(merged, types.NewSet(commitRef, currentHeadRef), types.EmptyStruct)
+			commitRef = dbc.WriteValue(newHead)
+		}
+	}
+	if err = checkSchema(datasetID, schemaFromRoot(dbc, currentDatasets, datasetID), newHead); err == nil {
+		err = dbc.hooks.preCommit(dbc, datasetID, newHead, currentHead)
+	}
+	return
+}
+
+// doCommitMany is like doCommit, but commits to several datasets with a single update of the root, so that either all of the commits are made or none are. It fails if any one of them would, e.g. with 'ErrMergeNeeded' if the head of any of the datasets has moved to somewhere the commit for it doesn't descend from.
+func (dbc *databaseCommon) doCommitMany(commits []datasetCommit, reason string) error {
+	ids := map[string]bool{}
+	for _, c := range commits {
+		if !IsCommitType(c.commit.Type()) {
+			d.Panic("Can't commit a non-Commit struct to dataset %s", c.datasetID)
+		}
+		if ids[c.datasetID] {
+			d.Panic("Can't commit to dataset %s more than once at a time", c.datasetID)
+		}
+		if IsTagID(c.datasetID) {
+			return ErrTagImmutable
+		}
+		ids[c.datasetID] = true
+	}
+	defer dbc.resetRoot()
+
+	var err error
+	newHeads, currentHeads := make([]types.Struct, len(commits)), make([]types.Ref, len(commits))
+	for err = ErrOptimisticLockFailed; err == ErrOptimisticLockFailed; {
+		currentRootHash, currentDatasets := dbc.getRootAndDatasets()
+		newDatasets := currentDatasets
+		reasons := []string{reason}
+		for i, c := range commits {
+			var commitRef types.Ref
+			newHeads[i], commitRef, currentHeads[i], err = dbc.prepareCommit(currentDatasets, c.datasetID, c.commit, c.mergePolicy)
+			if err != nil {
+				return err
+			}
+			newDatasets = newDatasets.Set(types.String(c.datasetID), types.ToRefOfValue(commitRef))
+			reasons = append(reasons, c.datasetID, commitRef.TargetHash().String())
+		}
+		err = dbc.tryUpdateRoot(newDatasets, currentRootHash, strings.Join(reasons, " "))
+	}
+	if err == nil {
+		for i, c := range commits {
+			dbc.hooks.postCommit(dbc, c.datasetID, newHeads[i], currentHeads[i])
 		}
-		currentDatasets = currentDatasets.Set(types.String(datasetID), types.ToRefOfValue(commitRef))
-		err = dbc.tryUpdateRoot(currentDatasets, currentRootHash)
 	}
 	return err
 }
 
+// datasetCommit is one of the commits made by doCommitMany().
+type datasetCommit struct {
+	datasetID   string
+	commit      types.Struct
+	mergePolicy merge.Policy
+}
+
+func buildDatasetCommits(commits []DatasetCommit) []datasetCommit {
+	built := make([]datasetCommit, len(commits))
+	for i, c := range commits {
+		built[i] = datasetCommit{c.Dataset.ID(), buildNewCommit(c.Dataset, c.Value, c.Options), c.Options.Policy}
+	}
+	return built
+}
+
+func getDatasets(db Database, commits []DatasetCommit) []Dataset {
+	datasets := make([]Dataset, len(commits))
+	for i, c := range commits {
+		datasets[i] = db.GetDataset(c.Dataset.ID())
+	}
+	return datasets
+}
+
 // doDelete manages concurrent access the single logical piece of mutable state: the current Root. doDelete is optimistic in that it is attempting to update head making the assumption that currentRootHash is the hash of the current head. The call to UpdateRoot below will return an 'ErrOptimisticLockFailed' error if that assumption fails (e.g. because of a race with another writer) and the entire algorithm must be tried again.
 func (dbc *databaseCommon) doDelete(datasetIDstr string) error {
-	defer func() { dbc.rootHash, dbc.datasets = dbc.rt.Root(), nil }()
+	if IsTagID(datasetIDstr) {
+		return ErrTagImmutable
+	}
+	defer dbc.resetRoot()
 
 	datasetID := types.String(datasetIDstr)
 	currentRootHash, currentDatasets := dbc.getRootAndDatasets()
@@ -159,7 +308,7 @@ func (dbc *databaseCommon) doDelete(datasetIDstr string) error {
 	var err error
 	for {
 		currentDatasets = currentDatasets.Remove(datasetID)
-		err = dbc.tryUpdateRoot(currentDatasets, currentRootHash)
+		err = dbc.tryUpdateRoot(currentDatasets, currentRootHash, fmt.Sprintf("delete %s %s", datasetIDstr, initialHead.TargetHash()))
 		if err != ErrOptimisticLockFailed {
 			break
 		}
@@ -175,7 +324,7 @@ func (dbc *databaseCommon) doDelete(datasetIDstr string) error {
 
 func (dbc *databaseCommon) getRootAndDatasets() (currentRootHash hash.Hash, currentDatasets types.Map) {
 	currentRootHash = dbc.rt.Root()
-	currentDatasets = dbc.Datasets()
+	currentDatasets = dbc.rootMap()
 
 	if currentRootHash != currentDatasets.Hash() && !currentRootHash.IsEmpty() {
 		// The root has been advanced.
@@ -184,13 +333,33 @@ func (dbc *databaseCommon) getRootAndDatasets() (currentRootHash hash.Hash, curr
 	return
 }
 
-func (dbc *databaseCommon) tryUpdateRoot(currentDatasets types.Map, currentRootHash hash.Hash) (err error) {
+// reasonedRootTracker is implemented by RootTrackers that can pass the reason
+// for a root update along to a RootLogger elsewhere, e.g. on the other end of
+// an HTTP connection.
+type reasonedRootTracker interface {
+	// updateRootWithReason returns ErrOptimisticLockFailed if |last| is no
+	// longer the root, or another error if the update was refused.
+	updateRootWithReason(current, last hash.Hash, reason string) error
+}
+
+// tryUpdateRoot attempts to make |currentDatasets| the new root of the
+// database. If the update succeeds and the database keeps a log of root
+// transitions, it's recorded there along with |reason|. If the database has a
+// commit-graph index, the Commits that datasets move to are added to it first.
+func (dbc *databaseCommon) tryUpdateRoot(currentDatasets types.Map, currentRootHash hash.Hash, reason string) (err error) {
+	currentDatasets = dbc.updateCommitGraph(currentDatasets, currentRootHash)
 	// TODO: This Map will be orphaned if the UpdateRoot below fails
 	newRootHash := dbc.WriteValue(currentDatasets).TargetHash()
 	dbc.Flush(newRootHash)
 	// If the root has been updated by another process in the short window since we read it, this call will fail. See issue #404
+	if rrt, ok := dbc.rt.(reasonedRootTracker); ok {
+		return rrt.updateRootWithReason(newRootHash, currentRootHash, reason)
+	}
 	if !dbc.rt.UpdateRoot(newRootHash, currentRootHash) {
-		err = ErrOptimisticLockFailed
+		return ErrOptimisticLockFailed
+	}
+	if dbc.rl != nil {
+		dbc.rl.LogRoot(chunks.RootLogEntry{Time: time.Now(), From: currentRootHash, To: newRootHash, Reason: reason})
 	}
 	return
 }
@@ -5,6 +5,7 @@
 package datas
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/constants"
 	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -29,6 +31,23 @@ type RemoteDatabaseServer struct {
 	closing bool
 	// Called just before the server is started.
 	Ready func()
+	// If set, every request other than a CORS pre-flight must come from a
+	// client that Auth recognizes. By default, anyone can read and write.
+	Auth Authenticator
+	// If set, the server only accepts TLS connections, configured by
+	// TLSConfig. See NewServerTLSConfig().
+	TLSConfig *tls.Config
+	// If set, the server refuses to write chunks or update the root.
+	ReadOnly bool
+	// If non-empty, the server is read-only and only exposes the datasets
+	// (and tags) whose IDs match one of these path.Match patterns: its root
+	// only holds those datasets, and it refuses to serve chunks that aren't
+	// reachable from them.
+	Datasets []string
+	// Hooks are run whenever a client moves the heads of datasets. A
+	// PreCommitHook that returns an error makes the server refuse the root
+	// update, and its error is returned to the client.
+	Hooks CommitHooks
 }
 
 func NewRemoteDatabaseServer(cs chunks.ChunkStore, port int) *RemoteDatabaseServer {
@@ -37,7 +56,7 @@ func NewRemoteDatabaseServer(cs chunks.ChunkStore, port int) *RemoteDatabaseServ
 		d.Panic("SDK version %s is incompatible with data of version %s", constants.NomsVersion, dataVersion)
 	}
 	return &RemoteDatabaseServer{
-		cs, port, nil, make(chan *connectionState, 16), false, func() {},
+		cs, port, nil, make(chan *connectionState, 16), false, func() {}, nil, nil, false, nil, CommitHooks{},
 	}
 }
 
@@ -51,6 +70,9 @@ func (s *RemoteDatabaseServer) Run() {
 
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
 	d.Chk.NoError(err)
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
+	}
 	s.l = &l
 	_, port, err := net.SplitHostPort(l.Addr().String())
 	d.Chk.NoError(err)
@@ -58,22 +80,32 @@ func (s *RemoteDatabaseServer) Run() {
 	d.Chk.NoError(err)
 	fmt.Printf("Listening on port %d...\n", s.port)
 
+	if len(s.Datasets) > 0 {
+		s.cs = newScopedChunkStore(s.cs, s.Datasets)
+	}
+
 	router := httprouter.New()
 
-	router.POST(constants.GetRefsPath, s.corsHandle(s.makeHandle(HandleGetRefs)))
-	router.GET(constants.GetBlobPath, s.corsHandle(s.makeHandle(HandleGetBlob)))
+	router.POST(constants.GetRefsPath, s.corsHandle(s.authHandle(s.scopeHandle(HandleGetRefs), false)))
+	router.GET(constants.GetBlobPath, s.corsHandle(s.authHandle(s.makeHandle(HandleGetBlob), false)))
 	router.OPTIONS(constants.GetRefsPath, s.corsHandle(noopHandle))
-	router.POST(constants.HasRefsPath, s.corsHandle(s.makeHandle(HandleHasRefs)))
+	router.POST(constants.HasRefsPath, s.corsHandle(s.authHandle(s.makeHandle(HandleHasRefs), false)))
 	router.OPTIONS(constants.HasRefsPath, s.corsHandle(noopHandle))
-	router.GET(constants.RootPath, s.corsHandle(s.makeHandle(HandleRootGet)))
-	router.POST(constants.RootPath, s.corsHandle(s.makeHandle(HandleRootPost)))
+	router.GET(constants.RootPath, s.corsHandle(s.authHandle(s.makeHandle(HandleRootGet), false)))
+	router.POST(constants.RootPath, s.corsHandle(s.authHandle(s.hooksHandle(s.makeHandle(HandleRootPost)), true)))
 	router.OPTIONS(constants.RootPath, s.corsHandle(noopHandle))
-	router.POST(constants.WriteValuePath, s.corsHandle(s.makeHandle(HandleWriteValue)))
+	router.POST(constants.WriteValuePath, s.corsHandle(s.authHandle(s.makeHandle(HandleWriteValue), true)))
 	router.OPTIONS(constants.WriteValuePath, s.corsHandle(noopHandle))
-	router.GET(constants.BasePath, s.corsHandle(s.makeHandle(HandleBaseGet)))
-
-	router.GET(constants.GraphQLPath, s.corsHandle(s.makeHandle(HandleGraphQL)))
-	router.POST(constants.GraphQLPath, s.corsHandle(s.makeHandle(HandleGraphQL)))
+	router.GET(constants.WatchPath, s.corsHandle(s.authHandle(s.makeHandle(HandleWatch), false)))
+	router.OPTIONS(constants.WatchPath, s.corsHandle(noopHandle))
+	router.GET(constants.CommitGraphPath, s.corsHandle(s.authHandle(s.makeHandle(HandleCommitGraph), false)))
+	router.OPTIONS(constants.CommitGraphPath, s.corsHandle(noopHandle))
+	router.GET(constants.CompactionPath, s.corsHandle(s.authHandle(s.makeHandle(HandleCompaction), false)))
+	router.OPTIONS(constants.CompactionPath, s.corsHandle(noopHandle))
+	router.GET(constants.BasePath, s.corsHandle(s.authHandle(s.makeHandle(HandleBaseGet), false)))
+
+	router.GET(constants.GraphQLPath, s.corsHandle(s.authHandle(s.makeHandle(HandleGraphQL), false)))
+	router.POST(constants.GraphQLPath, s.corsHandle(s.authHandle(s.makeHandle(HandleGraphQL), false)))
 	router.OPTIONS(constants.GraphQLPath, s.corsHandle(noopHandle))
 
 	srv := &http.Server{
@@ -108,6 +140,75 @@ func (s *RemoteDatabaseServer) makeHandle(hndlr Handler) httprouter.Handle {
 	}
 }
 
+// authHandle rejects requests from clients that s.Auth doesn't recognize, and,
+// if |write| is true, all requests to a read-only server and those from
+// clients that aren't allowed to write. The Permissions of accepted clients
+// are passed on with the request.
+func (s *RemoteDatabaseServer) authHandle(f httprouter.Handle, write bool) httprouter.Handle {
+	if write && (s.ReadOnly || len(s.Datasets) > 0) {
+		return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+			http.Error(w, "Forbidden: the database is served read-only", http.StatusForbidden)
+		}
+	}
+	if s.Auth == nil {
+		return f
+	}
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		perms, ok := s.Auth.Authenticate(req)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="noms"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if write && !perms.Write {
+			http.Error(w, "Forbidden: read-only access", http.StatusForbidden)
+			return
+		}
+		f(w, withPermissions(req, perms), ps)
+	}
+}
+
+// hooksHandle passes s.Hooks on with the request, for HandleRootPost to run.
+func (s *RemoteDatabaseServer) hooksHandle(f httprouter.Handle) httprouter.Handle {
+	if s.Hooks.isEmpty() {
+		return f
+	}
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		f(w, withCommitHooks(req, s.Hooks), ps)
+	}
+}
+
+// scopeHandle refuses getRefs requests for chunks that a dataset-scoped server
+// doesn't expose, rather than pretending they don't exist. The requested
+// chunks are checked once, up front, so |hndlr| is given a ChunkStore that
+// doesn't check them again.
+func (s *RemoteDatabaseServer) scopeHandle(hndlr Handler) httprouter.Handle {
+	scs, ok := s.cs.(*scopedChunkStore)
+	if !ok {
+		return s.makeHandle(hndlr)
+	}
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		if err := req.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hashes := hash.HashSet{}
+		for _, str := range req.PostForm["ref"] {
+			if h, ok := hash.MaybeParse(str); ok {
+				hashes.Insert(h)
+			}
+		}
+		found, filtered := scs.filterReachable(hashes)
+		for h := range hashes {
+			if !found.Has(h) {
+				http.Error(w, fmt.Sprintf("Forbidden: %s isn't reachable from the served datasets", h), http.StatusForbidden)
+				return
+			}
+		}
+		hndlr(w, req, ps, scs.checked(filtered))
+	}
+}
+
 func noopHandle(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 }
 
@@ -118,7 +219,7 @@ func (s *RemoteDatabaseServer) corsHandle(f httprouter.Handle) httprouter.Handle
 		// Can't use * when clients are using cookies.
 		w.Header().Add("Access-Control-Allow-Origin", r.Header.Get("Origin"))
 		w.Header().Add("Access-Control-Allow-Methods", "GET, POST")
-		w.Header().Add("Access-Control-Allow-Headers", NomsVersionHeader)
+		w.Header().Add("Access-Control-Allow-Headers", NomsVersionHeader+", Authorization")
 		w.Header().Add("Access-Control-Expose-Headers", NomsVersionHeader)
 		w.Header().Add(NomsVersionHeader, constants.NomsVersion)
 		f(w, r, ps)
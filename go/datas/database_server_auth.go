@@ -0,0 +1,214 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/attic-labs/noms/go/types"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Permissions describe what an authenticated client of a
+// RemoteDatabaseServer is allowed to do. Every authenticated client can read.
+type Permissions struct {
+	// Write allows the client to write chunks and to update the root.
+	Write bool
+
+	// Datasets, if non-empty, restricts the root updates a client with Write
+	// may make to adding, moving and deleting the datasets (and tags) whose
+	// IDs match one of these patterns. Patterns use the syntax of path.Match,
+	// e.g. "staging/*".
+	Datasets []string
+}
+
+// CanWriteDataset returns true if p allows the dataset (or tag) with ID |id|
+// to be changed.
+func (p Permissions) CanWriteDataset(id string) bool {
+	if !p.Write {
+		return false
+	}
+	return len(p.Datasets) == 0 || matchDatasetPatterns(p.Datasets, id)
+}
+
+// matchDatasetPatterns returns true if |id| matches any of |patterns|, using
+// the syntax of path.Match. The schema of a dataset matches if the dataset
+// does.
+func matchDatasetPatterns(patterns []string, id string) bool {
+	if isSchemaKey(id) {
+		id = id[len(SchemaPrefix):]
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator is implemented by anything that can identify the clients of a
+// RemoteDatabaseServer. Authenticate returns what the client that sent |req|
+// is allowed to do, or false if it isn't a known client.
+type Authenticator interface {
+	Authenticate(req *http.Request) (Permissions, bool)
+}
+
+// Credentials is an Authenticator that knows a fixed set of clients, each of
+// which is identified by a bearer token, a user name and password (HTTP basic
+// auth), or the common name of a verified TLS client certificate.
+type Credentials struct {
+	Tokens map[string]Permissions
+	Users  map[string]UserCredentials
+	Certs  map[string]Permissions
+}
+
+// UserCredentials are the bcrypt hash of a user's password, along with what
+// the user is allowed to do.
+type UserCredentials struct {
+	PasswordHash []byte
+	Permissions
+}
+
+// Authenticate checks, in order, the bearer token or user name and password
+// in the Authorization header of |req|, and the client certificate it was sent
+// with, if any.
+func (c *Credentials) Authenticate(req *http.Request) (Permissions, bool) {
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token := []byte(strings.TrimPrefix(auth, "Bearer "))
+		for t, perms := range c.Tokens {
+			if subtle.ConstantTimeCompare([]byte(t), token) == 1 {
+				return perms, true
+			}
+		}
+		return Permissions{}, false
+	}
+	if user, password, ok := req.BasicAuth(); ok {
+		uc, ok := c.Users[user]
+		if !ok || bcrypt.CompareHashAndPassword(uc.PasswordHash, []byte(password)) != nil {
+			return Permissions{}, false
+		}
+		return uc.Permissions, true
+	}
+	// Only certificates that were verified against the server's client CAs count.
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		perms, ok := c.Certs[req.TLS.VerifiedChains[0][0].Subject.CommonName]
+		return perms, ok
+	}
+	return Permissions{}, false
+}
+
+// ReadCredentials parses Credentials from |r|, which holds one client per
+// line, in the form:
+//
+//	<kind> <credential> read|write [<dataset-pattern>...]
+//
+// where <kind> is one of "token", whose credential is a bearer token, "basic",
+// whose credential is <user>:<bcrypt hash of password>, or "cert", whose
+// credential is the common name of a client certificate. Blank lines and
+// lines starting with # are ignored.
+func ReadCredentials(r io.Reader) (*Credentials, error) {
+	c := &Credentials{map[string]Permissions{}, map[string]UserCredentials{}, map[string]Permissions{}}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("Line %d: expected <kind> <credential> read|write [<dataset-pattern>...]", line)
+		}
+
+		perms := Permissions{Datasets: fields[3:]}
+		switch fields[2] {
+		case "read":
+			if len(perms.Datasets) > 0 {
+				return nil, fmt.Errorf("Line %d: dataset patterns only apply to write access", line)
+			}
+		case "write":
+			perms.Write = true
+		default:
+			return nil, fmt.Errorf("Line %d: unknown access %s, expected read or write", line, fields[2])
+		}
+		for _, pattern := range perms.Datasets {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("Line %d: invalid dataset pattern %s", line, pattern)
+			}
+		}
+
+		switch credential := fields[1]; fields[0] {
+		case "token":
+			c.Tokens[credential] = perms
+		case "basic":
+			parts := strings.SplitN(credential, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("Line %d: expected <user>:<password hash>", line)
+			}
+			if _, err := bcrypt.Cost([]byte(parts[1])); err != nil {
+				return nil, fmt.Errorf("Line %d: password of %s isn't a bcrypt hash", line, parts[0])
+			}
+			c.Users[parts[0]] = UserCredentials{[]byte(parts[1]), perms}
+		case "cert":
+			c.Certs[credential] = perms
+		default:
+			return nil, fmt.Errorf("Line %d: unknown kind %s, expected token, basic or cert", line, fields[0])
+		}
+	}
+	return c, scanner.Err()
+}
+
+// ReadCredentialsFile parses Credentials from the file at |name|, as by
+// ReadCredentials().
+func ReadCredentialsFile(name string) (*Credentials, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCredentials(f)
+}
+
+type permissionsKey struct{}
+
+// withPermissions returns a copy of |req| that carries |perms|, for handlers
+// that need to check more than whether the client may write at all.
+func withPermissions(req *http.Request, perms Permissions) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), permissionsKey{}, perms))
+}
+
+// permissionsFromRequest returns the Permissions of the client that sent
+// |req|, or false if the server doesn't authenticate its clients.
+func permissionsFromRequest(req *http.Request) (Permissions, bool) {
+	perms, ok := req.Context().Value(permissionsKey{}).(Permissions)
+	return perms, ok
+}
+
+// checkDatasetPermissions returns an error naming the first entry of the root
+// Map that differs between |proposed| and |current| and that |perms| doesn't
+// allow to be changed. The commit-graph index follows every dataset, so any
+// client that may write may change it; checkCommitGraph() makes sure that it
+// only adds what's true.
+func checkDatasetPermissions(perms Permissions, proposed, current types.Map) error {
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	changes := make(chan types.ValueChanged)
+	go func() {
+		defer close(changes)
+		proposed.Diff(current, changes, stopChan)
+	}()
+	for change := range changes {
+		if id := string(change.V.(types.String)); !perms.CanWriteDataset(id) && !(id == CommitGraphKey && perms.Write) {
+			return fmt.Errorf("Not allowed to change %s", id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestReadCredentials(t *testing.T) {
+	assert := assert.New(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(err)
+
+	creds, err := ReadCredentials(strings.NewReader(`
+# Comments and blank lines are ignored.
+token reader read
+token writer write staging/* @tag:*
+
+basic alice:` + string(hash) + ` write
+cert bob read
+`))
+	assert.NoError(err)
+	assert.Equal(Permissions{Datasets: []string{}}, creds.Tokens["reader"])
+	assert.Equal(Permissions{true, []string{"staging/*", "@tag:*"}}, creds.Tokens["writer"])
+	assert.True(creds.Users["alice"].Write)
+	assert.False(creds.Certs["bob"].Write)
+
+	for _, bad := range []string{
+		"token reader",
+		"token reader admin",
+		"token reader read foo",
+		"token writer write [",
+		"basic alice write",
+		"basic alice:secret write",
+		"password alice write",
+	} {
+		_, err := ReadCredentials(strings.NewReader(bad))
+		assert.Error(err, bad)
+	}
+}
+
+func TestPermissionsCanWriteDataset(t *testing.T) {
+	assert := assert.New(t)
+	assert.False(Permissions{}.CanWriteDataset("foo"))
+	assert.True(Permissions{Write: true}.CanWriteDataset("foo"))
+
+	p := Permissions{true, []string{"staging/*", "bar"}}
+	assert.True(p.CanWriteDataset("staging/foo"))
+	assert.True(p.CanWriteDataset("bar"))
+	assert.False(p.CanWriteDataset("foo"))
+	assert.False(p.CanWriteDataset("staging/foo/bar"))
+}
+
+func TestCredentialsAuthenticate(t *testing.T) {
+	assert := assert.New(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(err)
+	creds := &Credentials{
+		Tokens: map[string]Permissions{"tok": {Write: true}},
+		Users:  map[string]UserCredentials{"alice": {hash, Permissions{}}},
+	}
+
+	authenticate := func(setAuth func(req *http.Request)) (Permissions, bool) {
+		req := httptest.NewRequest("GET", "/root/", nil)
+		setAuth(req)
+		return creds.Authenticate(req)
+	}
+
+	perms, ok := authenticate(func(req *http.Request) { req.Header.Set("Authorization", "Bearer tok") })
+	assert.True(ok)
+	assert.True(perms.Write)
+	_, ok = authenticate(func(req *http.Request) { req.Header.Set("Authorization", "Bearer nope") })
+	assert.False(ok)
+
+	perms, ok = authenticate(func(req *http.Request) { req.SetBasicAuth("alice", "secret") })
+	assert.True(ok)
+	assert.False(perms.Write)
+	_, ok = authenticate(func(req *http.Request) { req.SetBasicAuth("alice", "wrong") })
+	assert.False(ok)
+	_, ok = authenticate(func(req *http.Request) { req.SetBasicAuth("mallory", "secret") })
+	assert.False(ok)
+
+	_, ok = authenticate(func(req *http.Request) {})
+	assert.False(ok)
+}
+
+func TestAuthHandle(t *testing.T) {
+	assert := assert.New(t)
+	s := &RemoteDatabaseServer{Auth: &Credentials{Tokens: map[string]Permissions{
+		"reader": {},
+		"writer": {Write: true},
+	}}}
+
+	called := false
+	handle := func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		called = true
+	}
+	code := func(token string, write bool) int {
+		called = false
+		w := httptest.NewRecorder()
+		s.authHandle(handle, write)(w, newRequest("POST", token, "/root/", nil, nil), nil)
+		assert.Equal(w.Code == http.StatusOK, called)
+		return w.Code
+	}
+
+	assert.Equal(http.StatusUnauthorized, code("", false))
+	assert.Equal(http.StatusUnauthorized, code("Bearer nope", false))
+	assert.Equal(http.StatusOK, code("Bearer reader", false))
+	assert.Equal(http.StatusForbidden, code("Bearer reader", true))
+	assert.Equal(http.StatusOK, code("Bearer writer", true))
+}
+
+func TestHandlePostRootDatasetPermissions(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	vs := types.NewValueStore(types.NewBatchStoreAdaptor(cs))
+
+	commitRef := vs.WriteValue(buildTestCommit(types.String("head")))
+	firstHead := types.NewMap(types.String("prod"), types.ToRefOfValue(commitRef))
+	firstHeadRef := vs.WriteValue(firstHead)
+	vs.Flush(firstHeadRef.TargetHash())
+	assert.True(cs.UpdateRoot(firstHeadRef.TargetHash(), hash.Hash{}))
+
+	perms := Permissions{true, []string{"staging/*"}}
+	post := func(newHead types.Map) int {
+		newHeadRef := vs.WriteValue(newHead)
+		vs.Flush(newHeadRef.TargetHash())
+
+		queryParams := url.Values{}
+		queryParams.Add("last", cs.Root().String())
+		queryParams.Add("current", newHeadRef.TargetHash().String())
+		u := &url.URL{RawQuery: queryParams.Encode()}
+
+		w := httptest.NewRecorder()
+		req := withPermissions(newRequest("POST", "", u.String(), nil, nil), perms)
+		HandleRootPost(w, req, params{}, cs)
+		return w.Code
+	}
+
+	// Changing, adding or removing a dataset that doesn't match is forbidden.
+	assert.Equal(http.StatusForbidden, post(firstHead.Set(types.String("prod"), types.ToRefOfValue(vs.WriteValue(buildTestCommit(types.String("second"), commitRef))))))
+	assert.Equal(http.StatusForbidden, post(firstHead.Set(types.String("other"), types.ToRefOfValue(commitRef))))
+	assert.Equal(http.StatusForbidden, post(firstHead.Remove(types.String("prod"))))
+	assert.Equal(firstHeadRef.TargetHash(), cs.Root())
+
+	// One that matches is fine.
+	assert.Equal(http.StatusOK, post(firstHead.Set(types.String("staging/foo"), types.ToRefOfValue(commitRef))))
+	assert.NotEqual(firstHeadRef.TargetHash(), cs.Root())
+}
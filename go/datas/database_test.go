@@ -272,6 +272,79 @@ func newOptsWithMerge(policy merge.ResolveFunc, parents ...types.Value) CommitOp
 	return CommitOptions{Parents: types.NewSet(parents...), Policy: merge.NewThreeWay(policy)}
 }
 
+func (suite *DatabaseSuite) TestCommitMany() {
+	ds1, ds2 := suite.db.GetDataset("ds1"), suite.db.GetDataset("ds2")
+	ds1, err := suite.db.CommitValue(ds1, types.String("a"))
+	suite.NoError(err)
+	ds1First := ds1
+
+	datasets, err := suite.db.CommitMany([]DatasetCommit{
+		{Dataset: ds1, Value: types.String("b")},
+		{Dataset: ds2, Value: types.Number(1)},
+	})
+	suite.NoError(err)
+	suite.Len(datasets, 2)
+	ds1, ds2 = datasets[0], datasets[1]
+	suite.True(types.String("b").Equals(ds1.HeadValue()))
+	suite.True(ds1First.HeadRef().Equals(ds1.Head().Get(ParentsField).(types.Set).First()))
+	suite.True(types.Number(1).Equals(ds2.HeadValue()))
+	suite.True(ds2.Head().Get(ParentsField).(types.Set).Empty())
+
+	// ds1 has moved on since ds1First, so nothing is committed.
+	datasets, err = suite.db.CommitMany([]DatasetCommit{
+		{Dataset: ds2, Value: types.Number(2)},
+		{Dataset: ds1First, Value: types.String("c")},
+	})
+	suite.Equal(ErrMergeNeeded, err)
+	suite.True(ds2.HeadRef().Equals(datasets[0].HeadRef()))
+	suite.True(ds1.HeadRef().Equals(datasets[1].HeadRef()))
+
+	_, err = suite.db.CommitMany([]DatasetCommit{{Dataset: suite.db.GetDataset(TagPrefix + "t"), Value: types.Number(2)}})
+	suite.Equal(ErrTagImmutable, err)
+	suite.Panics(func() {
+		suite.db.CommitMany([]DatasetCommit{{Dataset: ds1, Value: types.Number(2)}, {Dataset: ds1, Value: types.Number(3)}})
+	})
+}
+
+func (suite *DatabaseSuite) TestCommitManyWithConcurrentChunkStoreUse() {
+	ds1, err := suite.db.CommitValue(suite.db.GetDataset("ds1"), types.String("a"))
+	suite.NoError(err)
+
+	w := &waitDuringUpdateRootChunkStore{suite.cs, nil}
+	db := suite.makeDb(w)
+	defer db.Close()
+
+	// A concurrent change to another dataset is retried around...
+	w.preUpdateRootHook = func() {
+		_, concErr := suite.db.CommitValue(suite.db.GetDataset("ds3"), types.String("stuff"))
+		suite.NoError(concErr)
+		w.preUpdateRootHook = nil
+	}
+	datasets, err := db.CommitMany([]DatasetCommit{
+		{Dataset: db.GetDataset("ds1"), Value: types.String("b")},
+		{Dataset: db.GetDataset("ds2"), Value: types.String("b")},
+	})
+	suite.NoError(err)
+	suite.True(types.String("b").Equals(datasets[0].HeadValue()))
+	suite.True(types.String("b").Equals(datasets[1].HeadValue()))
+	ds1 = datasets[0]
+
+	// ...but one to any of the datasets being committed to fails all of them.
+	ds2 := datasets[1]
+	w.preUpdateRootHook = func() {
+		_, concErr := suite.db.Commit(suite.db.GetDataset("ds2"), types.String("e"), CommitOptions{Parents: types.NewSet(ds2.HeadRef())})
+		suite.NoError(concErr)
+		w.preUpdateRootHook = nil
+	}
+	datasets, err = db.CommitMany([]DatasetCommit{
+		{Dataset: ds1, Value: types.String("c")},
+		{Dataset: ds2, Value: types.String("c")},
+	})
+	suite.Equal(ErrMergeNeeded, err)
+	suite.True(types.String("b").Equals(datasets[0].HeadValue()))
+	suite.True(types.String("e").Equals(datasets[1].HeadValue()))
+}
+
 func (suite *DatabaseSuite) TestDatabaseDelete() {
 	datasetID1, datasetID2 := "ds1", "ds2"
 	ds1, ds2 := suite.db.GetDataset(datasetID1), suite.db.GetDataset(datasetID2)
@@ -449,6 +522,48 @@ func (suite *DatabaseSuite) TestSetHead() {
 	ds, err = suite.db.SetHead(ds, bCommitRef)
 	suite.NoError(err)
 	suite.True(ds.HeadValue().Equals(b))
+
+	// SetHead forces the head, even though it has moved since |stale| was read.
+	stale := ds
+	ds, err = suite.db.SetHead(ds, aCommitRef)
+	suite.NoError(err)
+	ds, err = suite.db.SetHead(stale, bCommitRef)
+	suite.NoError(err)
+	suite.True(ds.HeadValue().Equals(b))
+}
+
+func (suite *DatabaseSuite) TestCompareAndSetHead() {
+	var err error
+	ds := suite.db.GetDataset("ds1")
+
+	a := types.String("a")
+	ds, err = suite.db.CommitValue(ds, a)
+	suite.NoError(err)
+	aCommitRef := ds.HeadRef()
+
+	b := types.String("b")
+	ds, err = suite.db.CommitValue(ds, b)
+	suite.NoError(err)
+	bCommitRef := ds.HeadRef()
+
+	ds, err = suite.db.CompareAndSetHead(ds, aCommitRef)
+	suite.NoError(err)
+	suite.True(ds.HeadValue().Equals(a))
+
+	// The head has moved since |stale| was read, so it's left alone.
+	stale := ds
+	ds, err = suite.db.SetHead(ds, bCommitRef)
+	suite.NoError(err)
+	ds, err = suite.db.CompareAndSetHead(stale, aCommitRef)
+	suite.Equal(ErrMergeNeeded, err)
+	suite.True(ds.HeadValue().Equals(b))
+
+	// As is a dataset that has been deleted.
+	ds, err = suite.db.Delete(ds)
+	suite.NoError(err)
+	ds, err = suite.db.CompareAndSetHead(stale, aCommitRef)
+	suite.Equal(ErrMergeNeeded, err)
+	suite.False(ds.HasHead())
 }
 
 func (suite *DatabaseSuite) TestFastForward() {
@@ -556,3 +671,23 @@ func (suite *DatabaseSuite) TestMetaOption() {
 	c := ds.Head()
 	suite.Equal(types.String("arv"), c.Get("meta").(types.Struct).Get("author"))
 }
+
+func (suite *DatabaseSuite) TestRootLog() {
+	ds := suite.db.GetDataset("ds1")
+	ds, err := suite.db.CommitValue(ds, types.String("a"))
+	suite.NoError(err)
+	a := ds.HeadRef()
+	ds, err = suite.db.CommitValue(ds, types.String("b"))
+	suite.NoError(err)
+	_, err = suite.db.Delete(ds)
+	suite.NoError(err)
+
+	log := suite.cs.RootLog()
+	suite.Len(log, 3)
+	suite.Contains(log[0].Reason, "delete ds1 "+ds.HeadRef().TargetHash().String())
+	suite.Equal(suite.cs.Root(), log[0].To)
+	suite.Equal(log[1].To, log[0].From)
+	suite.Contains(log[1].Reason, "commit ds1 "+ds.HeadRef().TargetHash().String())
+	suite.Contains(log[2].Reason, "commit ds1 "+a.TargetHash().String())
+	suite.True(log[2].From.IsEmpty())
+}
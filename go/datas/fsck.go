@@ -0,0 +1,237 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/nbs"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// Kinds of problem that Fsck() can report.
+const (
+	FsckMissingChunk = "missing-chunk"
+	FsckHashMismatch = "hash-mismatch"
+	FsckUnreadable   = "unreadable"
+	FsckUndecodable  = "undecodable"
+	FsckBadRefHeight = "bad-ref-height"
+	FsckBadRoot      = "bad-root"
+	FsckBadCommit    = "bad-commit"
+	FsckBadTag       = "bad-tag"
+)
+
+const fsckGetManyBatchSize = 1 << 12
+
+// FsckProblem describes a single problem found by Fsck(). |Referrer|, if
+// non-empty, is the chunk containing the Ref that led to |Hash|.
+type FsckProblem struct {
+	Kind     string
+	Hash     hash.Hash
+	Referrer hash.Hash
+	Detail   string
+}
+
+// FsckReport is the result of calling Fsck() on a Database. |DamagedTables|
+// lists the damage found in the tables of the underlying ChunkStore, if it
+// keeps its chunks in tables that can be verified.
+type FsckReport struct {
+	Root          hash.Hash
+	Chunks        uint64
+	Problems      []FsckProblem
+	DamagedTables []nbs.TableDamage
+}
+
+// OK returns true if Fsck() found no problems.
+func (r FsckReport) OK() bool {
+	return len(r.Problems) == 0 && len(r.DamagedTables) == 0
+}
+
+// tableVerifier is implemented by ChunkStores whose tables can be checked for
+// damage, like nbs.NomsBlockStore.
+type tableVerifier interface {
+	VerifyTables() []nbs.TableDamage
+}
+
+type fsckRef struct {
+	referrer hash.Hash
+	height   uint64
+}
+
+// Fsck walks every chunk reachable from the current root of the database,
+// reading chunks in batches from the underlying BatchStore. It checks that every
+// chunk is present, that it hashes to the address it was requested by, that
+// it decodes, and that the heights of the Refs pointing at it are consistent
+// with the Refs it contains. It also checks that the root is a
+// Map<String, Ref<Commit>>, that the heads and parents of every dataset
+// are Commits and that every tag is a Tag pointing at a Commit.
+func (dbc *databaseCommon) Fsck() FsckReport {
+	return dbc.fsck(nil)
+}
+
+// Fsck first verifies the checksum of every record in every table of the
+// ChunkStore, if it's a tableVerifier. If any tables are damaged, the walk
+// then reads chunks one at a time, on the calling goroutine, so that those
+// that can't be read are reported as problems along with the rest, rather
+// than crashing one of the goroutines that read chunks in parallel.
+func (ldb *LocalDatabase) Fsck() FsckReport {
+	var damaged []nbs.TableDamage
+	if tv, ok := ldb.cs.(tableVerifier); ok {
+		damaged = tv.VerifyTables()
+	}
+	return ldb.fsck(damaged)
+}
+
+// fsck walks the chunks reachable from the root, as described by Fsck(),
+// reading them one at a time if |damaged| isn't empty.
+func (dbc *databaseCommon) fsck(damaged []nbs.TableDamage) (report FsckReport) {
+	report.DamagedTables = damaged
+	report.Root = dbc.rt.Root()
+	if report.Root.IsEmpty() {
+		return
+	}
+	problem := func(kind string, h, referrer hash.Hash, format string, args ...interface{}) {
+		report.Problems = append(report.Problems, FsckProblem{kind, h, referrer, fmt.Sprintf(format, args...)})
+	}
+
+	bs := dbc.BatchStore()
+	refs := map[hash.Hash]fsckRef{report.Root: {}}
+	heights := map[hash.Hash]uint64{}
+	expectCommit, expectTag := map[hash.Hash]hash.Hash{}, map[hash.Hash]hash.Hash{}
+	isCommit, isTag := hash.HashSet{}, hash.HashSet{}
+
+	// |ref| records a Ref found in |referrer|, checking its height against any other Refs to the same chunk.
+	next := hash.HashSet{report.Root: struct{}{}}
+	ref := func(referrer hash.Hash, r types.Ref) {
+		h := r.TargetHash()
+		if prev, seen := refs[h]; !seen {
+			refs[h] = fsckRef{referrer, r.Height()}
+			next.Insert(h)
+		} else if prev.height != r.Height() && prev.height != 0 {
+			problem(FsckBadRefHeight, h, referrer, "Ref has height %d, but a Ref from %s has height %d", r.Height(), prev.referrer, prev.height)
+		}
+	}
+
+	for len(next) > 0 {
+		batch := hash.HashSet{}
+		for h := range next {
+			batch.Insert(h)
+			next.Remove(h)
+			if len(batch) == fsckGetManyBatchSize {
+				break
+			}
+		}
+
+		found := make(chan *chunks.Chunk, len(batch))
+		if len(damaged) > 0 || fsckTry(func() { bs.GetMany(batch, found) }) != nil {
+			// Some chunk in the batch may be unreadable, e.g. because its checksum is bad. Read them one at a time so the rest can still be checked.
+			found = make(chan *chunks.Chunk, len(batch))
+			for h := range batch {
+				var c chunks.Chunk
+				if err := fsckTry(func() { c = bs.Get(h) }); err != nil {
+					problem(FsckUnreadable, h, refs[h].referrer, "%s", err)
+					batch.Remove(h)
+				} else if !c.IsEmpty() {
+					found <- &c
+				}
+			}
+		}
+		close(found)
+
+		for c := range found {
+			h := c.Hash()
+			batch.Remove(h)
+			report.Chunks++
+			from := refs[h].referrer
+
+			if actual := hash.Of(c.Data()); actual != h {
+				problem(FsckHashMismatch, h, from, "Chunk data hashes to %s", actual)
+				continue
+			}
+			var v types.Value
+			if err := fsckTry(func() { v = types.DecodeValue(*c, dbc) }); err != nil {
+				problem(FsckUndecodable, h, from, "%s", err)
+				continue
+			}
+
+			height := uint64(0)
+			v.WalkRefs(func(r types.Ref) {
+				if r.Height() > height {
+					height = r.Height()
+				}
+				ref(h, r)
+			})
+			heights[h] = height + 1
+
+			if h == report.Root {
+				rootType := types.MakeMapType(types.StringType, types.MakeRefType(types.ValueType))
+				if !types.IsSubtype(rootType, v.Type()) {
+					problem(FsckBadRoot, h, from, "Root of database must be %s, but is %s", rootType.Describe(), v.Type().Describe())
+					continue
+				}
+				err := fsckTry(func() {
+					v.(types.Map).IterAll(func(k, r types.Value) {
+						if key := string(k.(types.String)); IsTagID(key) {
+							expectTag[r.(types.Ref).TargetHash()] = h
+						} else if !isSchemaKey(key) && key != CommitGraphKey {
+							expectCommit[r.(types.Ref).TargetHash()] = h
+						}
+					})
+				})
+				if err != nil {
+					problem(FsckBadRoot, h, from, "%s", err)
+				}
+			} else if IsCommitType(v.Type()) {
+				isCommit.Insert(h)
+				err := fsckTry(func() {
+					v.(types.Struct).Get(ParentsField).(types.Set).IterAll(func(p types.Value) {
+						expectCommit[p.(types.Ref).TargetHash()] = h
+					})
+				})
+				if err != nil {
+					problem(FsckBadCommit, h, from, "%s", err)
+				}
+			} else if IsTagType(v.Type()) {
+				isTag.Insert(h)
+				expectCommit[v.(types.Struct).Get(TagCommitField).(types.Ref).TargetHash()] = h
+			}
+		}
+
+		for h := range batch {
+			problem(FsckMissingChunk, h, refs[h].referrer, "Chunk is referenced, but not present in the store")
+		}
+	}
+
+	for h, r := range refs {
+		if height, ok := heights[h]; ok && h != report.Root && height != r.height {
+			problem(FsckBadRefHeight, h, r.referrer, "Ref has height %d, but target has height %d", r.height, height)
+		}
+	}
+	for h, referrer := range expectCommit {
+		if _, ok := heights[h]; ok && !isCommit.Has(h) {
+			problem(FsckBadCommit, h, referrer, "Dataset head, commit parent or tagged commit is not a Commit")
+		}
+	}
+	for h, referrer := range expectTag {
+		if _, ok := heights[h]; ok && !isTag.Has(h) {
+			problem(FsckBadTag, h, referrer, "Tag is not a Tag")
+		}
+	}
+	return
+}
+
+// fsckTry calls |f|, turning any panic, e.g. one caused by decoding
+// malformed chunk data, into an error.
+func fsckTry(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	f()
+	return
+}
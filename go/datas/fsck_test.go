@@ -0,0 +1,135 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/nbs"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func (suite *DatabaseSuite) TestFsck() {
+	report := suite.db.Fsck()
+	suite.True(report.OK())
+	suite.Zero(report.Chunks)
+
+	ds, err := suite.db.CommitValue(suite.db.GetDataset("foo"), types.NewList(types.String("a"), types.String("b")))
+	suite.NoError(err)
+	_, err = suite.db.CommitValue(ds, suite.db.WriteValue(types.String("c")))
+	suite.NoError(err)
+
+	db := suite.makeDb(suite.cs)
+	defer db.Close()
+	report = db.Fsck()
+	suite.True(report.OK(), "%+v", report.Problems)
+	suite.Equal(suite.cs.Root(), report.Root)
+	// The root map, two commits and the String written separately. The List is inlined into the first commit.
+	suite.Equal(uint64(4), report.Chunks)
+}
+
+func TestFsckFindsProblems(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+
+	put := func(v types.Value) types.Ref {
+		cs.Put(types.EncodeValue(v, nil))
+		return types.NewRef(v)
+	}
+
+	// |missing| is never written, and |corrupt| is stored with the wrong data.
+	missing := types.String("missing")
+	corrupt := types.String("corrupt")
+	cs.Put(chunks.NewChunkWithHash(types.NewRef(corrupt).TargetHash(), []byte("garbage")))
+
+	commit := put(NewCommit(types.NewList(types.NewRef(missing), types.NewRef(corrupt)), types.NewSet(), types.EmptyStruct))
+	notCommit := put(types.String("not a commit"))
+	root := put(types.NewMap(types.String("good"), commit, types.String("bad"), notCommit))
+	assert.True(cs.UpdateRoot(root.TargetHash(), hash.Hash{}))
+
+	db := NewDatabase(cs)
+	defer db.Close()
+	report := db.Fsck()
+	assert.False(report.OK())
+	assert.Equal(root.TargetHash(), report.Root)
+
+	kinds := map[string]hash.Hash{}
+	for _, p := range report.Problems {
+		kinds[p.Kind] = p.Hash
+	}
+	assert.Equal(types.NewRef(missing).TargetHash(), kinds[FsckMissingChunk])
+	assert.Equal(types.NewRef(corrupt).TargetHash(), kinds[FsckHashMismatch])
+	assert.Equal(notCommit.TargetHash(), kinds[FsckBadCommit])
+}
+
+func TestFsckBadRoot(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	c := types.EncodeValue(types.NewMap(types.String("ds"), types.String("not a ref")), nil)
+	cs.Put(c)
+	assert.True(cs.UpdateRoot(c.Hash(), hash.Hash{}))
+
+	db := NewDatabase(cs)
+	defer db.Close()
+	report := db.Fsck()
+	assert.Len(report.Problems, 1)
+	assert.Equal(FsckBadRoot, report.Problems[0].Kind)
+	assert.Equal(c.Hash(), report.Problems[0].Hash)
+}
+
+func TestFsckDamagedTable(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	commit := func(v types.Value) {
+		store := nbs.NewLocalStore(dir, 1<<20)
+		db := NewDatabase(store)
+		defer db.Close()
+		ds := db.GetDataset("ds")
+		_, err := db.CommitValue(ds, v)
+		assert.NoError(err)
+	}
+	commit(types.String("first"))
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(err)
+	commit(types.String("second"))
+
+	// Flip every bit of every chunk record in the tables of the first commit, leaving their indices and footers intact.
+	for _, fi := range files {
+		if fi.Name() == "manifest" || fi.Name() == "LOCK" {
+			continue
+		}
+		p := filepath.Join(dir, fi.Name())
+		data, err := ioutil.ReadFile(p)
+		assert.NoError(err)
+		count := int(binary.BigEndian.Uint32(data[len(data)-20:]))
+		for i := 0; i < len(data)-20-28*count; i++ {
+			data[i] ^= 0xff
+		}
+		assert.NoError(ioutil.WriteFile(p, data, 0666))
+	}
+
+	db := NewDatabase(nbs.NewLocalStore(dir, 1<<20))
+	defer db.Close()
+	report := db.Fsck()
+	assert.False(report.OK())
+	assert.NotEmpty(report.DamagedTables)
+
+	// The new root and commit are still checked, and the first commit, which is their parent, is reported as unreadable.
+	assert.Equal(uint64(2), report.Chunks)
+	if assert.Len(report.Problems, 1) {
+		assert.Equal(FsckUnreadable, report.Problems[0].Kind)
+		assert.NotEmpty(report.Problems[0].Referrer)
+	}
+}
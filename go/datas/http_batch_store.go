@@ -8,11 +8,15 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -54,6 +58,13 @@ type httpBatchStore struct {
 }
 
 func NewHTTPBatchStore(baseURL, auth string) *httpBatchStore {
+	return NewHTTPBatchStoreTLS(baseURL, auth, nil)
+}
+
+// NewHTTPBatchStoreTLS is like NewHTTPBatchStore, but uses |tlsConfig|, if
+// it isn't nil, to connect to https servers, e.g. to trust a private CA or to
+// present a client certificate.
+func NewHTTPBatchStoreTLS(baseURL, auth string, tlsConfig *tls.Config) *httpBatchStore {
 	u, err := url.Parse(baseURL)
 	d.PanicIfError(err)
 	if u.Scheme != "http" && u.Scheme != "https" {
@@ -61,7 +72,7 @@ func NewHTTPBatchStore(baseURL, auth string) *httpBatchStore {
 	}
 	buffSink := &httpBatchStore{
 		host:          u,
-		httpClient:    makeHTTPClient(httpChunkSinkConcurrency),
+		httpClient:    makeHTTPClient(httpChunkSinkConcurrency, tlsConfig),
 		auth:          auth,
 		getQueue:      make(chan chunks.ReadRequest, readBufferSize),
 		hasQueue:      make(chan chunks.ReadRequest, readBufferSize),
@@ -90,9 +101,12 @@ type writeRequest struct {
 }
 
 // Use a custom http client rather than http.DefaultClient. We limit ourselves to a maximum of |requestLimit| concurrent http requests, the custom httpClient ups the maxIdleConnsPerHost value so that one connection stays open for each concurrent request.
-func makeHTTPClient(requestLimit int) *http.Client {
+func makeHTTPClient(requestLimit int, tlsConfig *tls.Config) *http.Client {
 	t := http.Transport(*http.DefaultTransport.(*http.Transport))
 	t.MaxIdleConnsPerHost = requestLimit
+	if tlsConfig != nil {
+		t.TLSClientConfig = tlsConfig
+	}
 	// This sets, essentially, an idle-timeout. The timer starts counting AFTER the client has finished sending the entire request to the server. As soon as the client receives the server's response headers, the timeout is canceled.
 	t.ResponseHeaderTimeout = time.Duration(4) * time.Minute
 
@@ -421,7 +435,7 @@ func (bhcs *httpBatchStore) sendWriteRequests() {
 
 func (bhcs *httpBatchStore) Root() hash.Hash {
 	// GET http://<host>/root. Response will be ref of root.
-	res := bhcs.requestRoot("GET", hash.Hash{}, hash.Hash{})
+	res := bhcs.requestRoot("GET", hash.Hash{}, hash.Hash{}, "")
 	expectVersion(res)
 	defer closeResponse(res.Body)
 
@@ -435,31 +449,44 @@ func (bhcs *httpBatchStore) Root() hash.Hash {
 
 // UpdateRoot flushes outstanding writes to the backing ChunkStore before updating its Root, because it's almost certainly the case that the caller wants to point that root at some recently-Put Chunk.
 func (bhcs *httpBatchStore) UpdateRoot(current, last hash.Hash) bool {
-	// POST http://<host>/root?current=<ref>&last=<ref>. Response will be 200 on success, 409 if current is outdated.
+	err := bhcs.updateRootWithReason(current, last, "")
+	if err == ErrOptimisticLockFailed {
+		return false
+	}
+	d.PanicIfError(err)
+	return true
+}
+
+// updateRootWithReason is like UpdateRoot, but also sends |reason| so that the server can record it in its log of root transitions. If the server refuses the update, e.g. because one of its commit hooks vetoed it, the reason it gave is returned as an error.
+func (bhcs *httpBatchStore) updateRootWithReason(current, last hash.Hash, reason string) error {
+	// POST http://<host>/root?current=<ref>&last=<ref>&reason=<reason>. Response will be 200 on success, 409 if current is outdated, and 403 if the update isn't allowed.
 	bhcs.Flush()
 
-	res := bhcs.requestRoot("POST", current, last)
+	res := bhcs.requestRoot("POST", current, last, reason)
 	expectVersion(res)
 	defer closeResponse(res.Body)
 
+	buf := bytes.Buffer{}
 	switch res.StatusCode {
 	case http.StatusOK:
-		return true
+		return nil
 	case http.StatusConflict:
-		return false
+		return ErrOptimisticLockFailed
+	case http.StatusForbidden:
+		buf.ReadFrom(res.Body)
+		return fmt.Errorf("Root update refused: %s", strings.TrimSpace(buf.String()))
 	default:
-		buf := bytes.Buffer{}
 		buf.ReadFrom(res.Body)
 		body := buf.String()
 		d.Chk.Fail(
 			fmt.Sprintf("Unexpected response: %s: %s",
 				http.StatusText(res.StatusCode),
 				body))
-		return false
+		return nil
 	}
 }
 
-func (bhcs *httpBatchStore) requestRoot(method string, current, last hash.Hash) *http.Response {
+func (bhcs *httpBatchStore) requestRoot(method string, current, last hash.Hash, reason string) *http.Response {
 	u := *bhcs.host
 	u.Path = httprouter.CleanPath(bhcs.host.Path + constants.RootPath)
 	if method == "POST" {
@@ -469,6 +496,9 @@ func (bhcs *httpBatchStore) requestRoot(method string, current, last hash.Hash)
 		params := u.Query()
 		params.Add("last", last.String())
 		params.Add("current", current.String())
+		if reason != "" {
+			params.Add("reason", reason)
+		}
 		u.RawQuery = params.Encode()
 	}
 
@@ -480,6 +510,108 @@ func (bhcs *httpBatchStore) requestRoot(method string, current, last hash.Hash)
 	return res
 }
 
+// getCommitGraph returns the entries of the commit-graph index of the server's
+// database for the Commits |hashes| and some of their ancestors, as described
+// by HandleCommitGraph, or false if the database has no such index.
+func (bhcs *httpBatchStore) getCommitGraph(hashes ...hash.Hash) ([]commitGraphEntry, bool) {
+	// GET http://<host>/commitGraph?h=<ref>&h=<ref>... Response will be one line per entry, or 404 if there's no index.
+	u := *bhcs.host
+	u.Path = httprouter.CleanPath(bhcs.host.Path + constants.CommitGraphPath)
+	params := url.Values{}
+	for _, h := range hashes {
+		params.Add("h", h.String())
+	}
+	u.RawQuery = params.Encode()
+
+	res, err := bhcs.httpClient.Do(newRequest("GET", bhcs.auth, u.String(), nil, nil))
+	d.PanicIfError(err)
+	expectVersion(res)
+	defer closeResponse(res.Body)
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, false
+	default:
+		d.Panic("Unexpected response: %s", formatErrorResponse(res))
+	}
+	entries := []commitGraphEntry{}
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		entries = append(entries, parseCommitGraphLine(scanner.Text()))
+	}
+	d.PanicIfError(scanner.Err())
+	return entries, true
+}
+
+func parseCommitGraphLine(line string) commitGraphEntry {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 {
+		d.Panic("Unexpected commit-graph entry: %s", line)
+	}
+	height, err := strconv.ParseUint(fields[1], 10, 64)
+	d.PanicIfError(err)
+	quoted, err := strconv.QuotedPrefix(fields[2])
+	d.PanicIfError(err)
+	date, err := strconv.Unquote(quoted)
+	d.PanicIfError(err)
+	e := commitGraphEntry{h: hash.Parse(fields[0]), height: height, date: date}
+	for _, p := range strings.Fields(fields[2][len(quoted):]) {
+		e.parents = append(e.parents, hash.Parse(p))
+	}
+	return e
+}
+
+// watchRoot calls |f| with the root of the database as it is now, and then
+// again each time the server reports that it has moved, until closeChan is
+// closed or the connection is lost.
+func (bhcs *httpBatchStore) watchRoot(closeChan <-chan struct{}, f func(root hash.Hash)) error {
+	// GET http://<host>/watch. The response is a stream of Server-Sent Events, each carrying the ref of the root.
+	u := *bhcs.host
+	u.Path = httprouter.CleanPath(bhcs.host.Path + constants.WatchPath)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-closeChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req := newRequest("GET", bhcs.auth, u.String(), nil, http.Header{"Accept": {"text/event-stream"}}).WithContext(ctx)
+	res, err := bhcs.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected response: %s", formatErrorResponse(res))
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		root, ok := hash.MaybeParse(strings.TrimPrefix(line, "data: "))
+		if !ok {
+			return fmt.Errorf("Unexpected root in watch stream: %s", line)
+		}
+		f(root)
+	}
+	select {
+	case <-closeChan:
+		return nil
+	default:
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("Server closed the watch stream")
+}
+
 func newRequest(method, auth, url string, body io.Reader, header http.Header) *http.Request {
 	req, err := http.NewRequest(method, url, body)
 	d.Chk.NoError(err)
@@ -84,6 +84,12 @@ func NewHTTPBatchStoreForTest(cs chunks.ChunkStore) *httpBatchStore {
 			HandleRootGet(w, req, ps, cs)
 		},
 	)
+	serv.GET(
+		constants.CommitGraphPath,
+		func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+			HandleCommitGraph(w, req, ps, cs)
+		},
+	)
 	hcs := NewHTTPBatchStore("http://localhost:9000", "")
 	hcs.httpClient = serv
 	return hcs
@@ -0,0 +1,136 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"io"
+	"sync"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
+)
+
+// UpstreamStore is the part of a ChunkStore that a LazyChunkStore reads
+// missing chunks from. Both chunks.ChunkStore and the BatchStore returned by
+// NewHTTPBatchStore() implement it.
+type UpstreamStore interface {
+	Get(h hash.Hash) chunks.Chunk
+	GetMany(hashes hash.HashSet, foundChunks chan *chunks.Chunk)
+	Has(h hash.Hash) bool
+	io.Closer
+}
+
+// LazyChunkStore is a ChunkStore that holds only some of the chunks of a
+// database, e.g. those copied by PullShallow(), and falls through to an
+// upstream store for the rest. Chunks fetched from upstream are Put into the
+// local store, so they're persisted along with the next root update, or when
+// the LazyChunkStore is closed. Writes and the root always go to the local
+// store; upstream is only ever read.
+type LazyChunkStore struct {
+	chunks.ChunkStore
+	upstream UpstreamStore
+	mu       *sync.Mutex
+	fetched  bool
+}
+
+// NewLazyChunkStore returns a LazyChunkStore that keeps its chunks and root
+// in |local| and fetches the chunks missing from |local| from |upstream|. It
+// takes ownership of both stores, and closes them when it's closed.
+func NewLazyChunkStore(local chunks.ChunkStore, upstream UpstreamStore) *LazyChunkStore {
+	return &LazyChunkStore{ChunkStore: local, upstream: upstream, mu: &sync.Mutex{}}
+}
+
+// Get returns the Chunk for |h| from the local store if it's there, or else
+// from upstream.
+func (lcs *LazyChunkStore) Get(h hash.Hash) chunks.Chunk {
+	if c := lcs.ChunkStore.Get(h); !c.IsEmpty() {
+		return c
+	}
+	c := lcs.upstream.Get(h)
+	if !c.IsEmpty() {
+		lcs.cache(c)
+	}
+	return c
+}
+
+// GetMany sends the Chunks for |hashes| that are in the local store, and then
+// fetches the remainder from upstream.
+func (lcs *LazyChunkStore) GetMany(hashes hash.HashSet, foundChunks chan *chunks.Chunk) {
+	localChunks := make(chan *chunks.Chunk)
+	go func() {
+		defer close(localChunks)
+		lcs.ChunkStore.GetMany(hashes, localChunks)
+	}()
+	remaining := hash.HashSet{}
+	for h := range hashes {
+		remaining.Insert(h)
+	}
+	for c := range localChunks {
+		remaining.Remove(c.Hash())
+		foundChunks <- c
+	}
+	if len(remaining) == 0 {
+		return
+	}
+
+	upstreamChunks := make(chan *chunks.Chunk)
+	go func() {
+		defer close(upstreamChunks)
+		lcs.upstream.GetMany(remaining, upstreamChunks)
+	}()
+	for c := range upstreamChunks {
+		lcs.cache(*c)
+		foundChunks <- c
+	}
+}
+
+// Has returns true if the Chunk for |h| is in either the local store or
+// upstream.
+func (lcs *LazyChunkStore) Has(h hash.Hash) bool {
+	return lcs.ChunkStore.Has(h) || lcs.upstream.Has(h)
+}
+
+// HasLocal returns true only if the Chunk for |h| is in the local store.
+func (lcs *LazyChunkStore) HasLocal(h hash.Hash) bool {
+	return lcs.ChunkStore.Has(h)
+}
+
+func (lcs *LazyChunkStore) cache(c chunks.Chunk) {
+	lcs.ChunkStore.Put(c)
+	lcs.mu.Lock()
+	defer lcs.mu.Unlock()
+	lcs.fetched = true
+}
+
+// LogRoot passes |e| on to the local store, if it keeps a root log.
+func (lcs *LazyChunkStore) LogRoot(e chunks.RootLogEntry) {
+	if rl, ok := lcs.ChunkStore.(chunks.RootLogger); ok {
+		rl.LogRoot(e)
+	}
+}
+
+// RootLog returns the root log of the local store, if it keeps one.
+func (lcs *LazyChunkStore) RootLog() []chunks.RootLogEntry {
+	if rl, ok := lcs.ChunkStore.(chunks.RootLogger); ok {
+		return rl.RootLog()
+	}
+	return nil
+}
+
+// Close persists any chunks fetched from upstream since the last Flush(), and
+// then closes both the local store and upstream.
+func (lcs *LazyChunkStore) Close() error {
+	lcs.mu.Lock()
+	fetched := lcs.fetched
+	lcs.mu.Unlock()
+	if fetched {
+		lcs.ChunkStore.Flush()
+	}
+	err := lcs.ChunkStore.Close()
+	if uerr := lcs.upstream.Close(); err == nil {
+		err = uerr
+	}
+	return err
+}
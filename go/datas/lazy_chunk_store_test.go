@@ -0,0 +1,68 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestLazyChunkStore(t *testing.T) {
+	assert := assert.New(t)
+	local, upstream := chunks.NewTestStore(), chunks.NewTestStore()
+	lcs := NewLazyChunkStore(local, upstream)
+
+	inLocal, inUpstream, nowhere := chunks.NewChunk([]byte("local")), chunks.NewChunk([]byte("upstream")), chunks.NewChunk([]byte("nowhere"))
+	local.Put(inLocal)
+	upstream.Put(inUpstream)
+
+	assert.True(lcs.Has(inLocal.Hash()))
+	assert.True(lcs.Has(inUpstream.Hash()))
+	assert.False(lcs.Has(nowhere.Hash()))
+	assert.False(lcs.HasLocal(inUpstream.Hash()))
+
+	assert.Equal(inLocal.Data(), lcs.Get(inLocal.Hash()).Data())
+	assert.Equal(0, upstream.Reads)
+	assert.True(lcs.Get(nowhere.Hash()).IsEmpty())
+
+	// Chunks fetched from upstream are kept locally.
+	assert.Equal(inUpstream.Data(), lcs.Get(inUpstream.Hash()).Data())
+	assert.True(lcs.HasLocal(inUpstream.Hash()))
+	reads := upstream.Reads
+	lcs.Get(inUpstream.Hash())
+	assert.Equal(reads, upstream.Reads)
+
+	// Writes only go to the local store.
+	written := chunks.NewChunk([]byte("written"))
+	lcs.Put(written)
+	assert.True(local.Has(written.Hash()))
+	assert.False(upstream.Has(written.Hash()))
+}
+
+func TestLazyChunkStoreGetMany(t *testing.T) {
+	assert := assert.New(t)
+	local, upstream := chunks.NewTestStore(), chunks.NewTestStore()
+	lcs := NewLazyChunkStore(local, upstream)
+
+	inLocal, inUpstream, nowhere := chunks.NewChunk([]byte("local")), chunks.NewChunk([]byte("upstream")), chunks.NewChunk([]byte("nowhere"))
+	local.Put(inLocal)
+	upstream.Put(inUpstream)
+
+	hashes := hash.NewHashSet(inLocal.Hash(), inUpstream.Hash(), nowhere.Hash())
+	found := make(chan *chunks.Chunk, len(hashes))
+	lcs.GetMany(hashes, found)
+	close(found)
+
+	foundHashes := hash.HashSet{}
+	for c := range found {
+		foundHashes.Insert(c.Hash())
+	}
+	assert.Equal(hash.NewHashSet(inLocal.Hash(), inUpstream.Hash()), foundHashes)
+	assert.Equal(2, upstream.Reads, "Only the chunks missing locally should be read from upstream")
+	assert.True(local.Has(inUpstream.Hash()))
+}
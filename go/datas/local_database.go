@@ -5,6 +5,8 @@
 package datas
 
 import (
+	"time"
+
 	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/types"
 )
@@ -18,11 +20,15 @@ type LocalDatabase struct {
 
 func newLocalDatabase(cs chunks.ChunkStore) *LocalDatabase {
 	bs := types.NewBatchStoreAdaptor(cs)
-	return &LocalDatabase{
+	ldb := &LocalDatabase{
 		newDatabaseCommon(newCachingChunkHaver(cs), types.NewValueStore(bs), bs),
 		cs,
 		nil,
 	}
+	if rl, ok := cs.(chunks.RootLogger); ok {
+		ldb.rl = rl
+	}
+	return ldb
 }
 
 func (ldb *LocalDatabase) GetDataset(datasetID string) Dataset {
@@ -32,7 +38,7 @@ func (ldb *LocalDatabase) GetDataset(datasetID string) Dataset {
 func (ldb *LocalDatabase) Commit(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
 	return ldb.doHeadUpdate(
 		ds,
-		func(ds Dataset) error { return ldb.doCommit(ds.ID(), buildNewCommit(ds, v, opts), opts.Policy) },
+		func(ds Dataset) error { return ldb.doCommit(ds.ID(), buildNewCommit(ds, v, opts), opts.Policy, "commit") },
 	)
 }
 
@@ -40,25 +46,76 @@ func (ldb *LocalDatabase) CommitValue(ds Dataset, v types.Value) (Dataset, error
 	return ldb.Commit(ds, v, CommitOptions{})
 }
 
+func (ldb *LocalDatabase) CommitMany(commits []DatasetCommit) ([]Dataset, error) {
+	ldb.flushValidatingBatchStore()
+	err := ldb.doCommitMany(buildDatasetCommits(commits), "commit-many")
+	return getDatasets(ldb, commits), err
+}
+
 func (ldb *LocalDatabase) Delete(ds Dataset) (Dataset, error) {
 	return ldb.doHeadUpdate(ds, func(ds Dataset) error { return ldb.doDelete(ds.ID()) })
 }
 
 func (ldb *LocalDatabase) SetHead(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
-	return ldb.doHeadUpdate(ds, func(ds Dataset) error { return ldb.doSetHead(ds, newHeadRef) })
+	return ldb.doHeadUpdate(ds, func(ds Dataset) error { return ldb.doSetHead(ds, newHeadRef, false) })
+}
+
+func (ldb *LocalDatabase) CompareAndSetHead(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	return ldb.doHeadUpdate(ds, func(ds Dataset) error { return ldb.doSetHead(ds, newHeadRef, true) })
 }
 
 func (ldb *LocalDatabase) FastForward(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
 	return ldb.doHeadUpdate(ds, func(ds Dataset) error { return ldb.doFastForward(ds, newHeadRef) })
 }
 
+func (ldb *LocalDatabase) CreateTag(name string, commitRef types.Ref, meta types.Struct) error {
+	ldb.flushValidatingBatchStore()
+	return ldb.doCreateTag(name, commitRef, meta)
+}
+
+func (ldb *LocalDatabase) DeleteTag(name string) error {
+	return ldb.doDeleteTag(name)
+}
+
+func (ldb *LocalDatabase) SetSchema(datasetID string, schema *types.Type) error {
+	return ldb.doSetSchema(datasetID, schema)
+}
+
+func (ldb *LocalDatabase) BuildCommitGraph() error {
+	return ldb.doBuildCommitGraph()
+}
+
+func (ldb *LocalDatabase) DropCommitGraph() error {
+	return ldb.doDropCommitGraph()
+}
+
+// Watch polls the root of the underlying ChunkStore, so it notices commits
+// made through any Database that shares it.
+func (ldb *LocalDatabase) Watch(changes chan<- HeadChange, closeChan <-chan struct{}, datasetIDs ...string) error {
+	w := newHeadWatcher(ldb, ldb.rt.Root(), datasetIDs, changes, closeChan)
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closeChan:
+			return nil
+		case <-ticker.C:
+			w.update(ldb.rt.Root())
+		}
+	}
+}
+
 func (ldb *LocalDatabase) doHeadUpdate(ds Dataset, updateFunc func(ds Dataset) error) (Dataset, error) {
+	ldb.flushValidatingBatchStore()
+	err := updateFunc(ds)
+	return ldb.GetDataset(ds.ID()), err
+}
+
+func (ldb *LocalDatabase) flushValidatingBatchStore() {
 	if ldb.vbs != nil {
 		ldb.vbs.FlushAndDestroyWithoutClose()
 		ldb.vbs = nil
 	}
-	err := updateFunc(ds)
-	return ldb.GetDataset(ds.ID()), err
 }
 
 func (ldb *LocalDatabase) validatingBatchStore() types.BatchStore {
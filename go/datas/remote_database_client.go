@@ -5,6 +5,9 @@
 package datas
 
 import (
+	"crypto/tls"
+
+	"github.com/attic-labs/noms/go/hash"
 	"github.com/attic-labs/noms/go/types"
 	"github.com/julienschmidt/httprouter"
 )
@@ -15,8 +18,23 @@ type RemoteDatabaseClient struct {
 }
 
 func NewRemoteDatabase(baseURL, auth string) *RemoteDatabaseClient {
-	httpBS := NewHTTPBatchStore(baseURL, auth)
-	return &RemoteDatabaseClient{newDatabaseCommon(newCachingChunkHaver(httpBS), types.NewValueStore(httpBS), httpBS)}
+	return NewRemoteDatabaseTLS(baseURL, auth, nil)
+}
+
+// NewRemoteDatabaseTLS is like NewRemoteDatabase, but connects to https
+// servers using |tlsConfig|, as by NewHTTPBatchStoreTLS().
+func NewRemoteDatabaseTLS(baseURL, auth string, tlsConfig *tls.Config) *RemoteDatabaseClient {
+	return NewRemoteDatabaseOpts(baseURL, auth, tlsConfig, DatabaseOptions{})
+}
+
+// NewRemoteDatabaseOpts is like NewRemoteDatabaseTLS, but also customizes the
+// Database with |opts|. CommitHooks given here run on the client, in addition
+// to any that the server runs.
+func NewRemoteDatabaseOpts(baseURL, auth string, tlsConfig *tls.Config, opts DatabaseOptions) *RemoteDatabaseClient {
+	httpBS := NewHTTPBatchStoreTLS(baseURL, auth, tlsConfig)
+	rdb := &RemoteDatabaseClient{newDatabaseCommon(newCachingChunkHaver(httpBS), types.NewValueStore(httpBS), httpBS)}
+	rdb.hooks = opts.Hooks
+	return rdb
 }
 
 func (rdb *RemoteDatabaseClient) validatingBatchStore() types.BatchStore {
@@ -31,7 +49,7 @@ func (rdb *RemoteDatabaseClient) GetDataset(datasetID string) Dataset {
 }
 
 func (rdb *RemoteDatabaseClient) Commit(ds Dataset, v types.Value, opts CommitOptions) (Dataset, error) {
-	err := rdb.doCommit(ds.ID(), buildNewCommit(ds, v, opts), opts.Policy)
+	err := rdb.doCommit(ds.ID(), buildNewCommit(ds, v, opts), opts.Policy, "commit")
 	return rdb.GetDataset(ds.ID()), err
 }
 
@@ -39,13 +57,23 @@ func (rdb *RemoteDatabaseClient) CommitValue(ds Dataset, v types.Value) (Dataset
 	return rdb.Commit(ds, v, CommitOptions{})
 }
 
+func (rdb *RemoteDatabaseClient) CommitMany(commits []DatasetCommit) ([]Dataset, error) {
+	err := rdb.doCommitMany(buildDatasetCommits(commits), "commit-many")
+	return getDatasets(rdb, commits), err
+}
+
 func (rdb *RemoteDatabaseClient) Delete(ds Dataset) (Dataset, error) {
 	err := rdb.doDelete(ds.ID())
 	return rdb.GetDataset(ds.ID()), err
 }
 
 func (rdb *RemoteDatabaseClient) SetHead(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
-	err := rdb.doSetHead(ds, newHeadRef)
+	err := rdb.doSetHead(ds, newHeadRef, false)
+	return rdb.GetDataset(ds.ID()), err
+}
+
+func (rdb *RemoteDatabaseClient) CompareAndSetHead(ds Dataset, newHeadRef types.Ref) (Dataset, error) {
+	err := rdb.doSetHead(ds, newHeadRef, true)
 	return rdb.GetDataset(ds.ID()), err
 }
 
@@ -54,6 +82,66 @@ func (rdb *RemoteDatabaseClient) FastForward(ds Dataset, newHeadRef types.Ref) (
 	return rdb.GetDataset(ds.ID()), err
 }
 
+func (rdb *RemoteDatabaseClient) CreateTag(name string, commitRef types.Ref, meta types.Struct) error {
+	return rdb.doCreateTag(name, commitRef, meta)
+}
+
+func (rdb *RemoteDatabaseClient) DeleteTag(name string) error {
+	return rdb.doDeleteTag(name)
+}
+
+func (rdb *RemoteDatabaseClient) SetSchema(datasetID string, schema *types.Type) error {
+	return rdb.doSetSchema(datasetID, schema)
+}
+
+func (rdb *RemoteDatabaseClient) BuildCommitGraph() error {
+	return rdb.doBuildCommitGraph()
+}
+
+func (rdb *RemoteDatabaseClient) DropCommitGraph() error {
+	return rdb.doDropCommitGraph()
+}
+
+// commitGraphSource fetches the entries of the commit-graph index from the
+// server a batch at a time, rather than reading the chunks of the index.
+func (rdb *RemoteDatabaseClient) commitGraphSource() graphSource {
+	if !rdb.rootMap().Has(types.String(CommitGraphKey)) {
+		return nil
+	}
+	hbs := rdb.BatchStore().(*httpBatchStore)
+	var src *indexSource
+	served := true
+	src = newIndexSource(rdb, func(h hash.Hash) (commitGraphEntry, bool) {
+		if !served {
+			return commitGraphEntry{}, false
+		}
+		entries, ok := hbs.getCommitGraph(h)
+		if !ok {
+			served = false
+			return commitGraphEntry{}, false
+		}
+		for _, e := range entries {
+			src.entries[e.h] = e
+		}
+		e, ok := src.entries[h]
+		return e, ok
+	})
+	return src
+}
+
+// Watch follows the root of the remote database as the server pushes it.
+func (rdb *RemoteDatabaseClient) Watch(changes chan<- HeadChange, closeChan <-chan struct{}, datasetIDs ...string) error {
+	var w *headWatcher
+	return rdb.BatchStore().(*httpBatchStore).watchRoot(closeChan, func(root hash.Hash) {
+		// The server starts by sending the root as it was when the watch began.
+		if w == nil {
+			w = newHeadWatcher(rdb, root, datasetIDs, changes, closeChan)
+		} else {
+			w.update(root)
+		}
+	})
+}
+
 func (f RemoteStoreFactory) CreateStore(ns string) Database {
 	return NewRemoteDatabase(f.host+httprouter.CleanPath(ns), f.auth)
 }
@@ -5,7 +5,9 @@
 package datas
 
 import (
+	"bufio"
 	"compress/gzip"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -13,6 +15,8 @@ import (
 	"net/http"
 	"net/url"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,6 +24,7 @@ import (
 	"github.com/attic-labs/noms/go/constants"
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/nbs"
 	"github.com/attic-labs/noms/go/ngql"
 	"github.com/attic-labs/noms/go/types"
 	"github.com/attic-labs/noms/go/util/verbose"
@@ -89,6 +94,29 @@ var (
 
 	HandleGraphQL = createHandler(handleGraphQL, false)
 
+	// HandleWatch is meant to handle HTTP GET requests to the watch/ server
+	// endpoint. The response is a stream of Server-Sent Events, each of
+	// which carries the hash of the Root as its data: first the current
+	// Root, and then the new Root every time it changes. The stream lasts
+	// until the client goes away.
+	HandleWatch = createHandler(handleWatch, true)
+
+	// HandleCommitGraph is meant to handle HTTP GET requests to the
+	// commitGraph/ server endpoint. Given the hashes of some Commits as |h|
+	// query params, the server returns the entries of its commit-graph index
+	// for them and their ancestors, tallest first, up to |limit| of them, one
+	// per line, as the hash of the Commit, its height, its date quoted as by
+	// strconv.Quote, and the hashes of its parents, separated by spaces. If
+	// the database has no commit-graph index, the response is a 404.
+	HandleCommitGraph = createHandler(handleCommitGraph, true)
+
+	// HandleCompaction is meant to handle HTTP GET requests to the
+	// compaction/ server endpoint. The server returns the metrics of the
+	// compaction its ChunkStore has done so far, as the JSON encoding of an
+	// nbs.CompactionMetrics. If the ChunkStore doesn't compact, the response
+	// is a 404.
+	HandleCompaction = createHandler(handleCompaction, false)
+
 	writeValueConcurrency = runtime.NumCPU()
 )
 
@@ -388,10 +416,183 @@ func handleRootPost(w http.ResponseWriter, req *http.Request, ps URLParams, cs c
 		assertMapOfStringToRefOfCommit(m, datasets, vs)
 	}
 
+	// Clients that may only write some datasets can't touch the others, even to delete them.
+	if perms, ok := permissionsFromRequest(req); ok {
+		if err := checkDatasetPermissions(perms, proposed.(types.Map), datasets); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	// Graph walks trust the commit-graph index, so it mustn't lie about any Commit.
+	if err := checkCommitGraph(vs, proposed.(types.Map), datasets); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// Clients check schemas before committing, but not all clients can be trusted to.
+	if err := checkSchemas(vs, proposed.(types.Map), datasets); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// Commit hooks see every dataset whose head the client is moving, but not deletions.
+	hooks := commitHooksFromRequest(req)
+	var moved []HeadChange
+	if !hooks.isEmpty() {
+		for _, change := range changedHeads(proposed.(types.Map), datasets) {
+			if change.NewHead == (types.Ref{}) {
+				continue
+			}
+			commit := vs.ReadValue(change.NewHead.TargetHash()).(types.Struct)
+			if err := hooks.preCommit(vs, change.DatasetID, commit, change.OldHead); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			moved = append(moved, change)
+		}
+	}
+
 	if !cs.UpdateRoot(current, last) {
 		w.WriteHeader(http.StatusConflict)
 		return
 	}
+
+	for _, change := range moved {
+		hooks.postCommit(vs, change.DatasetID, vs.ReadValue(change.NewHead.TargetHash()).(types.Struct), change.OldHead)
+	}
+
+	if rl, ok := cs.(chunks.RootLogger); ok {
+		reason := params.Get("reason")
+		if reason == "" {
+			reason = "update-root"
+		}
+		rl.LogRoot(chunks.RootLogEntry{Time: time.Now(), From: last, To: current, Reason: fmt.Sprintf("%s (via %s)", reason, req.RemoteAddr)})
+	}
+}
+
+// watchKeepAliveInterval is how often handleWatch sends a comment to keep
+// idle connections, and any proxies along the way, from timing out.
+const watchKeepAliveInterval = 30 * time.Second
+
+func handleWatch(w http.ResponseWriter, req *http.Request, ps URLParams, rt chunks.ChunkStore) {
+	if req.Method != "GET" {
+		d.Panic("Expected get method.")
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		d.Panic("Streaming isn't supported")
+	}
+
+	w.Header().Add("Content-Type", "text/event-stream")
+	w.Header().Add("Cache-Control", "no-cache")
+	last := rt.Root()
+	fmt.Fprintf(w, "data: %s\n\n", last)
+	flusher.Flush()
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	keepAlive := time.Now()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+			if root := rt.Root(); root != last {
+				last = root
+				fmt.Fprintf(w, "data: %s\n\n", root)
+			} else if time.Since(keepAlive) > watchKeepAliveInterval {
+				fmt.Fprint(w, ": keep-alive\n\n")
+			} else {
+				continue
+			}
+			keepAlive = time.Now()
+			flusher.Flush()
+		}
+	}
+}
+
+// compactingStore is a ChunkStore that reports the compaction it does, like
+// nbs.NomsBlockStore.
+type compactingStore interface {
+	CompactionMetrics() nbs.CompactionMetrics
+}
+
+func handleCompaction(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
+	if req.Method != "GET" {
+		d.Panic("Expected get method.")
+	}
+	store, ok := cs.(compactingStore)
+	if !ok {
+		http.Error(w, "The database doesn't compact its storage", http.StatusNotFound)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	d.PanicIfError(json.NewEncoder(w).Encode(store.CompactionMetrics()))
+}
+
+// commitGraphBatchSize is how many entries of the commit-graph index
+// handleCommitGraph returns if the client doesn't give a limit.
+const commitGraphBatchSize = 1 << 10
+
+func handleCommitGraph(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
+	if req.Method != "GET" {
+		d.Panic("Expected get method.")
+	}
+	d.PanicIfError(req.ParseForm())
+	limit := commitGraphBatchSize
+	if l := req.Form.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		d.PanicIfError(err)
+	}
+
+	vs := types.NewValueStore(types.NewBatchStoreAdaptor(cs))
+	root := types.NewMap()
+	if h := cs.Root(); !h.IsEmpty() {
+		root = vs.ReadValue(h).(types.Map)
+	}
+	index, ok := commitGraphFromRoot(vs, root)
+	if !ok {
+		http.Error(w, "The database has no commit-graph index", http.StatusNotFound)
+		return
+	}
+
+	seen := hash.HashSet{}
+	q := []commitGraphEntry{}
+	push := func(h hash.Hash) {
+		if seen.Has(h) {
+			return
+		}
+		seen.Insert(h)
+		if v, ok := index.MaybeGet(types.String(h.String())); ok {
+			q = append(q, commitGraphEntryFromStruct(h, v.(types.Struct)))
+		}
+	}
+	for _, str := range req.Form["h"] {
+		h, ok := hash.MaybeParse(str)
+		if !ok {
+			d.Panic("Invalid hash: %s", str)
+		}
+		push(h)
+	}
+
+	w.Header().Add("Content-Type", "text/plain")
+	buf := bufio.NewWriter(w)
+	defer buf.Flush()
+	for n := 0; n < limit && len(q) > 0; n++ {
+		sort.Slice(q, func(i, j int) bool {
+			return graphRef{q[i].h, q[i].height}.less(graphRef{q[j].h, q[j].height})
+		})
+		e := q[len(q)-1]
+		q = q[:len(q)-1]
+		fmt.Fprintf(buf, "%s %d %s", e.h, e.height, strconv.Quote(e.date))
+		for _, p := range e.parents {
+			fmt.Fprintf(buf, " %s", p)
+			push(p)
+		}
+		fmt.Fprintln(buf)
+	}
 }
 
 func handleGraphQL(w http.ResponseWriter, req *http.Request, ps URLParams, cs chunks.ChunkStore) {
@@ -468,6 +669,28 @@ func assertMapOfStringToRefOfCommit(proposed, datasets types.Map, vr types.Value
 			if !ok {
 				d.Panic("Root of a Database must be a Map<String, Ref<Commit>>, but key %s maps to a %s", change.V.(types.String), val.Type().Describe())
 			}
+			// Tags are stored alongside datasets, but point at a Tag and can't be changed once added.
+			if key := string(change.V.(types.String)); IsTagID(key) {
+				if change.ChangeType == types.DiffChangeModified {
+					d.Panic("Tag %s can't be moved", key[len(TagPrefix):])
+				}
+				if targetType := ref.TargetValue(vr).Type(); !IsTagType(targetType) {
+					d.Panic("Root of a Database must be a Map<String, Ref<Commit>>, but the tag at key %s points to a %s", key, targetType.Describe())
+				}
+				continue
+			}
+			if key := string(change.V.(types.String)); key == CommitGraphKey {
+				if targetType := ref.TargetValue(vr).Type(); targetType.Kind() != types.MapKind {
+					d.Panic("Root of a Database must be a Map<String, Ref<Commit>>, but the commit-graph index at key %s is a %s", key, targetType.Describe())
+				}
+				continue
+			}
+			if key := string(change.V.(types.String)); isSchemaKey(key) {
+				if targetType := ref.TargetValue(vr).Type(); !targetType.Equals(types.TypeType) {
+					d.Panic("Root of a Database must be a Map<String, Ref<Commit>>, but the schema at key %s is a %s", key, targetType.Describe())
+				}
+				continue
+			}
 			if targetType := ref.TargetValue(vr).Type(); !IsCommitType(targetType) {
 				d.Panic("Root of a Database must be a Map<String, Ref<Commit>>, not the ref at key %s points to a %s", change.V.(types.String), targetType.Describe())
 			}
@@ -7,17 +7,20 @@ package datas
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/nbs"
 	"github.com/attic-labs/noms/go/types"
 	"github.com/attic-labs/testify/assert"
 	"github.com/golang/snappy"
@@ -344,6 +347,37 @@ func TestHandleGetBase(t *testing.T) {
 	}
 }
 
+func TestHandleCompaction(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := nbs.NewLocalStore(dir, 1<<20)
+	defer store.Close()
+	for _, s := range []string{"a", "b"} {
+		c := chunks.NewChunk([]byte(s))
+		store.Put(c)
+		assert.True(store.UpdateRoot(c.Hash(), store.Root()))
+	}
+	_, err = store.Compact(nbs.CompactAllPolicy)
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	HandleCompaction(w, newRequest("GET", "", "", nil, nil), params{}, store)
+	if assert.Equal(http.StatusOK, w.Code, "Handler error:\n%s", string(w.Body.Bytes())) {
+		metrics := nbs.CompactionMetrics{}
+		assert.NoError(json.Unmarshal(w.Body.Bytes(), &metrics))
+		assert.Equal(store.CompactionMetrics(), metrics)
+		assert.Equal(uint64(2), metrics.TablesCompacted)
+	}
+
+	// Stores that don't compact have no metrics.
+	w = httptest.NewRecorder()
+	HandleCompaction(w, newRequest("GET", "", "", nil, nil), params{}, chunks.NewTestStore())
+	assert.Equal(http.StatusNotFound, w.Code)
+}
+
 func TestHandlePostRoot(t *testing.T) {
 	assert := assert.New(t)
 	cs := chunks.NewTestStore()
@@ -404,6 +438,75 @@ func TestRejectPostRoot(t *testing.T) {
 	assert.Equal(http.StatusBadRequest, w.Code, "Handler error:\n%s", string(w.Body.Bytes()))
 }
 
+func TestRejectPostRootSchemaMismatch(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	vs := types.NewValueStore(types.NewBatchStoreAdaptor(cs))
+
+	// The schema of dataset1 requires Strings, but a client that doesn't check it commits a Number.
+	schemaRef := vs.WriteValue(types.StringType)
+	commitRef := vs.WriteValue(buildTestCommit(types.String("head")))
+	last := vs.WriteValue(types.NewMap(types.String("dataset1"), types.ToRefOfValue(commitRef), types.String(SchemaPrefix+"dataset1"), types.ToRefOfValue(schemaRef)))
+	vs.Flush(last.TargetHash())
+	assert.True(cs.UpdateRoot(last.TargetHash(), hash.Hash{}))
+
+	commitRef = vs.WriteValue(buildTestCommit(types.Number(42), commitRef))
+	current := vs.WriteValue(last.TargetValue(vs).(types.Map).Set(types.String("dataset1"), types.ToRefOfValue(commitRef)))
+	vs.Flush(current.TargetHash())
+
+	u := &url.URL{}
+	queryParams := url.Values{}
+	queryParams.Add("last", last.TargetHash().String())
+	queryParams.Add("current", current.TargetHash().String())
+	u.RawQuery = queryParams.Encode()
+
+	w := httptest.NewRecorder()
+	HandleRootPost(w, newRequest("POST", "", u.String(), nil, nil), params{}, cs)
+	assert.Equal(http.StatusForbidden, w.Code, "Handler error:\n%s", string(w.Body.Bytes()))
+	assert.Equal(last.TargetHash(), cs.Root())
+}
+
+func TestRejectPostRootForgedCommitGraph(t *testing.T) {
+	assert := assert.New(t)
+	cs := chunks.NewTestStore()
+	vs := types.NewValueStore(types.NewBatchStoreAdaptor(cs))
+
+	first := buildTestCommit(types.String("first"))
+	firstRef := vs.WriteValue(first)
+	second := buildTestCommit(types.String("second"))
+	secondRef := vs.WriteValue(second)
+	vs.Flush(secondRef.TargetHash())
+	index, _ := indexCommits(vs, types.NewMap(), firstRef)
+	last := vs.WriteValue(types.NewMap(types.String("dataset1"), types.ToRefOfValue(firstRef), types.String(CommitGraphKey), types.ToRefOfValue(vs.WriteValue(index))))
+	vs.Flush(last.TargetHash())
+	assert.True(cs.UpdateRoot(last.TargetHash(), hash.Hash{}))
+
+	post := func(index types.Map) int {
+		current := vs.WriteValue(last.TargetValue(vs).(types.Map).Set(types.String(CommitGraphKey), types.ToRefOfValue(vs.WriteValue(index))))
+		vs.Flush(current.TargetHash())
+		u := &url.URL{}
+		queryParams := url.Values{}
+		queryParams.Add("last", last.TargetHash().String())
+		queryParams.Add("current", current.TargetHash().String())
+		u.RawQuery = queryParams.Encode()
+		w := httptest.NewRecorder()
+		HandleRootPost(w, newRequest("POST", "", u.String(), nil, nil), params{}, cs)
+		return w.Code
+	}
+
+	// Claiming that |second| descends from |first| is a lie...
+	forged := newCommitGraphEntry(secondRef, second)
+	forged.parents = []hash.Hash{firstRef.TargetHash()}
+	assert.Equal(http.StatusForbidden, post(index.Set(types.String(secondRef.TargetHash().String()), forged.toStruct())))
+	// ...as is rewriting what the index says about |first|...
+	assert.Equal(http.StatusForbidden, post(index.Set(types.String(firstRef.TargetHash().String()), forged.toStruct())))
+	assert.Equal(last.TargetHash(), cs.Root())
+
+	// ...but adding what's true is fine.
+	index, _ = indexCommits(vs, index, secondRef)
+	assert.Equal(http.StatusOK, post(index))
+}
+
 type params map[string]string
 
 func (p params) ByName(k string) string {
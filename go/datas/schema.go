@@ -0,0 +1,119 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// SchemaPrefix marks the keys in the root Map of a Database that hold the
+// schema of a dataset rather than its head. The schema of dataset "foo" is a
+// Ref<Type> stored at SchemaPrefix + "foo".
+const SchemaPrefix = "@schema:"
+
+// SchemaError is returned when the value of a Commit doesn't match the schema
+// of the dataset it's being committed to.
+type SchemaError struct {
+	DatasetID string
+	Schema    *types.Type
+	Type      *types.Type
+}
+
+func (e SchemaError) Error() string {
+	return fmt.Sprintf("Dataset %s requires values of type %s, but got a %s", e.DatasetID, e.Schema.Describe(), e.Type.Describe())
+}
+
+// isSchemaKey returns true if |key|, from the root Map of a Database, holds the
+// schema of a dataset.
+func isSchemaKey(key string) bool {
+	return strings.HasPrefix(key, SchemaPrefix)
+}
+
+// schemaFromRoot returns the schema of the dataset |datasetID| in |root|, which
+// is the Map at the root of a Database, or nil if it has none.
+func schemaFromRoot(vr types.ValueReader, root types.Map, datasetID string) *types.Type {
+	if r, ok := root.MaybeGet(types.String(SchemaPrefix + datasetID)); ok {
+		return r.(types.Ref).TargetValue(vr).(*types.Type)
+	}
+	return nil
+}
+
+// checkSchema returns a SchemaError if the value of |commit| doesn't match
+// |schema|. A nil schema matches anything.
+func checkSchema(datasetID string, schema *types.Type, commit types.Struct) error {
+	if schema == nil {
+		return nil
+	}
+	if t := commit.Get(ValueField).Type(); !types.IsSubtype(schema, t) {
+		return SchemaError{datasetID, schema, t}
+	}
+	return nil
+}
+
+// checkSchemas returns a SchemaError if the head of any dataset in |proposed|,
+// the Map at the root of a Database, doesn't match its schema, where the head
+// or the schema differs from that in |last|.
+func checkSchemas(vr types.ValueReader, proposed, last types.Map) error {
+	changes := make(chan types.ValueChanged)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(changes)
+		proposed.Diff(last, changes, stop)
+	}()
+	ids := map[string]bool{}
+	for change := range changes {
+		if key := string(change.V.(types.String)); isSchemaKey(key) {
+			ids[key[len(SchemaPrefix):]] = true
+		} else if !IsTagID(key) && key != CommitGraphKey {
+			ids[key] = true
+		}
+	}
+	for id := range ids {
+		if r, ok := proposed.MaybeGet(types.String(id)); ok {
+			if err := checkSchema(id, schemaFromRoot(vr, proposed, id), r.(types.Ref).TargetValue(vr).(types.Struct)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (dbc *databaseCommon) Schema(datasetID string) *types.Type {
+	return schemaFromRoot(dbc, dbc.rootMap(), datasetID)
+}
+
+// doSetSchema makes |schema| the schema of the dataset |datasetID|, or clears it if |schema| is nil. Like doCommit(), it retries if the root is changed concurrently by another writer. It fails with a SchemaError if the current head of the dataset doesn't match the new schema.
+func (dbc *databaseCommon) doSetSchema(datasetID string, schema *types.Type) error {
+	if !DatasetFullRe.MatchString(datasetID) {
+		d.Panic("Invalid dataset ID: %s", datasetID)
+	}
+	defer dbc.resetRoot()
+
+	key := types.String(SchemaPrefix + datasetID)
+	var err error
+	for err = ErrOptimisticLockFailed; err == ErrOptimisticLockFailed; {
+		currentRootHash, currentRoot := dbc.getRootAndDatasets()
+		if schema == nil {
+			if !currentRoot.Has(key) {
+				return nil
+			}
+			err = dbc.tryUpdateRoot(currentRoot.Remove(key), currentRootHash, fmt.Sprintf("clear-schema %s", datasetID))
+			continue
+		}
+		if r, ok := currentRoot.MaybeGet(types.String(datasetID)); ok {
+			if err := checkSchema(datasetID, schema, r.(types.Ref).TargetValue(dbc).(types.Struct)); err != nil {
+				return err
+			}
+		}
+		schemaRef := dbc.WriteValue(schema) // will be orphaned if the tryUpdateRoot() below fails
+		err = dbc.tryUpdateRoot(currentRoot.Set(key, types.ToRefOfValue(schemaRef)), currentRootHash, fmt.Sprintf("set-schema %s %s", datasetID, schemaRef.TargetHash()))
+	}
+	return err
+}
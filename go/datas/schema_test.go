@@ -0,0 +1,70 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func testSchema(assert *assert.Assertions, db Database) {
+	rowType := types.MakeStructType("Row", []string{"name"}, []*types.Type{types.StringType})
+	schema := types.MakeMapType(types.StringType, rowType)
+	row := func(name string) types.Struct {
+		return types.NewStruct("Row", types.StructData{"name": types.String(name)})
+	}
+
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.NewMap(types.String("a"), row("a")))
+	assert.NoError(err)
+	first := ds.HeadRef()
+	assert.Nil(db.Schema("ds"))
+	assert.NoError(db.SetSchema("ds", schema))
+	assert.True(schema.Equals(db.Schema("ds")))
+
+	// Schemas aren't datasets.
+	assert.Equal(uint64(1), db.Datasets().Len())
+	assert.True(db.Fsck().OK())
+
+	ds, err = db.CommitValue(ds, types.NewMap(types.String("b"), row("b")))
+	assert.NoError(err)
+	second := ds.HeadRef()
+
+	_, err = db.CommitValue(ds, types.NewList(types.Number(1)))
+	if assert.IsType(SchemaError{}, err) {
+		assert.Equal("ds", err.(SchemaError).DatasetID)
+		assert.Contains(err.Error(), "List<Number>")
+	}
+	bad := db.WriteValue(NewCommit(types.NewList(types.Number(1)), types.NewSet(second), types.EmptyStruct))
+	_, err = db.SetHead(ds, bad)
+	assert.IsType(SchemaError{}, err)
+	_, err = db.FastForward(ds, bad)
+	assert.IsType(SchemaError{}, err)
+	assert.True(second.Equals(db.GetDataset("ds").HeadRef()))
+
+	// Values that match are fine, however they got there.
+	ds, err = db.SetHead(ds, first)
+	assert.NoError(err)
+
+	// The current head has to match a new schema.
+	assert.IsType(SchemaError{}, db.SetSchema("ds", types.MakeListType(types.NumberType)))
+	assert.True(schema.Equals(db.Schema("ds")))
+
+	assert.NoError(db.SetSchema("ds", nil))
+	assert.Nil(db.Schema("ds"))
+	_, err = db.CommitValue(ds, types.NewList(types.Number(1)))
+	assert.NoError(err)
+}
+
+func TestLocalDatabaseSchema(t *testing.T) {
+	testSchema(assert.New(t), NewDatabase(chunks.NewTestStore()))
+}
+
+func TestRemoteDatabaseSchema(t *testing.T) {
+	hbs := NewHTTPBatchStoreForTest(chunks.NewTestStore())
+	testSchema(assert.New(t), &RemoteDatabaseClient{newDatabaseCommon(newCachingChunkHaver(hbs), types.NewValueStore(hbs), hbs)})
+}
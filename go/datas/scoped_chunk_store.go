@@ -0,0 +1,247 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"sync"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// scopedChunkStore is a read-only view of a ChunkStore that only exposes the
+// datasets whose IDs match one of |patterns|. Its root is a copy of the
+// underlying root Map that only holds those datasets, and it only serves the
+// chunks of that Map and the chunks reachable from the datasets' heads.
+//
+// Working out which chunks are reachable means walking the whole history of
+// the exposed datasets, so that's done the first time a chunk is asked for,
+// and the result is kept until the underlying root changes. Then only the
+// chunks that are new since the last walk are walked, as long as the heads it
+// started from are still reachable, e.g. because the datasets' heads have only
+// moved forward.
+type scopedChunkStore struct {
+	chunks.ChunkStore
+	patterns []string
+
+	mu       *sync.Mutex
+	root     hash.Hash // the underlying root that |filtered| reflects
+	filtered *chunks.MemoryStore
+
+	// walkMu guards the fields below, which are only brought up to date when
+	// chunks are asked for, so that Root() doesn't wait for a walk.
+	walkMu         *sync.Mutex
+	reachableRoot  hash.Hash           // the underlying root that |reachable| reflects
+	reachableMap   *chunks.MemoryStore // the chunks of the filtered root Map for reachableRoot
+	reachable      hash.HashSet
+	reachableHeads hash.HashSet // the heads that |reachable| was walked from
+}
+
+func newScopedChunkStore(cs chunks.ChunkStore, patterns []string) *scopedChunkStore {
+	return &scopedChunkStore{ChunkStore: cs, patterns: patterns, mu: &sync.Mutex{}, walkMu: &sync.Mutex{}}
+}
+
+// Root returns the hash of the filtered root Map.
+func (scs *scopedChunkStore) Root() hash.Hash {
+	scs.mu.Lock()
+	defer scs.mu.Unlock()
+	return scs.filteredRoot()
+}
+
+// filteredRoot builds the filtered root Map, if the underlying root has
+// changed since it was last built, and returns its hash. Callers must hold
+// scs.mu.
+func (scs *scopedChunkStore) filteredRoot() hash.Hash {
+	root := scs.ChunkStore.Root()
+	if scs.filtered != nil && root == scs.root {
+		return scs.filtered.Root()
+	}
+
+	// Reading the root through the same ValueStore that writes the filtered
+	// Map tells it that the heads exist, which it checks before writing. That
+	// also leaves the chunks it read in |scratch|, so only the chunks of the
+	// filtered Map are kept.
+	scratch := chunks.NewMemoryStore()
+	vs := types.NewValueStore(types.NewBatchStoreAdaptor(NewLazyChunkStore(scratch, scs.ChunkStore)))
+	datasets := types.NewMap()
+	if !root.IsEmpty() {
+		vs.ReadValue(root).(types.Map).IterAll(func(k, v types.Value) {
+			if matchDatasetPatterns(scs.patterns, string(k.(types.String))) {
+				datasets = datasets.Set(k, v)
+			}
+		})
+	}
+	r := vs.WriteValue(datasets)
+	vs.Flush(r.TargetHash())
+
+	scs.filtered = chunks.NewMemoryStore()
+	for next := []hash.Hash{r.TargetHash()}; len(next) > 0; next = next[1:] {
+		if c := scratch.Get(next[0]); !c.IsEmpty() && !scs.filtered.Has(c.Hash()) {
+			scs.filtered.Put(c)
+			types.DecodeValue(c, nil).WalkRefs(func(ref types.Ref) {
+				next = append(next, ref.TargetHash())
+			})
+		}
+	}
+	d.PanicIfFalse(scs.filtered.UpdateRoot(r.TargetHash(), hash.Hash{}))
+	scs.root = root
+	return r.TargetHash()
+}
+
+// filterReachable returns those of |hashes| that are part of the filtered root
+// Map or reachable from one of the heads in it, along with the chunks of that
+// Map, from which the former must be served.
+func (scs *scopedChunkStore) filterReachable(hashes hash.HashSet) (hash.HashSet, *chunks.MemoryStore) {
+	scs.walkMu.Lock()
+	defer scs.walkMu.Unlock()
+
+	scs.mu.Lock()
+	filteredRoot := scs.filteredRoot()
+	root, filtered := scs.root, scs.filtered
+	scs.mu.Unlock()
+
+	if scs.reachable == nil || root != scs.reachableRoot {
+		heads := hash.HashSet{}
+		types.DecodeValue(filtered.Get(filteredRoot), nil).(types.Map).IterAll(func(k, v types.Value) {
+			heads.Insert(v.(types.Ref).TargetHash())
+		})
+		if scs.reachable == nil || !scs.updateReachable(heads) {
+			scs.reachable = scs.walk(heads, nil)
+		}
+		scs.reachableRoot, scs.reachableMap, scs.reachableHeads = root, filtered, heads
+	}
+
+	found := hash.HashSet{}
+	for h := range hashes {
+		if scs.reachableMap.Has(h) || scs.reachable.Has(h) {
+			found.Insert(h)
+		}
+	}
+	return found, scs.reachableMap
+}
+
+// updateReachable adds the chunks reachable from |heads| to scs.reachable,
+// walking only those that aren't in it already. That only works if all the
+// chunks that are in it are still reachable, which is the case if the walk
+// comes across every one of scs.reachableHeads; if it doesn't, it returns
+// false and scs.reachable is left as it was.
+func (scs *scopedChunkStore) updateReachable(heads hash.HashSet) bool {
+	if len(heads) == len(scs.reachableHeads) {
+		same := true
+		for h := range heads {
+			same = same && scs.reachableHeads.Has(h)
+		}
+		if same {
+			return true
+		}
+	}
+	added := scs.walk(heads, scs.reachable)
+	for h := range scs.reachableHeads {
+		if !heads.Has(h) && !added.Has(h) {
+			return false
+		}
+	}
+	for h := range added {
+		scs.reachable.Insert(h)
+	}
+	return true
+}
+
+// walk returns the hashes of |start| and of every chunk reachable from them,
+// without walking any further from those in |known|. Those in |known| that it
+// comes across are included, but not the chunks reachable from them.
+func (scs *scopedChunkStore) walk(start, known hash.HashSet) hash.HashSet {
+	reachable := hash.HashSet{}
+	for next := start; len(next) > 0; {
+		batch := hash.HashSet{}
+		for h := range next {
+			if !reachable.Has(h) {
+				reachable.Insert(h)
+				if !known.Has(h) {
+					batch.Insert(h)
+				}
+			}
+		}
+		next = hash.HashSet{}
+
+		found := make(chan *chunks.Chunk, len(batch))
+		scs.ChunkStore.GetMany(batch, found)
+		close(found)
+		for c := range found {
+			types.DecodeValue(*c, nil).WalkRefs(func(r types.Ref) {
+				next.Insert(r.TargetHash())
+			})
+		}
+	}
+	return reachable
+}
+
+// Get returns the Chunk for |h|, or the empty Chunk if |h| isn't reachable
+// from the exposed datasets.
+func (scs *scopedChunkStore) Get(h hash.Hash) chunks.Chunk {
+	found, filtered := scs.filterReachable(hash.HashSet{h: struct{}{}})
+	if !found.Has(h) {
+		return chunks.EmptyChunk
+	}
+	if c := filtered.Get(h); !c.IsEmpty() {
+		return c
+	}
+	return scs.ChunkStore.Get(h)
+}
+
+// GetMany sends the Chunks for those of |hashes| that are reachable from the
+// exposed datasets.
+func (scs *scopedChunkStore) GetMany(hashes hash.HashSet, foundChunks chan *chunks.Chunk) {
+	remaining, filtered := scs.filterReachable(hashes)
+	scs.checked(filtered).GetMany(remaining, foundChunks)
+}
+
+// Has returns false for chunks that aren't reachable from the exposed
+// datasets, whether or not the underlying ChunkStore has them.
+func (scs *scopedChunkStore) Has(h hash.Hash) bool {
+	found, filtered := scs.filterReachable(hash.HashSet{h: struct{}{}})
+	return found.Has(h) && (filtered.Has(h) || scs.ChunkStore.Has(h))
+}
+
+// checked returns a view of scs that serves chunks which filterReachable()
+// has already found to be reachable, without checking them again. |filtered|
+// is the Map it returned them with.
+func (scs *scopedChunkStore) checked(filtered *chunks.MemoryStore) chunks.ChunkStore {
+	return &checkedChunkStore{scs, filtered}
+}
+
+// checkedChunkStore serves the chunks of the filtered root Map of a
+// scopedChunkStore, and all other chunks from the underlying ChunkStore.
+type checkedChunkStore struct {
+	*scopedChunkStore
+	filtered *chunks.MemoryStore
+}
+
+func (ccs *checkedChunkStore) GetMany(hashes hash.HashSet, foundChunks chan *chunks.Chunk) {
+	remaining := hash.HashSet{}
+	for h := range hashes {
+		if c := ccs.filtered.Get(h); !c.IsEmpty() {
+			foundChunks <- &c
+		} else {
+			remaining.Insert(h)
+		}
+	}
+	ccs.scopedChunkStore.ChunkStore.GetMany(remaining, foundChunks)
+}
+
+func (scs *scopedChunkStore) Put(c chunks.Chunk) {
+	d.Panic("Can't write to a dataset-scoped ChunkStore")
+}
+
+func (scs *scopedChunkStore) PutMany(cs []chunks.Chunk) {
+	d.Panic("Can't write to a dataset-scoped ChunkStore")
+}
+
+func (scs *scopedChunkStore) UpdateRoot(current, last hash.Hash) bool {
+	d.Panic("Can't write to a dataset-scoped ChunkStore")
+	return false
+}
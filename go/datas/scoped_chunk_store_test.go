@@ -0,0 +1,149 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/constants"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+	"github.com/julienschmidt/httprouter"
+)
+
+func setupScopedTest() (cs chunks.ChunkStore, public, private types.Struct) {
+	cs = chunks.NewMemoryStore()
+	db := NewDatabase(cs)
+	ds, err := db.CommitValue(db.GetDataset("public/a"), db.WriteValue(types.NewList(types.String("public"))))
+	d.PanicIfError(err)
+	public = ds.Head()
+	ds, err = db.CommitValue(db.GetDataset("private"), db.WriteValue(types.NewList(types.String("private"))))
+	d.PanicIfError(err)
+	return cs, public, ds.Head()
+}
+
+func TestScopedChunkStore(t *testing.T) {
+	assert := assert.New(t)
+	cs, public, private := setupScopedTest()
+	scs := newScopedChunkStore(cs, []string{"public/*"})
+
+	db := NewDatabase(scs)
+	assert.Equal(1, int(db.Datasets().Len()))
+	assert.True(public.Equals(db.GetDataset("public/a").Head()))
+	_, ok := db.GetDataset("private").MaybeHead()
+	assert.False(ok)
+
+	assert.True(scs.Has(public.Hash()))
+	assert.False(scs.Get(public.Get(ValueField).(types.Ref).TargetHash()).IsEmpty())
+	assert.False(scs.Has(private.Hash()))
+	assert.True(scs.Get(private.Hash()).IsEmpty())
+	assert.True(scs.Get(private.Get(ValueField).(types.Ref).TargetHash()).IsEmpty())
+	assert.True(scs.Get(cs.Root()).IsEmpty())
+
+	found := make(chan *chunks.Chunk, 2)
+	scs.GetMany(hash.HashSet{public.Hash(): struct{}{}, private.Hash(): struct{}{}}, found)
+	close(found)
+	assert.Len(found, 1)
+	assert.Equal(public.Hash(), (<-found).Hash())
+
+	assert.Panics(func() {
+		scs.Put(chunks.NewChunk([]byte("abc")))
+	})
+
+	// The scope follows changes to the underlying root.
+	udb := NewDatabase(cs)
+	_, err := udb.CommitValue(udb.GetDataset("public/b"), types.String("b"))
+	assert.NoError(err)
+	assert.Equal(2, int(NewDatabase(scs).Datasets().Len()))
+}
+
+// countingChunkStore counts the chunks that are asked for with GetMany().
+type countingChunkStore struct {
+	chunks.ChunkStore
+	count int
+}
+
+func (ccs *countingChunkStore) GetMany(hashes hash.HashSet, foundChunks chan *chunks.Chunk) {
+	ccs.count += len(hashes)
+	ccs.ChunkStore.GetMany(hashes, foundChunks)
+}
+
+func TestScopedChunkStoreFollowsHeads(t *testing.T) {
+	assert := assert.New(t)
+	cs, public, private := setupScopedTest()
+	ccs := &countingChunkStore{ChunkStore: cs}
+	scs := newScopedChunkStore(ccs, []string{"public/*"})
+	assert.True(scs.Has(public.Hash()))
+
+	// Until the root changes, chunks are checked without walking again.
+	ccs.count = 0
+	assert.True(scs.Has(public.Get(ValueField).(types.Ref).TargetHash()))
+	assert.False(scs.Has(private.Hash()))
+	assert.Equal(0, ccs.count)
+
+	// When the head moves forward, only the new chunks are walked. They become reachable, and the old ones stay so.
+	db := NewDatabase(cs)
+	ds, err := db.CommitValue(db.GetDataset("public/a"), db.WriteValue(types.NewList(types.String("newer"))))
+	assert.NoError(err)
+	newer := ds.Head()
+	ccs.count = 0
+	assert.True(scs.Has(newer.Hash()))
+	assert.Equal(2, ccs.count)
+	assert.True(scs.Has(newer.Get(ValueField).(types.Ref).TargetHash()))
+	assert.True(scs.Has(public.Hash()))
+
+	// When it moves back, the chunks it left behind are no longer reachable.
+	_, err = db.SetHead(ds, types.NewRef(public))
+	assert.NoError(err)
+	assert.True(scs.Has(public.Hash()))
+	assert.False(scs.Has(newer.Hash()))
+	assert.False(scs.Has(newer.Get(ValueField).(types.Ref).TargetHash()))
+}
+
+func TestScopedServer(t *testing.T) {
+	assert := assert.New(t)
+	cs, public, private := setupScopedTest()
+	s := &RemoteDatabaseServer{cs: newScopedChunkStore(cs, []string{"public/*"}), Datasets: []string{"public/*"}}
+
+	getRefs := func(hashes ...string) int {
+		form := url.Values{"ref": hashes}
+		req, _ := http.NewRequest("POST", constants.GetRefsPath, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(NomsVersionHeader, constants.NomsVersion)
+		w := httptest.NewRecorder()
+		s.authHandle(s.scopeHandle(HandleGetRefs), false)(w, req, nil)
+		return w.Code
+	}
+	assert.Equal(http.StatusOK, getRefs(public.Hash().String()))
+	assert.Equal(http.StatusForbidden, getRefs(public.Hash().String(), private.Hash().String()))
+
+	w := httptest.NewRecorder()
+	s.authHandle(s.makeHandle(HandleRootPost), true)(w, newRequest("POST", "", constants.RootPath, nil, nil), httprouter.Params{})
+	assert.Equal(http.StatusForbidden, w.Code, fmt.Sprintf("%s", w.Body))
+}
+
+func TestReadOnlyServer(t *testing.T) {
+	assert := assert.New(t)
+	s := &RemoteDatabaseServer{cs: chunks.NewMemoryStore(), ReadOnly: true}
+
+	for _, path := range []string{constants.WriteValuePath, constants.RootPath} {
+		w := httptest.NewRecorder()
+		s.authHandle(s.makeHandle(HandleWriteValue), true)(w, newRequest("POST", "", path, nil, nil), nil)
+		assert.Equal(http.StatusForbidden, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req := newRequest("GET", "", constants.RootPath, nil, http.Header{NomsVersionHeader: {constants.NomsVersion}})
+	s.authHandle(s.makeHandle(HandleRootGet), false)(w, req, nil)
+	assert.Equal(http.StatusOK, w.Code)
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// PullShallow copies the Commit referenced by |sourceRef| from srcDB to
+// sinkDB, along with |depth|-1 generations of its ancestors and, for each of
+// those Commits, everything reachable from the value at |subtree| within it,
+// if there is one. For example, a |depth| of 1 and a |subtree| of .value
+// copies the head Commit and its value, but none of its history.
+//
+// All other chunks are left behind, so sinkDB must be a LocalDatabase that can
+// fetch them on demand, typically because it's backed by a LazyChunkStore
+// whose upstream is srcDB. Unlike Pull(), PullShallow() doesn't validate the
+// chunks it writes, since that would require reading the chunks they refer
+// to.
+func PullShallow(srcDB, sinkDB Database, sourceRef types.Ref, depth int, subtree types.Path, progressCh chan PullProgress) {
+	d.PanicIfFalse(depth > 0)
+	ldb, ok := sinkDB.(*LocalDatabase)
+	if !ok {
+		d.Panic("Can't pull shallowly into a remote database")
+	}
+	hasLocal := ldb.cs.Has
+	if lcs, ok := ldb.cs.(*LazyChunkStore); ok {
+		hasLocal = lcs.HasLocal
+	}
+	srcBS := srcDB.validatingBatchStore()
+
+	var doneCount, knownCount, writtenBytes uint64
+	put := func(cs []chunks.Chunk) {
+		ldb.cs.PutMany(cs)
+		if progressCh == nil {
+			return
+		}
+		for _, c := range cs {
+			writtenBytes += uint64(len(c.Data()))
+		}
+		doneCount += uint64(len(cs))
+		progressCh <- PullProgress{doneCount, knownCount, writtenBytes}
+	}
+
+	// pullTree copies every chunk reachable from |v| that isn't already in
+	// sinkDB, one level of the tree at a time.
+	pullTree := func(v types.Value) {
+		next := hash.HashSet{}
+		v.WalkRefs(func(r types.Ref) {
+			next.Insert(r.TargetHash())
+		})
+		for len(next) > 0 {
+			batch := hash.HashSet{}
+			for h := range next {
+				if !hasLocal(h) {
+					batch.Insert(h)
+				}
+			}
+			knownCount += uint64(len(batch))
+			next = hash.HashSet{}
+
+			found := make(chan *chunks.Chunk, len(batch))
+			srcBS.GetMany(batch, found)
+			close(found)
+			cs := make([]chunks.Chunk, 0, len(batch))
+			for c := range found {
+				cs = append(cs, *c)
+				types.DecodeValue(*c, nil).WalkRefs(func(r types.Ref) {
+					next.Insert(r.TargetHash())
+				})
+			}
+			put(cs)
+		}
+	}
+
+	visited := hash.HashSet{}
+	commits := types.RefSlice{sourceRef}
+	for generation := 0; generation < depth && len(commits) > 0; generation++ {
+		parents := types.RefSlice{}
+		for _, r := range commits {
+			h := r.TargetHash()
+			if visited.Has(h) {
+				continue
+			}
+			visited.Insert(h)
+
+			c := srcBS.Get(h)
+			if c.IsEmpty() {
+				d.Panic("Commit %s not found in source database", h)
+			}
+			v := types.DecodeValue(c, srcDB)
+			if !IsCommitType(v.Type()) {
+				d.Panic("Can't pull shallowly from a non-Commit: %s", h)
+			}
+			commit := v.(types.Struct)
+			knownCount++
+			put([]chunks.Chunk{c})
+
+			if !subtree.IsEmpty() {
+				if v := subtree.Resolve(commit); v != nil {
+					pullTree(v)
+				}
+			}
+			commit.Get(ParentsField).(types.Set).IterAll(func(p types.Value) {
+				parents = append(parents, p.(types.Ref))
+			})
+		}
+		commits = parents
+	}
+}
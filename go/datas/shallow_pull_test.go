@@ -0,0 +1,91 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/suite"
+)
+
+func TestShallowPull(t *testing.T) {
+	suite.Run(t, &ShallowPullSuite{})
+}
+
+type ShallowPullSuite struct {
+	suite.Suite
+	sinkCS   *chunks.TestStore
+	sourceCS *chunks.TestStore
+	sink     Database
+	source   Database
+}
+
+func (suite *ShallowPullSuite) SetupTest() {
+	suite.sinkCS = chunks.NewTestStore()
+	suite.sourceCS = chunks.NewTestStore()
+	suite.sink = NewDatabase(NewLazyChunkStore(suite.sinkCS, suite.sourceCS))
+	suite.source = NewDatabase(suite.sourceCS)
+}
+
+func (suite *ShallowPullSuite) TearDownTest() {
+	suite.sink.Close()
+	suite.source.Close()
+}
+
+// commitLists commits two Commits to the source, each with a List of several
+// chunks as its value, and returns refs to both.
+func (suite *ShallowPullSuite) commitLists() (parent, head types.Ref) {
+	ds := suite.source.GetDataset(datasetID)
+	ds, err := suite.source.CommitValue(ds, buildListOfHeight(2, suite.source))
+	suite.NoError(err)
+	parent = ds.HeadRef()
+	ds, err = suite.source.CommitValue(ds, buildListOfHeight(3, suite.source))
+	suite.NoError(err)
+	return parent, ds.HeadRef()
+}
+
+// readAll reads every chunk reachable from |v|.
+func readAll(v types.Value, vr types.ValueReader) {
+	v.WalkRefs(func(r types.Ref) {
+		readAll(r.TargetValue(vr), vr)
+	})
+}
+
+func (suite *ShallowPullSuite) TestPullHeadOnly() {
+	parent, head := suite.commitLists()
+
+	PullShallow(suite.source, suite.sink, head, 1, nil, nil)
+	suite.True(suite.sinkCS.Has(head.TargetHash()))
+	suite.False(suite.sinkCS.Has(parent.TargetHash()))
+	headValue := suite.source.ReadValue(head.TargetHash()).(types.Struct).Get(ValueField)
+	headValue.WalkRefs(func(r types.Ref) {
+		suite.False(suite.sinkCS.Has(r.TargetHash()))
+	})
+
+	// Everything that was left behind can still be read, from upstream.
+	ds, err := suite.sink.SetHead(suite.sink.GetDataset(datasetID), head)
+	suite.NoError(err)
+	readAll(ds.Head(), suite.sink)
+	suite.True(suite.sinkCS.Has(parent.TargetHash()))
+}
+
+func (suite *ShallowPullSuite) TestPullDepthAndSubtree() {
+	parent, head := suite.commitLists()
+
+	subtree, err := types.ParsePath(".value")
+	suite.NoError(err)
+	PullShallow(suite.source, suite.sink, head, 2, subtree, nil)
+	suite.True(suite.sinkCS.Has(head.TargetHash()))
+	suite.True(suite.sinkCS.Has(parent.TargetHash()))
+
+	reads := suite.sourceCS.Reads
+	ds, err := suite.sink.SetHead(suite.sink.GetDataset(datasetID), head)
+	suite.NoError(err)
+	readAll(ds.HeadValue(), suite.sink)
+	readAll(parent.TargetValue(suite.sink).(types.Struct).Get(ValueField), suite.sink)
+	suite.Equal(reads, suite.sourceCS.Reads, "Values within the subtree shouldn't be fetched from upstream")
+}
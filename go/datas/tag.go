@@ -0,0 +1,158 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/types"
+)
+
+const (
+	// TagPrefix marks the keys in the root Map of a Database that hold tags
+	// rather than datasets. GetDataset(TagPrefix + name) returns a read-only
+	// Dataset whose head is the tagged Commit.
+	TagPrefix = "@tag:"
+
+	TagCommitField = "commit"
+)
+
+// TagNameRe is a regexp that matches a legal tag name anywhere within the
+// target string. Tag names are like Dataset names, except that they may also
+// contain dots followed by a digit, as in "release-1.2". Those can't be
+// confused with a following Path, since field names can't start with a digit.
+var TagNameRe = regexp.MustCompile(DatasetRe.String() + `(?:\.[0-9][a-zA-Z0-9\-_/]*)*`)
+
+// TagNameFullRe is a regexp that matches only a target string that is
+// entirely a legal tag name.
+var TagNameFullRe = regexp.MustCompile("^" + TagNameRe.String() + "$")
+
+// DatasetOrTagRe is a regexp that matches a legal Dataset name, or a tag name
+// preceded by TagPrefix, anywhere within the target string.
+var DatasetOrTagRe = regexp.MustCompile("(?:" + TagPrefix + TagNameRe.String() + "|" + DatasetRe.String() + ")")
+
+var (
+	ErrTagExists    = errors.New("Tag already exists")
+	ErrTagNotFound  = errors.New("Tag does not exist")
+	ErrTagImmutable = errors.New("Tags can't be moved")
+)
+
+var valueTagType = types.MakeStructType("Tag", []string{TagCommitField, MetaField}, []*types.Type{types.MakeRefType(valueCommitType), types.EmptyStructType})
+
+// NewTag creates a new tag object, which points at the Commit referenced by
+// |commitRef| and is annotated with |meta|:
+//
+// ```
+// struct Tag {
+//   commit: Ref<Commit>,
+//   meta: M,
+// }
+// ```
+func NewTag(commitRef types.Ref, meta types.Struct) types.Struct {
+	if !IsRefOfCommitType(commitRef.Type()) {
+		d.Panic("Can't tag a non-Commit: %s", commitRef.Type().Describe())
+	}
+	return types.NewStruct("Tag", types.StructData{
+		MetaField:      meta,
+		TagCommitField: commitRef,
+	})
+}
+
+func IsTagType(t *types.Type) bool {
+	return types.IsSubtype(valueTagType, t)
+}
+
+// IsTagID returns true if |datasetID| refers to a tag rather than a Dataset.
+func IsTagID(datasetID string) bool {
+	return strings.HasPrefix(datasetID, TagPrefix)
+}
+
+// tagsFromRoot returns the tags in |root|, which is the Map at the root of a
+// Database, as a Map from tag name to Ref<Tag>.
+func tagsFromRoot(root types.Map) types.Map {
+	tags := types.NewMap()
+	root.IterFrom(types.String(TagPrefix), func(k, v types.Value) bool {
+		name := string(k.(types.String))
+		if !IsTagID(name) {
+			return true
+		}
+		tags = tags.Set(types.String(name[len(TagPrefix):]), v)
+		return false
+	})
+	return tags
+}
+
+// datasetsFromRoot returns |root| without the entries that hold tags, schemas
+// and the commit-graph index, whose keys, unlike dataset IDs, start with "@".
+func datasetsFromRoot(root types.Map) types.Map {
+	datasets := root
+	root.IterFrom(types.String("@"), func(k, v types.Value) bool {
+		if key := string(k.(types.String)); !strings.HasPrefix(key, "@") {
+			return true
+		}
+		datasets = datasets.Remove(k)
+		return false
+	})
+	return datasets
+}
+
+func getTagDataset(db Database, datasetID string) Dataset {
+	name := datasetID[len(TagPrefix):]
+	if !TagNameFullRe.MatchString(name) {
+		d.Panic("Invalid tag name: %s", name)
+	}
+	if r, ok := db.Tags().MaybeGet(types.String(name)); ok {
+		tag := r.(types.Ref).TargetValue(db).(types.Struct)
+		d.Chk.True(IsTagType(tag.Type()))
+		return Dataset{db, datasetID, tag.Get(TagCommitField).(types.Ref)}
+	}
+	return Dataset{store: db, id: datasetID}
+}
+
+// doCreateTag adds a tag called |name| to the root, pointing at the Commit referenced by |commitRef|. Like doCommit(), it retries if the root is changed concurrently by another writer, and fails with 'ErrTagExists' if the tag is already present.
+func (dbc *databaseCommon) doCreateTag(name string, commitRef types.Ref, meta types.Struct) error {
+	if !TagNameFullRe.MatchString(name) {
+		d.Panic("Invalid tag name: %s", name)
+	}
+	// See buildNewCommit().
+	if meta.Type() == nil && getNumValues(meta) == 0 {
+		meta = types.EmptyStruct
+	}
+	tag := NewTag(types.NewRef(dbc.validateRefAsCommit(commitRef)), meta)
+	defer dbc.resetRoot()
+
+	key := types.String(TagPrefix + name)
+	var err error
+	for err = ErrOptimisticLockFailed; err == ErrOptimisticLockFailed; {
+		currentRootHash, currentRoot := dbc.getRootAndDatasets()
+		if currentRoot.Has(key) {
+			return ErrTagExists
+		}
+		tagRef := dbc.WriteValue(tag) // will be orphaned if the tryUpdateRoot() below fails
+		err = dbc.tryUpdateRoot(currentRoot.Set(key, types.ToRefOfValue(tagRef)), currentRootHash, fmt.Sprintf("tag %s %s", name, commitRef.TargetHash()))
+	}
+	return err
+}
+
+// doDeleteTag removes the tag called |name| from the root, failing with 'ErrTagNotFound' if it isn't present.
+func (dbc *databaseCommon) doDeleteTag(name string) error {
+	defer dbc.resetRoot()
+
+	key := types.String(TagPrefix + name)
+	var err error
+	for err = ErrOptimisticLockFailed; err == ErrOptimisticLockFailed; {
+		currentRootHash, currentRoot := dbc.getRootAndDatasets()
+		r, ok := currentRoot.MaybeGet(key)
+		if !ok {
+			return ErrTagNotFound
+		}
+		err = dbc.tryUpdateRoot(currentRoot.Remove(key), currentRootHash, fmt.Sprintf("delete-tag %s %s", name, r.(types.Ref).TargetHash()))
+	}
+	return err
+}
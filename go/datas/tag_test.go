@@ -0,0 +1,73 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func (suite *DatabaseSuite) TestTags() {
+	ds, err := suite.db.CommitValue(suite.db.GetDataset("ds"), types.String("a"))
+	suite.NoError(err)
+	a := ds.HeadRef()
+	ds, err = suite.db.CommitValue(ds, types.String("b"))
+	suite.NoError(err)
+
+	meta := types.NewStruct("Meta", types.StructData{"message": types.String("first")})
+	suite.NoError(suite.db.CreateTag("release-1.0", a, meta))
+	suite.NoError(suite.db.CreateTag("latest", ds.HeadRef(), types.Struct{}))
+	suite.Equal(ErrTagExists, suite.db.CreateTag("release-1.0", ds.HeadRef(), types.Struct{}))
+
+	// Tags don't show up as datasets.
+	suite.Equal(uint64(1), suite.db.Datasets().Len())
+	suite.Equal(uint64(2), suite.db.Tags().Len())
+
+	tag := suite.db.Tags().Get(types.String("release-1.0")).(types.Ref).TargetValue(suite.db).(types.Struct)
+	suite.True(IsTagType(tag.Type()))
+	suite.True(meta.Equals(tag.Get(MetaField)))
+
+	tagged := suite.db.GetDataset(TagPrefix + "release-1.0")
+	suite.Equal(a.TargetHash(), tagged.HeadRef().TargetHash())
+	suite.True(types.String("a").Equals(tagged.HeadValue()))
+	_, present := suite.db.GetDataset(TagPrefix + "nope").MaybeHeadRef()
+	suite.False(present)
+
+	// Tags can't be moved.
+	_, err = suite.db.CommitValue(tagged, types.String("c"))
+	suite.Equal(ErrTagImmutable, err)
+	_, err = suite.db.FastForward(tagged, ds.HeadRef())
+	suite.Equal(ErrTagImmutable, err)
+	_, err = suite.db.SetHead(tagged, ds.HeadRef())
+	suite.Equal(ErrTagImmutable, err)
+	_, err = suite.db.Delete(tagged)
+	suite.Equal(ErrTagImmutable, err)
+	suite.Equal(a.TargetHash(), suite.db.GetDataset(TagPrefix+"release-1.0").HeadRef().TargetHash())
+
+	// Updating a dataset leaves the tags alone, and vice versa.
+	ds, err = suite.db.CommitValue(ds, types.String("c"))
+	suite.NoError(err)
+	suite.Equal(uint64(2), suite.db.Tags().Len())
+	suite.NoError(suite.db.DeleteTag("latest"))
+	suite.Equal(ErrTagNotFound, suite.db.DeleteTag("latest"))
+	suite.Equal(uint64(1), suite.db.Tags().Len())
+	suite.True(types.String("c").Equals(suite.db.GetDataset("ds").HeadValue()))
+
+	report := suite.db.Fsck()
+	suite.True(report.OK(), "%v", report.Problems)
+}
+
+func TestTagNameRe(t *testing.T) {
+	assert := assert.New(t)
+	for _, name := range []string{"v1", "release-1.2", "1.2.3", "a/b_c-d.4rc"} {
+		assert.True(TagNameFullRe.MatchString(name), name)
+	}
+	for _, name := range []string{"", "a.b", "release-1.", "1..2", "a b"} {
+		assert.False(TagNameFullRe.MatchString(name), name)
+	}
+	assert.Equal(TagPrefix+"release-1.2", DatasetOrTagRe.FindString(TagPrefix+"release-1.2.value"))
+}
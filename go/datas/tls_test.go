@@ -0,0 +1,133 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// makeTestCert creates a certificate for |cn|, signed by |parent|, or
+// self-signed if |parent| is nil, and writes it and its key to dir/name.pem
+// and dir/name.key.
+func makeTestCert(dir, name, cn string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	d.PanicIfError(err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer := &testCert{tmpl, key}
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		signer = parent
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer.cert, &key.PublicKey, signer.key)
+	d.PanicIfError(err)
+	cert, err := x509.ParseCertificate(der)
+	d.PanicIfError(err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	d.PanicIfError(err)
+
+	d.PanicIfError(ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	d.PanicIfError(ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return &testCert{cert, key}
+}
+
+func TestTLSConfigs(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	d.PanicIfError(err)
+	defer os.RemoveAll(dir)
+	ca := makeTestCert(dir, "ca", "Test CA", nil)
+	makeTestCert(dir, "server", "server", ca)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	cfg, err := NewServerTLSConfig(file("server.pem"), file("server.key"), "")
+	assert.NoError(err)
+	assert.Len(cfg.Certificates, 1)
+	assert.Nil(cfg.ClientCAs)
+
+	cfg, err = NewServerTLSConfig(file("server.pem"), file("server.key"), file("ca.pem"))
+	assert.NoError(err)
+	assert.NotNil(cfg.ClientCAs)
+
+	_, err = NewServerTLSConfig(file("server.pem"), file("missing.key"), "")
+	assert.Error(err)
+	_, err = NewServerTLSConfig(file("server.pem"), file("server.key"), file("server.key"))
+	assert.Error(err)
+
+	cfg, err = NewClientTLSConfig(file("ca.pem"), "", "")
+	assert.NoError(err)
+	assert.NotNil(cfg.RootCAs)
+	assert.Empty(cfg.Certificates)
+
+	_, err = NewClientTLSConfig("", file("server.pem"), "")
+	assert.Error(err)
+}
+
+func TestMutualTLSServer(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	d.PanicIfError(err)
+	defer os.RemoveAll(dir)
+	ca := makeTestCert(dir, "ca", "Test CA", nil)
+	makeTestCert(dir, "server", "server", ca)
+	makeTestCert(dir, "client", "client", ca)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	server := NewRemoteDatabaseServer(chunks.NewMemoryStore(), 0)
+	server.TLSConfig, err = NewServerTLSConfig(file("server.pem"), file("server.key"), file("ca.pem"))
+	d.PanicIfError(err)
+	ready := make(chan struct{})
+	server.Ready = func() { close(ready) }
+	go server.Run()
+	<-ready
+	defer server.Stop()
+	url := fmt.Sprintf("https://127.0.0.1:%d", server.Port())
+
+	clientCfg, err := NewClientTLSConfig(file("ca.pem"), file("client.pem"), file("client.key"))
+	d.PanicIfError(err)
+	db := NewRemoteDatabaseTLS(url, "", clientCfg)
+	ds, err := db.CommitValue(db.GetDataset("ds"), types.String("hello"))
+	assert.NoError(err)
+	assert.True(types.String("hello").Equals(ds.HeadValue()))
+	db.Close()
+
+	// Without a client certificate, the server refuses to talk.
+	clientCfg, err = NewClientTLSConfig(file("ca.pem"), "", "")
+	d.PanicIfError(err)
+	assert.Panics(func() {
+		NewRemoteDatabaseTLS(url, "", clientCfg).Datasets()
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"time"
+
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// watchPollInterval is how often a LocalDatabase, and a RemoteDatabaseServer
+// on behalf of its watchers, check whether the root has moved.
+const watchPollInterval = 100 * time.Millisecond
+
+// HeadChange describes the head of the dataset DatasetID moving from the
+// Commit referenced by OldHead to the one referenced by NewHead. OldHead is the
+// zero Ref if the dataset was just created, and NewHead is the zero Ref if it
+// was deleted.
+type HeadChange struct {
+	DatasetID string
+	OldHead   types.Ref
+	NewHead   types.Ref
+}
+
+// headWatcher turns successive roots of a database into the HeadChanges of
+// the datasets being watched.
+type headWatcher struct {
+	vr         types.ValueReader
+	datasetIDs map[string]bool // watch all datasets if empty
+	rootHash   hash.Hash
+	root       types.Map
+	changes    chan<- HeadChange
+	closeChan  <-chan struct{}
+}
+
+func newHeadWatcher(vr types.ValueReader, root hash.Hash, datasetIDs []string, changes chan<- HeadChange, closeChan <-chan struct{}) *headWatcher {
+	ids := map[string]bool{}
+	for _, id := range datasetIDs {
+		ids[id] = true
+	}
+	w := &headWatcher{vr: vr, datasetIDs: ids, changes: changes, closeChan: closeChan}
+	w.rootHash, w.root = root, w.readRoot(root)
+	return w
+}
+
+func (w *headWatcher) readRoot(root hash.Hash) types.Map {
+	if root.IsEmpty() {
+		return types.NewMap()
+	}
+	return w.vr.ReadValue(root).(types.Map)
+}
+
+// update sends a HeadChange for each watched dataset whose head differs
+// between the last root and |root|. It returns early if closeChan is closed.
+func (w *headWatcher) update(root hash.Hash) {
+	if root == w.rootHash {
+		return
+	}
+	rootMap := w.readRoot(root)
+	for _, change := range changedHeads(rootMap, w.root) {
+		if len(w.datasetIDs) > 0 && !w.datasetIDs[change.DatasetID] {
+			continue
+		}
+		select {
+		case w.changes <- change:
+		case <-w.closeChan:
+			return
+		}
+	}
+	w.rootHash, w.root = root, rootMap
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package datas
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+// startWatch runs db.Watch() in the background, and returns the channel it
+// sends changes on and a func that stops it and returns what Watch returned.
+func startWatch(db Database, datasetIDs ...string) (<-chan HeadChange, func() error) {
+	changes := make(chan HeadChange, 16)
+	closeChan := make(chan struct{})
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- db.Watch(changes, closeChan, datasetIDs...)
+	}()
+	return changes, func() error {
+		close(closeChan)
+		return <-errChan
+	}
+}
+
+// assertNextChange checks that the next HeadChange on |changes| moved
+// |datasetID| from |oldHead| to |newHead|. The Refs in a HeadChange come from
+// the root Map, so they're compared by target rather than by type.
+func assertNextChange(assert *assert.Assertions, changes <-chan HeadChange, datasetID string, oldHead, newHead types.Ref) {
+	select {
+	case change := <-changes:
+		assert.Equal(datasetID, change.DatasetID)
+		assert.Equal(oldHead.TargetHash(), change.OldHead.TargetHash())
+		assert.Equal(newHead.TargetHash(), change.NewHead.TargetHash())
+	case <-time.After(5 * time.Second):
+		assert.Fail("Timed out waiting for a HeadChange")
+	}
+}
+
+func testWatch(assert *assert.Assertions, db, watched Database) {
+	// Changes from before Watch is called aren't reported.
+	ds, err := db.CommitValue(db.GetDataset("ds1"), types.String("a"))
+	assert.NoError(err)
+	first := ds.HeadRef()
+
+	changes, stop := startWatch(watched, "ds1")
+	// Give the watch time to see the initial root.
+	time.Sleep(2 * watchPollInterval)
+
+	ds, err = db.CommitValue(ds, types.String("b"))
+	assert.NoError(err)
+	assertNextChange(assert, changes, "ds1", first, ds.HeadRef())
+
+	// Other datasets aren't reported...
+	_, err = db.CommitValue(db.GetDataset("ds2"), types.String("c"))
+	assert.NoError(err)
+
+	// ...but deleting a watched one is.
+	second := ds.HeadRef()
+	_, err = db.Delete(ds)
+	assert.NoError(err)
+	assertNextChange(assert, changes, "ds1", second, types.Ref{})
+
+	assert.NoError(stop())
+	assert.Len(changes, 0)
+}
+
+func TestLocalDatabaseWatch(t *testing.T) {
+	cs := chunks.NewTestStore()
+	testWatch(assert.New(t), NewDatabase(cs), NewDatabase(cs))
+}
+
+func TestRemoteDatabaseWatch(t *testing.T) {
+	assert := assert.New(t)
+	server := NewRemoteDatabaseServer(chunks.NewMemoryStore(), 0)
+	ready := make(chan struct{})
+	server.Ready = func() { close(ready) }
+	go server.Run()
+	<-ready
+	url := fmt.Sprintf("http://localhost:%d", server.Port())
+
+	db := NewRemoteDatabase(url, "")
+	testWatch(assert, db, NewRemoteDatabase(url, ""))
+
+	// Losing the connection ends the watch with an error.
+	closeChan := make(chan struct{})
+	defer close(closeChan)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- db.Watch(make(chan HeadChange), closeChan)
+	}()
+	time.Sleep(2 * watchPollInterval)
+	server.Stop()
+	select {
+	case err := <-errChan:
+		assert.Error(err)
+	case <-time.After(5 * time.Second):
+		assert.Fail("Watch didn't notice the server going away")
+	}
+}
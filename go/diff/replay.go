@@ -0,0 +1,176 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package diff
+
+import (
+	"fmt"
+
+	"github.com/attic-labs/noms/go/merge"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// Replay applies the changes that turn parent into changed to onto, and
+// returns the result. This is the building block for cherry-picking and
+// rebasing commits: parent and changed are the values of a commit's parent
+// and of the commit itself, and onto is the value of the head they're being
+// replayed on top of.
+//
+// The changes are computed using Diff() and applied using Apply().
+// A change is in conflict if the value it modifies or removes in onto isn't
+// the one it modified or removed in parent. Conflicting compound values are
+// merged using merge.ThreeWay(), with parent as the common ancestor; anything else
+// is handed to resolve, with onto's value as a and changed's as b. Since Lists
+// are diffed by index, changes within a List are replayed by merging the
+// whole List.
+func Replay(onto, changed, parent types.Value, vrw types.ValueReadWriter, resolve merge.ResolveFunc, progress chan struct{}) (types.Value, error) {
+	if resolve == nil {
+		resolve = merge.None
+	}
+
+	difs := make(chan Difference)
+	stop := make(chan struct{})
+	go func() {
+		Diff(parent, changed, difs, stop, false)
+		close(difs)
+	}()
+
+	patch := Patch{}
+	listPaths := map[string]bool{}
+	for dif := range difs {
+		// Replace changes within a List with a change to the whole List, once.
+		if i := listPrefixLen(dif.Path, parent); i != -1 {
+			p := dif.Path[:i]
+			if listPaths[p.String()] {
+				continue
+			}
+			listPaths[p.String()] = true
+			dif = Difference{Path: p, ChangeType: types.DiffChangeModified, OldValue: p.Resolve(parent), NewValue: p.Resolve(changed)}
+		}
+
+		replayed, err := replayDifference(onto, dif, vrw, resolve, progress)
+		if err != nil {
+			close(stop)
+			for range difs {
+			}
+			return onto, err
+		}
+		if !replayed.IsEmpty() {
+			patch = append(patch, replayed)
+		}
+		if progress != nil {
+			progress <- struct{}{}
+		}
+	}
+
+	if len(patch) == 0 {
+		return onto, nil
+	}
+	return Apply(onto, patch), nil
+}
+
+// listPrefixLen returns the length of the shortest prefix of p that resolves
+// to a List in v, if p passes through one, and -1 otherwise.
+func listPrefixLen(p types.Path, v types.Value) int {
+	for i, part := range p {
+		if _, ok := v.(types.List); ok {
+			return i
+		}
+		if v = part.Resolve(v); v == nil {
+			break
+		}
+	}
+	return -1
+}
+
+// replayDifference returns the Difference that should be applied to onto in
+// order to replay dif, or an empty Difference if onto already reflects it.
+func replayDifference(onto types.Value, dif Difference, vrw types.ValueReadWriter, resolve merge.ResolveFunc, progress chan struct{}) (Difference, error) {
+	if len(dif.Path) > 0 {
+		container := dif.Path[:len(dif.Path)-1].Resolve(onto)
+		if container == nil {
+			return Difference{}, fmt.Errorf("Conflict:\n%s %s\nvs\nremoved %s", describeChangeType(dif.ChangeType), dif.Path, dif.Path[:len(dif.Path)-1])
+		}
+		// Adding or removing an element of a Set can't conflict with anything.
+		if _, ok := container.(types.Set); ok {
+			return dif, nil
+		}
+	}
+
+	current := dif.Path.Resolve(onto)
+	if valuesEqual(current, dif.OldValue) {
+		return dif, nil
+	} else if valuesEqual(current, dif.NewValue) {
+		return Difference{}, nil
+	}
+
+	if current != nil && dif.OldValue != nil && mergeable(current, dif.NewValue) {
+		merged, err := merge.ThreeWay(current, dif.NewValue, dif.OldValue, vrw, resolve, progress)
+		if err != nil {
+			return Difference{}, err
+		}
+		return Difference{Path: dif.Path, ChangeType: types.DiffChangeModified, OldValue: current, NewValue: merged}, nil
+	}
+
+	currentChange := types.DiffChangeModified
+	if current == nil {
+		currentChange = types.DiffChangeRemoved
+	} else if dif.OldValue == nil {
+		currentChange = types.DiffChangeAdded
+	}
+	change, merged, ok := resolve(currentChange, dif.ChangeType, current, dif.NewValue, dif.Path)
+	if !ok {
+		return Difference{}, fmt.Errorf("Conflict:\n%s %s = %s\nvs\n%s %s = %s", describeChangeType(currentChange), dif.Path, encodedValue(current), describeChangeType(dif.ChangeType), dif.Path, encodedValue(dif.NewValue))
+	}
+
+	switch {
+	case change == types.DiffChangeRemoved && current == nil, change != types.DiffChangeRemoved && valuesEqual(current, merged):
+		return Difference{}, nil
+	case change == types.DiffChangeRemoved:
+		if len(dif.Path) == 0 {
+			return Difference{}, fmt.Errorf("Can't remove the root value")
+		}
+		return Difference{Path: dif.Path, ChangeType: types.DiffChangeRemoved, OldValue: current}, nil
+	case current == nil:
+		return Difference{Path: dif.Path, ChangeType: types.DiffChangeAdded, NewValue: merged, NewKeyValue: dif.NewKeyValue}, nil
+	default:
+		return Difference{Path: dif.Path, ChangeType: types.DiffChangeModified, OldValue: current, NewValue: merged}, nil
+	}
+}
+
+// mergeable returns true if a and b are compound values of the same Kind,
+// which merge.ThreeWay() can merge.
+func mergeable(a, b types.Value) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	aKind, bKind := a.Type().Kind(), b.Type().Kind()
+	return aKind == bKind && !types.IsPrimitiveKind(aKind)
+}
+
+func valuesEqual(a, b types.Value) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equals(b)
+}
+
+func encodedValue(v types.Value) string {
+	if v == nil {
+		return "<nil>"
+	}
+	return types.EncodedValue(v)
+}
+
+func describeChangeType(changeType types.DiffChangeType) string {
+	switch changeType {
+	case types.DiffChangeAdded:
+		return "added"
+	case types.DiffChangeModified:
+		return "modded"
+	case types.DiffChangeRemoved:
+		return "removed"
+	}
+	return ""
+}
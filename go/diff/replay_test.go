@@ -0,0 +1,81 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package diff
+
+import (
+	"testing"
+
+	"github.com/attic-labs/noms/go/merge"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestReplay(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	defer vs.Close()
+
+	s := func(a, b types.Value) types.Struct {
+		return types.NewStruct("S", types.StructData{"a": a, "b": b})
+	}
+	replays := func(expected, onto, changed, parent types.Value) {
+		actual, err := Replay(onto, changed, parent, vs, nil, nil)
+		if assert.NoError(err) {
+			assert.True(expected.Equals(actual), "expected %s, got %s", types.EncodedValue(expected), types.EncodedValue(actual))
+		}
+	}
+
+	one, two, three := types.Number(1), types.Number(2), types.Number(3)
+
+	// Independent changes to different fields.
+	replays(s(two, three), s(one, three), s(two, one), s(one, one))
+	// The change is already in |onto|.
+	replays(s(two, three), s(two, three), s(two, one), s(one, one))
+	// Changes to Map entries.
+	replays(
+		types.NewMap(types.String("b"), two, types.String("c"), three),
+		types.NewMap(types.String("a"), one, types.String("b"), two),
+		types.NewMap(types.String("c"), three),
+		types.NewMap(types.String("a"), one),
+	)
+	// Adding to a Set that has since lost an element.
+	replays(types.NewSet(two, three), types.NewSet(two), types.NewSet(one, two, three), types.NewSet(one, two))
+	// Changes within a List are merged with the whole List.
+	replays(
+		s(types.NewList(types.Number(0), one, two, three), two),
+		s(types.NewList(types.Number(0), one, two), two),
+		s(types.NewList(one, two, three), one),
+		s(types.NewList(one, two), one),
+	)
+}
+
+func TestReplayConflict(t *testing.T) {
+	assert := assert.New(t)
+	vs := types.NewTestValueStore()
+	defer vs.Close()
+
+	s := func(a types.Value) types.Struct {
+		return types.NewStruct("S", types.StructData{"a": a})
+	}
+	parent, changed, onto := s(types.Number(1)), s(types.Number(2)), s(types.Number(3))
+
+	_, err := Replay(onto, changed, parent, vs, merge.None, nil)
+	assert.Error(err)
+
+	replayed, err := Replay(onto, changed, parent, vs, merge.Ours, nil)
+	assert.NoError(err)
+	assert.True(onto.Equals(replayed))
+
+	replayed, err = Replay(onto, changed, parent, vs, merge.Theirs, nil)
+	assert.NoError(err)
+	assert.True(changed.Equals(replayed))
+
+	// A change within a Map that's gone from |onto| can't be replayed.
+	m := func(v types.Value) types.Struct {
+		return types.NewStruct("S", types.StructData{"m": types.NewMap(types.String("k"), v)})
+	}
+	_, err = Replay(types.NewStruct("S", types.StructData{}), m(types.Number(2)), m(types.Number(1)), vs, merge.Theirs, nil)
+	assert.Error(err)
+}
@@ -93,6 +93,18 @@ func (ccs *compactingChunkSource) hash() addr {
 	return ccs.cs.hash()
 }
 
+func (ccs *compactingChunkSource) keyID() string {
+	ccs.wg.Wait()
+	d.Chk.True(ccs.cs != nil)
+	return ccs.cs.keyID()
+}
+
+func (ccs *compactingChunkSource) tableFormat() TableFormat {
+	ccs.wg.Wait()
+	d.Chk.True(ccs.cs != nil)
+	return ccs.cs.tableFormat()
+}
+
 func (ccs *compactingChunkSource) calcReads(reqs []getRecord, blockSize uint64) (reads int, remaining bool) {
 	ccs.wg.Wait()
 	d.Chk.True(ccs.cs != nil)
@@ -139,6 +151,14 @@ func (ecs emptyChunkSource) hash() addr {
 	return addr{} // TODO: is this legal?
 }
 
+func (ecs emptyChunkSource) keyID() string {
+	return ""
+}
+
+func (ecs emptyChunkSource) tableFormat() TableFormat {
+	return SnappyTables
+}
+
 func (ecs emptyChunkSource) calcReads(reqs []getRecord, blockSize uint64) (reads int, remaining bool) {
 	return 0, true
 }
@@ -0,0 +1,384 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/verbose"
+)
+
+// ErrCompactionConflict is returned by Compact() if tables it was compacting
+// were removed from the store, e.g. by GC() or by another process's
+// compaction, while it was running. Nothing has changed in that case, and
+// Compact() can simply be retried.
+var ErrCompactionConflict = errors.New("Store was modified during compaction")
+
+// CompactionPolicy decides which tables Compact() merges. Tables are grouped
+// into tiers by size: those smaller than MinTableBytes are in the first tier,
+// and each tier after that holds tables up to FanIn times larger than those of
+// the one before. Whenever a tier holds at least FanIn tables, they're merged
+// into one, which belongs to a later tier. So, like in a log-structured merge
+// tree, each chunk is rewritten about once per tier rather than every time
+// tables are compacted. Sizes are those of the uncompressed chunk data.
+type CompactionPolicy struct {
+	// FanIn is how many tables of a tier it takes to compact them. It must be
+	// at least 2.
+	FanIn int
+
+	// MinTableBytes is the size below which tables are all in the first tier.
+	MinTableBytes uint64
+
+	// MaxTableBytes, if not 0, is the size of tables that are never compacted.
+	MaxTableBytes uint64
+
+	// GroupByReachability writes the chunks of compacted tables breadth-first
+	// from the chunks that no other chunk among them refers to, rather than in
+	// the order they were written. That keeps each chunk near its siblings,
+	// and chunks of the same ref-height together, which is the order in which
+	// Noms reads them when walking a value. It requires every chunk in the
+	// store to be an encoded Noms value, and all the chunks of the tables
+	// being compacted to fit in memory at once.
+	GroupByReachability bool
+}
+
+// DefaultCompactionPolicy is a reasonable CompactionPolicy for most stores.
+var DefaultCompactionPolicy = CompactionPolicy{FanIn: 4, MinTableBytes: 1 << 24}
+
+// CompactAllPolicy is a CompactionPolicy that merges all of a store's tables
+// into one.
+var CompactAllPolicy = CompactionPolicy{FanIn: 2, MinTableBytes: math.MaxUint64}
+
+// tier returns the tier of tables of |size| bytes.
+func (p CompactionPolicy) tier(size uint64) (tier int) {
+	for bound := p.MinTableBytes; size >= bound; bound *= uint64(p.FanIn) {
+		tier++
+		if bound > math.MaxUint64/uint64(p.FanIn) {
+			break
+		}
+	}
+	return
+}
+
+// plan returns the groups of |sources| that are to be merged, each into a
+// table of its own.
+func (p CompactionPolicy) plan(sources chunkSources) (groups []chunkSources) {
+	d.PanicIfFalse(p.FanIn >= 2 && p.MinTableBytes > 0)
+	tiers := map[int]chunkSources{}
+	maxTier := 0
+	for _, src := range sources {
+		size := src.uncompressedLen()
+		if p.MaxTableBytes > 0 && size >= p.MaxTableBytes {
+			continue
+		}
+		t := p.tier(size)
+		tiers[t] = append(tiers[t], src)
+		if t > maxTier {
+			maxTier = t
+		}
+	}
+	for t := 0; t <= maxTier; t++ {
+		if len(tiers[t]) >= p.FanIn {
+			groups = append(groups, tiers[t])
+		}
+	}
+	return
+}
+
+// CompactionStats describes the store before and after a call to Compact().
+type CompactionStats struct {
+	TablesBefore, TablesAfter int
+	// TablesCompacted tables, holding BytesCompacted bytes of uncompressed
+	// chunk data, were merged into TablesWritten new ones.
+	TablesCompacted, TablesWritten int
+	BytesCompacted                 uint64
+}
+
+// CompactionMetrics add up the work done by all the calls to Compact() on a
+// NomsBlockStore, including those made in the background.
+type CompactionMetrics struct {
+	// Runs is the number of calls to Compact() that found tables to compact,
+	// and Conflicts how many of those failed with ErrCompactionConflict.
+	Runs, Conflicts                 uint64
+	TablesCompacted, TablesWritten  uint64
+	ChunksCompacted, BytesCompacted uint64
+	// Duration is the total time spent in those calls.
+	Duration time.Duration
+}
+
+// Compact merges the store's tables according to |policy|. Unlike the
+// compaction that UpdateRoot() does when the store has more than maxTables
+// tables, it writes the new tables without holding the store's lock, so other
+// operations on the store can go on in the meantime. It only takes the lock
+// to swap the new tables into the manifest, using the same optimistic lock
+// as UpdateRoot(). Tables that were added in the meantime are kept, but if
+// any that were being compacted were removed, Compact() fails with
+// ErrCompactionConflict, and the store is left untouched.
+//
+// Tables that have been written, but not yet added to the manifest by
+// UpdateRoot(), aren't compacted.
+func (nbs *NomsBlockStore) Compact(policy CompactionPolicy) (stats CompactionStats, err error) {
+	t1 := time.Now()
+	upstream, p := func() ([]tableSpec, tablePersister) {
+		nbs.mu.RLock()
+		defer nbs.mu.RUnlock()
+		return nbs.upstream, nbs.tables.p
+	}()
+	stats.TablesBefore, stats.TablesAfter = len(upstream), len(upstream)
+
+	// Work from tables of our own, since UpdateRoot() may close those of nbs.tables at any time.
+	sources := make(chunkSources, len(upstream))
+	for i, spec := range upstream {
+		sources[i] = p.Open(spec.name, spec.chunkCount, spec.keyID)
+	}
+	defer sources.close()
+
+	groups := policy.plan(sources)
+	if len(groups) == 0 {
+		return
+	}
+
+	compactees := map[addr]bool{}
+	compacted := make(chunkSources, 0, len(groups))
+	chunkCount := uint64(0)
+	for _, group := range groups {
+		for _, src := range group {
+			compactees[src.hash()] = true
+			stats.BytesCompacted += src.uncompressedLen()
+			chunkCount += uint64(src.count())
+		}
+		stats.TablesCompacted += len(group)
+		var cs chunkSource
+		if policy.GroupByReachability {
+			cs = compactByReachability(p, group)
+		} else {
+			cs = p.CompactAll(group)
+		}
+		compacted = append(compacted, cs)
+	}
+	stats.TablesWritten = len(compacted)
+
+	nbs.mu.Lock()
+	defer nbs.mu.Unlock()
+	nbs.compactionMetrics.Runs++
+	defer func() {
+		nbs.compactionMetrics.Duration += time.Since(t1)
+	}()
+
+	// fail drops the new tables, except any that share names with those in |current|, e.g. because someone else compacted the same tables.
+	fail := func(current []tableSpec) (CompactionStats, error) {
+		compacted.close()
+		if r, ok := p.(tableRemover); ok {
+			inUse := map[addr]bool{}
+			for _, spec := range current {
+				inUse[spec.name] = true
+			}
+			names := []addr{}
+			for _, cs := range compacted {
+				if !compactees[cs.hash()] && !inUse[cs.hash()] {
+					names = append(names, cs.hash())
+				}
+			}
+			r.Remove(names)
+		}
+		nbs.compactionMetrics.Conflicts++
+		return CompactionStats{}, ErrCompactionConflict
+	}
+
+	// Replace the first of each group of compactees with the table it was merged into, and drop the rest, leaving any other tables as they are.
+	first := map[addr]chunkSource{}
+	for i, group := range groups {
+		first[group[0].hash()] = compacted[i]
+	}
+	found := 0
+	specs := make([]tableSpec, 0, len(nbs.upstream))
+	for _, spec := range nbs.upstream {
+		if !compactees[spec.name] {
+			specs = append(specs, spec)
+			continue
+		}
+		found++
+		if cs, ok := first[spec.name]; ok {
+			specs = append(specs, tableSpec{cs.hash(), cs.count(), cs.keyID(), cs.tableFormat()})
+		}
+	}
+	if found != len(compactees) {
+		return fail(nbs.upstream)
+	}
+
+	actual, tableSpecs := nbs.mm.Update(nbs.upstream, specs, nbs.root, nbs.root, nil)
+	if actual != nbs.root || !specsEqual(specs, tableSpecs) {
+		return fail(append(tableSpecs, nbs.upstream...))
+	}
+
+	// nbs.tables.upstream holds the tables named by nbs.upstream, so swap the new tables into it the same way.
+	ts := tableSet{novel: nbs.tables.novel, p: nbs.tables.p, rl: nbs.tables.rl}
+	dropped := chunkSources{}
+	for _, src := range nbs.tables.upstream {
+		if !compactees[src.hash()] {
+			ts.upstream = append(ts.upstream, src)
+			continue
+		}
+		dropped = append(dropped, src)
+		if cs, ok := first[src.hash()]; ok {
+			ts.upstream = append(ts.upstream, cs)
+		}
+	}
+	nbs.tables, nbs.upstream = ts, tableSpecs
+	dropped.close()
+
+	stats.TablesAfter = len(tableSpecs)
+	nbs.compactionMetrics.TablesCompacted += uint64(stats.TablesCompacted)
+	nbs.compactionMetrics.TablesWritten += uint64(stats.TablesWritten)
+	nbs.compactionMetrics.ChunksCompacted += chunkCount
+	nbs.compactionMetrics.BytesCompacted += stats.BytesCompacted
+	verbose.Log("Compacted %d tables (%d Kb) into %d in %s", stats.TablesCompacted, stats.BytesCompacted/1024, stats.TablesWritten, time.Since(t1))
+	return stats, nil
+}
+
+// CompactionMetrics returns the metrics of all the compaction done by this
+// NomsBlockStore so far.
+func (nbs *NomsBlockStore) CompactionMetrics() CompactionMetrics {
+	nbs.mu.RLock()
+	defer nbs.mu.RUnlock()
+	return nbs.compactionMetrics
+}
+
+// CompactInBackground starts calling Compact(|policy|) every |interval|, until
+// the store is closed. Failures are logged, with verbose.Log(), and otherwise
+// ignored; the tables will be compacted on a later try. From then on,
+// UpdateRoot() no longer compacts tables itself when the store has more than
+// maxTables of them. StoreOptions.CompactionInterval starts it when the store
+// is opened.
+func (nbs *NomsBlockStore) CompactInBackground(policy CompactionPolicy, interval time.Duration) {
+	d.PanicIfFalse(policy.FanIn >= 2 && policy.MinTableBytes > 0)
+	nbs.compactorMu.Lock()
+	defer nbs.compactorMu.Unlock()
+	d.PanicIfTrue(nbs.stopCompactor != nil)
+
+	stop, wg := make(chan struct{}), &sync.WaitGroup{}
+	nbs.stopCompactor = func() {
+		close(stop)
+		wg.Wait()
+	}
+	nbs.mu.Lock()
+	nbs.compactingInBackground = true
+	nbs.mu.Unlock()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							verbose.Log("Background compaction failed: %v", r)
+						}
+					}()
+					if _, err := nbs.Compact(policy); err != nil {
+						verbose.Log("Background compaction failed: %s", err)
+					}
+				}()
+			}
+		}
+	}()
+}
+
+// stopBackgroundCompaction stops the compaction started by
+// CompactInBackground(), if any, and waits for it to finish.
+func (nbs *NomsBlockStore) stopBackgroundCompaction() {
+	nbs.compactorMu.Lock()
+	defer nbs.compactorMu.Unlock()
+	if nbs.stopCompactor != nil {
+		nbs.stopCompactor()
+		nbs.stopCompactor = nil
+		nbs.mu.Lock()
+		nbs.compactingInBackground = false
+		nbs.mu.Unlock()
+	}
+}
+
+// compactByReachability merges |sources| into a single table, whose chunks
+// are in the order described by CompactionPolicy.GroupByReachability.
+func compactByReachability(p tablePersister, sources chunkSources) chunkSource {
+	ch := make(chan extractRecord, 1)
+	go func() {
+		defer close(ch)
+		tableSet{upstream: sources}.extract(InsertOrder, ch)
+	}()
+
+	data := map[addr][]byte{}
+	order := []addr{}
+	size := uint64(0)
+	for rec := range ch {
+		if _, present := data[rec.a]; !present {
+			data[rec.a] = rec.data
+			order = append(order, rec.a)
+			size += uint64(len(rec.data))
+		}
+	}
+
+	refs := make(map[addr][]addr, len(order))
+	referenced := map[addr]bool{}
+	for _, a := range order {
+		for _, r := range chunkRefs(a, data[a]) {
+			if _, present := data[r]; present {
+				refs[a] = append(refs[a], r)
+				referenced[r] = true
+			}
+		}
+	}
+
+	mt := newMemTable(size)
+	added := map[addr]bool{}
+	add := func(a addr) bool {
+		if added[a] {
+			return false
+		}
+		added[a] = true
+		d.PanicIfFalse(mt.addChunk(a, data[a]))
+		return true
+	}
+	for _, root := range order {
+		if referenced[root] {
+			continue
+		}
+		add(root)
+		for level := []addr{root}; len(level) > 0; {
+			next := []addr{}
+			for _, a := range level {
+				for _, r := range refs[a] {
+					if add(r) {
+						next = append(next, r)
+					}
+				}
+			}
+			level = next
+		}
+	}
+	d.PanicIfFalse(uint32(len(order)) == mt.count())
+	return p.Compact(mt, nil)
+}
+
+// chunkRefs returns the addresses of the chunks that the Noms value encoded
+// in |data| refers to.
+func chunkRefs(a addr, data []byte) (refs []addr) {
+	types.DecodeValue(chunks.NewChunkWithHash(hash.Hash(a), data), nil).WalkRefs(func(r types.Ref) {
+		refs = append(refs, addr(r.TargetHash()))
+	})
+	return
+}
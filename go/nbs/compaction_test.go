@@ -0,0 +1,255 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+type sizedChunkSource struct {
+	chunkSource
+	size uint64
+}
+
+func (scs sizedChunkSource) uncompressedLen() uint64 {
+	return scs.size
+}
+
+func TestCompactionPolicyPlan(t *testing.T) {
+	assert := assert.New(t)
+	sources := chunkSources{}
+	for _, size := range []uint64{10, 150, 500, 20, 160} {
+		sources = append(sources, sizedChunkSource{size: size})
+	}
+	sizes := func(groups []chunkSources) (s [][]uint64) {
+		for _, group := range groups {
+			g := []uint64{}
+			for _, src := range group {
+				g = append(g, src.uncompressedLen())
+			}
+			s = append(s, g)
+		}
+		return
+	}
+
+	p := CompactionPolicy{FanIn: 2, MinTableBytes: 100}
+	assert.Equal(0, p.tier(99))
+	assert.Equal(1, p.tier(100))
+	assert.Equal(1, p.tier(199))
+	assert.Equal(2, p.tier(200))
+	assert.Equal([][]uint64{{10, 20}, {150, 160}}, sizes(p.plan(sources)))
+
+	p.MaxTableBytes = 155
+	assert.Equal([][]uint64{{10, 20}}, sizes(p.plan(sources)))
+
+	p = CompactionPolicy{FanIn: 3, MinTableBytes: 100}
+	assert.Nil(p.plan(sources))
+
+	assert.Equal([][]uint64{{10, 150, 500, 20, 160}}, sizes(CompactAllPolicy.plan(sources)))
+	assert.Equal(64, CompactionPolicy{FanIn: 2, MinTableBytes: 1}.tier(1<<63+1))
+}
+
+// makeTables commits each of |vals| to |store| separately, so that each ends
+// up in a table of its own, and returns their chunks.
+func makeTables(assert *assert.Assertions, store *NomsBlockStore, vals ...types.Value) (cs []chunks.Chunk) {
+	for _, v := range vals {
+		c := putValue(store, v)
+		assert.True(store.UpdateRoot(c.Hash(), store.Root()))
+		cs = append(cs, c)
+	}
+	return
+}
+
+func TestCompact(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+	cs := makeTables(assert, store, types.String("a"), types.String("b"), types.String("c"), types.String("d"))
+	assert.Len(store.upstream, 4)
+
+	stats, err := store.Compact(CompactAllPolicy)
+	assert.NoError(err)
+	assert.Equal(CompactionStats{TablesBefore: 4, TablesAfter: 1, TablesCompacted: 4, TablesWritten: 1, BytesCompacted: stats.BytesCompacted}, stats)
+	assert.True(stats.BytesCompacted > 0)
+	assert.Len(store.tables.upstream, 1)
+	for _, c := range cs {
+		assert.Equal(c.Data(), store.Get(c.Hash()).Data())
+	}
+
+	// Nothing more to do.
+	stats, err = store.Compact(CompactAllPolicy)
+	assert.NoError(err)
+	assert.Equal(CompactionStats{TablesBefore: 1, TablesAfter: 1}, stats)
+
+	metrics := store.CompactionMetrics()
+	assert.Equal(uint64(1), metrics.Runs)
+	assert.Equal(uint64(4), metrics.TablesCompacted)
+	assert.Equal(uint64(1), metrics.TablesWritten)
+	assert.Equal(uint64(4), metrics.ChunksCompacted)
+
+	// Writing goes on as usual, and a fresh store sees the compacted tables.
+	more := makeTables(assert, store, types.String("e"))
+	reopened := NewLocalStore(dir, testMemTableSize)
+	defer reopened.Close()
+	assert.Len(reopened.upstream, 2)
+	assert.Equal(more[0].Hash(), reopened.Root())
+	for _, c := range append(cs, more...) {
+		assert.True(reopened.Has(c.Hash()))
+	}
+}
+
+func TestCompactConflict(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+	cs := makeTables(assert, store, types.String("a"), types.String("b"))
+
+	// Someone else adds a table and compacts them all first.
+	other := NewLocalStore(dir, testMemTableSize)
+	defer other.Close()
+	cs = append(cs, makeTables(assert, other, types.String("c"))...)
+	_, err = other.Compact(CompactAllPolicy)
+	assert.NoError(err)
+
+	_, err = store.Compact(CompactAllPolicy)
+	assert.Equal(ErrCompactionConflict, err)
+	assert.Equal(uint64(1), store.CompactionMetrics().Conflicts)
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(err)
+	tables := 0
+	for _, fi := range files {
+		if len(fi.Name()) == len(addr{}.String()) {
+			tables++
+		}
+	}
+	assert.Equal(4, tables, "Only the three original tables and theirs should be left")
+
+	reopened := NewLocalStore(dir, testMemTableSize)
+	defer reopened.Close()
+	assert.Len(reopened.upstream, 1)
+	for _, c := range cs {
+		assert.Equal(c.Data(), reopened.Get(c.Hash()).Data())
+	}
+}
+
+func TestCompactByAnotherWriter(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+	cs := makeTables(assert, store, types.String("a"), types.String("b"))
+
+	// Someone else compacts the tables, leaving the root as it was...
+	other := NewLocalStore(dir, testMemTableSize)
+	defer other.Close()
+	_, err = other.Compact(CompactAllPolicy)
+	assert.NoError(err)
+
+	// ...so moving it from there succeeds on top of their tables.
+	cs = append(cs, makeTables(assert, store, types.String("c"))...)
+	assert.Len(store.upstream, 2)
+
+	reopened := NewLocalStore(dir, testMemTableSize)
+	defer reopened.Close()
+	assert.Equal(cs[2].Hash(), reopened.Root())
+	for _, c := range cs {
+		assert.Equal(c.Data(), reopened.Get(c.Hash()).Data())
+	}
+}
+
+func TestCompactGroupByReachability(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+	leaf1, leaf2, leaf3 := types.String("leaf1"), types.String("leaf2"), types.String("leaf3")
+	inner := types.NewList(types.NewRef(leaf2), types.NewRef(leaf3))
+	root := types.NewList(types.NewRef(inner), types.NewRef(leaf1))
+	unreferenced := types.String("unreferenced")
+	makeTables(assert, store, leaf3, unreferenced, leaf2, leaf1, inner, root)
+
+	_, err = store.Compact(CompactionPolicy{FanIn: 2, MinTableBytes: 1 << 20, GroupByReachability: true})
+	assert.NoError(err)
+	if !assert.Len(store.tables.upstream, 1) {
+		return
+	}
+
+	ch := make(chan extractRecord, 6)
+	store.tables.upstream[0].extract(InsertOrder, ch)
+	close(ch)
+	order := []hash.Hash{}
+	for rec := range ch {
+		order = append(order, hash.Hash(rec.a))
+	}
+	expected := []hash.Hash{unreferenced.Hash(), root.Hash(), inner.Hash(), leaf1.Hash(), leaf2.Hash(), leaf3.Hash()}
+	assert.Equal(expected, order)
+}
+
+func TestCompactInBackground(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	store.CompactInBackground(CompactAllPolicy, time.Millisecond)
+	makeTables(assert, store, types.String("a"), types.String("b"), types.String("c"))
+
+	deadline := time.Now().Add(10 * time.Second)
+	for store.CompactionMetrics().TablesWritten == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NotZero(store.CompactionMetrics().TablesWritten)
+
+	// Closing the store stops the compaction.
+	assert.NoError(store.Close())
+	runs := store.CompactionMetrics().Runs
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(runs, store.CompactionMetrics().Runs)
+}
+
+func TestStoreCompactionInterval(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// Stores that compact in the background don't compact in UpdateRoot(), however many tables they have.
+	store := newLocalStore(dir, testMemTableSize, nil, 2, StoreOptions{CompactionInterval: time.Hour})
+	makeTables(assert, store, types.String("a"), types.String("b"), types.String("c"))
+	assert.Len(store.upstream, 3)
+	assert.NoError(store.Close())
+
+	store = newLocalStore(dir, testMemTableSize, nil, 2, StoreOptions{CompactionInterval: time.Millisecond, CompactionPolicy: CompactAllPolicy})
+	defer store.Close()
+	makeTables(assert, store, types.String("d"), types.String("e"))
+	deadline := time.Now().Add(10 * time.Second)
+	for store.CompactionMetrics().TablesWritten == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NotZero(store.CompactionMetrics().TablesWritten)
+}
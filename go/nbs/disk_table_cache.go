@@ -0,0 +1,202 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/util/sizecache"
+)
+
+const (
+	// diskCacheBlockSize is the size of the blocks of table data that a
+	// diskTableCache holds. Reads of table data are rounded out to whole blocks,
+	// so that the same blocks are cached however the reads are coalesced. They're
+	// much smaller than the reads themselves can be, so that reading a single
+	// chunk doesn't fetch much more than it needs.
+	diskCacheBlockSize = 1 << 16 // 64K
+
+	// DefaultDiskCacheSize is the size of a disk cache that is opened with a
+	// size of 0.
+	DefaultDiskCacheSize = 1 << 30 // 1G
+
+	diskCacheTempPrefix = "tmp_"
+	diskCacheIndexKey   = "idx"
+)
+
+var (
+	diskTableCaches  = map[string]*diskTableCache{}
+	diskTableCacheMu sync.Mutex
+)
+
+// diskTableCache is a persistent cache, in a local directory, of the tables
+// of a remote store. It holds the index of each table, and blocks of the
+// chunk data, each in a file named for the table and the block. Since tables
+// are named for their contents, what's cached for a table never goes stale.
+// Once the files add up to more than the size the cache was opened with, the
+// least recently used are deleted. Each file ends with a checksum of what's
+// before it, and a file that doesn't match its checksum when it's loaded is
+// deleted and treated as missing.
+type diskTableCache struct {
+	dir   string
+	files *sizecache.SizeCache
+}
+
+// openDiskTableCache returns the diskTableCache in |dir|, creating |dir| if
+// need be. Caches are shared by everything in the process that opens the
+// same directory, and the size of the first to open it wins.
+func openDiskTableCache(dir string, maxSize uint64) *diskTableCache {
+	if maxSize == 0 {
+		maxSize = DefaultDiskCacheSize
+	}
+	diskTableCacheMu.Lock()
+	defer diskTableCacheMu.Unlock()
+	dir, err := filepath.Abs(dir)
+	d.PanicIfError(err)
+	if dtc, ok := diskTableCaches[dir]; ok {
+		return dtc
+	}
+	dtc := newDiskTableCache(dir, maxSize)
+	diskTableCaches[dir] = dtc
+	return dtc
+}
+
+func newDiskTableCache(dir string, maxSize uint64) *diskTableCache {
+	d.PanicIfError(os.MkdirAll(dir, 0777))
+	dtc := &diskTableCache{dir: dir}
+	dtc.files = sizecache.NewWithExpireCallback(maxSize, func(key interface{}) {
+		dtc.remove(key.(string))
+	})
+
+	// Pick up the files left by earlier processes, least recently used first,
+	// so that those are the first to go.
+	infos, err := ioutil.ReadDir(dir)
+	d.PanicIfError(err)
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(info.Name(), diskCacheTempPrefix) {
+			dtc.remove(info.Name()) // left behind by a process that died while writing it
+			continue
+		}
+		dtc.add(info.Name(), uint64(info.Size()))
+	}
+	return dtc
+}
+
+func diskCacheIndexName(name addr) string {
+	return fmt.Sprintf("%s-%s", name, diskCacheIndexKey)
+}
+
+func diskCacheBlockName(name addr, block uint64) string {
+	return fmt.Sprintf("%s-%d", name, block)
+}
+
+// add records that the file |key| is in the cache. If that pushes the cache
+// over its size, or |size| is more than the whole cache can hold, files are
+// deleted to make room.
+func (dtc *diskTableCache) add(key string, size uint64) {
+	dtc.files.Add(key, size, nil)
+	if _, ok := dtc.files.Get(key); !ok {
+		dtc.remove(key)
+	}
+}
+
+func (dtc *diskTableCache) remove(key string) {
+	err := os.Remove(filepath.Join(dtc.dir, key))
+	if !os.IsNotExist(err) {
+		d.PanicIfError(err)
+	}
+}
+
+// get returns the contents of the file |key|, if it's in the cache and
+// matches its checksum.
+func (dtc *diskTableCache) get(key string) ([]byte, bool) {
+	if _, ok := dtc.files.Get(key); !ok {
+		return nil, false
+	}
+	path := filepath.Join(dtc.dir, key)
+	buff, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		// Expired by another process sharing the directory.
+		dtc.files.Drop(key)
+		return nil, false
+	}
+	d.PanicIfError(err)
+
+	if uint64(len(buff)) < checksumSize {
+		dtc.drop(key)
+		return nil, false
+	}
+	data, sum := buff[:uint64(len(buff))-checksumSize], buff[uint64(len(buff))-checksumSize:]
+	if binary.BigEndian.Uint32(sum) != crc(data) {
+		dtc.drop(key)
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now) // so that later processes know it was used recently
+	return data, true
+}
+
+func (dtc *diskTableCache) drop(key string) {
+	dtc.files.Drop(key)
+	dtc.remove(key)
+}
+
+// put writes |data| to the file |key|, followed by its checksum. The file is
+// written under a temporary name and then renamed, so that it's never seen
+// half written.
+func (dtc *diskTableCache) put(key string, data []byte) {
+	if _, ok := dtc.files.Get(key); ok {
+		return
+	}
+	temp, err := ioutil.TempFile(dtc.dir, diskCacheTempPrefix)
+	d.PanicIfError(err)
+	sum := make([]byte, checksumSize)
+	binary.BigEndian.PutUint32(sum, crc(data))
+	_, err = temp.Write(data)
+	if err == nil {
+		_, err = temp.Write(sum)
+	}
+	checkClose(temp)
+	d.PanicIfError(err)
+	d.PanicIfError(os.Rename(temp.Name(), filepath.Join(dtc.dir, key)))
+	dtc.add(key, uint64(len(data))+checksumSize)
+}
+
+// putTable caches the index and all of the blocks of the table |name|, whose
+// contents are |data|.
+func (dtc *diskTableCache) putTable(name addr, data []byte, index tableIndex) {
+	size := tableFileSize(index)
+	d.PanicIfFalse(size == uint64(len(data)))
+	dtc.put(diskCacheIndexName(name), data[size-indexSize(index.chunkCount)-maxFooterSize:])
+	for block := uint64(0); block*diskCacheBlockSize < size; block++ {
+		start, end := block*diskCacheBlockSize, (block+1)*diskCacheBlockSize
+		if end > size {
+			end = size
+		}
+		dtc.put(diskCacheBlockName(name, block), data[start:end])
+	}
+}
+
+// tableFileSize returns the size of the table that |index| indexes.
+func tableFileSize(index tableIndex) uint64 {
+	size := index.dataLength() + indexSize(index.chunkCount) + footerSize
+	if index.format == ZstdTables {
+		size += uint64(index.dictionaryLength) + zstdFooterSize - footerSize
+	}
+	return size
+}
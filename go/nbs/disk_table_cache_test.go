@@ -0,0 +1,180 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestDiskTableCache(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	dtc := newDiskTableCache(dir, 1024)
+	dtc.put("a", []byte("hello"))
+	data, ok := dtc.get("a")
+	assert.True(ok)
+	assert.Equal("hello", string(data))
+	_, ok = dtc.get("b")
+	assert.False(ok)
+
+	// A file that doesn't match its checksum is deleted.
+	dtc.put("b", []byte("goodbye"))
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "b"), []byte("badbye\x00\x00\x00\x00"), 0666))
+	_, ok = dtc.get("b")
+	assert.False(ok)
+	_, err = os.Stat(filepath.Join(dir, "b"))
+	assert.True(os.IsNotExist(err))
+
+	// Another cache in the same directory picks up the files in it.
+	dtc = newDiskTableCache(dir, 1024)
+	data, ok = dtc.get("a")
+	assert.True(ok)
+	assert.Equal("hello", string(data))
+}
+
+func TestDiskTableCacheEvicts(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	block := make([]byte, 400-checksumSize)
+	dtc := newDiskTableCache(dir, 1000)
+	dtc.put("a", block)
+	dtc.put("b", block)
+	dtc.get("a")
+	dtc.put("c", block)
+
+	_, ok := dtc.get("b")
+	assert.False(ok)
+	_, err = os.Stat(filepath.Join(dir, "b"))
+	assert.True(os.IsNotExist(err))
+	for _, key := range []string{"a", "c"} {
+		_, ok := dtc.get(key)
+		assert.True(ok)
+	}
+
+	// Something too big to cache at all isn't left on disk.
+	dtc.put("d", make([]byte, 2000))
+	infos, err := ioutil.ReadDir(dir)
+	assert.NoError(err)
+	assert.Len(infos, 2)
+}
+
+func TestS3TableReaderDiskCache(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	s3 := makeFakeS3(assert)
+
+	chunks := [][]byte{
+		[]byte("hello2"),
+		[]byte("goodbye2"),
+		[]byte("badbye2"),
+	}
+	tableData, h := buildTable(chunks)
+	s3.data[h.String()] = tableData
+
+	dtc := newDiskTableCache(dir, 1<<20)
+	trc := newS3TableReader(s3, "bucket", h, uint32(len(chunks)), nil, dtc, nil, nil)
+	for _, c := range chunks {
+		assert.Equal(string(c), string(trc.get(computeAddr(c))))
+	}
+	reads := s3.getCount
+
+	// Another process with the same cache directory doesn't go to S3 at all.
+	dtc = newDiskTableCache(dir, 1<<20)
+	trc = newS3TableReader(s3, "bucket", h, uint32(len(chunks)), nil, dtc, nil, nil)
+	for _, c := range chunks {
+		assert.Equal(string(c), string(trc.get(computeAddr(c))))
+	}
+	assert.Equal(reads, s3.getCount)
+}
+
+func TestS3TableReaderDiskCacheCoalesces(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s3 := makeFakeS3(assert)
+	// Random, so that the chunks don't compress to less than a block each.
+	chunks := [][]byte{make([]byte, diskCacheBlockSize), make([]byte, diskCacheBlockSize), []byte("small")}
+	rand.Read(chunks[0])
+	rand.Read(chunks[1])
+	tableData, h := buildTable(chunks)
+	s3.data[h.String()] = tableData
+
+	dtc := newDiskTableCache(dir, 1<<20)
+	trc := newS3TableReader(s3, "bucket", h, uint32(len(chunks)), nil, dtc, nil, nil).(*s3TableReader)
+	reads := s3.getCount
+
+	// A cold read of several blocks is a single read from S3...
+	p := make([]byte, 3*diskCacheBlockSize/2)
+	n, err := trc.ReadAt(p, diskCacheBlockSize/4)
+	assert.NoError(err)
+	assert.Equal(len(p), n)
+	assert.Equal(tableData[diskCacheBlockSize/4:diskCacheBlockSize/4+len(p)], p)
+	assert.Equal(reads+1, s3.getCount)
+
+	// ...and reading any part of those blocks again doesn't go to S3.
+	n, err = trc.ReadAt(p[:10], diskCacheBlockSize+5)
+	assert.NoError(err)
+	assert.Equal(10, n)
+	assert.Equal(tableData[diskCacheBlockSize+5:diskCacheBlockSize+15], p[:10])
+	assert.Equal(reads+1, s3.getCount)
+
+	// Reading past the end of the table fills what it can.
+	p = make([]byte, len(tableData))
+	n, err = trc.ReadAt(p, 10)
+	assert.Equal(io.EOF, err)
+	assert.Equal(len(tableData)-10, n)
+	assert.Equal(tableData[10:], p[:n])
+}
+
+func TestDiskTableCacheDefaultSize(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	dtc := openDiskTableCache(dir, 0)
+	dtc.put("key", []byte("data"))
+	data, ok := dtc.get("key")
+	assert.True(ok)
+	assert.Equal("data", string(data))
+}
+
+func TestS3TablePersisterDiskCache(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	mt := newMemTable(testMemTableSize)
+	for _, c := range testChunks {
+		assert.True(mt.addChunk(computeAddr(c), c))
+	}
+	s3svc := makeFakeS3(assert)
+	s3p := s3TablePersister{s3: s3svc, bucket: "bucket", partSize: calcPartSize(mt, 3), dtc: newDiskTableCache(dir, 1<<20)}
+	src := s3p.Compact(mt, nil)
+
+	src = s3p.Open(src.hash(), src.count(), "")
+	for _, c := range testChunks {
+		assert.Equal(string(c), string(src.get(computeAddr(c))))
+	}
+	assert.Zero(s3svc.getCount)
+}
@@ -6,8 +6,10 @@ package nbs
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/constants"
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/hash"
@@ -23,11 +25,20 @@ const (
 	versAttr       = "vers"
 	nbsVersAttr    = "nbsVers"
 	tableSpecsAttr = "specs"
+	rootLogAttr    = "log"
+	rootLogSeqAttr = "seq"
+
+	// The root log for a store is kept in its own item, keyed by the store's namespace plus this suffix.
+	rootLogKeySuffix = ":reflog"
 )
 
 var (
-	valueEqualsExpression            = fmt.Sprintf("(%s = :prev) and (%s = :vers)", rootAttr, versAttr)
-	valueNotExistsOrEqualsExpression = fmt.Sprintf("attribute_not_exists("+rootAttr+") or %s", valueEqualsExpression)
+	valueEqualsExpression                = fmt.Sprintf("(%s = :prev) and (%s = :vers)", rootAttr, versAttr)
+	valueNotExistsOrEqualsExpression     = fmt.Sprintf("attribute_not_exists("+rootAttr+") or %s", valueEqualsExpression)
+	valueAndSpecsEqualExpression         = fmt.Sprintf("%s and (%s = :specs)", valueEqualsExpression, tableSpecsAttr)
+	valueNotExistsOrSpecsEqualExpression = fmt.Sprintf("attribute_not_exists("+rootAttr+") or (%s)", valueAndSpecsEqualExpression)
+	rootLogNotExistsExpression           = fmt.Sprintf("attribute_not_exists(%s)", dbAttr)
+	rootLogSeqEqualsExpression           = fmt.Sprintf("%s = :seq", rootLogSeqAttr)
 )
 
 type ddbsvc interface {
@@ -63,7 +74,7 @@ func (dm dynamoManifest) ParseIfExists(readHook func()) (exists bool, vers strin
 		exists = true
 		vers = *result.Item[versAttr].S
 		root = hash.New(result.Item[rootAttr].B)
-		tableSpecs = parseSpecs(strings.Split(*result.Item[tableSpecsAttr].S, ":"))
+		tableSpecs = parseSpecs(*result.Item[nbsVersAttr].S, strings.Split(*result.Item[tableSpecsAttr].S, ":"))
 	}
 
 	return
@@ -72,38 +83,45 @@ func (dm dynamoManifest) ParseIfExists(readHook func()) (exists bool, vers strin
 func validateManifest(item map[string]*dynamodb.AttributeValue) bool {
 	return len(item) == 5 &&
 		item[nbsVersAttr] != nil && item[nbsVersAttr].S != nil &&
-		StorageVersion == *item[nbsVersAttr].S &&
 		item[versAttr] != nil && item[versAttr].S != nil &&
 		item[rootAttr] != nil && item[rootAttr].B != nil &&
 		item[tableSpecsAttr] != nil && item[tableSpecsAttr].S != nil
 }
 
-func (dm dynamoManifest) Update(specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (actual hash.Hash, tableSpecs []tableSpec) {
-	tableSpecs = specs
-
-	tableInfo := make([]string, 2*len(tableSpecs))
-	formatSpecs(tableSpecs, tableInfo)
+func (dm dynamoManifest) Update(lastSpecs, specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (actual hash.Hash, tableSpecs []tableSpec) {
 	putArgs := dynamodb.PutItemInput{
 		TableName: aws.String(dm.table),
 		Item: map[string]*dynamodb.AttributeValue{
 			dbAttr:         {S: aws.String(dm.db)},
-			nbsVersAttr:    {S: aws.String(StorageVersion)},
+			nbsVersAttr:    {S: aws.String(storageVersion(specs))},
 			versAttr:       {S: aws.String(constants.NomsVersion)},
 			rootAttr:       {B: newRoot[:]},
-			tableSpecsAttr: {S: aws.String(strings.Join(tableInfo, ":"))},
+			tableSpecsAttr: {S: aws.String(joinSpecs(specs))},
 		},
 	}
 
-	expr := valueEqualsExpression
-	if root.IsEmpty() {
-		expr = valueNotExistsOrEqualsExpression
-	}
-
-	putArgs.ConditionExpression = aws.String(expr)
+	// DynamoDB rejects requests that bind values their condition doesn't use,
+	// so each condition gets just the ones it needs. It also doesn't allow
+	// empty string attribute values, so an empty |lastSpecs| can only be
+	// checked implicitly via |root|.
 	putArgs.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
 		":prev": {B: root[:]},
 		":vers": {S: aws.String(constants.NomsVersion)},
 	}
+	var expr string
+	switch {
+	case len(lastSpecs) > 0:
+		putArgs.ExpressionAttributeValues[":specs"] = &dynamodb.AttributeValue{S: aws.String(joinSpecs(lastSpecs))}
+		expr = valueAndSpecsEqualExpression
+		if root.IsEmpty() {
+			expr = valueNotExistsOrSpecsEqualExpression
+		}
+	case root.IsEmpty():
+		expr = valueNotExistsOrEqualsExpression
+	default:
+		expr = valueEqualsExpression
+	}
+	putArgs.ConditionExpression = aws.String(expr)
 
 	_, err := dm.ddbsvc.PutItem(&putArgs)
 	if err != nil {
@@ -118,5 +136,77 @@ func (dm dynamoManifest) Update(specs []tableSpec, root, newRoot hash.Hash, writ
 		d.Chk.NoError(err)
 	}
 
-	return newRoot, tableSpecs
+	return newRoot, specs
+}
+
+func joinSpecs(specs []tableSpec) string {
+	tableInfo := make([]string, 2*len(specs))
+	formatSpecs(specs, tableInfo)
+	return strings.Join(tableInfo, ":")
+}
+
+// updateRootLog updates the log of root transitions, which is stored in a
+// separate item from the manifest. The item carries a sequence number so that
+// concurrent updates can be serialized using a conditional put. DynamoDB
+// doesn't allow empty string attribute values, so an empty log is stored
+// without one.
+func (dm dynamoManifest) updateRootLog(f func(log []chunks.RootLogEntry) []chunks.RootLogEntry) {
+	for {
+		log, seq, exists := dm.getRootLog()
+		putArgs := dynamodb.PutItemInput{
+			TableName: aws.String(dm.table),
+			Item: map[string]*dynamodb.AttributeValue{
+				dbAttr:         {S: aws.String(dm.db + rootLogKeySuffix)},
+				rootLogSeqAttr: {N: aws.String(strconv.FormatUint(seq+1, 10))},
+			},
+			ConditionExpression: aws.String(rootLogNotExistsExpression),
+		}
+		if log = f(log); len(log) > 0 {
+			putArgs.Item[rootLogAttr] = &dynamodb.AttributeValue{S: aws.String(formatRootLog(log))}
+		}
+		if exists {
+			putArgs.ConditionExpression = aws.String(rootLogSeqEqualsExpression)
+			putArgs.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+				":seq": {N: aws.String(strconv.FormatUint(seq, 10))},
+			}
+		}
+
+		_, err := dm.ddbsvc.PutItem(&putArgs)
+		if err == nil {
+			return
+		}
+		if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != "ConditionalCheckFailedException" {
+			d.PanicIfError(err)
+		}
+		// Someone else changed the log since we read it. Try again.
+	}
+}
+
+func (dm dynamoManifest) readRootLog() []chunks.RootLogEntry {
+	log, _, _ := dm.getRootLog()
+	return log
+}
+
+func (dm dynamoManifest) getRootLog() (log []chunks.RootLogEntry, seq uint64, exists bool) {
+	result, err := dm.ddbsvc.GetItem(&dynamodb.GetItemInput{
+		ConsistentRead: aws.Bool(true),
+		TableName:      aws.String(dm.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			dbAttr: {S: aws.String(dm.db + rootLogKeySuffix)},
+		},
+	})
+	d.PanicIfError(err)
+
+	if len(result.Item) == 0 {
+		return nil, 0, false
+	}
+	if (result.Item[rootLogAttr] != nil && result.Item[rootLogAttr].S == nil) || result.Item[rootLogSeqAttr] == nil || result.Item[rootLogSeqAttr].N == nil {
+		d.Panic("Malformed root log for %s: %+v", dm.db, result.Item)
+	}
+	seq, err = strconv.ParseUint(*result.Item[rootLogSeqAttr].N, 10, 64)
+	d.PanicIfError(err)
+	if result.Item[rootLogAttr] == nil {
+		return nil, seq, true
+	}
+	return parseRootLog(*result.Item[rootLogAttr].S), seq, true
 }
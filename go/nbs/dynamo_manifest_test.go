@@ -6,6 +6,7 @@ package nbs
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/attic-labs/noms/go/constants"
@@ -57,7 +58,7 @@ func TestDynamoManifestUpdateWontClobberOldVersion(t *testing.T) {
 	badRoot := hash.Of([]byte("bad root"))
 	ddb.put(db, badRoot[:], "0", "")
 
-	assert.Panics(func() { mm.Update(nil, badRoot, hash.Hash{}, nil) })
+	assert.Panics(func() { mm.Update(nil, nil, badRoot, hash.Hash{}, nil) })
 }
 
 func TestDynamoManifestUpdate(t *testing.T) {
@@ -66,33 +67,73 @@ func TestDynamoManifestUpdate(t *testing.T) {
 
 	// First, test winning the race against another process.
 	newRoot := hash.Of([]byte("new root"))
-	specs := []tableSpec{{computeAddr([]byte("a")), 3}}
-	actual, tableSpecs := mm.Update(specs, hash.Hash{}, newRoot, nil)
+	specs := []tableSpec{{computeAddr([]byte("a")), 3, "", SnappyTables}}
+	actual, tableSpecs := mm.Update(nil, specs, hash.Hash{}, newRoot, nil)
 	assert.Equal(newRoot, actual)
 	assert.Equal(specs, tableSpecs)
 
 	// Now, test the case where the optimistic lock fails, and someone else updated the root since last we checked.
 	newRoot2 := hash.Of([]byte("new root 2"))
-	actual, tableSpecs = mm.Update(nil, hash.Hash{}, newRoot2, nil)
+	actual, tableSpecs = mm.Update(nil, nil, hash.Hash{}, newRoot2, nil)
 	assert.Equal(newRoot, actual)
 	assert.Equal(specs, tableSpecs)
-	actual, tableSpecs = mm.Update(nil, actual, newRoot2, nil)
+
+	// The root matches, but the tables have changed since last we checked.
+	stale := []tableSpec{{computeAddr([]byte("c")), 1, "", SnappyTables}}
+	actual, tableSpecs = mm.Update(stale, nil, actual, newRoot2, nil)
+	assert.Equal(newRoot, actual)
+	assert.Equal(specs, tableSpecs)
+
+	specs2 := []tableSpec{{computeAddr([]byte("b")), 3, "", SnappyTables}}
+	actual, tableSpecs = mm.Update(tableSpecs, specs2, actual, newRoot2, nil)
+	assert.Equal(newRoot2, actual)
+	assert.Equal(specs2, tableSpecs)
+}
+
+func TestDynamoManifestUpdateEmptyRoot(t *testing.T) {
+	assert := assert.New(t)
+	mm, _ := makeDynamoManifestFake(t)
+
+	// Tables can be added to the manifest before there's a root.
+	specs := []tableSpec{{computeAddr([]byte("a")), 3, "", SnappyTables}}
+	actual, tableSpecs := mm.Update(nil, specs, hash.Hash{}, hash.Hash{}, nil)
+	assert.Equal(hash.Hash{}, actual)
+	assert.Equal(specs, tableSpecs)
+
+	// Later updates of the empty root still check the tables.
+	newRoot := hash.Of([]byte("new root"))
+	stale := []tableSpec{{computeAddr([]byte("c")), 1, "", SnappyTables}}
+	actual, tableSpecs = mm.Update(stale, nil, hash.Hash{}, newRoot, nil)
+	assert.Equal(hash.Hash{}, actual)
+	assert.Equal(specs, tableSpecs)
+
+	specs2 := append(specs, tableSpec{computeAddr([]byte("b")), 3, "", SnappyTables})
+	actual, tableSpecs = mm.Update(specs, specs2, hash.Hash{}, newRoot, nil)
+	assert.Equal(newRoot, actual)
+	assert.Equal(specs2, tableSpecs)
 }
 
 type fakeDDB struct {
 	data    map[string]record
+	logs    map[string]logRecord
 	assert  *assert.Assertions
 	numPuts int
 }
 
+type logRecord struct {
+	log, seq string
+}
+
 type record struct {
 	root        []byte
 	vers, specs string
+	nbsVers     string // StorageVersion if empty
 }
 
 func makeFakeDDB(a *assert.Assertions) *fakeDDB {
 	return &fakeDDB{
 		data:   map[string]record{},
+		logs:   map[string]logRecord{},
 		assert: a,
 	}
 }
@@ -102,10 +143,22 @@ func (m *fakeDDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput
 	m.assert.NotNil(key, "key should have been a String: %+v", input.Key[dbAttr])
 
 	item := map[string]*dynamodb.AttributeValue{}
+	if l, present := m.logs[*key]; present {
+		item[dbAttr] = &dynamodb.AttributeValue{S: key}
+		if l.log != "" {
+			item[rootLogAttr] = &dynamodb.AttributeValue{S: aws.String(l.log)}
+		}
+		item[rootLogSeqAttr] = &dynamodb.AttributeValue{N: aws.String(l.seq)}
+		return &dynamodb.GetItemOutput{Item: item}, nil
+	}
 	root, vers, specs := m.get(*key)
 	if root != nil {
 		item[dbAttr] = &dynamodb.AttributeValue{S: key}
-		item[nbsVersAttr] = &dynamodb.AttributeValue{S: aws.String(StorageVersion)}
+		nbsVers := m.data[*key].nbsVers
+		if nbsVers == "" {
+			nbsVers = StorageVersion
+		}
+		item[nbsVersAttr] = &dynamodb.AttributeValue{S: aws.String(nbsVers)}
 		item[versAttr] = &dynamodb.AttributeValue{S: aws.String(vers)}
 		item[rootAttr] = &dynamodb.AttributeValue{B: root}
 		item[tableSpecsAttr] = &dynamodb.AttributeValue{S: aws.String(specs)}
@@ -118,7 +171,7 @@ func (m *fakeDDB) get(k string) ([]byte, string, string) {
 }
 
 func (m *fakeDDB) put(k string, r []byte, v string, s string) {
-	m.data[k] = record{r, v, s}
+	m.data[k] = record{r, v, s, ""}
 }
 
 func (m *fakeDDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
@@ -126,9 +179,14 @@ func (m *fakeDDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput
 	m.assert.NotNil(input.Item[dbAttr].S, "key should have been a String: %+v", input.Item[dbAttr])
 	key := *input.Item[dbAttr].S
 
+	if _, isLog := input.Item[rootLogSeqAttr]; isLog {
+		return m.putLog(key, input)
+	}
+
 	m.assert.NotNil(input.Item[nbsVersAttr], "%s should have been present", nbsVersAttr)
 	m.assert.NotNil(input.Item[nbsVersAttr].S, "nbsVers should have been a String: %+v", input.Item[nbsVersAttr])
-	m.assert.Equal(StorageVersion, *input.Item[nbsVersAttr].S)
+	nbsVers := *input.Item[nbsVersAttr].S
+	m.assert.Contains([]string{StorageVersion, EncryptedStorageVersion, ZstdStorageVersion}, nbsVers)
 
 	m.assert.NotNil(input.Item[versAttr], "%s should have been present", versAttr)
 	m.assert.NotNil(input.Item[versAttr].S, "nbsVers should have been a String: %+v", input.Item[versAttr])
@@ -142,21 +200,52 @@ func (m *fakeDDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput
 	m.assert.NotNil(input.Item[tableSpecsAttr].S, "specs should have been a String: %+v", input.Item[tableSpecsAttr])
 	specs := *input.Item[tableSpecsAttr].S
 
-	mustNotExist := *(input.ConditionExpression) == valueNotExistsOrEqualsExpression
+	// Like DynamoDB, refuse values that the condition doesn't use.
+	for name := range input.ExpressionAttributeValues {
+		if !strings.Contains(*input.ConditionExpression, name) {
+			return nil, mockAWSError("ValidationException")
+		}
+	}
+	mayNotExist := strings.HasPrefix(*input.ConditionExpression, "attribute_not_exists(")
 	current, present := m.data[key]
 
-	if mustNotExist && present {
+	if !present && !mayNotExist {
 		return nil, mockAWSError("ConditionalCheckFailedException")
-	} else if !mustNotExist && !checkCondition(current, input.ExpressionAttributeValues) {
+	} else if present && !checkCondition(current, input.ExpressionAttributeValues) {
 		return nil, mockAWSError("ConditionalCheckFailedException")
 	}
 
-	m.put(key, root, constants.NomsVersion, specs)
+	m.data[key] = record{root, constants.NomsVersion, specs, nbsVers}
 	m.numPuts++
 
 	return &dynamodb.PutItemOutput{}, nil
 }
 
+func (m *fakeDDB) putLog(key string, input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	log := ""
+	if input.Item[rootLogAttr] != nil {
+		m.assert.NotNil(input.Item[rootLogAttr].S, "log should have been a String: %+v", input.Item[rootLogAttr])
+		log = *input.Item[rootLogAttr].S
+		m.assert.NotEmpty(log, "DynamoDB doesn't allow empty strings")
+	}
+	m.assert.NotNil(input.Item[rootLogSeqAttr].N, "seq should have been a Number: %+v", input.Item[rootLogSeqAttr])
+
+	current, present := m.logs[key]
+	if *input.ConditionExpression == rootLogNotExistsExpression {
+		if present {
+			return nil, mockAWSError("ConditionalCheckFailedException")
+		}
+	} else if !present || current.seq != *input.ExpressionAttributeValues[":seq"].N {
+		return nil, mockAWSError("ConditionalCheckFailedException")
+	}
+	m.logs[key] = logRecord{log, *input.Item[rootLogSeqAttr].N}
+	m.numPuts++
+	return &dynamodb.PutItemOutput{}, nil
+}
+
 func checkCondition(current record, expressionAttrVals map[string]*dynamodb.AttributeValue) bool {
+	if specs, present := expressionAttrVals[":specs"]; present && current.specs != *specs.S {
+		return false
+	}
 	return current.vers == *expressionAttrVals[":vers"].S && bytes.Equal(current.root, expressionAttrVals[":prev"].B)
 }
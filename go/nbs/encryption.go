@@ -0,0 +1,170 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/attic-labs/noms/go/d"
+)
+
+// EncryptionKeysEnvVar is the environment variable from which KeyringFromEnv
+// reads a Keyring, in the format that ParseKeyring accepts.
+const EncryptionKeysEnvVar = "NOMS_ENCRYPTION_KEYS"
+
+// ErrUnencryptedWrite is the error with which a store refuses to add
+// unencrypted tables to a manifest that names encrypted ones, e.g. because it
+// was opened without keys before the first encrypted table was added.
+var ErrUnencryptedWrite = errors.New("Store has encrypted tables, so it can't be written to without an encryption key")
+
+const (
+	encryptionNonceSize = 12
+	encryptionTagSize   = 16
+
+	// encryptionOverhead is how many bytes longer an encrypted chunk record
+	// is than a plaintext one.
+	encryptionOverhead = encryptionNonceSize + encryptionTagSize
+)
+
+var keyIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_.\-]+$`)
+
+// Keyring holds the data keys that a NomsBlockStore encrypts its tables with.
+// Each key has an ID, which the manifest records alongside every table that
+// was encrypted with it. New tables are encrypted with the active key; the
+// others are only needed to read tables written before it was rotated in. To
+// retire a key, make another key active and run GC, which rewrites every live
+// chunk into new tables.
+type Keyring struct {
+	activeID string
+	ciphers  map[string]*chunkCipher
+}
+
+// NewKeyring returns a Keyring of |keys|, by ID, whose active key is
+// |activeID|. Keys must be 16, 24 or 32 bytes long, to select AES-128, AES-192
+// or AES-256.
+func NewKeyring(activeID string, keys map[string][]byte) (*Keyring, error) {
+	kr := &Keyring{activeID, map[string]*chunkCipher{}}
+	for id, key := range keys {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("Invalid key ID %q: only letters, digits, '_', '.' and '-' are allowed", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key %s: %s", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		d.PanicIfError(err)
+		kr.ciphers[id] = &chunkCipher{id, aead}
+	}
+	if kr.ciphers[activeID] == nil {
+		return nil, fmt.Errorf("No key for active key ID %q", activeID)
+	}
+	return kr, nil
+}
+
+// ParseKeyring parses a comma-separated list of keys, each an ID and the
+// base64 encoding of the key, separated by '='. The first key is the active
+// one. For example:
+//
+//	2017-06=eLbYQJbZ5CtXm6b2JNGQmE63WeLlgTpaxHzL2ii+mNY=,2017-01=...
+func ParseKeyring(s string) (*Keyring, error) {
+	activeID, keys := "", map[string][]byte{}
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid key %q: expected <id>=<base64 key>", entry)
+		}
+		if _, present := keys[parts[0]]; present {
+			return nil, fmt.Errorf("Duplicate key ID %q", parts[0])
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key %s: %s", parts[0], err)
+		}
+		if activeID == "" {
+			activeID = parts[0]
+		}
+		keys[parts[0]] = key
+	}
+	return NewKeyring(activeID, keys)
+}
+
+// KeyringFromEnv parses the Keyring in the EncryptionKeysEnvVar environment
+// variable. It returns nil, and no error, if the variable isn't set.
+func KeyringFromEnv() (*Keyring, error) {
+	s := os.Getenv(EncryptionKeysEnvVar)
+	if s == "" {
+		return nil, nil
+	}
+	return ParseKeyring(s)
+}
+
+// ActiveKeyID returns the ID of the key that new tables are encrypted with.
+func (kr *Keyring) ActiveKeyID() string {
+	return kr.activeID
+}
+
+// active returns the cipher to write new tables with, or nil if |kr| is nil
+// and tables aren't to be encrypted.
+func (kr *Keyring) active() *chunkCipher {
+	if kr == nil {
+		return nil
+	}
+	return kr.ciphers[kr.activeID]
+}
+
+// cipher returns the cipher to read tables encrypted with the key |keyID|,
+// or nil if |keyID| is "" and they aren't encrypted.
+func (kr *Keyring) cipher(keyID string) *chunkCipher {
+	if keyID == "" {
+		return nil
+	}
+	if kr == nil {
+		d.Panic("Table is encrypted with key %s, but no keys were supplied", keyID)
+	}
+	c := kr.ciphers[keyID]
+	if c == nil {
+		d.Panic("Table is encrypted with key %s, which isn't in the keyring", keyID)
+	}
+	return c
+}
+
+// chunkCipher encrypts and decrypts the chunk records of tables, using
+// AES-GCM with a random nonce per record. The address of each chunk is
+// authenticated along with it, so that records can't be swapped around
+// within or between tables. Only the records are encrypted; table indices
+// hold nothing but addresses and lengths, and stay plaintext so that chunks
+// can be found, and de-duplicated, by address.
+type chunkCipher struct {
+	keyID string
+	aead  cipher.AEAD
+}
+
+// seal appends the nonce and the encryption of |plaintext|, the compressed
+// data of the chunk |h|, to |dst|, which must have the capacity to hold them
+// both.
+func (c *chunkCipher) seal(dst []byte, plaintext []byte, h addr) []byte {
+	nonce := dst[len(dst) : len(dst)+encryptionNonceSize]
+	_, err := rand.Read(nonce)
+	d.PanicIfError(err)
+	return c.aead.Seal(dst[:len(dst)+encryptionNonceSize], nonce, plaintext, h[:])
+}
+
+// open is the inverse of seal. It returns an error if |sealed| wasn't
+// produced by sealing the chunk |h| with this key.
+func (c *chunkCipher) open(sealed []byte, h addr) ([]byte, error) {
+	if len(sealed) < encryptionOverhead {
+		return nil, fmt.Errorf("Encrypted record is too short")
+	}
+	return c.aead.Open(nil, sealed[:encryptionNonceSize], sealed[encryptionNonceSize:], h[:])
+}
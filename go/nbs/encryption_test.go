@@ -0,0 +1,166 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+var (
+	testKey1 = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	testKey2 = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 16))
+)
+
+func mustParseKeyring(assert *assert.Assertions, s string) *Keyring {
+	kr, err := ParseKeyring(s)
+	assert.NoError(err)
+	return kr
+}
+
+func TestParseKeyring(t *testing.T) {
+	assert := assert.New(t)
+
+	kr := mustParseKeyring(assert, "new="+testKey2+", old="+testKey1)
+	assert.Equal("new", kr.ActiveKeyID())
+	assert.Equal("new", kr.active().keyID)
+	assert.Equal("old", kr.cipher("old").keyID)
+	assert.Nil(kr.cipher(""))
+	assert.Panics(func() { kr.cipher("other") })
+
+	for _, s := range []string{"", "k1", "k:1=" + testKey1, "k1=not base64", "k1=" + base64.StdEncoding.EncodeToString([]byte("short")), "k1=" + testKey1 + ",k1=" + testKey2} {
+		_, err := ParseKeyring(s)
+		assert.Error(err, s)
+	}
+}
+
+func TestChunkCipher(t *testing.T) {
+	assert := assert.New(t)
+	c := mustParseKeyring(assert, "k1="+testKey1).active()
+
+	data := []byte("hello")
+	h := computeAddr(data)
+	sealed := c.seal(make([]byte, 0, len(data)+encryptionOverhead), data, h)
+	assert.Len(sealed, len(data)+encryptionOverhead)
+	assert.False(bytes.Contains(sealed, data))
+
+	opened, err := c.open(sealed, h)
+	assert.NoError(err)
+	assert.Equal(data, opened)
+
+	// Records are bound to their addresses.
+	_, err = c.open(sealed, computeAddr([]byte("goodbye")))
+	assert.Error(err)
+
+	sealed[len(sealed)-1] ^= 1
+	_, err = c.open(sealed, h)
+	assert.Error(err)
+
+	_, err = mustParseKeyring(assert, "k1="+testKey2).active().open(sealed, h)
+	assert.Error(err)
+}
+
+func TestEncryptedAWSStore(t *testing.T) {
+	assert := assert.New(t)
+	s3svc, ddb := makeFakeS3(assert), makeFakeDDB(assert)
+	open := func(keys *Keyring) *NomsBlockStore {
+		return newAWSStore("table", "db", "bucket", s3svc, ddb, testMemTableSize, nil, nil, keys, StoreOptions{}, make(chan struct{}, 32))
+	}
+	specs := func() string {
+		_, _, specs := ddb.get("db")
+		return specs
+	}
+
+	// A store can start encrypting its tables at any time.
+	store := open(nil)
+	plain := putValue(store, types.String("public data"))
+	assert.True(store.UpdateRoot(plain.Hash(), store.Root()))
+	assert.NoError(store.Close())
+
+	store = open(mustParseKeyring(assert, "old="+testKey1))
+	secretValue := types.String("top secret customer data")
+	secret := putValue(store, secretValue)
+	assert.True(store.UpdateRoot(secret.Hash(), store.Root()))
+	assert.Equal(plain.Data(), store.Get(plain.Hash()).Data())
+	assert.NoError(store.Close())
+
+	assert.Contains(specs(), "@old")
+	assert.Equal(EncryptedStorageVersion, ddb.data["db"].nbsVers)
+	for key, data := range s3svc.data {
+		assert.False(bytes.Contains(data, []byte(secretValue)), "Table %s holds plaintext", key)
+	}
+
+	// After rotating in a new key, tables encrypted with the old one can still
+	// be read, and chunks are still deduplicated by address.
+	rotated := mustParseKeyring(assert, "new="+testKey2+",old="+testKey1)
+	store = open(rotated)
+	assert.True(store.Has(secret.Hash()))
+	assert.Equal(secret.Data(), store.Get(secret.Hash()).Data())
+	root := putValue(store, types.NewList(types.NewRef(secretValue), types.NewRef(types.String("public data"))))
+	putValue(store, secretValue)
+	assert.True(store.UpdateRoot(root.Hash(), store.Root()))
+	assert.Contains(specs(), "@new")
+	assert.Contains(specs(), "@old")
+
+	// The old key can't be dropped until GC has rewritten its tables.
+	assert.Panics(func() { open(mustParseKeyring(assert, "new="+testKey2)) })
+	assert.Panics(func() { open(nil) })
+
+	_, err := store.GC()
+	assert.NoError(err)
+	for _, spec := range parseSpecs(EncryptedStorageVersion, strings.Split(specs(), ":")) {
+		assert.Equal("new", spec.keyID)
+	}
+
+	// When all their chunks are live, encrypted tables are rewritten under
+	// the same names, but not byte-for-byte, since each record gets a new
+	// nonce. Their indexes don't change.
+	before := specs()
+	tables := map[string][]byte{}
+	for _, spec := range parseSpecs(EncryptedStorageVersion, strings.Split(before, ":")) {
+		tables[spec.name.String()] = s3svc.data[spec.name.String()]
+	}
+	_, err = store.GC()
+	assert.NoError(err)
+	assert.Equal(before, specs())
+	for name, data := range tables {
+		assert.NotEqual(data, s3svc.data[name])
+		assert.Equal(parseTableIndex(data), parseTableIndex(s3svc.data[name]))
+	}
+	assert.NoError(store.Close())
+
+	store = open(mustParseKeyring(assert, "new="+testKey2))
+	defer store.Close()
+	for _, c := range []chunks.Chunk{plain, secret, root} {
+		assert.Equal(c.Data(), store.Get(c.Hash()).Data())
+	}
+}
+
+func TestEncryptedStoreRefusesPlaintextWrites(t *testing.T) {
+	assert := assert.New(t)
+	s3svc, ddb := makeFakeS3(assert), makeFakeDDB(assert)
+	keys := mustParseKeyring(assert, "key="+testKey1)
+	store := newAWSStore("table", "db", "bucket", s3svc, ddb, testMemTableSize, nil, nil, keys, StoreOptions{}, make(chan struct{}, 32))
+	defer store.Close()
+	secret := putValue(store, types.String("secret"))
+	assert.True(store.UpdateRoot(secret.Hash(), store.Root()))
+
+	// Whatever the reason a store has no key to write with, it mustn't add
+	// plaintext tables alongside the encrypted ones.
+	store.tables.p = newS3TableSet(s3svc, "bucket", nil, nil, nil, SnappyTables, nil).p
+	plain := putValue(store, types.String("plain"))
+	assert.Panics(func() { store.UpdateRoot(plain.Hash(), secret.Hash()) })
+	_, _, specs := ddb.get("db")
+	assert.Equal(1, strings.Count(specs, "@key"))
+	assert.Equal(1, strings.Count(specs, ":"))
+
+	assert.NoError(checkEncrypted(nil, []tableSpec{{name: computeAddr([]byte("a")), chunkCount: 1}}))
+}
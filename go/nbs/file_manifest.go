@@ -13,6 +13,7 @@ import (
 
 	"golang.org/x/sys/unix"
 
+	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/constants"
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/hash"
@@ -21,6 +22,7 @@ import (
 const (
 	manifestFileName = "manifest"
 	lockFileName     = "LOCK"
+	rootLogFileName  = "reflog"
 )
 
 // fileManifest provides access to a NomsBlockStore manifest stored on disk in |dir|. The format
@@ -79,29 +81,26 @@ func parseManifest(r io.Reader) (string, hash.Hash, []tableSpec) {
 	if len(slices) < 3 || len(slices)%2 == 0 {
 		d.Chk.Fail("Malformed manifest: " + string(manifest))
 	}
-	d.PanicIfFalse(StorageVersion == string(slices[0]))
-
-	return slices[1], hash.Parse(slices[2]), parseSpecs(slices[3:])
+	return slices[1], hash.Parse(slices[2]), parseSpecs(slices[0], slices[3:])
 }
 
 // Update optimistically tries to write a new manifest, containing |newRoot|
-// and the elements of |tables|. If the existing manifest on disk doesn't
-// contain |root|, Update fails and returns the parsed contents of the
-// manifest on disk. Callers should check that |actual| == |newRoot| upon
-// return and, if not, merge any desired new table information with the
-// contents of |tableSpecs| before trying again.
+// and the elements of |specs|. If the existing manifest on disk doesn't
+// contain |root| and the tables in |lastSpecs|, Update fails and returns the
+// parsed contents of the manifest on disk. Callers should check that
+// |actual| == |newRoot| and that |tableSpecs| matches |specs| upon return
+// and, if not, merge any desired new table information with the contents of
+// |tableSpecs| before trying again.
 // If writeHook is non-nil, it will be invoked wile the manifest file lock is
 // held. This is to allow for testing of race conditions.
-func (fm fileManifest) Update(specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (actual hash.Hash, tableSpecs []tableSpec) {
-	tableSpecs = specs
-
+func (fm fileManifest) Update(lastSpecs, specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (actual hash.Hash, tableSpecs []tableSpec) {
 	// Write a temporary manifest file, to be renamed over manifestFileName upon success.
 	// The closure here ensures this file is closed before moving on.
 	tempManifestPath := func() string {
 		temp, err := ioutil.TempFile(fm.dir, "nbs_manifest_")
 		d.PanicIfError(err)
 		defer checkClose(temp)
-		writeManifest(temp, newRoot, tableSpecs)
+		writeManifest(temp, newRoot, specs)
 		return temp.Name()
 	}()
 	defer os.Remove(tempManifestPath) // If we rename below, this will be a no-op
@@ -128,17 +127,49 @@ func (fm fileManifest) Update(specs []tableSpec, root, newRoot hash.Hash, writeH
 		}
 	}()
 
-	if root != actual {
+	if root != actual || !specsEqual(lastSpecs, tableSpecs) {
 		return actual, tableSpecs
 	}
 	err := os.Rename(tempManifestPath, manifestPath)
 	d.PanicIfError(err)
-	return newRoot, tableSpecs
+	return newRoot, specs
+}
+
+// updateRootLog updates the log of root transitions in fm.dir/reflog,
+// holding the manifest file lock while it does so. Like the manifest, the log
+// is written to a temporary file and renamed into place.
+func (fm fileManifest) updateRootLog(f func(log []chunks.RootLogEntry) []chunks.RootLogEntry) {
+	defer checkClose(flock(filepath.Join(fm.dir, lockFileName))) // closing releases the lock
+
+	log := f(fm.readRootLog())
+	tempLogPath := func() string {
+		temp, err := ioutil.TempFile(fm.dir, "nbs_reflog_")
+		d.PanicIfError(err)
+		defer checkClose(temp)
+		_, err = io.WriteString(temp, formatRootLog(log))
+		d.PanicIfError(err)
+		return temp.Name()
+	}()
+	defer os.Remove(tempLogPath) // If we rename below, this will be a no-op
+	d.PanicIfError(os.Rename(tempLogPath, filepath.Join(fm.dir, rootLogFileName)))
+}
+
+// readRootLog returns the contents of fm.dir/reflog, if it exists. Since the
+// file is only ever replaced by rename, it doesn't need to take the lock.
+func (fm fileManifest) readRootLog() []chunks.RootLogEntry {
+	f := openIfExists(filepath.Join(fm.dir, rootLogFileName))
+	if f == nil {
+		return nil
+	}
+	defer checkClose(f)
+	data, err := ioutil.ReadAll(f)
+	d.PanicIfError(err)
+	return parseRootLog(string(data))
 }
 
 func writeManifest(temp io.Writer, root hash.Hash, specs []tableSpec) {
 	strs := make([]string, 2*len(specs)+3)
-	strs[0], strs[1], strs[2] = StorageVersion, constants.NomsVersion, root.String()
+	strs[0], strs[1], strs[2] = storageVersion(specs), constants.NomsVersion, root.String()
 	tableInfo := strs[3:]
 	formatSpecs(specs, tableInfo)
 	_, err := io.WriteString(temp, strings.Join(strs, ":"))
@@ -86,7 +86,43 @@ func TestFileManifestUpdateWontClobberOldVersion(t *testing.T) {
 	err := clobberManifest(fm.dir, strings.Join([]string{StorageVersion, "0", hash.Hash{}.String()}, ":"))
 	assert.NoError(err)
 
-	assert.Panics(func() { fm.Update(nil, hash.Hash{}, hash.Hash{}, nil) })
+	assert.Panics(func() { fm.Update(nil, nil, hash.Hash{}, hash.Hash{}, nil) })
+}
+
+func TestFileManifestStorageVersion(t *testing.T) {
+	assert := assert.New(t)
+	fm := makeFileManifestTempDir(t)
+	defer os.RemoveAll(fm.dir)
+
+	// Manifests that name encrypted tables have a storage version of their own...
+	root := hash.Of([]byte("root"))
+	plain := tableSpec{computeAddr([]byte("plain")), 1, "", SnappyTables}
+	encrypted := tableSpec{computeAddr([]byte("encrypted")), 2, "key1", SnappyTables}
+	fm.Update(nil, []tableSpec{plain}, hash.Hash{}, root, nil)
+	b, err := ioutil.ReadFile(filepath.Join(fm.dir, manifestFileName))
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(string(b), StorageVersion+":"))
+	fm.Update([]tableSpec{plain}, []tableSpec{encrypted, plain}, root, root, nil)
+	b, err = ioutil.ReadFile(filepath.Join(fm.dir, manifestFileName))
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(string(b), EncryptedStorageVersion+":"))
+	_, _, _, tableSpecs := fm.ParseIfExists(nil)
+	assert.Equal([]tableSpec{encrypted, plain}, tableSpecs)
+
+	// ...as do those that name zstd tables...
+	zstd := tableSpec{computeAddr([]byte("zstd")), 3, "key1", ZstdTables}
+	fm.Update([]tableSpec{encrypted, plain}, []tableSpec{zstd, plain}, root, root, nil)
+	b, err = ioutil.ReadFile(filepath.Join(fm.dir, manifestFileName))
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(string(b), ZstdStorageVersion+":"))
+	_, _, _, tableSpecs = fm.ParseIfExists(nil)
+	assert.Equal([]tableSpec{zstd, plain}, tableSpecs)
+
+	// ...and unknown versions, or encrypted or zstd tables in older ones, are refused.
+	for _, tc := range []struct{ vers, count string }{{"5", "2"}, {StorageVersion, "2@key1"}, {StorageVersion, "3z"}, {EncryptedStorageVersion, "3z@key1"}} {
+		assert.NoError(clobberManifest(fm.dir, strings.Join([]string{tc.vers, constants.NomsVersion, root.String(), encrypted.name.String(), tc.count}, ":")))
+		assert.Panics(func() { fm.ParseIfExists(nil) }, "%s %s", tc.vers, tc.count)
+	}
 }
 
 func TestFileManifestUpdate(t *testing.T) {
@@ -96,8 +132,8 @@ func TestFileManifestUpdate(t *testing.T) {
 
 	// First, test winning the race against another process.
 	newRoot := hash.Of([]byte("new root"))
-	specs := []tableSpec{{computeAddr([]byte("a")), 3}}
-	actual, tableSpecs := fm.Update(specs, hash.Hash{}, newRoot, func() {
+	specs := []tableSpec{{computeAddr([]byte("a")), 3, "", SnappyTables}}
+	actual, tableSpecs := fm.Update(nil, specs, hash.Hash{}, newRoot, func() {
 		// This should fail to get the lock, and therefore _not_ clobber the manifest. So the Update should succeed.
 		newRoot2 := hash.Of([]byte("new root 2"))
 		b, err := tryClobberManifest(fm.dir, strings.Join([]string{StorageVersion, constants.NomsVersion, newRoot2.String()}, ":"))
@@ -108,10 +144,20 @@ func TestFileManifestUpdate(t *testing.T) {
 
 	// Now, test the case where the optimistic lock fails, and someone else updated the root since last we checked.
 	newRoot2 := hash.Of([]byte("new root 2"))
-	actual, tableSpecs = fm.Update(nil, hash.Hash{}, newRoot2, nil)
+	actual, tableSpecs = fm.Update(nil, nil, hash.Hash{}, newRoot2, nil)
 	assert.Equal(newRoot, actual)
 	assert.Equal(specs, tableSpecs)
-	actual, tableSpecs = fm.Update(nil, actual, newRoot2, nil)
+
+	// The root matches, but the tables have changed since last we checked.
+	stale := []tableSpec{{computeAddr([]byte("c")), 1, "", SnappyTables}}
+	actual, tableSpecs = fm.Update(stale, nil, actual, newRoot2, nil)
+	assert.Equal(newRoot, actual)
+	assert.Equal(specs, tableSpecs)
+
+	specs2 := []tableSpec{{computeAddr([]byte("b")), 3, "", SnappyTables}}
+	actual, tableSpecs = fm.Update(tableSpecs, specs2, actual, newRoot2, nil)
+	assert.Equal(newRoot2, actual)
+	assert.Equal(specs2, tableSpecs)
 }
 
 // tryClobberManifest simulates another process trying to access dir/manifestFileName concurrently. To avoid deadlock, it does a non-blocking lock of dir/lockFileName. If it can get the lock, it clobbers the manifest.
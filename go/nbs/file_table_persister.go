@@ -17,10 +17,12 @@ import (
 type fsTablePersister struct {
 	dir        string
 	indexCache *indexCache
+	keys       *Keyring
+	format     TableFormat
 }
 
 func (ftp fsTablePersister) Compact(mt *memTable, haver chunkReader) chunkSource {
-	return ftp.persistTable(mt.write(haver))
+	return ftp.persistTable(mt.write(haver, ftp.keys.active(), ftp.format))
 }
 
 func (ftp fsTablePersister) persistTable(name addr, data []byte, chunkCount uint32) chunkSource {
@@ -36,15 +38,26 @@ func (ftp fsTablePersister) persistTable(name addr, data []byte, chunkCount uint
 	}()
 	err := os.Rename(tempName, filepath.Join(ftp.dir, name.String()))
 	d.PanicIfError(err)
-	return ftp.Open(name, chunkCount)
+	return newMmapTableReader(ftp.dir, name, chunkCount, ftp.indexCache, ftp.keys.active())
 }
 
 func (ftp fsTablePersister) CompactAll(sources chunkSources) chunkSource {
 	rl := make(chan struct{}, 32)
 	defer close(rl)
-	return ftp.persistTable(compactSourcesToBuffer(sources, rl))
+	return ftp.persistTable(compactSourcesToBuffer(sources, ftp.keys.active(), ftp.format, rl))
 }
 
-func (ftp fsTablePersister) Open(name addr, chunkCount uint32) chunkSource {
-	return newMmapTableReader(ftp.dir, name, chunkCount, ftp.indexCache)
+func (ftp fsTablePersister) Open(name addr, chunkCount uint32, keyID string) chunkSource {
+	return newMmapTableReader(ftp.dir, name, chunkCount, ftp.indexCache, ftp.keys.cipher(keyID))
+}
+
+// Remove deletes the named table files from ftp.dir. Processes that already
+// have them open can continue to read them until they close them.
+func (ftp fsTablePersister) Remove(names []addr) {
+	for _, name := range names {
+		err := os.Remove(filepath.Join(ftp.dir, name.String()))
+		if !os.IsNotExist(err) {
+			d.PanicIfError(err)
+		}
+	}
 }
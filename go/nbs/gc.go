@@ -0,0 +1,258 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+)
+
+// ErrGCConflict is returned by GC() if the store was updated, either by this
+// NomsBlockStore or by another process, while garbage collection was running.
+// Nothing has been removed from the store in that case, and GC() can simply
+// be retried.
+var ErrGCConflict = errors.New("Store was modified during garbage collection")
+
+// GCStats describes the store before and after a call to GC().
+type GCStats struct {
+	ChunksBefore, ChunksAfter uint32
+	TablesBefore, TablesAfter int
+}
+
+// tableRemover is implemented by tablePersisters that can delete tables once
+// they are no longer referenced by the manifest.
+type tableRemover interface {
+	Remove(names []addr)
+}
+
+// GCOptions customize GC().
+type GCOptions struct {
+	// KeepRootLog is how long the roots recorded in the root log are kept.
+	// The chunks of roots logged within that long are live, so that they can
+	// still be restored, while older entries are removed from the log, and
+	// their chunks collected unless they're reachable from a newer root. If
+	// 0, only the current root is kept.
+	KeepRootLog time.Duration
+}
+
+// DefaultKeepRootLog is how long GC() keeps the roots in the root log.
+const DefaultKeepRootLog = 7 * 24 * time.Hour
+
+// GC is GCOpts() with the roots logged in the last DefaultKeepRootLog kept.
+func (nbs *NomsBlockStore) GC() (stats GCStats, err error) {
+	return nbs.GCOpts(GCOptions{KeepRootLog: DefaultKeepRootLog})
+}
+
+// GCOpts rewrites the store so that it contains only the chunks reachable from
+// the current root, or from any root in the root log that's recent enough to
+// keep according to |opts|. It first flushes any pending writes, then walks
+// the graph of refs from those roots to find all live chunks and copies them,
+// in insertion order, into a new set of tables. Finally, it swaps the new
+// tables into the manifest using the same optimistic lock as UpdateRoot(),
+// so if the root or the set of tables changed in the meantime GC() fails
+// with ErrGCConflict and the store is left untouched. Otherwise, the entries
+// of the root log that weren't kept are removed from it.
+//
+// Writers that were working from the pre-GC set of tables will fail their
+// next UpdateRoot() and, while rebasing, copy any chunks they still need out
+// of the dropped tables. On local disk, the old table files are deleted
+// (processes that already have them open can still read them). Tables
+// stored in S3 are left in place, since there's no way to know when other
+// processes are done reading them; they can be expired using a bucket
+// lifecycle policy.
+//
+// GC() holds the store's lock for its duration, so other operations on this
+// NomsBlockStore will block until it's done.
+func (nbs *NomsBlockStore) GCOpts(opts GCOptions) (stats GCStats, err error) {
+	nbs.Flush()
+
+	nbs.mu.Lock()
+	defer nbs.mu.Unlock()
+
+	if (nbs.mt != nil && nbs.mt.count() > 0) || len(nbs.tables.novel) > 0 {
+		return stats, ErrGCConflict
+	}
+	stats.ChunksBefore, stats.TablesBefore = nbs.tables.count(), nbs.tables.Size()
+
+	live := hash.HashSet{}
+	if err := nbs.markLive(live, nbs.root, true); err != nil {
+		return stats, err
+	}
+	// Keep the recent roots recorded in the root log, too, so that they can still be restored. Some of their chunks may already have been collected, e.g. by a GC that predates the log, so don't insist that they're complete.
+	cutoff := time.Now().Add(-opts.KeepRootLog)
+	for _, e := range nbs.RootLog() {
+		if !e.Time.Before(cutoff) {
+			nbs.markLive(live, e.From, false)
+			nbs.markLive(live, e.To, false)
+		}
+	}
+
+	sources := nbs.sweep(live)
+	specs := make([]tableSpec, len(sources))
+	for i, src := range sources {
+		specs[i] = tableSpec{src.hash(), src.count(), src.keyID(), src.tableFormat()}
+	}
+
+	actual, tableSpecs := nbs.mm.Update(nbs.upstream, specs, nbs.root, nbs.root, nil)
+	if actual != nbs.root || !specsEqual(specs, tableSpecs) {
+		sources.close()
+		if r, ok := nbs.tables.p.(tableRemover); ok {
+			// Tables that held only live chunks were rewritten under their old names, so don't remove any that are still in use.
+			inUse := map[addr]bool{}
+			for _, spec := range append(tableSpecs, nbs.upstream...) {
+				inUse[spec.name] = true
+			}
+			garbage := []addr{}
+			for _, spec := range specs {
+				if !inUse[spec.name] {
+					garbage = append(garbage, spec.name)
+				}
+			}
+			r.Remove(garbage)
+		}
+		return stats, ErrGCConflict
+	}
+
+	old := nbs.tables
+	nbs.tables = tableSet{upstream: sources, p: old.p, rl: old.rl}
+	nbs.upstream = tableSpecs
+	stats.ChunksAfter, stats.TablesAfter = nbs.tables.count(), nbs.tables.Size()
+
+	// Tables are named for the chunks they hold, along with their format and key, so those that held only live chunks are rewritten under their old names. Unless they're encrypted, they're rewritten byte-for-byte. Encrypted records are sealed with a new random nonce, but their lengths, and so the table's index, which readers may have cached, don't change.
+	kept := map[addr]bool{}
+	for _, spec := range specs {
+		kept[spec.name] = true
+	}
+	garbage := []addr{}
+	for _, src := range old.upstream {
+		if !kept[src.hash()] {
+			garbage = append(garbage, src.hash())
+		}
+	}
+	old.Close()
+	if r, ok := old.p.(tableRemover); ok {
+		r.Remove(garbage)
+	}
+	if rl, ok := nbs.mm.(rootLog); ok {
+		expireRootLog(rl, cutoff)
+	}
+	return stats, nil
+}
+
+// markLive adds to |live| the chunks in nbs.tables reachable from |root|,
+// without revisiting any that are already there. If |strict| is true, it
+// fails if any reachable chunk is missing. It must be called with nbs.mu held.
+func (nbs *NomsBlockStore) markLive(live hash.HashSet, root hash.Hash, strict bool) error {
+	if root.IsEmpty() || live.Has(root) {
+		return nil
+	}
+	live.Insert(root)
+	next := hash.HashSet{root: struct{}{}}
+	for len(next) > 0 {
+		reqs := toGetRecords(next)
+		found := make(chan *chunks.Chunk, len(reqs))
+		wg := &sync.WaitGroup{}
+		nbs.tables.getMany(reqs, found, wg)
+		wg.Wait()
+		close(found)
+
+		batch := next
+		next = hash.HashSet{}
+		for c := range found {
+			batch.Remove(c.Hash())
+			types.DecodeValue(*c, nil).WalkRefs(func(r types.Ref) {
+				if h := r.TargetHash(); !live.Has(h) {
+					live.Insert(h)
+					next.Insert(h)
+				}
+			})
+		}
+		for h := range batch {
+			if strict {
+				return fmt.Errorf("Chunk %s is reachable from root %s, but is missing from the store", h, root)
+			}
+			live.Remove(h)
+		}
+	}
+	return nil
+}
+
+// sweep copies the chunks named in |live| out of nbs.tables, in insertion
+// order, and persists them as new tables of at most nbs.mtSize bytes each.
+// It must be called with nbs.mu held.
+func (nbs *NomsBlockStore) sweep(live hash.HashSet) (sources chunkSources) {
+	ch := make(chan extractRecord, 1)
+	go func() {
+		defer close(ch)
+		nbs.tables.extract(InsertOrder, ch)
+	}()
+
+	mt := newMemTable(nbs.mtSize)
+	for rec := range ch {
+		h := hash.Hash(rec.a)
+		if !live.Has(h) {
+			continue
+		}
+		live.Remove(h) // Chunks may appear in more than one table.
+		if !mt.addChunk(rec.a, rec.data) {
+			sources = append(sources, nbs.tables.p.Compact(mt, nil))
+			mt = newMemTable(nbs.mtSize)
+			d.PanicIfFalse(mt.addChunk(rec.a, rec.data))
+		}
+	}
+	if mt.count() > 0 {
+		sources = append(sources, nbs.tables.p.Compact(mt, nil))
+	}
+	return
+}
+
+// salvage is called by UpdateRoot() when the manifest no longer references
+// some of the tables this store was working from, e.g. because they were
+// garbage collected by another process. It walks the graph of chunks
+// reachable from |root| that aren't yet in an upstream table, and copies any
+// that are only present in |dropped| into the memTable so that they'll be
+// persisted by the next successful UpdateRoot(). It must be called with
+// nbs.mu held for writing, and before |dropped| is closed.
+func (nbs *NomsBlockStore) salvage(root hash.Hash, dropped chunkSources) {
+	upstream := tableSet{upstream: nbs.tables.upstream}
+	novel := tableSet{novel: nbs.tables.novel}
+	salvaged := tableSet{upstream: dropped}
+
+	visited := hash.HashSet{}
+	todo := []hash.Hash{root}
+	for len(todo) > 0 {
+		h := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		a := addr(h)
+		if h.IsEmpty() || visited.Has(h) || upstream.has(a) {
+			continue
+		}
+		visited.Insert(h)
+
+		var data []byte
+		if nbs.mt != nil {
+			data = nbs.mt.get(a)
+		}
+		if data == nil {
+			data = novel.get(a)
+		}
+		if data == nil {
+			if data = salvaged.get(a); data == nil {
+				continue
+			}
+			nbs.addChunkLocked(a, data)
+		}
+		types.DecodeValue(chunks.NewChunkWithHash(h, data), nil).WalkRefs(func(r types.Ref) {
+			todo = append(todo, r.TargetHash())
+		})
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func putValue(store *NomsBlockStore, v types.Value) chunks.Chunk {
+	c := types.EncodeValue(v, nil)
+	store.Put(c)
+	return c
+}
+
+func TestGCRemovesUnreachableChunks(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+
+	leaf := types.String("leaf")
+	garbage := putValue(store, types.String("garbage"))
+	leafChunk := putValue(store, leaf)
+	store.Flush()
+	oldTables := store.upstream
+
+	root := putValue(store, types.NewList(types.NewRef(leaf)))
+	assert.True(store.UpdateRoot(root.Hash(), store.Root()))
+
+	stats, err := store.GC()
+	assert.NoError(err)
+	assert.Equal(uint32(3), stats.ChunksBefore)
+	assert.Equal(uint32(2), stats.ChunksAfter)
+	assert.Equal(1, stats.TablesAfter)
+
+	assert.True(store.Has(root.Hash()))
+	assert.True(store.Has(leafChunk.Hash()))
+	assert.False(store.Has(garbage.Hash()))
+	assert.Equal(root.Hash(), store.Root())
+
+	for _, spec := range oldTables {
+		_, err := os.Stat(filepath.Join(dir, spec.name.String()))
+		assert.True(os.IsNotExist(err))
+	}
+
+	// A fresh store should see the collected tables.
+	reopened := NewLocalStore(dir, testMemTableSize)
+	defer reopened.Close()
+	assert.Equal(root.Hash(), reopened.Root())
+	assert.True(reopened.Has(leafChunk.Hash()))
+	assert.False(reopened.Has(garbage.Hash()))
+}
+
+func TestGCMissingChunk(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+
+	// The leaf is referenced, but never written.
+	root := putValue(store, types.NewList(types.NewRef(types.String("missing"))))
+	assert.True(store.UpdateRoot(root.Hash(), store.Root()))
+
+	_, err = store.GC()
+	assert.Error(err)
+	assert.True(store.Has(root.Hash()))
+}
+
+func TestGCConflictingWriterSalvagesChunks(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	collector := NewLocalStore(dir, testMemTableSize)
+	defer collector.Close()
+	writer := NewLocalStore(dir, testMemTableSize)
+	defer writer.Close()
+
+	// |writer| persists a chunk that isn't yet reachable from the root...
+	leaf := types.String("leaf")
+	leafChunk := putValue(writer, leaf)
+	writer.Flush()
+
+	// ...so |collector|, which picks up the new table while flushing, throws it away.
+	_, err = collector.GC()
+	assert.NoError(err)
+	assert.False(collector.Has(leafChunk.Hash()))
+
+	// |writer| now commits a root that references it. Its first try at the manifest fails because the tables have changed, but the root hasn't, so it rescues the chunk and tries again on top of the new tables, leaving a complete store.
+	root := putValue(writer, types.NewList(types.NewRef(leaf)))
+	assert.True(writer.UpdateRoot(root.Hash(), writer.Root()))
+
+	reopened := NewLocalStore(dir, testMemTableSize)
+	defer reopened.Close()
+	assert.Equal(root.Hash(), reopened.Root())
+	assert.True(reopened.Has(leafChunk.Hash()))
+}
+
+// racingManifest calls |race| before the Update() that follows the first
+// |skip| ones, so that it fails.
+type racingManifest struct {
+	manifest
+	skip int
+	race func()
+}
+
+func (rm *racingManifest) Update(lastSpecs, specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (hash.Hash, []tableSpec) {
+	if rm.skip--; rm.skip == -1 {
+		rm.race()
+	}
+	return rm.manifest.Update(lastSpecs, specs, root, newRoot, writeHook)
+}
+
+func TestGCConflictKeepsRewrittenTables(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+	root := putValue(store, types.String("root"))
+	assert.True(store.UpdateRoot(root.Hash(), store.Root()))
+	assert.Len(store.upstream, 1)
+
+	// The store's only table is all live, so GC rewrites it under the same name, but someone else commits before GC can swap it in.
+	other := NewLocalStore(dir, testMemTableSize)
+	defer other.Close()
+	var next chunks.Chunk
+	// GC() flushes the store, and so updates the manifest, before it starts.
+	store.mm = &racingManifest{store.mm, 1, func() {
+		next = putValue(other, types.NewList(types.NewRef(types.String("root"))))
+		assert.True(other.UpdateRoot(next.Hash(), root.Hash()))
+	}}
+
+	_, err = store.GC()
+	assert.Equal(ErrGCConflict, err)
+
+	reopened := NewLocalStore(dir, testMemTableSize)
+	defer reopened.Close()
+	assert.Equal(next.Hash(), reopened.Root())
+	assert.Equal(root.Data(), reopened.Get(root.Hash()).Data())
+	assert.Equal(next.Data(), reopened.Get(next.Hash()).Data())
+}
+
+func TestGCKeepsRootLogRoots(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+
+	old := putValue(store, types.String("old root"))
+	assert.True(store.UpdateRoot(old.Hash(), store.Root()))
+	store.LogRoot(chunks.RootLogEntry{Time: time.Now(), To: old.Hash()})
+
+	root := putValue(store, types.String("new root"))
+	assert.True(store.UpdateRoot(root.Hash(), old.Hash()))
+	store.LogRoot(chunks.RootLogEntry{Time: time.Now(), From: old.Hash(), To: root.Hash()})
+	garbage := putValue(store, types.String("garbage"))
+
+	_, err = store.GC()
+	assert.NoError(err)
+	assert.True(store.Has(root.Hash()))
+	assert.True(store.Has(old.Hash()))
+	assert.False(store.Has(garbage.Hash()))
+}
+
+func TestGCExpiresRootLog(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+
+	ancient := putValue(store, types.String("ancient root"))
+	assert.True(store.UpdateRoot(ancient.Hash(), store.Root()))
+	store.LogRoot(chunks.RootLogEntry{Time: time.Now().Add(-2 * time.Hour), To: ancient.Hash()})
+	old := putValue(store, types.String("old root"))
+	assert.True(store.UpdateRoot(old.Hash(), ancient.Hash()))
+	store.LogRoot(chunks.RootLogEntry{Time: time.Now().Add(-time.Hour), From: ancient.Hash(), To: old.Hash()})
+	root := putValue(store, types.String("new root"))
+	assert.True(store.UpdateRoot(root.Hash(), old.Hash()))
+	store.LogRoot(chunks.RootLogEntry{Time: time.Now(), From: old.Hash(), To: root.Hash()})
+
+	// Only the roots of the entry logged in the last half hour are kept, and the older entries are dropped from the log.
+	_, err = store.GCOpts(GCOptions{KeepRootLog: 30 * time.Minute})
+	assert.NoError(err)
+	assert.False(store.Has(ancient.Hash()))
+	assert.True(store.Has(old.Hash()))
+	assert.True(store.Has(root.Hash()))
+	assert.Len(store.RootLog(), 1)
+
+	// With no log kept, only the current root is.
+	_, err = store.GCOpts(GCOptions{})
+	assert.NoError(err)
+	assert.False(store.Has(old.Hash()))
+	assert.True(store.Has(root.Hash()))
+	assert.Empty(store.RootLog())
+}
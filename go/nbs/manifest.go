@@ -6,6 +6,7 @@ package nbs
 
 import (
 	"strconv"
+	"strings"
 
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/hash"
@@ -29,43 +30,149 @@ type manifest interface {
 	ParseIfExists(readHook func()) (exists bool, vers string, root hash.Hash, tableSpecs []tableSpec)
 
 	// Update optimistically tries to write a new manifest containing
-	// |newRoot| and the tables referenced by |specs|. If |root| matches the root
-	// hash in the currently persisted manifest (logically, the root that
-	// would be returned by ParseIfExists), then Update succeeds and
-	// subsequent calls to both Update and ParseIfExists will reflect a
-	// manifest containing |newRoot| and |tables|. If not, Update fails.
+	// |newRoot| and the tables referenced by |specs|. If |root| and
+	// |lastSpecs| match the root hash and tables in the currently persisted
+	// manifest (logically, the values that would be returned by
+	// ParseIfExists), then Update succeeds and subsequent calls to both
+	// Update and ParseIfExists will reflect a manifest containing |newRoot|
+	// and |specs|. If not, Update fails.
+	// Comparing the tables as well as the root means that a writer working
+	// from a stale view of the store can't resurrect tables that were
+	// removed from the manifest, e.g. by garbage collection.
 	// Regardless, |actual| and |tableSpecs| will reflect the current state of
 	// the world upon return. Callers should check that |actual| == |newRoot|
-	// and, if not, merge any desired new table information with the contents
-	// of |tableSpecs| before trying again.
+	// and |tableSpecs| matches |specs| and, if not, merge any desired new
+	// table information with the contents of |tableSpecs| before trying
+	// again.
 	// Concrete implementations are responsible for ensuring that concurrent
 	// Update calls (and ParseIfExists calls) are correct.
 	// If writeHook is non-nil, it will be invoked while the implementation is
 	// guaranteeing exclusive access to the manifest. This allows for testing
 	// of race conditions.
-	Update(specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (actual hash.Hash, tableSpecs []tableSpec)
+	Update(lastSpecs, specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (actual hash.Hash, tableSpecs []tableSpec)
 }
 
 type tableSpec struct {
 	name       addr
 	chunkCount uint32
+	keyID      string // The ID of the key the table is encrypted with, or "" if it isn't.
+	format     TableFormat
 }
 
-func parseSpecs(tableInfo []string) []tableSpec {
+// specsEqual returns true if |a| and |b| name the same tables, with the same
+// chunk counts and keys, in the same order.
+func specsEqual(a, b []tableSpec) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// removedSpecs returns true if any table named in |before| is missing from
+// |after|.
+func removedSpecs(before, after []tableSpec) bool {
+	present := map[addr]bool{}
+	for _, t := range after {
+		present[t.name] = true
+	}
+	for _, t := range before {
+		if !present[t.name] {
+			return true
+		}
+	}
+	return false
+}
+
+// zstdSpecSuffix follows the chunk count of a zstd table in a manifest.
+const zstdSpecSuffix = "z"
+
+// storageVersion returns the storage version of a manifest naming |specs|:
+// the oldest one that can describe all of them.
+func storageVersion(specs []tableSpec) string {
+	vers := StorageVersion
+	for _, t := range specs {
+		if t.format == ZstdTables {
+			return ZstdStorageVersion
+		} else if t.keyID != "" {
+			vers = EncryptedStorageVersion
+		}
+	}
+	return vers
+}
+
+// checkStorageVersion panics if |vers| is a storage version that this version
+// of noms can't read.
+func checkStorageVersion(vers string) {
+	if vers != StorageVersion && vers != EncryptedStorageVersion && vers != ZstdStorageVersion {
+		d.Panic("Unsupported NBS storage version %s: this version of noms supports versions %s, %s and %s", vers, StorageVersion, EncryptedStorageVersion, ZstdStorageVersion)
+	}
+}
+
+// parseSpecs parses pairs of table names and chunk counts from a manifest of
+// storage version |vers|. From EncryptedStorageVersion on, the count of an
+// encrypted table is followed by '@' and the ID of its key. In
+// ZstdStorageVersion, the count of a zstd table is followed by
+// zstdSpecSuffix, before any key ID.
+func parseSpecs(vers string, tableInfo []string) []tableSpec {
+	checkStorageVersion(vers)
 	specs := make([]tableSpec, len(tableInfo)/2)
 	for i := range specs {
 		specs[i].name = ParseAddr([]byte(tableInfo[2*i]))
-		c, err := strconv.ParseUint(tableInfo[2*i+1], 10, 32)
+		count := tableInfo[2*i+1]
+		if at := strings.IndexByte(count, '@'); at >= 0 {
+			if vers == StorageVersion {
+				d.Panic("Malformed manifest: table %s is encrypted, but the storage version is %s", tableInfo[2*i], vers)
+			}
+			count, specs[i].keyID = count[:at], count[at+1:]
+		}
+		if strings.HasSuffix(count, zstdSpecSuffix) {
+			if vers != ZstdStorageVersion {
+				d.Panic("Malformed manifest: table %s is compressed with zstd, but the storage version is %s", tableInfo[2*i], vers)
+			}
+			count, specs[i].format = strings.TrimSuffix(count, zstdSpecSuffix), ZstdTables
+		}
+		c, err := strconv.ParseUint(count, 10, 32)
 		d.PanicIfError(err)
 		specs[i].chunkCount = uint32(c)
 	}
 	return specs
 }
 
+// checkEncrypted returns ErrUnencryptedWrite if |specs| adds unencrypted
+// tables to |lastSpecs|, and |lastSpecs| names encrypted ones.
+func checkEncrypted(lastSpecs, specs []tableSpec) error {
+	encrypted := false
+	present := map[addr]bool{}
+	for _, t := range lastSpecs {
+		encrypted = encrypted || t.keyID != ""
+		present[t.name] = true
+	}
+	if !encrypted {
+		return nil
+	}
+	for _, t := range specs {
+		if t.keyID == "" && !present[t.name] {
+			return ErrUnencryptedWrite
+		}
+	}
+	return nil
+}
+
 func formatSpecs(specs []tableSpec, tableInfo []string) {
 	d.Chk.True(len(tableInfo) == 2*len(specs))
 	for i, t := range specs {
 		tableInfo[2*i] = t.name.String()
 		tableInfo[2*i+1] = strconv.FormatUint(uint64(t.chunkCount), 10)
+		if t.format == ZstdTables {
+			tableInfo[2*i+1] += zstdSpecSuffix
+		}
+		if t.keyID != "" {
+			tableInfo[2*i+1] += "@" + t.keyID
+		}
 	}
 }
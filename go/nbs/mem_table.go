@@ -104,10 +104,18 @@ func (mt *memTable) extract(order EnumerationOrder, chunks chan<- extractRecord)
 	}
 }
 
-func (mt *memTable) write(haver chunkReader) (name addr, data []byte, count uint32) {
+// write builds a table of the chunks in |mt| that |haver| doesn't have, encrypting them with |c| if it's not nil.
+func (mt *memTable) write(haver chunkReader, c *chunkCipher, format TableFormat) (name addr, data []byte, count uint32) {
 	maxSize := maxTableSize(uint64(len(mt.order)), mt.totalData)
+	if c != nil {
+		maxSize += uint64(len(mt.order)) * encryptionOverhead
+	}
+	if format == ZstdTables {
+		maxSize += zstdTableOverhead
+	}
 	buff := make([]byte, maxSize)
 	tw := newTableWriter(buff, mt.snapper)
+	tw.cipher, tw.format = c, format
 
 	if haver != nil {
 		sort.Sort(hasRecordByPrefix(mt.order)) // hasMany() requires addresses to be sorted.
@@ -37,7 +37,7 @@ func init() {
 	}
 }
 
-func newMmapTableReader(dir string, h addr, chunkCount uint32, indexCache *indexCache) chunkSource {
+func newMmapTableReader(dir string, h addr, chunkCount uint32, indexCache *indexCache, c *chunkCipher) chunkSource {
 	success := false
 	f, err := os.Open(filepath.Join(dir, h.String()))
 	d.PanicIfError(err)
@@ -60,7 +60,7 @@ func newMmapTableReader(dir string, h addr, chunkCount uint32, indexCache *index
 	var buff []byte
 	if !found {
 		// index. Mmap won't take an offset that's not page-aligned, so find the nearest page boundary preceding the index.
-		indexOffset := fi.Size() - int64(footerSize) - int64(indexSize(chunkCount))
+		indexOffset := fi.Size() - int64(maxFooterSize) - int64(indexSize(chunkCount))
 		aligned := indexOffset / pageSize * pageSize // Thanks, integer arithmetic!
 		d.PanicIfTrue(fi.Size()-aligned > maxInt)
 		var err error
@@ -71,6 +71,7 @@ func newMmapTableReader(dir string, h addr, chunkCount uint32, indexCache *index
 	success = true
 
 	source := &mmapTableReader{newTableReader(index, f, fileBlockSize), f, buff, h}
+	source.cipher = c
 
 	d.PanicIfFalse(chunkCount == source.count())
 	return source
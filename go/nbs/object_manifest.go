@@ -0,0 +1,111 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"bytes"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/constants"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+)
+
+// objectManifest is a manifest kept in a ManifestStore, in the same format
+// as a fileManifest. The manifest and root log of the store with namespace
+// "" are the objects "manifest" and "reflog", just as in the directory of a
+// local store, and those of any other namespace |ns| are "|ns|-manifest" and
+// "|ns|-reflog".
+type objectManifest struct {
+	store       ManifestStore
+	manifestKey string
+	rootLogKey  string
+}
+
+func newObjectManifest(store ManifestStore, ns string) objectManifest {
+	prefix := ""
+	if ns != "" {
+		prefix = ns + "-"
+	}
+	return objectManifest{store, prefix + manifestFileName, prefix + rootLogFileName}
+}
+
+// get returns the manifest as it is in om.store, or nil if there isn't one.
+func (om objectManifest) get() []byte {
+	data, err := om.store.Get(om.manifestKey)
+	if err == ErrObjectNotFound {
+		return nil
+	}
+	d.PanicIfError(err)
+	return data
+}
+
+func (om objectManifest) ParseIfExists(readHook func()) (exists bool, vers string, root hash.Hash, tableSpecs []tableSpec) {
+	if readHook != nil {
+		readHook()
+	}
+	if data := om.get(); data != nil {
+		exists = true
+		vers, root, tableSpecs = parseManifest(bytes.NewReader(data))
+	}
+	return
+}
+
+// Update reads the manifest and, if it contains |root| and |lastSpecs|,
+// swaps in one containing |newRoot| and |specs|. If the manifest is changed
+// by someone else in between, it tries again with what they wrote.
+func (om objectManifest) Update(lastSpecs, specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (actual hash.Hash, tableSpecs []tableSpec) {
+	buff := &bytes.Buffer{}
+	writeManifest(buff, newRoot, specs)
+	for {
+		last := om.get()
+		if last != nil {
+			var vers string
+			vers, actual, tableSpecs = parseManifest(bytes.NewReader(last))
+			d.PanicIfFalse(constants.NomsVersion == vers)
+		} else {
+			d.Chk.True(root == hash.Hash{})
+			actual, tableSpecs = hash.Hash{}, nil
+		}
+		if root != actual || !specsEqual(lastSpecs, tableSpecs) {
+			return actual, tableSpecs
+		}
+
+		if writeHook != nil {
+			writeHook()
+		}
+		ok, err := om.store.CompareAndSwap(om.manifestKey, last, buff.Bytes())
+		d.PanicIfError(err)
+		if ok {
+			return newRoot, specs
+		}
+	}
+}
+
+func (om objectManifest) updateRootLog(f func(log []chunks.RootLogEntry) []chunks.RootLogEntry) {
+	for {
+		last, err := om.store.Get(om.rootLogKey)
+		if err == ErrObjectNotFound {
+			last, err = nil, nil
+		}
+		d.PanicIfError(err)
+		log := f(parseRootLog(string(last)))
+		ok, err := om.store.CompareAndSwap(om.rootLogKey, last, []byte(formatRootLog(log)))
+		d.PanicIfError(err)
+		if ok {
+			return
+		}
+		// Someone else changed the log since we read it. Try again.
+	}
+}
+
+func (om objectManifest) readRootLog() []chunks.RootLogEntry {
+	data, err := om.store.Get(om.rootLogKey)
+	if err == ErrObjectNotFound {
+		return nil
+	}
+	d.PanicIfError(err)
+	return parseRootLog(string(data))
+}
@@ -0,0 +1,179 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrObjectNotFound is returned by ObjectStores and ManifestStores when asked
+// for an object that doesn't exist.
+var ErrObjectNotFound = errors.New("Object not found")
+
+// ObjectStore is a flat namespace of objects, like an S3 bucket, that a
+// NomsBlockStore can keep its tables in. Objects are written whole and never
+// modified. Tables are named for their contents, so stores with different
+// namespaces can share one ObjectStore. For that reason, and so that readers
+// in other processes never find a table gone, NomsBlockStores never delete
+// objects, even those that GC() has dropped from their manifests; like the
+// tables of aws stores, those are left for the owner of the ObjectStore to
+// expire, e.g. with List and Delete. Implementations must be safe for
+// concurrent use.
+type ObjectStore interface {
+	// Put writes |data| as the object |key|, replacing any that's there.
+	Put(key string, data []byte) error
+
+	// GetRange reads len(p) bytes of the object |key| into |p|, starting
+	// |off| bytes into it, or, if |off| is negative, -|off| bytes before its
+	// end. It returns ErrObjectNotFound if there's no such object, and
+	// io.ErrUnexpectedEOF if it's too short.
+	GetRange(key string, p []byte, off int64) error
+
+	// List returns the keys of the objects whose keys start with |prefix|, in
+	// no particular order.
+	List(prefix string) ([]string, error)
+
+	// Delete removes the object |key|. Deleting an object that doesn't exist
+	// isn't an error.
+	Delete(key string) error
+}
+
+// ManifestStore holds the small, mutable objects that record the state of
+// NomsBlockStores, like their manifests. Every change is made with
+// CompareAndSwap, so that concurrent writers can't lose each other's
+// updates.
+type ManifestStore interface {
+	// Get returns the contents of the object |key|, or ErrObjectNotFound if
+	// there's no such object.
+	Get(key string) ([]byte, error)
+
+	// CompareAndSwap replaces the contents of the object |key| with |data|,
+	// but only if they're currently |last|, or, if |last| is nil, if there's
+	// no such object. It returns false, and changes nothing, if not.
+	CompareAndSwap(key string, last, data []byte) (bool, error)
+}
+
+// tempObjectPrefix starts the names of the files that DirObjectStore.Put
+// writes objects to before renaming them into place.
+const tempObjectPrefix = "nbs_object_"
+
+// DirObjectStore is an ObjectStore and ManifestStore that keeps each object
+// in a file in a local directory. Any number of processes can share the
+// directory.
+type DirObjectStore struct {
+	dir string
+}
+
+// NewDirObjectStore returns a DirObjectStore that keeps its objects in
+// |dir|, creating it if need be.
+func NewDirObjectStore(dir string) (*DirObjectStore, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	return &DirObjectStore{dir}, nil
+}
+
+func (ds *DirObjectStore) path(key string) string {
+	return filepath.Join(ds.dir, key)
+}
+
+// Put writes |data| to a temporary file and renames it into place, so that
+// it's never seen half written.
+func (ds *DirObjectStore) Put(key string, data []byte) error {
+	temp, err := ioutil.TempFile(ds.dir, tempObjectPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name()) // If we rename below, this will be a no-op
+	_, err = io.Copy(temp, bytes.NewReader(data))
+	if cerr := temp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), ds.path(key))
+}
+
+func (ds *DirObjectStore) GetRange(key string, p []byte, off int64) error {
+	f, err := os.Open(ds.path(key))
+	if os.IsNotExist(err) {
+		return ErrObjectNotFound
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	if off < 0 {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if off += fi.Size(); off < 0 {
+			return io.ErrUnexpectedEOF
+		}
+	}
+	n, err := f.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	} else if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// List leaves out the lock file and any temporary files that Put hasn't
+// renamed into place yet.
+func (ds *DirObjectStore) List(prefix string) ([]string, error) {
+	infos, err := ioutil.ReadDir(ds.dir)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasPrefix(info.Name(), prefix) && info.Name() != lockFileName && !strings.HasPrefix(info.Name(), tempObjectPrefix) {
+			keys = append(keys, info.Name())
+		}
+	}
+	return keys, nil
+}
+
+func (ds *DirObjectStore) Delete(key string) error {
+	err := os.Remove(ds.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (ds *DirObjectStore) Get(key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(ds.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	return data, err
+}
+
+// CompareAndSwap holds a lock on ds.dir/LOCK, the same lock a fileManifest
+// uses, while it compares and replaces the object.
+func (ds *DirObjectStore) CompareAndSwap(key string, last, data []byte) (bool, error) {
+	defer checkClose(flock(ds.path(lockFileName))) // closing releases the lock
+	current, err := ds.Get(key)
+	if err == ErrObjectNotFound {
+		if last != nil {
+			return false, nil
+		}
+	} else if err != nil {
+		return false, err
+	} else if last == nil || !bytes.Equal(current, last) {
+		return false, nil
+	}
+	return true, ds.Put(key, data)
+}
@@ -0,0 +1,256 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/s3test"
+	"github.com/attic-labs/testify/assert"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func makeDirObjectStore(t *testing.T) *DirObjectStore {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	ds, err := NewDirObjectStore(dir)
+	assert.NoError(t, err)
+	return ds
+}
+
+func testObjectStore(assert *assert.Assertions, os ObjectStore) {
+	assert.NoError(os.Put("a1", []byte("hello")))
+	assert.NoError(os.Put("a2", []byte("goodbye")))
+	assert.NoError(os.Put("b1", []byte("badbye")))
+
+	p := make([]byte, 3)
+	assert.NoError(os.GetRange("a1", p, 1))
+	assert.Equal("ell", string(p))
+	assert.NoError(os.GetRange("a2", p, -3))
+	assert.Equal("bye", string(p))
+	assert.Equal(io.ErrUnexpectedEOF, os.GetRange("a1", make([]byte, 10), 0))
+	assert.Equal(ErrObjectNotFound, os.GetRange("c1", p, 0))
+
+	keys, err := os.List("a")
+	assert.NoError(err)
+	sort.Strings(keys)
+	assert.Equal([]string{"a1", "a2"}, keys)
+
+	assert.NoError(os.Delete("a1"))
+	assert.NoError(os.Delete("a1"))
+	keys, err = os.List("")
+	assert.NoError(err)
+	sort.Strings(keys)
+	assert.Equal([]string{"a2", "b1"}, keys)
+}
+
+func testManifestStore(assert *assert.Assertions, ds ManifestStore) {
+	_, err := ds.Get("m")
+	assert.Equal(ErrObjectNotFound, err)
+	ok, err := ds.CompareAndSwap("m", []byte("x"), []byte("a"))
+	assert.NoError(err)
+	assert.False(ok)
+	ok, err = ds.CompareAndSwap("m", nil, []byte("a"))
+	assert.NoError(err)
+	assert.True(ok)
+
+	ok, err = ds.CompareAndSwap("m", nil, []byte("b"))
+	assert.NoError(err)
+	assert.False(ok)
+	ok, err = ds.CompareAndSwap("m", []byte("a"), []byte("b"))
+	assert.NoError(err)
+	assert.True(ok)
+	data, err := ds.Get("m")
+	assert.NoError(err)
+	assert.Equal("b", string(data))
+}
+
+func TestDirObjectStore(t *testing.T) {
+	assert := assert.New(t)
+	ds := makeDirObjectStore(t)
+	defer os.RemoveAll(ds.dir)
+	testObjectStore(assert, ds)
+	testManifestStore(assert, ds)
+}
+
+func makeS3ObjectStore(srv *s3test.Server, prefix string) *S3ObjectStore {
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithEndpoint(srv.URL).
+		WithRegion("us-east-1").
+		WithS3ForcePathStyle(true).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", ""))))
+	return NewS3ObjectStore(sess, "bucket", prefix)
+}
+
+func TestS3ObjectStore(t *testing.T) {
+	assert := assert.New(t)
+	srv := s3test.NewServer()
+	defer srv.Close()
+	srv.MaxKeys = 1 // so that List has to page through the keys
+
+	testObjectStore(assert, makeS3ObjectStore(srv, ""))
+	testManifestStore(assert, makeS3ObjectStore(srv, "db/"))
+	assert.Equal([]string{"a2", "b1", "db/m"}, srv.Objects("bucket"))
+
+	// Stores with different prefixes don't see each other's objects.
+	keys, err := makeS3ObjectStore(srv, "db/").List("")
+	assert.NoError(err)
+	assert.Equal([]string{"m"}, keys)
+}
+
+func TestS3ObjectStoreConcurrentSwap(t *testing.T) {
+	assert := assert.New(t)
+	srv := s3test.NewServer()
+	defer srv.Close()
+	ss := makeS3ObjectStore(srv, "")
+
+	// Someone else changes the object after CompareAndSwap has read it, but
+	// before it writes it, so its conditional write fails.
+	var change func()
+	raced := int32(0)
+	srv.OnPut = func(key string) {
+		if change != nil && atomic.CompareAndSwapInt32(&raced, 0, 1) {
+			change()
+		}
+	}
+	swap := func(last, data string, concurrently func()) bool {
+		change, raced = concurrently, 0
+		var lastData []byte
+		if last != "" {
+			lastData = []byte(last)
+		}
+		ok, err := ss.CompareAndSwap("m", lastData, []byte(data))
+		assert.NoError(err)
+		return ok
+	}
+
+	assert.False(swap("", "a", func() { assert.NoError(ss.Put("m", []byte("b"))) }))
+	assert.True(swap("b", "c", nil))
+	assert.False(swap("c", "d", func() { assert.NoError(ss.Put("m", []byte("e"))) }))
+	assert.False(swap("e", "f", func() { assert.NoError(ss.Delete("m")) }))
+	_, err := ss.Get("m")
+	assert.Equal(ErrObjectNotFound, err)
+}
+
+func TestObjectManifestUpdate(t *testing.T) {
+	assert := assert.New(t)
+	ds := makeDirObjectStore(t)
+	defer os.RemoveAll(ds.dir)
+	om := newObjectManifest(ds, "db")
+
+	exists, _, _, _ := om.ParseIfExists(nil)
+	assert.False(exists)
+
+	newRoot := hash.Of([]byte("new root"))
+	specs := []tableSpec{{computeAddr([]byte("a")), 3, "", SnappyTables}}
+	actual, tableSpecs := om.Update(nil, specs, hash.Hash{}, newRoot, nil)
+	assert.Equal(newRoot, actual)
+	assert.Equal(specs, tableSpecs)
+
+	// Another store that shares the ManifestStore is separate.
+	exists, _, _, _ = newObjectManifest(ds, "other").ParseIfExists(nil)
+	assert.False(exists)
+
+	// Someone else updates the manifest between our reading and swapping it.
+	newRoot2, newRoot3 := hash.Of([]byte("new root 2")), hash.Of([]byte("new root 3"))
+	specs2 := []tableSpec{{computeAddr([]byte("b")), 3, "", SnappyTables}}
+	actual, tableSpecs = om.Update(specs, nil, newRoot, newRoot3, func() {
+		if actual, _ := om.Update(specs, specs2, newRoot, newRoot2, nil); actual != newRoot2 {
+			assert.Fail("Concurrent update failed")
+		}
+	})
+	assert.Equal(newRoot2, actual)
+	assert.Equal(specs2, tableSpecs)
+
+	exists, _, root, tableSpecs := om.ParseIfExists(nil)
+	assert.True(exists)
+	assert.Equal(newRoot2, root)
+	assert.Equal(specs2, tableSpecs)
+}
+
+func TestBlobStore(t *testing.T) {
+	assert := assert.New(t)
+	ds := makeDirObjectStore(t)
+	defer os.RemoveAll(ds.dir)
+
+	store := NewBlobStore(ds, ds, "", testMemTableSize)
+	c := chunks.NewChunk([]byte("abc"))
+	store.Put(c)
+	assert.True(store.UpdateRoot(c.Hash(), store.Root()))
+	store.LogRoot(chunks.RootLogEntry{To: c.Hash(), Reason: "test"})
+	assert.NoError(store.Close())
+
+	// The directory of a blob store with no namespace is laid out just like
+	// that of a local store.
+	for _, s := range []*NomsBlockStore{NewBlobStore(ds, ds, "", testMemTableSize), NewLocalStore(ds.dir, testMemTableSize)} {
+		assert.Equal(c.Hash(), s.Root())
+		assert.Equal(c.Data(), s.Get(c.Hash()).Data())
+		if log := s.RootLog(); assert.Len(log, 1) {
+			assert.Equal("test", log[0].Reason)
+		}
+		assert.NoError(s.Close())
+	}
+}
+
+func TestS3BlobStore(t *testing.T) {
+	assert := assert.New(t)
+	srv := s3test.NewServer()
+	defer srv.Close()
+	ss := makeS3ObjectStore(srv, "db/")
+
+	store := NewBlobStore(ss, ss, "", testMemTableSize)
+	c := putValue(store, types.String("abc"))
+	assert.True(store.UpdateRoot(c.Hash(), store.Root()))
+	assert.NoError(store.Close())
+
+	store = NewBlobStore(makeS3ObjectStore(srv, "db/"), ss, "", testMemTableSize)
+	defer store.Close()
+	assert.Equal(c.Hash(), store.Root())
+	assert.Equal(c.Data(), store.Get(c.Hash()).Data())
+	keys, err := ss.List(manifestFileName)
+	assert.NoError(err)
+	assert.Equal([]string{manifestFileName}, keys)
+}
+
+func TestBlobStoreGCKeepsSharedTables(t *testing.T) {
+	assert := assert.New(t)
+	ds := makeDirObjectStore(t)
+	defer os.RemoveAll(ds.dir)
+
+	// Both namespaces write the same chunk, so they end up with the same table.
+	factory := NewBlobStoreFactory(ds, ds, 0)
+	var c chunks.Chunk
+	stores := []*NomsBlockStore{}
+	for _, ns := range []string{"ns1", "ns2"} {
+		store := factory.CreateStore(ns).(*NomsBlockStore)
+		defer store.Close()
+		c = putValue(store, types.String("shared"))
+		assert.True(store.UpdateRoot(c.Hash(), store.Root()))
+		stores = append(stores, store)
+	}
+	assert.Equal(stores[0].upstream, stores[1].upstream)
+
+	// Once ns1 no longer refers to it, GC drops the table from its manifest...
+	other := putValue(stores[0], types.String("other"))
+	assert.True(stores[0].UpdateRoot(other.Hash(), c.Hash()))
+	_, err := stores[0].GC()
+	assert.NoError(err)
+	assert.False(stores[0].Has(c.Hash()))
+
+	// ...but ns2 can still read it.
+	reopened := factory.CreateStore("ns2")
+	defer reopened.Close()
+	assert.Equal(c.Data(), reopened.Get(c.Hash()).Data())
+}
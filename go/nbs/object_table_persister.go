@@ -0,0 +1,120 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"time"
+
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/util/verbose"
+)
+
+// objectBlockSize is the block size of the tableReaders of tables in an
+// ObjectStore. Like S3, ObjectStores are assumed to be remote, so reads are
+// coalesced as aggressively.
+const objectBlockSize = s3BlockSize
+
+// objectTablePersister keeps tables in an ObjectStore, each in an object named
+// for the table. It isn't a tableRemover: see ObjectStore.
+type objectTablePersister struct {
+	store      ObjectStore
+	indexCache *indexCache
+	keys       *Keyring
+	format     TableFormat
+	readRl     chan struct{}
+}
+
+func newObjectTableSet(store ObjectStore, indexCache *indexCache, format TableFormat, readRl chan struct{}) tableSet {
+	return tableSet{
+		p:  objectTablePersister{store, indexCache, nil, format, readRl},
+		rl: make(chan struct{}, concurrentCompactions),
+	}
+}
+
+func (otp objectTablePersister) Open(name addr, chunkCount uint32, keyID string) chunkSource {
+	return newObjectTableReader(otp.store, name, chunkCount, otp.indexCache, otp.keys.cipher(keyID), otp.readRl)
+}
+
+func (otp objectTablePersister) Compact(mt *memTable, haver chunkReader) chunkSource {
+	return otp.persistTable(mt.write(haver, otp.keys.active(), otp.format))
+}
+
+func (otp objectTablePersister) CompactAll(sources chunkSources) chunkSource {
+	return otp.persistTable(compactSourcesToBuffer(sources, otp.keys.active(), otp.format, otp.readRl))
+}
+
+func (otp objectTablePersister) persistTable(name addr, data []byte, chunkCount uint32) chunkSource {
+	if chunkCount == 0 {
+		return emptyChunkSource{}
+	}
+	t1 := time.Now()
+	d.PanicIfError(otp.store.Put(name.String(), data))
+	verbose.Log("Compacted table of %d Kb in %s", len(data)/1024, time.Since(t1))
+
+	index := parseTableIndex(data)
+	if otp.indexCache != nil {
+		otp.indexCache.put(name, index)
+	}
+	otr := &objectTableReader{store: otp.store, h: name, readRl: otp.readRl}
+	otr.tableReader = newTableReader(index, otr, objectBlockSize)
+	otr.cipher = otp.keys.active()
+	return otr
+}
+
+type objectTableReader struct {
+	tableReader
+	store  ObjectStore
+	h      addr
+	readRl chan struct{}
+}
+
+func newObjectTableReader(store ObjectStore, h addr, chunkCount uint32, indexCache *indexCache, c *chunkCipher, readRl chan struct{}) chunkSource {
+	source := &objectTableReader{store: store, h: h, readRl: readRl}
+
+	var index tableIndex
+	found := false
+	if indexCache != nil {
+		index, found = indexCache.get(h)
+	}
+	if !found {
+		size := indexSize(chunkCount) + maxFooterSize
+		buff := make([]byte, size)
+		d.PanicIfError(source.getRange(buff, -int64(size)))
+		index = parseTableIndex(buff)
+		if indexCache != nil {
+			indexCache.put(h, index)
+		}
+	}
+
+	source.tableReader = newTableReader(index, source, objectBlockSize)
+	source.cipher = c
+	d.PanicIfFalse(chunkCount == source.count())
+	return source
+}
+
+func (otr *objectTableReader) close() error {
+	return nil
+}
+
+func (otr *objectTableReader) hash() addr {
+	return otr.h
+}
+
+func (otr *objectTableReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if err = otr.getRange(p, off); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (otr *objectTableReader) getRange(p []byte, off int64) error {
+	if otr.readRl != nil {
+		otr.readRl <- struct{}{}
+		defer func() {
+			<-otr.readRl
+		}()
+	}
+	return otr.store.GetRange(otr.h.String(), p, off)
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/hash"
+)
+
+// rootLog is implemented by manifests that can keep a bounded log of root
+// transitions alongside the manifest itself. The log isn't updated atomically
+// with the manifest, so a crash between the two can lose an entry; it's meant
+// for humans recovering from mistakes, not for correctness.
+type rootLog interface {
+	// updateRootLog replaces the entries in the log, oldest first, with those
+	// returned by |f|. |f| is called again with the new entries if the log is
+	// changed concurrently.
+	updateRootLog(f func(log []chunks.RootLogEntry) []chunks.RootLogEntry)
+
+	// readRootLog returns the entries in the log, oldest first.
+	readRootLog() []chunks.RootLogEntry
+}
+
+// LogRoot records a root transition in the log kept alongside the manifest,
+// if the manifest supports one.
+func (nbs *NomsBlockStore) LogRoot(e chunks.RootLogEntry) {
+	if rl, ok := nbs.mm.(rootLog); ok {
+		appendRootLog(rl, e)
+	}
+}
+
+// RootLog returns the root transitions recorded by LogRoot(), most recent
+// first.
+func (nbs *NomsBlockStore) RootLog() []chunks.RootLogEntry {
+	rl, ok := nbs.mm.(rootLog)
+	if !ok {
+		return nil
+	}
+	log := rl.readRootLog()
+	for i, j := 0, len(log)-1; i < j; i, j = i+1, j-1 {
+		log[i], log[j] = log[j], log[i]
+	}
+	return log
+}
+
+// The log is stored as text, one entry per line:
+//
+// |-- String --|-------- String --------|-------- String --------|- String -|
+// | unix nanos : Base32-encoded from root: Base32-encoded to root  : reason   |
+func formatRootLog(log []chunks.RootLogEntry) string {
+	lines := make([]string, len(log))
+	for i, e := range log {
+		reason := strings.Replace(e.Reason, "\n", " ", -1)
+		lines[i] = strings.Join([]string{strconv.FormatInt(e.Time.UnixNano(), 10), e.From.String(), e.To.String(), reason}, ":")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func parseRootLog(s string) (log []chunks.RootLogEntry) {
+	if s == "" {
+		return
+	}
+	for _, line := range strings.Split(s, "\n") {
+		fields := strings.SplitN(line, ":", 4)
+		if len(fields) != 4 {
+			d.Panic("Malformed root log entry: %s", line)
+		}
+		nanos, err := strconv.ParseInt(fields[0], 10, 64)
+		d.PanicIfError(err)
+		log = append(log, chunks.RootLogEntry{
+			Time:   time.Unix(0, nanos),
+			From:   hash.Parse(fields[1]),
+			To:     hash.Parse(fields[2]),
+			Reason: fields[3],
+		})
+	}
+	return
+}
+
+// appendRootLog adds |e| to |rl|, dropping the oldest entries so that no more
+// than chunks.RootLogSize remain.
+func appendRootLog(rl rootLog, e chunks.RootLogEntry) {
+	rl.updateRootLog(func(log []chunks.RootLogEntry) []chunks.RootLogEntry {
+		log = append(log, e)
+		if len(log) > chunks.RootLogSize {
+			log = log[len(log)-chunks.RootLogSize:]
+		}
+		return log
+	})
+}
+
+// expireRootLog drops the entries of |rl| that were logged before |cutoff|.
+func expireRootLog(rl rootLog, cutoff time.Time) {
+	rl.updateRootLog(func(log []chunks.RootLogEntry) []chunks.RootLogEntry {
+		kept := []chunks.RootLogEntry{}
+		for _, e := range log {
+			if !e.Time.Before(cutoff) {
+				kept = append(kept, e)
+			}
+		}
+		return kept
+	})
+}
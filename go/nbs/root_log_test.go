@@ -0,0 +1,91 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/hash"
+	"github.com/attic-labs/testify/assert"
+)
+
+func testRootLog(t *testing.T, rl rootLog) {
+	assert := assert.New(t)
+	assert.Empty(rl.readRootLog())
+
+	entry := func(i int) chunks.RootLogEntry {
+		return chunks.RootLogEntry{
+			Time:   time.Unix(0, int64(i)),
+			From:   hash.Of([]byte(fmt.Sprintf("root %d", i))),
+			To:     hash.Of([]byte(fmt.Sprintf("root %d", i+1))),
+			Reason: fmt.Sprintf("commit ds%d\nwith a newline", i),
+		}
+	}
+
+	appendRootLog(rl, entry(0))
+	appendRootLog(rl, entry(1))
+	log := rl.readRootLog()
+	if assert.Len(log, 2) {
+		assert.Equal(entry(0).To, log[0].To)
+		assert.Equal(entry(1).From, log[1].From)
+		assert.Equal("commit ds1 with a newline", log[1].Reason)
+		assert.True(entry(1).Time.Equal(log[1].Time))
+	}
+
+	for i := 2; i < chunks.RootLogSize+10; i++ {
+		appendRootLog(rl, entry(i))
+	}
+	log = rl.readRootLog()
+	assert.Len(log, chunks.RootLogSize)
+	assert.Equal(entry(10).From, log[0].From)
+
+	expireRootLog(rl, entry(20).Time)
+	log = rl.readRootLog()
+	assert.Len(log, chunks.RootLogSize-10)
+	assert.Equal(entry(20).From, log[0].From)
+	expireRootLog(rl, time.Now())
+	assert.Empty(rl.readRootLog())
+	appendRootLog(rl, entry(0))
+	assert.Len(rl.readRootLog(), 1)
+}
+
+func TestFileManifestRootLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	testRootLog(t, fileManifest{dir})
+}
+
+func TestDynamoManifestRootLog(t *testing.T) {
+	mm, _ := makeDynamoManifestFake(t)
+	testRootLog(t, mm.(rootLog))
+}
+
+func TestBlockStoreRootLog(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+	first, second := hash.Of([]byte("first")), hash.Of([]byte("second"))
+	store.LogRoot(chunks.RootLogEntry{Time: time.Now(), To: first, Reason: "one"})
+	store.LogRoot(chunks.RootLogEntry{Time: time.Now(), From: first, To: second, Reason: "two"})
+
+	// Most recent first.
+	log := store.RootLog()
+	if assert.Len(log, 2) {
+		assert.Equal("two", log[0].Reason)
+		assert.Equal(second, log[0].To)
+		assert.Equal(first, log[1].To)
+		assert.True(log[1].From.IsEmpty())
+	}
+}
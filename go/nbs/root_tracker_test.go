@@ -74,7 +74,7 @@ func TestChunkStoreManifestAppearsAfterConstruction(t *testing.T) {
 	chunks := [][]byte{[]byte("hello2"), []byte("goodbye2"), []byte("badbye2")}
 	newRoot := hash.Of([]byte("new root"))
 	src := tt.p.Compact(createMemTable(chunks), nil)
-	fm.set(constants.NomsVersion, newRoot, []tableSpec{{src.hash(), uint32(len(chunks))}})
+	fm.set(constants.NomsVersion, newRoot, []tableSpec{{src.hash(), uint32(len(chunks)), "", SnappyTables}})
 
 	// state in store shouldn't change
 	assert.Equal(hash.Hash{}, store.Root())
@@ -90,7 +90,7 @@ func TestChunkStoreManifestFirstWriteByOtherProcess(t *testing.T) {
 	chunks := [][]byte{[]byte("hello2"), []byte("goodbye2"), []byte("badbye2")}
 	newRoot := hash.Of([]byte("new root"))
 	src := tt.p.Compact(createMemTable(chunks), nil)
-	fm.set(constants.NomsVersion, newRoot, []tableSpec{{src.hash(), uint32(len(chunks))}})
+	fm.set(constants.NomsVersion, newRoot, []tableSpec{{src.hash(), uint32(len(chunks)), "", SnappyTables}})
 
 	store := newNomsBlockStore(fm, tt, defaultMemTableSize, defaultMaxTables)
 	defer store.Close()
@@ -109,7 +109,7 @@ func TestChunkStoreUpdateRootOptimisticLockFail(t *testing.T) {
 	chunks := [][]byte{[]byte("hello2"), []byte("goodbye2"), []byte("badbye2")}
 	newRoot := hash.Of([]byte("new root"))
 	src := tt.p.Compact(createMemTable(chunks), nil)
-	fm.set(constants.NomsVersion, newRoot, []tableSpec{{src.hash(), uint32(len(chunks))}})
+	fm.set(constants.NomsVersion, newRoot, []tableSpec{{src.hash(), uint32(len(chunks)), "", SnappyTables}})
 
 	newRoot2 := hash.Of([]byte("new root 2"))
 	assert.False(store.UpdateRoot(newRoot2, hash.Hash{}))
@@ -156,26 +156,16 @@ func (fm *fakeManifest) ParseIfExists(readHook func()) (exists bool, vers string
 	return false, "", hash.Hash{}, nil
 }
 
-// Update checks whether |root| == |fm.root| and, if so, updates internal fake manifest state as per the manifest.Update() contract: |fm.root| is set to |newRoot|, and the contents of |specs| are merged into |fm.tableSpecs|. If |root| != |fm.root|, then the update fails. Regardless of success or failure, the current state is returned.
-func (fm *fakeManifest) Update(specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (actual hash.Hash, tableSpecs []tableSpec) {
+// Update checks whether |root| == |fm.root| and |lastSpecs| == |fm.tableSpecs| and, if so, updates internal fake manifest state as per the manifest.Update() contract: |fm.root| is set to |newRoot|, and |fm.tableSpecs| is set to |specs|. Otherwise, the update fails. Regardless of success or failure, the current state is returned.
+func (fm *fakeManifest) Update(lastSpecs, specs []tableSpec, root, newRoot hash.Hash, writeHook func()) (actual hash.Hash, tableSpecs []tableSpec) {
 	fm.mu.Lock()
 	defer fm.mu.Unlock()
-	if fm.root != root {
+	if fm.root != root || !specsEqual(fm.tableSpecs, lastSpecs) {
 		return fm.root, fm.tableSpecs
 	}
 	fm.version = constants.NomsVersion
 	fm.root = newRoot
-
-	known := map[addr]struct{}{}
-	for _, t := range fm.tableSpecs {
-		known[t.name] = struct{}{}
-	}
-
-	for _, t := range specs {
-		if _, present := known[t.name]; !present {
-			fm.tableSpecs = append(fm.tableSpecs, t)
-		}
-	}
+	fm.tableSpecs = specs
 	return fm.root, fm.tableSpecs
 }
 
@@ -197,7 +187,7 @@ type fakeTablePersister struct {
 
 func (ftp fakeTablePersister) Compact(mt *memTable, haver chunkReader) chunkSource {
 	if mt.count() > 0 {
-		name, data, chunkCount := mt.write(haver)
+		name, data, chunkCount := mt.write(haver, nil, SnappyTables)
 		if chunkCount > 0 {
 			ftp.sources[name] = newTableReader(parseTableIndex(data), bytes.NewReader(data), fileBlockSize)
 			return chunkSourceAdapter{ftp.sources[name], name}
@@ -209,7 +199,7 @@ func (ftp fakeTablePersister) Compact(mt *memTable, haver chunkReader) chunkSour
 func (ftp fakeTablePersister) CompactAll(sources chunkSources) chunkSource {
 	rl := make(chan struct{}, 32)
 	defer close(rl)
-	name, data, chunkCount := compactSourcesToBuffer(sources, rl)
+	name, data, chunkCount := compactSourcesToBuffer(sources, nil, SnappyTables, rl)
 	if chunkCount > 0 {
 		ftp.sources[name] = newTableReader(parseTableIndex(data), bytes.NewReader(data), fileBlockSize)
 		return chunkSourceAdapter{ftp.sources[name], name}
@@ -217,7 +207,7 @@ func (ftp fakeTablePersister) CompactAll(sources chunkSources) chunkSource {
 	return emptyChunkSource{}
 }
 
-func (ftp fakeTablePersister) Open(name addr, chunkCount uint32) chunkSource {
+func (ftp fakeTablePersister) Open(name addr, chunkCount uint32, keyID string) chunkSource {
 	return chunkSourceAdapter{ftp.sources[name], name}
 }
 
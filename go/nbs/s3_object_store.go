@@ -0,0 +1,164 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3ObjectStore is an ObjectStore and ManifestStore backed by a bucket of S3,
+// or of a service that speaks its API, like MinIO. Its objects are those whose
+// keys start with a prefix, which lets several share a bucket.
+// CompareAndSwap relies on conditional writes, i.e. on the service honoring
+// the If-Match and If-None-Match headers of PUT requests.
+type S3ObjectStore struct {
+	s3     *s3.S3
+	bucket string
+	prefix string
+}
+
+// NewS3ObjectStore returns an S3ObjectStore that keeps its objects in
+// |bucket|, under keys that start with |prefix|. To use a service other than
+// S3, configure |sess| with its endpoint, and, usually, S3ForcePathStyle.
+func NewS3ObjectStore(sess *session.Session, bucket, prefix string) *S3ObjectStore {
+	return &S3ObjectStore{s3.New(sess), bucket, prefix}
+}
+
+func (ss *S3ObjectStore) Put(key string, data []byte) error {
+	_, err := ss.s3.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(ss.prefix + key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+func (ss *S3ObjectStore) GetRange(key string, p []byte, off int64) error {
+	rangeHeader := fmt.Sprintf("%s=%d-%d", s3RangePrefix, off, off+int64(len(p))-1) // insanely, the HTTP range header specifies ranges inclusively.
+	if off < 0 {
+		rangeHeader = fmt.Sprintf("%s=%d", s3RangePrefix, off)
+	}
+	result, err := ss.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(ss.prefix + key),
+		Range:  aws.String(rangeHeader),
+	})
+	if isS3Error(err, "NoSuchKey") {
+		return ErrObjectNotFound
+	} else if isS3Error(err, "InvalidRange") {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+	defer result.Body.Close()
+	_, err = io.ReadFull(result.Body, p)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (ss *S3ObjectStore) List(prefix string) ([]string, error) {
+	keys := []string{}
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(ss.bucket),
+		Prefix: aws.String(ss.prefix + prefix),
+	}
+	for {
+		result, err := ss.s3.ListObjectsV2(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range result.Contents {
+			keys = append(keys, strings.TrimPrefix(*obj.Key, ss.prefix))
+		}
+		if result.IsTruncated == nil || !*result.IsTruncated {
+			return keys, nil
+		}
+		input.ContinuationToken = result.NextContinuationToken
+	}
+}
+
+func (ss *S3ObjectStore) Delete(key string) error {
+	_, err := ss.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(ss.prefix + key),
+	})
+	return err
+}
+
+func (ss *S3ObjectStore) Get(key string) ([]byte, error) {
+	data, _, err := ss.get(key)
+	return data, err
+}
+
+// get returns the contents of the object |key| along with its ETag.
+func (ss *S3ObjectStore) get(key string) ([]byte, string, error) {
+	result, err := ss.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(ss.prefix + key),
+	})
+	if isS3Error(err, "NoSuchKey") {
+		return nil, "", ErrObjectNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+	defer result.Body.Close()
+	data, err := ioutil.ReadAll(result.Body)
+	return data, aws.StringValue(result.ETag), err
+}
+
+// CompareAndSwap reads the object |key|, and, if it holds |last|, writes
+// |data| with a PUT that's conditional on the object still having the ETag
+// that it was read with, or, if |last| is nil, on there still being no such
+// object.
+func (ss *S3ObjectStore) CompareAndSwap(key string, last, data []byte) (bool, error) {
+	current, etag, err := ss.get(key)
+	if err == ErrObjectNotFound {
+		if last != nil {
+			return false, nil
+		}
+	} else if err != nil {
+		return false, err
+	} else if last == nil || !bytes.Equal(current, last) {
+		return false, nil
+	}
+
+	req, _ := ss.s3.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(ss.prefix + key),
+		Body:   bytes.NewReader(data),
+	})
+	if last == nil {
+		req.HTTPRequest.Header.Set("If-None-Match", "*")
+	} else {
+		req.HTTPRequest.Header.Set("If-Match", etag)
+	}
+	err = req.Send()
+	if reqErr, ok := err.(awserr.RequestFailure); ok && (reqErr.StatusCode() == http.StatusPreconditionFailed || reqErr.StatusCode() == http.StatusConflict) {
+		// Someone else wrote the object since it was read, or is writing it
+		// right now.
+		return false, nil
+	} else if isS3Error(err, "NoSuchKey") {
+		// Someone else deleted it.
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func isS3Error(err error, code string) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == code
+}
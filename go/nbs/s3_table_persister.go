@@ -23,11 +23,14 @@ type s3TablePersister struct {
 	bucket     string
 	partSize   int
 	indexCache *indexCache
+	dtc        *diskTableCache
+	keys       *Keyring
+	format     TableFormat
 	readRl     chan struct{}
 }
 
-func (s3p s3TablePersister) Open(name addr, chunkCount uint32) chunkSource {
-	return newS3TableReader(s3p.s3, s3p.bucket, name, chunkCount, s3p.indexCache, s3p.readRl)
+func (s3p s3TablePersister) Open(name addr, chunkCount uint32, keyID string) chunkSource {
+	return newS3TableReader(s3p.s3, s3p.bucket, name, chunkCount, s3p.indexCache, s3p.dtc, s3p.keys.cipher(keyID), s3p.readRl)
 }
 
 type s3UploadedPart struct {
@@ -36,7 +39,7 @@ type s3UploadedPart struct {
 }
 
 func (s3p s3TablePersister) Compact(mt *memTable, haver chunkReader) chunkSource {
-	return s3p.persistTable(mt.write(haver))
+	return s3p.persistTable(mt.write(haver, s3p.keys.active(), s3p.format))
 }
 
 func (s3p s3TablePersister) persistTable(name addr, data []byte, chunkCount uint32) chunkSource {
@@ -45,19 +48,23 @@ func (s3p s3TablePersister) persistTable(name addr, data []byte, chunkCount uint
 		s3p.multipartUpload(data, name.String())
 		verbose.Log("Compacted table of %d Kb in %s", len(data)/1024, time.Since(t1))
 
-		s3tr := &s3TableReader{s3: s3p.s3, bucket: s3p.bucket, h: name}
+		s3tr := &s3TableReader{s3: s3p.s3, bucket: s3p.bucket, h: name, dtc: s3p.dtc}
 		index := parseTableIndex(data)
 		if s3p.indexCache != nil {
 			s3p.indexCache.put(name, index)
 		}
+		if s3p.dtc != nil {
+			s3p.dtc.putTable(name, data, index)
+		}
 		s3tr.tableReader = newTableReader(index, s3tr, s3BlockSize)
+		s3tr.cipher = s3p.keys.active()
 		return s3tr
 	}
 	return emptyChunkSource{}
 }
 
 func (s3p s3TablePersister) CompactAll(sources chunkSources) chunkSource {
-	return s3p.persistTable(compactSourcesToBuffer(sources, s3p.readRl))
+	return s3p.persistTable(compactSourcesToBuffer(sources, s3p.keys.active(), s3p.format, s3p.readRl))
 }
 
 func (s3p s3TablePersister) multipartUpload(data []byte, key string) {
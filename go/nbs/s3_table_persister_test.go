@@ -159,7 +159,7 @@ func TestCompactSourcesToBufferPanic(t *testing.T) {
 	src := bytesToChunkSource([]byte("hello"))
 	pcs := panicingChunkSource{src}
 
-	assert.Panics(func() { compactSourcesToBuffer(chunkSources{pcs}, rl) })
+	assert.Panics(func() { compactSourcesToBuffer(chunkSources{pcs}, nil, SnappyTables, rl) })
 }
 
 type panicingChunkSource struct {
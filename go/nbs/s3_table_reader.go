@@ -30,6 +30,7 @@ type s3TableReader struct {
 	bucket string
 	h      addr
 	readRl chan struct{}
+	dtc    *diskTableCache
 }
 
 type s3svc interface {
@@ -41,8 +42,8 @@ type s3svc interface {
 	PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error)
 }
 
-func newS3TableReader(s3 s3svc, bucket string, h addr, chunkCount uint32, indexCache *indexCache, readRl chan struct{}) chunkSource {
-	source := &s3TableReader{s3: s3, bucket: bucket, h: h, readRl: readRl}
+func newS3TableReader(s3 s3svc, bucket string, h addr, chunkCount uint32, indexCache *indexCache, dtc *diskTableCache, c *chunkCipher, readRl chan struct{}) chunkSource {
+	source := &s3TableReader{s3: s3, bucket: bucket, h: h, readRl: readRl, dtc: dtc}
 
 	var index tableIndex
 	found := false
@@ -51,12 +52,23 @@ func newS3TableReader(s3 s3svc, bucket string, h addr, chunkCount uint32, indexC
 	}
 
 	if !found {
-		size := indexSize(chunkCount) + footerSize
-		buff := make([]byte, size)
-
-		n, err := source.readRange(buff, fmt.Sprintf("%s=-%d", s3RangePrefix, size))
-		d.PanicIfError(err)
-		d.PanicIfFalse(size == uint64(n))
+		size := indexSize(chunkCount) + maxFooterSize
+		buff, cached := []byte(nil), false
+		if dtc != nil {
+			buff, cached = dtc.get(diskCacheIndexName(h))
+			// Indices cached before there were footers of different sizes are shorter.
+			cached = cached && uint64(len(buff)) == size
+		}
+		if !cached {
+			buff = make([]byte, size)
+			n, err := source.readRange(buff, fmt.Sprintf("%s=-%d", s3RangePrefix, size))
+			d.PanicIfError(err)
+			d.PanicIfFalse(size == uint64(n))
+			if dtc != nil {
+				dtc.put(diskCacheIndexName(h), buff)
+			}
+		}
+		d.PanicIfFalse(size == uint64(len(buff)))
 		index = parseTableIndex(buff)
 
 		if indexCache != nil {
@@ -65,6 +77,7 @@ func newS3TableReader(s3 s3svc, bucket string, h addr, chunkCount uint32, indexC
 	}
 
 	source.tableReader = newTableReader(index, source, s3BlockSize)
+	source.cipher = c
 	d.PanicIfFalse(chunkCount == source.count())
 	return source
 }
@@ -78,6 +91,74 @@ func (s3tr *s3TableReader) hash() addr {
 }
 
 func (s3tr *s3TableReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if s3tr.dtc != nil {
+		return s3tr.readAtCached(p, off)
+	}
+	return s3tr.readAt(p, off)
+}
+
+// readAtCached reads the blocks of the table that |p| overlaps from the disk
+// cache. Those that aren't there are read from S3 in a single ranged read,
+// from the first missing block to the last, and added to the cache.
+func (s3tr *s3TableReader) readAtCached(p []byte, off int64) (n int, err error) {
+	size := tableFileSize(s3tr.tableIndex)
+	end := uint64(off) + uint64(len(p))
+	if end > size {
+		end = size
+	}
+	if uint64(off) >= end {
+		if len(p) > 0 {
+			err = io.EOF
+		}
+		return
+	}
+
+	first, last := uint64(off)/diskCacheBlockSize, (end-1)/diskCacheBlockSize
+	blocks := make([][]byte, last-first+1)
+	missingFirst, missingLast := last+1, first
+	for block := first; block <= last; block++ {
+		data, ok := s3tr.dtc.get(diskCacheBlockName(s3tr.h, block))
+		if !ok {
+			if block < missingFirst {
+				missingFirst = block
+			}
+			missingLast = block
+		}
+		blocks[block-first] = data
+	}
+
+	if missingFirst <= missingLast {
+		start, stop := missingFirst*diskCacheBlockSize, (missingLast+1)*diskCacheBlockSize
+		if stop > size {
+			stop = size
+		}
+		buff := make([]byte, stop-start)
+		if _, err = s3tr.readAt(buff, int64(start)); err != nil {
+			return
+		}
+		for block := missingFirst; block <= missingLast; block++ {
+			data := buff[(block-missingFirst)*diskCacheBlockSize:]
+			if uint64(len(data)) > diskCacheBlockSize {
+				data = data[:diskCacheBlockSize]
+			}
+			if blocks[block-first] == nil {
+				s3tr.dtc.put(diskCacheBlockName(s3tr.h, block), data)
+			}
+			blocks[block-first] = data
+		}
+	}
+
+	for _, data := range blocks {
+		pos := uint64(off) + uint64(n)
+		n += copy(p[n:], data[pos%diskCacheBlockSize:])
+	}
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+func (s3tr *s3TableReader) readAt(p []byte, off int64) (n int, err error) {
 	end := off + int64(len(p)) - 1 // insanely, the HTTP range header specifies ranges inclusively.
 	rangeHeader := fmt.Sprintf("%s=%d-%d", s3RangePrefix, off, end)
 	return s3tr.readRange(p, rangeHeader)
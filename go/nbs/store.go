@@ -33,6 +33,16 @@ const (
 	// StorageVersion is the version of the on-disk Noms Chunks Store data format.
 	StorageVersion = "2"
 
+	// EncryptedStorageVersion is the version of manifests that name encrypted
+	// tables. Versions of noms that can't read those refuse to open the store,
+	// rather than failing to parse the manifest or misreading the tables.
+	EncryptedStorageVersion = "3"
+
+	// ZstdStorageVersion is the version of manifests that name tables
+	// compressed with zstd, which may be encrypted as well. Versions of noms
+	// that can't read those refuse to open the store in the same way.
+	ZstdStorageVersion = "4"
+
 	defaultMemTableSize uint64 = (1 << 20) * 128 // 128MB
 	defaultAWSReadLimit        = 1024
 	defaultMaxTables           = 128
@@ -54,14 +64,80 @@ type NomsBlockStore struct {
 	mm          manifest
 	nomsVersion string
 
-	mu     sync.RWMutex // protects the following state
-	mt     *memTable
-	tables tableSet
-	root   hash.Hash
+	mu       sync.RWMutex // protects the following state
+	mt       *memTable
+	tables   tableSet
+	root     hash.Hash
+	upstream []tableSpec // the tables named by the manifest when last we read or wrote it
+
+	mtSize            uint64
+	maxTables         int
+	putCount          uint64
+	compactionMetrics CompactionMetrics
+
+	// compactingInBackground is set while CompactInBackground() is compacting
+	// the store's tables, in which case UpdateRoot() leaves them be.
+	compactingInBackground bool
+
+	compactorMu   sync.Mutex // protects stopCompactor
+	stopCompactor func()     // stops the goroutine started by CompactInBackground()
+}
+
+// StoreOptions customize NomsBlockStores of every kind.
+type StoreOptions struct {
+	// TableFormat is the format in which the store writes new tables,
+	// including those written by compaction, which recompresses the chunks
+	// of the tables it merges. Stores read tables in any format.
+	TableFormat TableFormat
+
+	// CompactionInterval, if not 0, is how often the store compacts its
+	// tables in the background with CompactionPolicy, as by
+	// CompactInBackground(). Such stores don't compact tables in
+	// UpdateRoot(), so writers never wait for compaction.
+	CompactionInterval time.Duration
+
+	// CompactionPolicy is the policy of background compaction. If its FanIn
+	// is 0, DefaultCompactionPolicy is used.
+	CompactionPolicy CompactionPolicy
+}
+
+// start starts the background compaction of |nbs|, if |opts| ask for it.
+func (opts StoreOptions) start(nbs *NomsBlockStore) *NomsBlockStore {
+	if opts.CompactionInterval > 0 {
+		policy := opts.CompactionPolicy
+		if policy.FanIn == 0 {
+			policy = DefaultCompactionPolicy
+		}
+		nbs.CompactInBackground(policy, opts.CompactionInterval)
+	}
+	return nbs
+}
+
+// AWSStoreOptions customize the NomsBlockStores that are backed by AWS.
+type AWSStoreOptions struct {
+	StoreOptions
+
+	// DiskCacheDir, if not empty, is a local directory in which to cache the
+	// tables that are read from and written to S3, so that reading them again
+	// doesn't go to S3. It can be shared by any number of stores and
+	// processes.
+	DiskCacheDir string
+
+	// DiskCacheSize is roughly how many bytes the files in DiskCacheDir may add
+	// up to before the least recently used are deleted. If 0,
+	// DefaultDiskCacheSize is used.
+	DiskCacheSize uint64
 
-	mtSize    uint64
-	maxTables int
-	putCount  uint64
+	// Keys, if not nil, are the keys to encrypt the chunks of new tables with,
+	// and to decrypt those of existing ones. See Keyring.
+	Keys *Keyring
+}
+
+func (opts AWSStoreOptions) diskTableCache() *diskTableCache {
+	if opts.DiskCacheDir == "" {
+		return nil
+	}
+	return openDiskTableCache(opts.DiskCacheDir, opts.DiskCacheSize)
 }
 
 type AWSStoreFactory struct {
@@ -69,24 +145,56 @@ type AWSStoreFactory struct {
 	ddb           ddbsvc
 	table, bucket string
 	indexCache    *indexCache
+	dtc           *diskTableCache
+	keys          *Keyring
+	opts          StoreOptions
 	readRl        chan struct{}
 }
 
 func NewAWSStoreFactory(sess *session.Session, table, bucket string, indexCacheSize uint64) chunks.Factory {
+	return NewAWSStoreFactoryOpts(sess, table, bucket, indexCacheSize, AWSStoreOptions{})
+}
+
+func NewAWSStoreFactoryOpts(sess *session.Session, table, bucket string, indexCacheSize uint64, opts AWSStoreOptions) chunks.Factory {
 	var indexCache *indexCache
 	if indexCacheSize > 0 {
 		indexCache = newIndexCache(indexCacheSize)
 	}
-	return &AWSStoreFactory{s3.New(sess), dynamodb.New(sess), table, bucket, indexCache, make(chan struct{}, defaultAWSReadLimit)}
+	return &AWSStoreFactory{s3.New(sess), dynamodb.New(sess), table, bucket, indexCache, opts.diskTableCache(), opts.Keys, opts.StoreOptions, make(chan struct{}, defaultAWSReadLimit)}
 }
 
 func (asf *AWSStoreFactory) CreateStore(ns string) chunks.ChunkStore {
-	return newAWSStore(asf.table, ns, asf.bucket, asf.s3, asf.ddb, defaultMemTableSize, asf.indexCache, asf.readRl)
+	return newAWSStore(asf.table, ns, asf.bucket, asf.s3, asf.ddb, defaultMemTableSize, asf.indexCache, asf.dtc, asf.keys, asf.opts, asf.readRl)
 }
 
 func (asf *AWSStoreFactory) Shutter() {
 }
 
+type BlobStoreFactory struct {
+	objects    ObjectStore
+	manifests  ManifestStore
+	indexCache *indexCache
+	readRl     chan struct{}
+}
+
+// NewBlobStoreFactory returns a Factory of NomsBlockStores that keep their
+// tables in |objects| and their manifests in |manifests|. The stores share the
+// tables, like those of an AWSStoreFactory do.
+func NewBlobStoreFactory(objects ObjectStore, manifests ManifestStore, indexCacheSize uint64) chunks.Factory {
+	var indexCache *indexCache
+	if indexCacheSize > 0 {
+		indexCache = newIndexCache(indexCacheSize)
+	}
+	return &BlobStoreFactory{objects, manifests, indexCache, make(chan struct{}, defaultAWSReadLimit)}
+}
+
+func (bsf *BlobStoreFactory) CreateStore(ns string) chunks.ChunkStore {
+	return newBlobStore(bsf.objects, bsf.manifests, ns, defaultMemTableSize, bsf.indexCache, StoreOptions{}, bsf.readRl)
+}
+
+func (bsf *BlobStoreFactory) Shutter() {
+}
+
 type LocalStoreFactory struct {
 	dir        string
 	indexCache *indexCache
@@ -119,33 +227,60 @@ func (lsf *LocalStoreFactory) CreateStore(ns string) chunks.ChunkStore {
 	path := path.Join(lsf.dir, ns)
 	err := os.MkdirAll(path, 0777)
 	d.PanicIfError(err)
-	return newLocalStore(path, defaultMemTableSize, lsf.indexCache, lsf.maxTables)
+	return newLocalStore(path, defaultMemTableSize, lsf.indexCache, lsf.maxTables, StoreOptions{})
 }
 
 func (lsf *LocalStoreFactory) Shutter() {
 }
 
 func NewAWSStore(table, ns, bucket string, s3 s3svc, ddb ddbsvc, memTableSize uint64) *NomsBlockStore {
+	return NewAWSStoreOpts(table, ns, bucket, s3, ddb, memTableSize, AWSStoreOptions{})
+}
+
+func NewAWSStoreOpts(table, ns, bucket string, s3 s3svc, ddb ddbsvc, memTableSize uint64, opts AWSStoreOptions) *NomsBlockStore {
 	indexCacheOnce.Do(makeGlobalIndexCache)
-	return newAWSStore(table, ns, bucket, s3, ddb, memTableSize, globalIndexCache, make(chan struct{}, 32))
+	return newAWSStore(table, ns, bucket, s3, ddb, memTableSize, globalIndexCache, opts.diskTableCache(), opts.Keys, opts.StoreOptions, make(chan struct{}, 32))
 }
 
-func newAWSStore(table, ns, bucket string, s3 s3svc, ddb ddbsvc, memTableSize uint64, indexCache *indexCache, readRl chan struct{}) *NomsBlockStore {
+func newAWSStore(table, ns, bucket string, s3 s3svc, ddb ddbsvc, memTableSize uint64, indexCache *indexCache, dtc *diskTableCache, keys *Keyring, opts StoreOptions, readRl chan struct{}) *NomsBlockStore {
 	d.PanicIfTrue(ns == "")
 	mm := newDynamoManifest(table, ns, ddb)
-	ts := newS3TableSet(s3, bucket, indexCache, readRl)
-	return newNomsBlockStore(mm, ts, memTableSize, defaultMaxTables)
+	ts := newS3TableSet(s3, bucket, indexCache, dtc, keys, opts.TableFormat, readRl)
+	return opts.start(newNomsBlockStore(mm, ts, memTableSize, defaultMaxTables))
+}
+
+// NewBlobStore returns a NomsBlockStore that keeps its tables in |objects|
+// and its manifest in |manifests|. Stores with different namespaces can share
+// both.
+func NewBlobStore(objects ObjectStore, manifests ManifestStore, ns string, memTableSize uint64) *NomsBlockStore {
+	return NewBlobStoreOpts(objects, manifests, ns, memTableSize, StoreOptions{})
+}
+
+// NewBlobStoreOpts is like NewBlobStore, but customizes the store with |opts|.
+func NewBlobStoreOpts(objects ObjectStore, manifests ManifestStore, ns string, memTableSize uint64, opts StoreOptions) *NomsBlockStore {
+	indexCacheOnce.Do(makeGlobalIndexCache)
+	return newBlobStore(objects, manifests, ns, memTableSize, globalIndexCache, opts, make(chan struct{}, 32))
+}
+
+func newBlobStore(objects ObjectStore, manifests ManifestStore, ns string, memTableSize uint64, indexCache *indexCache, opts StoreOptions, readRl chan struct{}) *NomsBlockStore {
+	return opts.start(newNomsBlockStore(newObjectManifest(manifests, ns), newObjectTableSet(objects, indexCache, opts.TableFormat, readRl), memTableSize, defaultMaxTables))
 }
 
 func NewLocalStore(dir string, memTableSize uint64) *NomsBlockStore {
+	return NewLocalStoreOpts(dir, memTableSize, StoreOptions{})
+}
+
+// NewLocalStoreOpts is like NewLocalStore, but customizes the store with
+// |opts|.
+func NewLocalStoreOpts(dir string, memTableSize uint64, opts StoreOptions) *NomsBlockStore {
 	indexCacheOnce.Do(makeGlobalIndexCache)
-	return newLocalStore(dir, memTableSize, globalIndexCache, defaultMaxTables)
+	return newLocalStore(dir, memTableSize, globalIndexCache, defaultMaxTables, opts)
 }
 
-func newLocalStore(dir string, memTableSize uint64, indexCache *indexCache, maxTables int) *NomsBlockStore {
+func newLocalStore(dir string, memTableSize uint64, indexCache *indexCache, maxTables int, opts StoreOptions) *NomsBlockStore {
 	err := CheckDir(dir)
 	d.PanicIfError(err)
-	return newNomsBlockStore(fileManifest{dir}, newFSTableSet(dir, indexCache), memTableSize, maxTables)
+	return opts.start(newNomsBlockStore(fileManifest{dir}, newFSTableSet(dir, indexCache, opts.TableFormat), memTableSize, maxTables))
 }
 
 func newNomsBlockStore(mm manifest, ts tableSet, memTableSize uint64, maxTables int) *NomsBlockStore {
@@ -161,7 +296,7 @@ func newNomsBlockStore(mm manifest, ts tableSet, memTableSize uint64, maxTables
 	}
 
 	if exists, vers, root, tableSpecs := nbs.mm.ParseIfExists(nil); exists {
-		nbs.nomsVersion, nbs.root = vers, root
+		nbs.nomsVersion, nbs.root, nbs.upstream = vers, root, tableSpecs
 		nbs.tables, _ = nbs.tables.Rebase(tableSpecs)
 	}
 
@@ -188,6 +323,11 @@ func (nbs *NomsBlockStore) PutMany(chunx []chunks.Chunk) {
 func (nbs *NomsBlockStore) addChunk(h addr, data []byte) bool {
 	nbs.mu.Lock()
 	defer nbs.mu.Unlock()
+	return nbs.addChunkLocked(h, data)
+}
+
+// addChunkLocked must be called with nbs.mu held for writing.
+func (nbs *NomsBlockStore) addChunkLocked(h addr, data []byte) bool {
 	if nbs.mt == nil {
 		nbs.mt = newMemTable(nbs.mtSize)
 	}
@@ -335,32 +475,88 @@ func (nbs *NomsBlockStore) UpdateRoot(current, last hash.Hash) bool {
 		return false
 	}
 
-	if nbs.mt != nil && nbs.mt.count() > 0 {
-		nbs.tables = nbs.tables.Prepend(nbs.mt)
-		nbs.mt = nil
-	}
+	for {
+		if nbs.mt != nil && nbs.mt.count() > 0 {
+			nbs.tables = nbs.tables.Prepend(nbs.mt)
+			nbs.mt = nil
+		}
 
-	candidate := nbs.tables
-	var compactees chunkSources
-	if candidate.Size() > nbs.maxTables {
-		candidate, compactees = candidate.Compact() // Compact() must only compact upstream tables (BUG 3142)
-	}
+		candidate := nbs.tables
+		var compactees chunkSources
+		if candidate.Size() > nbs.maxTables && !nbs.compactingInBackground {
+			candidate, compactees = candidate.Compact() // Compact() must only compact upstream tables (BUG 3142)
+		}
 
-	actual, tableNames := nbs.mm.Update(candidate.ToSpecs(), nbs.root, current, nil)
+		specs := candidate.ToSpecs()
+		d.PanicIfError(checkEncrypted(nbs.upstream, specs))
+		actual, tableSpecs := nbs.mm.Update(nbs.upstream, specs, nbs.root, current, nil)
+
+		if current == actual && specsEqual(specs, tableSpecs) {
+			nbs.tables = candidate.Flatten()
+			compactees.close()
+			nbs.nomsVersion, nbs.root, nbs.upstream = constants.NomsVersion, current, tableSpecs
+			return true
+		}
 
-	if current != actual {
 		// Optimistic lock failure. Since we're going to start fresh, re-opening all the new tables from upstream, and re-calculate which tables to compact, close all the compactees as well as the chunkSources that are dropped during Rebase().
 		compactees.close()
 		var dropped chunkSources
-		nbs.root = actual
-		nbs.tables, dropped = candidate.Rebase(tableNames)
+		removed := removedSpecs(nbs.upstream, tableSpecs)
+		nbs.root, nbs.upstream = actual, tableSpecs
+		nbs.tables, dropped = candidate.Rebase(tableSpecs)
+		if removed {
+			// Some tables we knew about are gone, probably due to GC. Rescue any chunks that |current| still needs from them before letting them go.
+			nbs.salvage(current, dropped)
+		}
 		dropped.close()
-		return false
+		if actual != last {
+			return false
+		}
+		// Only the tables changed, e.g. because another process compacted or garbage collected them, so try again on top of the new ones.
 	}
-	nbs.tables = candidate.Flatten()
-	compactees.close()
-	nbs.nomsVersion, nbs.root = constants.NomsVersion, current
-	return true
+}
+
+// TableDamage describes a problem found by VerifyTables(). |Chunk| is the
+// address of the damaged chunk record, or empty if the problem affects the
+// whole table.
+type TableDamage struct {
+	Table, Chunk, Problem string
+}
+
+type chunkDamage struct {
+	a       addr
+	problem string
+}
+
+// tableVerifier is implemented by chunkSources that can check their on-disk
+// (or in-S3) contents for damage.
+type tableVerifier interface {
+	verify() []chunkDamage
+}
+
+// VerifyTables reads every record in every table in the store, checking its
+// crc and that its contents hash to the address it's stored under. Tables
+// that haven't been persisted yet are skipped.
+func (nbs *NomsBlockStore) VerifyTables() (damaged []TableDamage) {
+	tables := func() tableSet {
+		nbs.mu.RLock()
+		defer nbs.mu.RUnlock()
+		return nbs.tables
+	}()
+	for _, css := range []chunkSources{tables.novel, tables.upstream} {
+		for _, src := range css {
+			if tv, ok := src.(tableVerifier); ok {
+				for _, cd := range tv.verify() {
+					td := TableDamage{Table: src.hash().String(), Problem: cd.problem}
+					if cd.a != (addr{}) {
+						td.Chunk = cd.a.String()
+					}
+					damaged = append(damaged, td)
+				}
+			}
+		}
+	}
+	return
 }
 
 func (nbs *NomsBlockStore) Version() string {
@@ -368,6 +564,7 @@ func (nbs *NomsBlockStore) Version() string {
 }
 
 func (nbs *NomsBlockStore) Close() (err error) {
+	nbs.stopBackgroundCompaction()
 	nbs.mu.Lock()
 	defer nbs.mu.Unlock()
 	return nbs.tables.Close()
@@ -32,6 +32,9 @@ import (
 
      -Address suffix is the 4 least-significant bytes of the Chunk's address. Used (e.g. in place
       of CRC32) as a checksum and a filter against false positive reads costing more than one IOP.
+     -In the tables of encrypted stores, Chunk Data is (12) Nonce + the AES-GCM encryption of the
+      compressed data, with the Chunk's address as additional data. The CRC32 covers the encrypted
+      bytes, and the manifest records the ID of the key alongside the table.
 
    Index:
    +------------+---------+----------+
@@ -79,6 +82,29 @@ import (
 
      -Total Uncompressed Chunk Data is the sum of the uncompressed byte lengths of all contained chunk byte slices.
      -Magic Number is the first 8 bytes of the SHA256 hash of "https://github.com/attic-labs/nbs".
+     -In the tables of this format, SnappyTables, Chunk Data is the snappy compression of the chunk.
+
+   Tables in the ZstdTables format compress each chunk with zstd instead. They may hold a dictionary,
+   built from a sample of their chunks, which is used to compress each of them:
+
+   Table:
+   +----------------+-----+----------------+------------+-------+-------------+
+   | Chunk Record 0 | ... | Chunk Record N | Dictionary | Index | Zstd Footer |
+   +----------------+-----+----------------+------------+-------+-------------+
+
+   Zstd Footer:
+   +----------------------------+----------------------+----------------------------------------+------------------+
+   | (Uint32) Dictionary Length | (Uint32) Chunk Count | (Uint64) Total Uncompressed Chunk Data | (8) Magic Number |
+   +----------------------------+----------------------+----------------------------------------+------------------+
+
+     -Dictionary is a raw zstd dictionary, i.e. data that zstd matches against as though it preceded
+      each chunk. Dictionary Length may be 0, in which case the chunks are compressed without one.
+      Encrypted tables never hold a dictionary, since it would be stored in the clear.
+     -Magic Number is the first 8 bytes of the SHA256 hash of "https://github.com/attic-labs/nbs#zstd".
+     -Chunk Data is a zstd frame, without a checksum of its own.
+
+   Readers tell the formats apart by their magic numbers, and fetch indexSize()+maxFooterSize bytes
+   from the end of a table to be sure to get its index and footer.
 
     NOTE: Unsigned integer quanities, hashes and hash suffix are all encoded big-endian
 
@@ -113,8 +139,11 @@ const (
 	ordinalSize        uint64 = uint32Size
 	lengthSize         uint64 = uint32Size
 	magicNumber               = "\xff\xb5\xd8\xc2\x24\x63\xee\x50"
+	zstdMagicNumber           = "\x21\x1a\x06\xba\x3c\x2c\xfb\x8b"
 	magicNumberSize    uint64 = uint64(len(magicNumber))
 	footerSize                = uint32Size + uint64Size + magicNumberSize
+	zstdFooterSize            = uint32Size + footerSize
+	maxFooterSize             = zstdFooterSize
 	prefixTupleSize           = addrPrefixSize + ordinalSize
 	checksumSize       uint64 = uint32Size
 	maxChunkLengthSize uint64 = binary.MaxVarintLen64
@@ -213,6 +242,10 @@ type chunkSource interface {
 	chunkReader
 	close() error
 	hash() addr
+	// keyID returns the ID of the key the source's table is encrypted with, or "" if it isn't encrypted.
+	keyID() string
+	// tableFormat returns the format the source's table is written in.
+	tableFormat() TableFormat
 	calcReads(reqs []getRecord, blockSize uint64) (reads int, remaining bool)
 }
 
@@ -0,0 +1,212 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/attic-labs/noms/go/d"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// TableFormat is the format of the chunk records of a table. It's recorded by
+// the magic number at the end of the table's footer, so stores read tables of
+// every format, whatever format they write new ones in. See table.go.
+type TableFormat int
+
+const (
+	// SnappyTables compress each chunk with snappy on its own. It's the
+	// format of every table written before ZstdTables existed.
+	SnappyTables TableFormat = iota
+
+	// ZstdTables compress each chunk with zstd. Unless they're encrypted, they
+	// also hold a dictionary made of the starts of a sample of their chunks,
+	// which primes the compression of each chunk with the type descriptors
+	// and struct field names that Noms chunks have in common. Versions of NBS
+	// that predate the format can't read these tables, so manifests that name
+	// them have ZstdStorageVersion, which those versions refuse to open.
+	ZstdTables
+)
+
+// TableFormatEnvVar is the environment variable from which TableFormatFromEnv
+// reads a TableFormat, in the format that ParseTableFormat accepts.
+const TableFormatEnvVar = "NOMS_TABLE_FORMAT"
+
+var tableFormatNames = map[TableFormat]string{
+	SnappyTables: "snappy",
+	ZstdTables:   "zstd",
+}
+
+func (f TableFormat) String() string {
+	if name, ok := tableFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("TableFormat(%d)", int(f))
+}
+
+// ParseTableFormat parses the name of a TableFormat, "snappy" or "zstd".
+func ParseTableFormat(s string) (TableFormat, error) {
+	for f, name := range tableFormatNames {
+		if s == name {
+			return f, nil
+		}
+	}
+	return SnappyTables, fmt.Errorf("Unknown table format %q, expected snappy or zstd", s)
+}
+
+// TableFormatFromEnv parses the TableFormat in the TableFormatEnvVar
+// environment variable. It returns SnappyTables, and no error, if the variable
+// isn't set.
+func TableFormatFromEnv() (TableFormat, error) {
+	s := os.Getenv(TableFormatEnvVar)
+	if s == "" {
+		return SnappyTables, nil
+	}
+	return ParseTableFormat(s)
+}
+
+// tableFormatOf returns the format of tables whose footers end with |magic|.
+func tableFormatOf(magic string) (TableFormat, bool) {
+	switch magic {
+	case magicNumber:
+		return SnappyTables, true
+	case zstdMagicNumber:
+		return ZstdTables, true
+	}
+	return SnappyTables, false
+}
+
+const (
+	// maxDictionarySize is the size of the largest dictionary a table holds.
+	maxDictionarySize = 1 << 16
+
+	// maxDictionaryEntrySize is how many bytes from the start of each sampled
+	// chunk go into a dictionary. That's where Noms chunks keep the encodings
+	// of their types.
+	maxDictionaryEntrySize = 1 << 10
+
+	// dictionarySampleSize is how many bytes of chunk data the dictionary of
+	// a table is built from. tableWriter holds back the first chunks of a
+	// table until it has that many.
+	dictionarySampleSize = 1 << 22
+
+	// minDictionaryChunks is the number of chunks below which a table doesn't
+	// get a dictionary, since it would cost more than it saves.
+	minDictionaryChunks = 16
+
+	// zstdTableOverhead is how much bigger than maxTableSize() a ZstdTables
+	// table may be.
+	zstdTableOverhead = maxDictionarySize + zstdFooterSize - footerSize
+)
+
+// samplePrefixDictionary returns a raw zstd dictionary for a table of
+// |samples|, or nil if there are too few of them to be worth one. It isn't
+// trained, the way zstd's ZDICT trainer picks out the substrings that recur
+// most and adds entropy tables for them: it's simply the starts of samples
+// taken evenly from all of them, each distinct one included once, until it's
+// full. zstd matches chunks against it as though it preceded each one, which
+// is enough to capture the type encodings at the start of most Noms chunks.
+func samplePrefixDictionary(samples [][]byte) []byte {
+	if len(samples) < minDictionaryChunks {
+		return nil
+	}
+	stride := len(samples) / (maxDictionarySize / maxDictionaryEntrySize)
+	if stride == 0 {
+		stride = 1
+	}
+
+	dictionary := make([]byte, 0, maxDictionarySize)
+	seen := map[string]bool{}
+	for i := 0; i < len(samples) && len(dictionary) < maxDictionarySize; i += stride {
+		entry := samples[i]
+		if len(entry) > maxDictionaryEntrySize {
+			entry = entry[:maxDictionaryEntrySize]
+		}
+		if len(entry) > maxDictionarySize-len(dictionary) {
+			entry = entry[:maxDictionarySize-len(dictionary)]
+		}
+		if seen[string(entry)] {
+			continue
+		}
+		seen[string(entry)] = true
+		dictionary = append(dictionary, entry...)
+	}
+	return dictionary
+}
+
+// newZstdEncoder returns an encoder of the chunks of a ZstdTables table, which
+// uses |dictionary| if it's not empty. Records have a checksum of their own,
+// so frames don't.
+func newZstdEncoder(dictionary []byte) *zstd.Encoder {
+	opts := []zstd.EOption{zstd.WithEncoderCRC(false), zstd.WithEncoderConcurrency(1)}
+	if len(dictionary) > 0 {
+		opts = append(opts, zstd.WithEncoderDictRaw(0, dictionary))
+	}
+	enc, err := zstd.NewWriter(nil, opts...)
+	d.PanicIfError(err)
+	return enc
+}
+
+func newZstdDecoder(dictionary []byte) *zstd.Decoder {
+	opts := []zstd.DOption{}
+	if len(dictionary) > 0 {
+		opts = append(opts, zstd.WithDecoderDictRaw(0, dictionary))
+	}
+	dec, err := zstd.NewReader(nil, opts...)
+	d.PanicIfError(err)
+	return dec
+}
+
+var (
+	plainZstdDecoderOnce sync.Once
+	plainZstdDecoder     *zstd.Decoder
+)
+
+// chunkDecoder decompresses the chunks of a table, in the format recorded by
+// its footer. Tables with a dictionary read it the first time a chunk is
+// decompressed.
+type chunkDecoder struct {
+	format TableFormat
+	index  tableIndex
+	r      io.ReaderAt
+
+	once sync.Once
+	dec  *zstd.Decoder
+	err  error
+}
+
+func newChunkDecoder(index tableIndex, r io.ReaderAt) *chunkDecoder {
+	return &chunkDecoder{format: index.format, index: index, r: r}
+}
+
+func (cd *chunkDecoder) decode(compressed []byte) ([]byte, error) {
+	if cd.format == SnappyTables {
+		return snappy.Decode(nil, compressed)
+	}
+	cd.once.Do(cd.load)
+	if cd.err != nil {
+		return nil, cd.err
+	}
+	return cd.dec.DecodeAll(compressed, nil)
+}
+
+func (cd *chunkDecoder) load() {
+	if cd.index.dictionaryLength == 0 {
+		plainZstdDecoderOnce.Do(func() { plainZstdDecoder = newZstdDecoder(nil) })
+		cd.dec = plainZstdDecoder
+		return
+	}
+	dictionary := make([]byte, cd.index.dictionaryLength)
+	n, err := cd.r.ReadAt(dictionary, int64(cd.index.dataLength()))
+	if err != nil || n != len(dictionary) {
+		cd.err = fmt.Errorf("Failed to read dictionary: read %d of %d bytes (%v)", n, len(dictionary), err)
+		return
+	}
+	cd.dec = newZstdDecoder(dictionary)
+}
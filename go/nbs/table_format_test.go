@@ -0,0 +1,178 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package nbs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/testify/assert"
+)
+
+func TestParseTableFormat(t *testing.T) {
+	assert := assert.New(t)
+	for _, f := range []TableFormat{SnappyTables, ZstdTables} {
+		parsed, err := ParseTableFormat(f.String())
+		assert.NoError(err)
+		assert.Equal(f, parsed)
+	}
+	_, err := ParseTableFormat("lz4")
+	assert.Error(err)
+}
+
+// similarChunks returns |n| chunks that have a lot in common, like those of a
+// Noms List of structs.
+func similarChunks(n int) [][]byte {
+	chunks := make([][]byte, n)
+	for i := range chunks {
+		chunks[i] = []byte(fmt.Sprintf("struct Person {name: String, age: Number, email: String}"+
+			"{name: \"person %d\", age: %d, email: \"person%d@example.com\"}", i, i%90, i))
+	}
+	return chunks
+}
+
+func buildTableFormat(chunks [][]byte, c *chunkCipher, format TableFormat) ([]byte, addr) {
+	totalData := uint64(0)
+	for _, chunk := range chunks {
+		totalData += uint64(len(chunk))
+	}
+	buff := make([]byte, maxTableSize(uint64(len(chunks)), totalData)+uint64(len(chunks))*encryptionOverhead+zstdTableOverhead)
+	tw := newTableWriter(buff, nil)
+	tw.cipher, tw.format = c, format
+	for _, chunk := range chunks {
+		tw.addChunk(computeAddr(chunk), chunk)
+	}
+	length, name := tw.finish()
+	return buff[:length], name
+}
+
+func TestZstdTable(t *testing.T) {
+	assert := assert.New(t)
+	chunks := similarChunks(200)
+
+	snappyData, snappyName := buildTableFormat(chunks, nil, SnappyTables)
+	data, name := buildTableFormat(chunks, nil, ZstdTables)
+	assert.True(len(data) < len(snappyData))
+	// The same chunks in a different format make a different table.
+	assert.NotEqual(snappyName, name)
+
+	index := parseTableIndex(data)
+	assert.Equal(ZstdTables, index.format)
+	assert.True(index.dictionaryLength > 0)
+	assert.Equal(uint64(len(data)), tableFileSize(index))
+
+	tr := newTableReader(index, bytes.NewReader(data), fileBlockSize)
+	for _, c := range chunks {
+		assert.Equal(c, tr.get(computeAddr(c)))
+	}
+	assert.Empty(tr.verify())
+}
+
+func TestZstdTableWithoutDictionary(t *testing.T) {
+	assert := assert.New(t)
+
+	// Too few chunks to be worth a dictionary.
+	chunks := similarChunks(minDictionaryChunks - 1)
+	data, _ := buildTableFormat(chunks, nil, ZstdTables)
+	index := parseTableIndex(data)
+	assert.Equal(ZstdTables, index.format)
+	assert.Zero(index.dictionaryLength)
+	assert.Equal(uint64(len(data)), tableFileSize(index))
+	tr := newTableReader(index, bytes.NewReader(data), fileBlockSize)
+	for _, c := range chunks {
+		assert.Equal(c, tr.get(computeAddr(c)))
+	}
+
+	// Encrypted tables never hold a dictionary, which would leak their chunks.
+	c := mustParseKeyring(assert, "k1="+testKey1).active()
+	chunks = similarChunks(200)
+	data, _ = buildTableFormat(chunks, c, ZstdTables)
+	index = parseTableIndex(data)
+	assert.Zero(index.dictionaryLength)
+	assert.False(bytes.Contains(data, []byte("struct Person")))
+	tr = newTableReader(index, bytes.NewReader(data), fileBlockSize)
+	tr.cipher = c
+	for _, c := range chunks {
+		assert.Equal(c, tr.get(computeAddr(c)))
+	}
+}
+
+func TestZstdTableDiskCache(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	chunks := similarChunks(200)
+	mt := newMemTable(1 << 20)
+	for _, c := range chunks {
+		assert.True(mt.addChunk(computeAddr(c), c))
+	}
+	s3svc := makeFakeS3(assert)
+	s3p := s3TablePersister{s3: s3svc, bucket: "bucket", partSize: calcPartSize(mt, 1), dtc: newDiskTableCache(dir, 1<<20), format: ZstdTables}
+	src := s3p.Compact(mt, nil)
+
+	// The dictionary is read from the cache, along with the chunks.
+	src = s3p.Open(src.hash(), src.count(), "")
+	for _, c := range chunks {
+		assert.Equal(c, src.get(computeAddr(c)))
+	}
+	assert.Zero(s3svc.getCount)
+}
+
+// tableFormatOfFile returns the format of the table in the file |path|.
+func tableFormatOfFile(assert *assert.Assertions, path string) TableFormat {
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(err)
+	format, ok := tableFormatOf(string(data[uint64(len(data))-magicNumberSize:]))
+	assert.True(ok)
+	return format
+}
+
+func TestStoreTableFormat(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := NewLocalStore(dir, testMemTableSize)
+	cs := makeTables(assert, store, types.String("a"), types.String("b"))
+	assert.NoError(store.Close())
+
+	// A store that writes zstd tables reads snappy ones, and compaction recompresses them.
+	store = NewLocalStoreOpts(dir, testMemTableSize, StoreOptions{TableFormat: ZstdTables})
+	cs = append(cs, makeTables(assert, store, types.String("c"))...)
+	assert.Equal(ZstdTables, tableFormatOfFile(assert, filepath.Join(dir, store.upstream[0].name.String())))
+	_, err = store.Compact(CompactAllPolicy)
+	assert.NoError(err)
+	assert.Len(store.upstream, 1)
+	assert.Equal(ZstdTables, tableFormatOfFile(assert, filepath.Join(dir, store.upstream[0].name.String())))
+	assert.NoError(store.Close())
+
+	// The manifest's storage version tells older versions of noms that they can't read the store.
+	vers := func() string {
+		b, err := ioutil.ReadFile(filepath.Join(dir, manifestFileName))
+		assert.NoError(err)
+		return strings.SplitN(string(b), ":", 2)[0]
+	}
+	assert.Equal(ZstdStorageVersion, vers())
+
+	// And one that writes snappy tables reads zstd ones. Once GC has recompressed them all, older versions can read the store again.
+	store = NewLocalStore(dir, testMemTableSize)
+	defer store.Close()
+	for _, c := range cs {
+		assert.Equal(c.Data(), store.Get(c.Hash()).Data())
+	}
+	assert.Empty(store.VerifyTables())
+	_, err = store.GCOpts(GCOptions{})
+	assert.NoError(err)
+	assert.Equal(StorageVersion, vers())
+}
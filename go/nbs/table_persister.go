@@ -16,7 +16,8 @@ import (
 type tablePersister interface {
 	Compact(mt *memTable, haver chunkReader) chunkSource
 	CompactAll(sources chunkSources) chunkSource
-	Open(name addr, chunkCount uint32) chunkSource
+	// Open returns a chunkSource for the table |name|, decrypting it with the key |keyID| unless that's "".
+	Open(name addr, chunkCount uint32, keyID string) chunkSource
 }
 
 type indexCache struct {
@@ -55,7 +56,8 @@ func (csbc chunkSourcesByDescendingCount) Less(i, j int) bool {
 }
 func (csbc chunkSourcesByDescendingCount) Swap(i, j int) { csbc[i], csbc[j] = csbc[j], csbc[i] }
 
-func compactSourcesToBuffer(sources chunkSources, rl chan struct{}) (name addr, data []byte, chunkCount uint32) {
+// compactSourcesToBuffer builds a table of all the chunks in |sources|, in |format|, encrypting them with |c| if it's not nil. The chunks are recompressed, so tables of any format can be compacted into one of any other.
+func compactSourcesToBuffer(sources chunkSources, c *chunkCipher, format TableFormat, rl chan struct{}) (name addr, data []byte, chunkCount uint32) {
 	d.Chk.True(rl != nil)
 	totalData := uint64(0)
 	for _, src := range sources {
@@ -67,8 +69,15 @@ func compactSourcesToBuffer(sources chunkSources, rl chan struct{}) (name addr,
 	}
 
 	maxSize := maxTableSize(uint64(chunkCount), totalData)
+	if c != nil {
+		maxSize += uint64(chunkCount) * encryptionOverhead
+	}
+	if format == ZstdTables {
+		maxSize += zstdTableOverhead
+	}
 	buff := make([]byte, maxSize) // This can blow up RAM (BUG 3130)
 	tw := newTableWriter(buff, nil)
+	tw.cipher, tw.format = c, format
 
 	// Use "channel of channels" ordered-concurrency pattern so that chunks from a given table stay together, preserving whatever locality was present in that table.
 	chunkChans := make(chan chan extractRecord)
@@ -7,6 +7,7 @@ package nbs
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"sort"
 	"sync"
@@ -14,7 +15,6 @@ import (
 	"github.com/attic-labs/noms/go/chunks"
 	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/hash"
-	"github.com/golang/snappy"
 )
 
 type tableIndex struct {
@@ -23,6 +23,8 @@ type tableIndex struct {
 	prefixes, offsets     []uint64
 	lengths, ordinals     []uint32
 	suffixes              []byte
+	format                TableFormat
+	dictionaryLength      uint32
 }
 
 // tableReader implements get & has queries against a single nbs table. goroutine safe.
@@ -30,6 +32,11 @@ type tableReader struct {
 	tableIndex
 	r         io.ReaderAt
 	blockSize uint64
+
+	// cipher, if not nil, decrypts the records of the table.
+	cipher *chunkCipher
+
+	decoder *chunkDecoder
 }
 
 // parses a valid nbs tableIndex from a byte stream. |buff| must end with an NBS index and footer, though it may contain an unspecified number of bytes before that data. |tableIndex| doesn't keep alive any references to |buff|.
@@ -38,7 +45,8 @@ func parseTableIndex(buff []byte) tableIndex {
 
 	// footer
 	pos -= magicNumberSize
-	d.Chk.True(string(buff[pos:]) == magicNumber)
+	format, ok := tableFormatOf(string(buff[pos:]))
+	d.Chk.True(ok, "Table is in an unknown format")
 
 	// total uncompressed chunk data
 	pos -= uint64Size
@@ -47,6 +55,12 @@ func parseTableIndex(buff []byte) tableIndex {
 	pos -= uint32Size
 	chunkCount := binary.BigEndian.Uint32(buff[pos:])
 
+	dictionaryLength := uint32(0)
+	if format == ZstdTables {
+		pos -= uint32Size
+		dictionaryLength = binary.BigEndian.Uint32(buff[pos:])
+	}
+
 	// index
 	suffixesSize := uint64(chunkCount) * addrSuffixSize
 	pos -= suffixesSize
@@ -66,6 +80,7 @@ func parseTableIndex(buff []byte) tableIndex {
 		prefixes, offsets,
 		lengths, ordinals,
 		suffixes,
+		format, dictionaryLength,
 	}
 }
 
@@ -94,6 +109,16 @@ func computePrefixes(count uint32, buff []byte) (prefixes []uint64, ordinals []u
 	return
 }
 
+// dataLength returns the length of the chunk records of the table, which come
+// first in it.
+func (ti tableIndex) dataLength() uint64 {
+	if ti.chunkCount == 0 {
+		return 0
+	}
+	last := ti.chunkCount - 1
+	return ti.offsets[last] + uint64(ti.lengths[last])
+}
+
 func (ti tableIndex) prefixIdxToOrdinal(idx uint32) uint32 {
 	return ti.ordinals[idx]
 }
@@ -139,7 +164,7 @@ func (ti tableIndex) lookupOrdinal(h addr) uint32 {
 
 // newTableReader parses a valid nbs table byte stream and returns a reader. buff must end with an NBS index and footer, though it may contain an unspecified number of bytes before that data. r should allow retrieving any desired range of bytes from the table.
 func newTableReader(index tableIndex, r io.ReaderAt, blockSize uint64) tableReader {
-	return tableReader{index, r, blockSize}
+	return tableReader{index, r, blockSize, nil, newChunkDecoder(index, r)}
 }
 
 // Scan across (logically) two ordered slices of address prefixes.
@@ -212,7 +237,7 @@ func (tr tableReader) get(h addr) (data []byte) {
 	n, err := tr.r.ReadAt(buff, int64(offset))
 	d.Chk.NoError(err)
 	d.Chk.True(n == int(length))
-	data = tr.parseChunk(buff)
+	data = tr.parseChunk(buff, h)
 	d.Chk.True(data != nil)
 
 	return
@@ -242,7 +267,7 @@ func (tr tableReader) readAtOffsets(readStart, readEnd uint64, reqs []getRecord,
 		localStart := rec.offset - readStart
 		localEnd := localStart + uint64(tr.lengths[rec.ordinal])
 		d.Chk.True(localEnd <= readLength)
-		data := tr.parseChunk(buff[localStart:localEnd])
+		data := tr.parseChunk(buff[localStart:localEnd], *rec.a)
 		c := chunks.NewChunkWithHash(hash.Hash(*rec.a), data)
 		foundChunks <- &c
 	}
@@ -360,19 +385,43 @@ func canReadAhead(fRec offsetRec, fLength uint32, readStart, readEnd, blockSize
 	return fRec.offset + uint64(fLength), true
 }
 
-// Fetches the byte stream of data logically encoded within the table starting at |pos|.
-func (tr tableReader) parseChunk(buff []byte) []byte {
+// Fetches the byte stream of data logically encoded within the table starting at |pos|. |h| is the address of the chunk.
+func (tr tableReader) parseChunk(buff []byte, h addr) []byte {
 	dataLen := uint64(len(buff)) - checksumSize
 
 	chksum := binary.BigEndian.Uint32(buff[dataLen:])
 	d.Chk.True(chksum == crc(buff[:dataLen]))
 
-	data, err := snappy.Decode(nil, buff[:dataLen])
+	compressed, err := tr.decrypt(buff[:dataLen], h)
+	d.Chk.NoError(err)
+	data, err := tr.decoder.decode(compressed)
 	d.Chk.NoError(err)
 
 	return data
 }
 
+// decrypt returns the compressed data of the chunk |h| from |record|, its
+// record less the checksum.
+func (tr tableReader) decrypt(record []byte, h addr) ([]byte, error) {
+	if tr.cipher == nil {
+		return record, nil
+	}
+	return tr.cipher.open(record, h)
+}
+
+// keyID returns the ID of the key that the table is encrypted with, or "" if
+// it isn't.
+func (tr tableReader) keyID() string {
+	if tr.cipher == nil {
+		return ""
+	}
+	return tr.cipher.keyID
+}
+
+func (tr tableReader) tableFormat() TableFormat {
+	return tr.format
+}
+
 func (tr tableReader) calcReads(reqs []getRecord, blockSize uint64) (reads int, remaining bool) {
 	var offsetRecords offsetRecSlice
 	// Pass #1: Build the set of table locations which must be read in order to find all the elements of |reqs| which are present in this table.
@@ -412,8 +461,8 @@ func (tr tableReader) calcReads(reqs []getRecord, blockSize uint64) (reads int,
 	return
 }
 
-func (tr tableReader) extract(order EnumerationOrder, chunks chan<- extractRecord) {
-	// Build reverse lookup table from ordinal -> chunk hash
+// ordinalAddrs builds a reverse lookup table from ordinal -> chunk address.
+func (tr tableReader) ordinalAddrs() addrSlice {
 	hashes := make(addrSlice, len(tr.prefixes))
 	for idx, prefix := range tr.prefixes {
 		ordinal := tr.prefixIdxToOrdinal(uint32(idx))
@@ -421,6 +470,11 @@ func (tr tableReader) extract(order EnumerationOrder, chunks chan<- extractRecor
 		li := uint64(ordinal) * addrSuffixSize
 		copy(hashes[ordinal][addrPrefixSize:], tr.suffixes[li:li+addrSuffixSize])
 	}
+	return hashes
+}
+
+func (tr tableReader) extract(order EnumerationOrder, chunks chan<- extractRecord) {
+	hashes := tr.ordinalAddrs()
 	chunkLen := tr.offsets[tr.chunkCount-1] + uint64(tr.lengths[tr.chunkCount-1])
 	buff := make([]byte, chunkLen)
 	n, err := tr.r.ReadAt(buff, int64(tr.offsets[0]))
@@ -429,7 +483,7 @@ func (tr tableReader) extract(order EnumerationOrder, chunks chan<- extractRecor
 
 	sendChunk := func(i uint32) {
 		localOffset := tr.offsets[i] - tr.offsets[0]
-		chunks <- extractRecord{hashes[i], tr.parseChunk(buff[localOffset : localOffset+uint64(tr.lengths[i])])}
+		chunks <- extractRecord{hashes[i], tr.parseChunk(buff[localOffset:localOffset+uint64(tr.lengths[i])], hashes[i])}
 	}
 
 	if order == ReverseOrder {
@@ -442,3 +496,46 @@ func (tr tableReader) extract(order EnumerationOrder, chunks chan<- extractRecor
 		sendChunk(i)
 	}
 }
+
+// verify reads every record in the table, checking its crc and that its
+// contents hash to the address under which it's indexed. Unlike parseChunk(),
+// it reports problems rather than panicking.
+func (tr tableReader) verify() (damaged []chunkDamage) {
+	if tr.chunkCount == 0 {
+		return
+	}
+	hashes := tr.ordinalAddrs()
+	chunkLen := tr.offsets[tr.chunkCount-1] + uint64(tr.lengths[tr.chunkCount-1])
+	buff := make([]byte, chunkLen)
+	if n, err := tr.r.ReadAt(buff, int64(tr.offsets[0])); err != nil || uint64(n) != chunkLen {
+		return []chunkDamage{{problem: fmt.Sprintf("Failed to read chunk data: read %d of %d bytes (%v)", n, chunkLen, err)}}
+	}
+
+	for i := uint32(0); i < tr.chunkCount; i++ {
+		localOffset := tr.offsets[i] - tr.offsets[0]
+		rec := buff[localOffset : localOffset+uint64(tr.lengths[i])]
+		if uint64(len(rec)) < checksumSize {
+			damaged = append(damaged, chunkDamage{hashes[i], "Record is too short"})
+			continue
+		}
+		dataLen := uint64(len(rec)) - checksumSize
+		if binary.BigEndian.Uint32(rec[dataLen:]) != crc(rec[:dataLen]) {
+			damaged = append(damaged, chunkDamage{hashes[i], "Checksum mismatch"})
+			continue
+		}
+		compressed, err := tr.decrypt(rec[:dataLen], hashes[i])
+		if err != nil {
+			damaged = append(damaged, chunkDamage{hashes[i], fmt.Sprintf("Failed to decrypt: %s", err)})
+			continue
+		}
+		data, err := tr.decoder.decode(compressed)
+		if err != nil {
+			damaged = append(damaged, chunkDamage{hashes[i], fmt.Sprintf("Failed to decompress: %s", err)})
+			continue
+		}
+		if computeAddr(data) != hashes[i] {
+			damaged = append(damaged, chunkDamage{hashes[i], "Data does not hash to indexed address"})
+		}
+	}
+	return
+}
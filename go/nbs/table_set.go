@@ -14,16 +14,16 @@ import (
 
 const concurrentCompactions = 5
 
-func newS3TableSet(s3 s3svc, bucket string, indexCache *indexCache, readRl chan struct{}) tableSet {
+func newS3TableSet(s3 s3svc, bucket string, indexCache *indexCache, dtc *diskTableCache, keys *Keyring, format TableFormat, readRl chan struct{}) tableSet {
 	return tableSet{
-		p:  s3TablePersister{s3, bucket, defaultS3PartSize, indexCache, readRl},
+		p:  s3TablePersister{s3, bucket, defaultS3PartSize, indexCache, dtc, keys, format, readRl},
 		rl: make(chan struct{}, concurrentCompactions),
 	}
 }
 
-func newFSTableSet(dir string, indexCache *indexCache) tableSet {
+func newFSTableSet(dir string, indexCache *indexCache, format TableFormat) tableSet {
 	return tableSet{
-		p:  fsTablePersister{dir, indexCache},
+		p:  fsTablePersister{dir, indexCache, nil, format},
 		rl: make(chan struct{}, concurrentCompactions),
 	}
 }
@@ -249,18 +249,31 @@ func (ts tableSet) Rebase(specs []tableSpec) (merged tableSet, dropped chunkSour
 
 	// Open all the new upstream tables concurrently
 	openedTables := make(chunkSources, len(tablesToOpen))
+	failures := make([]interface{}, len(tablesToOpen))
 	wg := &sync.WaitGroup{}
 	i := 0
 	for _, spec := range tablesToOpen {
 		wg.Add(1)
 		go func(idx int, spec tableSpec) {
-			openedTables[idx] = ts.p.Open(spec.name, spec.chunkCount)
-			wg.Done()
+			defer wg.Done()
+			// Re-panic below, on the caller's goroutine, e.g. if the table's key is missing.
+			defer func() { failures[idx] = recover() }()
+			openedTables[idx] = ts.p.Open(spec.name, spec.chunkCount, spec.keyID)
 		}(i, spec)
 		i++
 	}
 
 	wg.Wait()
+	for _, r := range failures {
+		if r != nil {
+			for _, t := range openedTables {
+				if t != nil {
+					t.close()
+				}
+			}
+			panic(r)
+		}
+	}
 	merged.upstream = append(merged.upstream, openedTables...)
 	return merged, dropped
 }
@@ -269,12 +282,12 @@ func (ts tableSet) ToSpecs() []tableSpec {
 	tableSpecs := make([]tableSpec, 0, ts.Size())
 	for _, src := range ts.novel {
 		if src.count() > 0 {
-			tableSpecs = append(tableSpecs, tableSpec{src.hash(), src.count()})
+			tableSpecs = append(tableSpecs, tableSpec{src.hash(), src.count(), src.keyID(), src.tableFormat()})
 		}
 	}
 	for _, src := range ts.upstream {
 		d.Chk.True(src.count() > 0)
-		tableSpecs = append(tableSpecs, tableSpec{src.hash(), src.count()})
+		tableSpecs = append(tableSpecs, tableSpec{src.hash(), src.count(), src.keyID(), src.tableFormat()})
 	}
 	return tableSpecs
 }
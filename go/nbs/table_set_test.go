@@ -201,12 +201,12 @@ func TestTableSetRebase(t *testing.T) {
 		}
 		return ts
 	}
-	fullTS := newFSTableSet(dir, nil)
+	fullTS := newFSTableSet(dir, nil, SnappyTables)
 	assert.Empty(fullTS.ToSpecs())
 	fullTS = insert(fullTS, testChunks...)
 	fullTS = fullTS.Flatten()
 
-	ts := newFSTableSet(dir, nil)
+	ts := newFSTableSet(dir, nil, SnappyTables)
 	ts = insert(ts, testChunks[0])
 	assert.Equal(1, ts.Size())
 	ts = ts.Flatten()
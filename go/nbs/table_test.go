@@ -253,6 +253,26 @@ func TestExtract(t *testing.T) {
 	}
 }
 
+func TestVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	chunks := [][]byte{
+		[]byte("hello2"),
+		[]byte("goodbye2"),
+		[]byte("badbye2"),
+	}
+
+	tableData, _ := buildTable(chunks)
+	tr := newTableReader(parseTableIndex(tableData), bytes.NewReader(tableData), fileBlockSize)
+	assert.Empty(tr.verify())
+
+	// Corrupt the first byte of the first record.
+	tableData[0] ^= 0xff
+	damaged := tr.verify()
+	assert.Len(damaged, 1)
+	assert.Equal(computeAddr(chunks[0]), damaged[0].a)
+}
+
 func Test65k(t *testing.T) {
 	assert := assert.New(t)
 
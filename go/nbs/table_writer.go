@@ -13,6 +13,7 @@ import (
 
 	"github.com/attic-labs/noms/go/d"
 	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
 )
 
 // tableWriter encodes a collection of byte stream chunks into a nbs table. NOT goroutine safe.
@@ -24,6 +25,18 @@ type tableWriter struct {
 	blockHash             hash.Hash
 
 	snapper snappyEncoder
+
+	// cipher, if not nil, encrypts each record after it's compressed.
+	cipher *chunkCipher
+
+	// format is the format of the table. ZstdTables tables hold back their
+	// first chunks in |pending| until there are enough of them to build the
+	// dictionary from, unless they're encrypted and so don't get one.
+	format      TableFormat
+	zstd        *zstd.Encoder
+	dictionary  []byte
+	pending     []extractRecord
+	pendingData uint64
 }
 
 type snappyEncoder interface {
@@ -65,23 +78,73 @@ func (tw *tableWriter) addChunk(h addr, data []byte) bool {
 		panic("NBS blocks cannont be zero length")
 	}
 
-	// Compress data straight into tw.buff
-	compressed := tw.snapper.Encode(tw.buff[tw.pos:], data)
-	dataLength := uint64(len(compressed))
+	if tw.format == ZstdTables && tw.zstd == nil {
+		tw.pending = append(tw.pending, extractRecord{h, data})
+		tw.pendingData += uint64(len(data))
+		if tw.cipher != nil || tw.pendingData >= dictionarySampleSize {
+			tw.startZstd()
+		}
+		return true
+	}
+	tw.writeRecord(h, data)
+	return true
+}
+
+// startZstd builds the dictionary of a ZstdTables table from the chunks held
+// back so far, and writes them.
+func (tw *tableWriter) startZstd() {
+	if tw.cipher == nil {
+		samples := make([][]byte, len(tw.pending))
+		for i, rec := range tw.pending {
+			samples[i] = rec.data
+		}
+		tw.dictionary = samplePrefixDictionary(samples)
+	}
+	tw.zstd = newZstdEncoder(tw.dictionary)
+	for _, rec := range tw.pending {
+		tw.writeRecord(rec.a, rec.data)
+	}
+	tw.pending, tw.pendingData = nil, 0
+}
 
-	// BUG 3156 indicated that, sometimes, snappy decided that there's not enough space in tw.buff[tw.pos:] to encode into.
-	// This _should never happen anymore be_, because we iterate over all chunks to be added and sum the max amount of space that snappy says it might need.
-	// Since we know that |data| can't be 0-length, we also know that the compressed version of |data| has length greater than zero. The first element in a snappy-encoded blob is a Uvarint indicating how much data is present. Therefore, if there's a Uvarint-encoded 0 at tw.buff[tw.pos:], we know that snappy did not write anything there and we have a problem.
-	if v, n := binary.Uvarint(tw.buff[tw.pos:]); v == 0 {
-		d.Chk.True(n != 0)
-		panic(fmt.Errorf("BUG 3156: unbuffered chunk %s: uncompressed %d, compressed %d, snappy max %d, tw.buff %d\n", h.String(), len(data), dataLength, snappy.MaxEncodedLen(len(data)), len(tw.buff[tw.pos:])))
+func (tw *tableWriter) compress(data []byte) []byte {
+	if tw.zstd != nil {
+		return tw.zstd.EncodeAll(data, nil)
 	}
+	return tw.snapper.Encode(nil, data)
+}
+
+func (tw *tableWriter) writeRecord(h addr, data []byte) {
+	var record []byte
+	if tw.cipher == nil && tw.zstd == nil {
+		// Compress data straight into tw.buff
+		record = tw.snapper.Encode(tw.buff[tw.pos:], data)
+
+		// BUG 3156 indicated that, sometimes, snappy decided that there's not enough space in tw.buff[tw.pos:] to encode into.
+		// This _should never happen anymore be_, because we iterate over all chunks to be added and sum the max amount of space that snappy says it might need.
+		// Since we know that |data| can't be 0-length, we also know that the compressed version of |data| has length greater than zero. The first element in a snappy-encoded blob is a Uvarint indicating how much data is present. Therefore, if there's a Uvarint-encoded 0 at tw.buff[tw.pos:], we know that snappy did not write anything there and we have a problem.
+		if v, n := binary.Uvarint(tw.buff[tw.pos:]); v == 0 {
+			d.Chk.True(n != 0)
+			panic(fmt.Errorf("BUG 3156: unbuffered chunk %s: uncompressed %d, compressed %d, snappy max %d, tw.buff %d\n", h.String(), len(data), len(record), snappy.MaxEncodedLen(len(data)), len(tw.buff[tw.pos:])))
+		}
+	} else if tw.cipher == nil {
+		// Compress data to the side, then copy it into tw.buff
+		compressed := tw.compress(data)
+		d.Chk.True(uint64(len(compressed))+checksumSize <= uint64(len(tw.buff))-tw.pos)
+		record = tw.buff[tw.pos : tw.pos+uint64(copy(tw.buff[tw.pos:], compressed))]
+	} else {
+		// Compress data to the side, then encrypt it into tw.buff
+		compressed := tw.compress(data)
+		d.Chk.True(uint64(len(compressed)+encryptionOverhead)+checksumSize <= uint64(len(tw.buff))-tw.pos)
+		record = tw.cipher.seal(tw.buff[tw.pos:tw.pos], compressed, h)
+	}
+	dataLength := uint64(len(record))
 
 	tw.pos += dataLength
 	tw.totalUncompressedData += uint64(len(data))
 
 	// checksum (4 LSBytes, big-endian)
-	binary.BigEndian.PutUint32(tw.buff[tw.pos:], crc(compressed))
+	binary.BigEndian.PutUint32(tw.buff[tw.pos:], crc(record))
 	tw.pos += checksumSize
 
 	// Stored in insertion order
@@ -91,13 +154,26 @@ func (tw *tableWriter) addChunk(h addr, data []byte) bool {
 		uint32(len(tw.prefixes)),
 		uint32(checksumSize + dataLength),
 	})
-
-	return true
 }
 
 func (tw *tableWriter) finish() (uncompressedLength uint64, blockAddr addr) {
+	if tw.format == ZstdTables {
+		if tw.zstd == nil {
+			tw.startZstd()
+		}
+		tw.pos += uint64(copy(tw.buff[tw.pos:], tw.dictionary))
+	}
 	tw.writeIndex()
 	tw.writeFooter()
+	if tw.format == ZstdTables {
+		// Tables of the same chunks in different formats, or with different dictionaries, must have different names.
+		tw.blockHash.Write([]byte(zstdMagicNumber))
+		tw.blockHash.Write(tw.dictionary)
+	}
+	if tw.cipher != nil {
+		// Tables of the same chunks encrypted with different keys must have different names.
+		tw.blockHash.Write([]byte(tw.cipher.keyID))
+	}
 	uncompressedLength = tw.pos
 
 	var h []byte
@@ -153,6 +229,12 @@ func (tw *tableWriter) writeIndex() {
 }
 
 func (tw *tableWriter) writeFooter() {
+	if tw.format == ZstdTables {
+		// dictionary length
+		binary.BigEndian.PutUint32(tw.buff[tw.pos:], uint32(len(tw.dictionary)))
+		tw.pos += uint32Size
+	}
+
 	// chunk count
 	chunkCount := uint32(len(tw.prefixes))
 	binary.BigEndian.PutUint32(tw.buff[tw.pos:], chunkCount)
@@ -163,6 +245,10 @@ func (tw *tableWriter) writeFooter() {
 	tw.pos += uint64Size
 
 	// magic number
-	copy(tw.buff[tw.pos:], magicNumber)
+	if tw.format == ZstdTables {
+		copy(tw.buff[tw.pos:], zstdMagicNumber)
+	} else {
+		copy(tw.buff[tw.pos:], magicNumber)
+	}
 	tw.pos += magicNumberSize
 }
@@ -14,7 +14,7 @@ import (
 	"github.com/attic-labs/noms/go/types"
 )
 
-var datasetCapturePrefixRe = regexp.MustCompile("^(" + datas.DatasetRe.String() + ")")
+var datasetCapturePrefixRe = regexp.MustCompile("^(" + datas.DatasetOrTagRe.String() + ")")
 
 // AbsolutePath describes the location of a Value within a Noms database.
 //
@@ -28,6 +28,7 @@ func TestAbsolutePathToAndFromString(t *testing.T) {
 	h := types.Number(42).Hash() // arbitrary hash
 	test(fmt.Sprintf("foo.bar[#%s]", h.String()))
 	test(fmt.Sprintf("#%s.bar[42]", h.String()))
+	test("@tag:release-1.2.value[0]")
 }
 
 func TestAbsolutePaths(t *testing.T) {
@@ -48,6 +49,7 @@ func TestAbsolutePaths(t *testing.T) {
 	ds, err = db.CommitValue(ds, list)
 	assert.NoError(err)
 	head := ds.Head()
+	assert.NoError(db.CreateTag("release-1.2", ds.HeadRef(), types.Struct{}))
 
 	resolvesTo := func(exp types.Value, str string) {
 		p, err := NewAbsolutePath(str)
@@ -72,7 +74,12 @@ func TestAbsolutePaths(t *testing.T) {
 	resolvesTo(s0, "#"+list.Hash().String()+"[0]")
 	resolvesTo(s1, "#"+list.Hash().String()+"[1]")
 
+	resolvesTo(head, "@tag:release-1.2")
+	resolvesTo(list, "@tag:release-1.2.value")
+	resolvesTo(s1, "@tag:release-1.2.value[1]")
+
 	resolvesTo(nil, "foo")
+	resolvesTo(nil, "@tag:foo.value")
 	resolvesTo(nil, "foo.parents")
 	resolvesTo(nil, "foo.value")
 	resolvesTo(nil, "foo.value[0]")
@@ -120,6 +127,7 @@ func TestAbsolutePathParseErrors(t *testing.T) {
 	test("", "Empty path")
 	test(".foo", "Invalid dataset name: .foo")
 	test(".foo.bar.baz", "Invalid dataset name: .foo.bar.baz")
+	test("@tag:", "Invalid dataset name: @tag:")
 	test("#", "Invalid hash: ")
 	test("#abc", "Invalid hash: abc")
 	invHash := strings.Repeat("z", hash.StringLen)
@@ -7,14 +7,17 @@
 package spec
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net/url"
+	"os"
 	"regexp"
 	"strings"
-	"os"
+	"time"
 
 	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
 	"github.com/attic-labs/noms/go/datas"
 	"github.com/attic-labs/noms/go/nbs"
 	"github.com/attic-labs/noms/go/types"
@@ -22,10 +25,28 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/s3"
+	humanize "github.com/dustin/go-humanize"
 )
 
 const Separator = "::"
 
+// The environment variables from which the TLS options of http(s) specs are
+// read, if none of them are set in SpecOptions. See SpecOptions.CACertFile,
+// ClientCertFile and ClientKeyFile.
+const (
+	CACertFileEnvVar     = "NOMS_CA_CERT_FILE"
+	ClientCertFileEnvVar = "NOMS_CLIENT_CERT_FILE"
+	ClientKeyFileEnvVar  = "NOMS_CLIENT_KEY_FILE"
+)
+
+// The environment variables from which the disk cache of aws:// specs is
+// configured, if SpecOptions.DiskCacheDir isn't set. The size is in the
+// format of humanize.ParseBytes, e.g. "10GB".
+const (
+	DiskCacheDirEnvVar  = "NOMS_DISK_CACHE_DIR"
+	DiskCacheSizeEnvVar = "NOMS_DISK_CACHE_SIZE"
+)
+
 var datasetRe = regexp.MustCompile("^" + datas.DatasetRe.String() + "$")
 
 // SpecOptions customize Spec behavior.
@@ -33,6 +54,61 @@ type SpecOptions struct {
 	// Authorization token for requests. For example, if the database is HTTP
 	// this will used for an `Authorization: Bearer ${authorization}` header.
 	Authorization string
+
+	// CACertFile is a PEM bundle of the CAs to verify https servers against,
+	// instead of the system's.
+	CACertFile string
+
+	// ClientCertFile and ClientKeyFile are the PEM encoded certificate and key
+	// to present to https servers that require clients to identify themselves.
+	// If none of CACertFile, ClientCertFile and ClientKeyFile are set, they
+	// are read from the environment variables CACertFileEnvVar,
+	// ClientCertFileEnvVar and ClientKeyFileEnvVar instead.
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// CommitHooks are run by the Database whenever it moves the head of a
+	// dataset. See datas.CommitHooks.
+	CommitHooks datas.CommitHooks
+
+	// CompactionInterval, if not 0, is how often nbs:, blob: and aws://
+	// databases compact their tables in the background, with
+	// CompactionPolicy, instead of whenever a write leaves them with too many.
+	// See nbs.StoreOptions.
+	CompactionInterval time.Duration
+	CompactionPolicy   nbs.CompactionPolicy
+
+	// DiskCacheDir and DiskCacheSize configure a local cache of the data that
+	// aws:// databases read from S3. See nbs.AWSStoreOptions. If DiskCacheDir
+	// is empty, both are read from the environment variables
+	// DiskCacheDirEnvVar and DiskCacheSizeEnvVar instead.
+	DiskCacheDir  string
+	DiskCacheSize uint64
+
+	// EncryptionKeys are the keys that aws:// databases encrypt the chunks
+	// they write to S3 with, in the format of nbs.ParseKeyring. If empty, they
+	// are read from the environment variable nbs.EncryptionKeysEnvVar instead.
+	EncryptionKeys string
+
+	// TableFormat is the format in which nbs:, blob: and aws:// databases
+	// write new tables, in the format of nbs.ParseTableFormat. If empty, it's
+	// read from the environment variable nbs.TableFormatEnvVar instead.
+	TableFormat string
+}
+
+// tlsConfig returns the TLS configuration described by these options, or by
+// the environment, or nil if neither customizes TLS.
+func (opts SpecOptions) tlsConfig() *tls.Config {
+	caFile, certFile, keyFile := opts.CACertFile, opts.ClientCertFile, opts.ClientKeyFile
+	if caFile == "" && certFile == "" && keyFile == "" {
+		caFile, certFile, keyFile = os.Getenv(CACertFileEnvVar), os.Getenv(ClientCertFileEnvVar), os.Getenv(ClientKeyFileEnvVar)
+	}
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil
+	}
+	cfg, err := datas.NewClientTLSConfig(caFile, certFile, keyFile)
+	d.PanicIfError(err)
+	return cfg
 }
 
 // Spec locates a Noms database, dataset, or value globally.
@@ -169,16 +245,18 @@ func (sp Spec) NewChunkStore() chunks.ChunkStore {
 	case "http", "https":
 		return nil
 	case "aws":
-		return parseAWSSpec(sp.Href())
+		return parseAWSSpec(sp.Href(), sp.Options)
 	case "nbs":
-		return nbs.NewLocalStore(sp.DatabaseName, 1<<28)
+		return nbs.NewLocalStoreOpts(sp.DatabaseName, 1<<28, sp.Options.storeOptions())
+	case "blob":
+		return sp.newBlobStore()
 	case "mem":
 		return chunks.NewMemoryStore()
 	}
 	panic("unreachable")
 }
 
-func parseAWSSpec(awsURL string) chunks.ChunkStore {
+func parseAWSSpec(awsURL string, opts SpecOptions) chunks.ChunkStore {
 	u, _ := url.Parse(awsURL)
 	parts := strings.SplitN(u.Host, ":", 2) // [table] [, bucket]?
 	sess := session.Must(session.NewSession(aws.NewConfig().WithRegion("us-west-2")))
@@ -186,7 +264,51 @@ func parseAWSSpec(awsURL string) chunks.ChunkStore {
 	if len(parts) == 1 {
 		return chunks.NewDynamoStore(parts[0], u.Path, ddb, false)
 	}
-	return nbs.NewAWSStore(parts[0], u.Path, parts[1], s3.New(sess), ddb, 1<<28)
+	dir, size := opts.diskCache()
+	return nbs.NewAWSStoreOpts(parts[0], u.Path, parts[1], s3.New(sess), ddb, 1<<28, nbs.AWSStoreOptions{StoreOptions: opts.storeOptions(), DiskCacheDir: dir, DiskCacheSize: size, Keys: opts.keyring()})
+}
+
+// diskCache returns the directory and size of the disk cache described by
+// these options, or by the environment.
+func (opts SpecOptions) diskCache() (string, uint64) {
+	if opts.DiskCacheDir != "" {
+		return opts.DiskCacheDir, opts.DiskCacheSize
+	}
+	dir, size := os.Getenv(DiskCacheDirEnvVar), uint64(0)
+	if s := os.Getenv(DiskCacheSizeEnvVar); dir != "" && s != "" {
+		var err error
+		size, err = humanize.ParseBytes(s)
+		d.PanicIfError(err)
+	}
+	return dir, size
+}
+
+// keyring returns the keys described by these options, or by the
+// environment, or nil if there are none.
+func (opts SpecOptions) keyring() *nbs.Keyring {
+	var keys *nbs.Keyring
+	var err error
+	if opts.EncryptionKeys != "" {
+		keys, err = nbs.ParseKeyring(opts.EncryptionKeys)
+	} else {
+		keys, err = nbs.KeyringFromEnv()
+	}
+	d.PanicIfError(err)
+	return keys
+}
+
+// storeOptions returns the options of NomsBlockStores described by these
+// options, or by the environment.
+func (opts SpecOptions) storeOptions() nbs.StoreOptions {
+	var format nbs.TableFormat
+	var err error
+	if opts.TableFormat != "" {
+		format, err = nbs.ParseTableFormat(opts.TableFormat)
+	} else {
+		format, err = nbs.TableFormatFromEnv()
+	}
+	d.PanicIfError(err)
+	return nbs.StoreOptions{TableFormat: format, CompactionInterval: opts.CompactionInterval, CompactionPolicy: opts.CompactionPolicy}
 }
 
 // GetDataset returns the current Dataset instance for this Spec's Database.
@@ -263,20 +385,70 @@ func (sp Spec) Close() error {
 }
 
 func (sp Spec) createDatabase() datas.Database {
+	opts := datas.DatabaseOptions{Hooks: sp.Options.CommitHooks}
 	switch sp.Protocol {
 	case "http", "https":
-		return datas.NewRemoteDatabase(sp.Href(), sp.Options.Authorization)
+		return datas.NewRemoteDatabaseOpts(sp.Href(), sp.Options.Authorization, sp.Options.tlsConfig(), opts)
 	case "aws":
-		return datas.NewDatabase(parseAWSSpec(sp.Href()))
+		return datas.NewDatabaseOpts(parseAWSSpec(sp.Href(), sp.Options), opts)
 	case "nbs":
 		os.Mkdir(sp.DatabaseName, 0777)
-		return datas.NewDatabase(nbs.NewLocalStore(sp.DatabaseName, 1<<28))
+		var cs chunks.ChunkStore = nbs.NewLocalStoreOpts(sp.DatabaseName, 1<<28, sp.Options.storeOptions())
+		if upstream := sp.Upstream(); upstream != "" {
+			cs = sp.newLazyChunkStore(cs, upstream)
+		}
+		return datas.NewDatabaseOpts(cs, opts)
+	case "blob":
+		return datas.NewDatabaseOpts(sp.newBlobStore(), opts)
 	case "mem":
-		return datas.NewDatabase(chunks.NewMemoryStore())
+		return datas.NewDatabaseOpts(chunks.NewMemoryStore(), opts)
 	}
 	panic("unreachable")
 }
 
+// newBlobStore returns a NomsBlockStore that keeps its tables and manifest as
+// objects in a local directory, or, given an endpoint option, in a bucket of
+// an S3-compatible service. The spec blob://dir or blob:dir names the
+// directory dir, and blob:///dir names /dir. The spec
+// blob://bucket/prefix?endpoint=http://host:9000 names the objects of bucket
+// whose keys start with prefix/ on the service at http://host:9000, which is
+// found in the region given by the region option, or us-east-1. Credentials
+// for the service are looked up the way the AWS SDK usually does, e.g. in the
+// environment variables AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+func (sp Spec) newBlobStore() chunks.ChunkStore {
+	path, query := parseBlobName(sp.DatabaseName)
+	if endpoint := query.Get("endpoint"); endpoint != "" {
+		region := query.Get("region")
+		if region == "" {
+			region = "us-east-1"
+		}
+		sess := session.Must(session.NewSession(aws.NewConfig().WithEndpoint(endpoint).WithRegion(region).WithS3ForcePathStyle(true)))
+		parts := strings.SplitN(path, "/", 2) // [bucket] [, prefix]?
+		prefix := ""
+		if len(parts) == 2 && strings.Trim(parts[1], "/") != "" {
+			prefix = strings.Trim(parts[1], "/") + "/"
+		}
+		objects := nbs.NewS3ObjectStore(sess, parts[0], prefix)
+		return nbs.NewBlobStoreOpts(objects, objects, "", 1<<28, sp.Options.storeOptions())
+	}
+	objects, err := nbs.NewDirObjectStore(path)
+	d.PanicIfError(err)
+	return nbs.NewBlobStoreOpts(objects, objects, "", 1<<28, sp.Options.storeOptions())
+}
+
+// parseBlobName splits the name of a blob: database into the path it names and
+// its options, if it has a query string with an endpoint option. Otherwise,
+// the whole name is a directory.
+func parseBlobName(name string) (path string, query url.Values) {
+	path = strings.TrimPrefix(name, "//")
+	if i := strings.LastIndex(path, "?"); i >= 0 {
+		if q, err := url.ParseQuery(path[i+1:]); err == nil && q.Get("endpoint") != "" {
+			return path[:i], q
+		}
+	}
+	return path, url.Values{}
+}
+
 func parseDatabaseSpec(spec string) (protocol, name string, err error) {
 	if len(spec) == 0 {
 		err = fmt.Errorf("Empty spec")
@@ -301,6 +473,15 @@ func parseDatabaseSpec(spec string) (protocol, name string, err error) {
 	case "nbs":
 		protocol, name = parts[0], parts[1]
 
+	case "blob":
+		if path, query := parseBlobName(parts[1]); path == "" {
+			err = fmt.Errorf("%s does not specify a directory", spec)
+		} else if query.Get("endpoint") != "" && strings.HasPrefix(path, "/") {
+			err = fmt.Errorf("%s does not specify a bucket", spec)
+		} else {
+			protocol, name = parts[0], parts[1]
+		}
+
 	case "http", "https", "aws":
 		u, perr := url.Parse(spec)
 		if perr != nil {
@@ -10,10 +10,12 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/attic-labs/noms/go/datas"
 	"github.com/attic-labs/noms/go/nbs"
 	"github.com/attic-labs/noms/go/types"
+	"github.com/attic-labs/noms/go/util/s3test"
 	"github.com/attic-labs/testify/assert"
 )
 
@@ -149,10 +151,100 @@ func TestNBSDatabaseSpec(t *testing.T) {
 	run("nbs:")
 }
 
+func TestBlobDatabaseSpec(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir, err := ioutil.TempDir("", "spec_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpDir)
+
+	s := types.String("string")
+	store := path.Join(tmpDir, "store")
+	func() {
+		sp, err := ForDatabase("blob://" + store)
+		assert.NoError(err)
+		defer sp.Close()
+		assert.Equal("blob", sp.Protocol)
+
+		db := sp.GetDatabase()
+		_, err = db.CommitValue(db.GetDataset("datasetID"), db.WriteValue(s))
+		assert.NoError(err)
+	}()
+
+	// A blob directory is laid out like a local nbs store.
+	for _, spec := range []string{"blob:" + store, "nbs:" + store} {
+		sp, err := ForDataset(spec + "::datasetID")
+		assert.NoError(err)
+		defer sp.Close()
+		assert.Equal(s, sp.GetDataset().HeadValue().(types.Ref).TargetValue(sp.GetDatabase()))
+	}
+}
+
+func TestS3BlobDatabaseSpec(t *testing.T) {
+	assert := assert.New(t)
+	srv := s3test.NewServer()
+	defer srv.Close()
+	for k, v := range map[string]string{"AWS_ACCESS_KEY_ID": "id", "AWS_SECRET_ACCESS_KEY": "secret"} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	s := types.String("string")
+	spec := "blob://bucket/db?endpoint=" + srv.URL
+	func() {
+		sp, err := ForDatabase(spec)
+		assert.NoError(err)
+		defer sp.Close()
+		assert.Equal("blob", sp.Protocol)
+
+		db := sp.GetDatabase()
+		_, err = db.CommitValue(db.GetDataset("datasetID"), db.WriteValue(s))
+		assert.NoError(err)
+	}()
+
+	sp, err := ForDataset(spec + "::datasetID")
+	assert.NoError(err)
+	defer sp.Close()
+	assert.Equal(s, sp.GetDataset().HeadValue().(types.Ref).TargetValue(sp.GetDatabase()))
+	assert.Contains(srv.Objects("bucket"), "db/manifest")
+}
+
 // Skip LDB dataset and path tests: the database behaviour is tested in
 // TestLDBDatabaseSpec, TestMemDatasetSpec/TestMem*PathSpec cover general
 // dataset/path behaviour, and ForDataset/ForPath test LDB parsing.
 
+func TestSpecOptionsKeyring(t *testing.T) {
+	assert := assert.New(t)
+	key := "eLbYQJbZ5CtXm6b2JNGQmE63WeLlgTpaxHzL2ii+mNY="
+
+	defer os.Setenv(nbs.EncryptionKeysEnvVar, os.Getenv(nbs.EncryptionKeysEnvVar))
+	os.Unsetenv(nbs.EncryptionKeysEnvVar)
+	assert.Nil(SpecOptions{}.keyring())
+
+	os.Setenv(nbs.EncryptionKeysEnvVar, "env="+key)
+	assert.Equal("env", SpecOptions{}.keyring().ActiveKeyID())
+	assert.Equal("opts", SpecOptions{EncryptionKeys: "opts=" + key}.keyring().ActiveKeyID())
+
+	assert.Panics(func() { SpecOptions{EncryptionKeys: "opts"}.keyring() })
+}
+
+func TestSpecOptionsStoreOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv(nbs.TableFormatEnvVar, os.Getenv(nbs.TableFormatEnvVar))
+	os.Unsetenv(nbs.TableFormatEnvVar)
+	assert.Equal(nbs.SnappyTables, SpecOptions{}.storeOptions().TableFormat)
+
+	os.Setenv(nbs.TableFormatEnvVar, "zstd")
+	assert.Equal(nbs.ZstdTables, SpecOptions{}.storeOptions().TableFormat)
+	assert.Equal(nbs.SnappyTables, SpecOptions{TableFormat: "snappy"}.storeOptions().TableFormat)
+
+	assert.Panics(func() { SpecOptions{TableFormat: "lz4"}.storeOptions() })
+
+	opts := SpecOptions{CompactionInterval: time.Minute, CompactionPolicy: nbs.CompactAllPolicy}.storeOptions()
+	assert.Equal(time.Minute, opts.CompactionInterval)
+	assert.Equal(nbs.CompactAllPolicy, opts.CompactionPolicy)
+}
+
 func TestCloseSpecWithoutOpen(t *testing.T) {
 	s, err := ForDatabase("mem")
 	assert.NoError(t, err)
@@ -207,6 +299,9 @@ func TestForDatabase(t *testing.T) {
 		"aws://t:b",
 		"aws://t",
 		"aws://t:",
+		"blob:",
+		"blob://",
+		"blob://?endpoint=http://localhost:9000",
 	}
 
 	for _, spec := range badSpecs {
@@ -238,6 +333,9 @@ func TestForDatabase(t *testing.T) {
 		{"http://::ffff::1e::9a", "http", "//::ffff::1e::9a", ""},
 		{"aws://table:bucket/db", "aws", "//table:bucket/db", ""},
 		{"aws://table/db", "aws", "//table/db", ""},
+		{"blob://" + tmpDir, "blob", "//" + tmpDir, ""},
+		{"blob:" + tmpDir, "blob", tmpDir, ""},
+		{"blob://bucket/db?endpoint=http://localhost:9000", "blob", "//bucket/db?endpoint=http://localhost:9000", ""},
 	}
 
 	for _, tc := range testCases {
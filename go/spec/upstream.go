@@ -0,0 +1,86 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package spec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/attic-labs/noms/go/chunks"
+	"github.com/attic-labs/noms/go/d"
+	"github.com/attic-labs/noms/go/datas"
+)
+
+// upstreamFileName is the file within an nbs database's directory that
+// records the database it lazily fetches missing chunks from.
+const upstreamFileName = "upstream"
+
+// Upstream returns the database spec that this Spec's database fetches
+// missing chunks from, as recorded by SetUpstream(), or "" if it has none.
+// Only nbs databases can have an upstream.
+func (sp Spec) Upstream() string {
+	if sp.Protocol != "nbs" {
+		return ""
+	}
+	b, err := ioutil.ReadFile(filepath.Join(sp.DatabaseName, upstreamFileName))
+	if os.IsNotExist(err) {
+		return ""
+	}
+	d.PanicIfError(err)
+	return strings.TrimSpace(string(b))
+}
+
+// SetUpstream records that this Spec's database, which must be an nbs
+// database, holds only some of the chunks of the database described by
+// |upstream|, e.g. because it was created by a shallow sync. From then on,
+// GetDatabase() returns a Database that fetches the chunks it's missing from
+// |upstream| when they're needed. It's an error to change the upstream of a
+// database that already has one.
+func (sp Spec) SetUpstream(upstream Spec) error {
+	if sp.Protocol != "nbs" {
+		return fmt.Errorf("Only nbs databases can fetch chunks from an upstream, not %s", sp.Protocol)
+	}
+	if upstream.Protocol == "mem" {
+		return fmt.Errorf("An in-memory database can't be an upstream")
+	}
+	upstreamSpec := upstream.Protocol + ":" + upstream.DatabaseName
+	if upstream.Protocol == "nbs" {
+		abs, err := filepath.Abs(upstream.DatabaseName)
+		if err != nil {
+			return err
+		}
+		upstreamSpec = upstream.Protocol + ":" + abs
+	}
+
+	if abs, err := filepath.Abs(sp.DatabaseName); err != nil {
+		return err
+	} else if upstreamSpec == sp.Protocol+":"+abs {
+		return fmt.Errorf("Database %s can't be its own upstream", sp.DatabaseName)
+	}
+
+	if current := sp.Upstream(); current == upstreamSpec {
+		return nil
+	} else if current != "" {
+		return fmt.Errorf("Database %s already fetches chunks from %s", sp.DatabaseName, current)
+	}
+	if err := os.MkdirAll(sp.DatabaseName, 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(sp.DatabaseName, upstreamFileName), []byte(upstreamSpec+"\n"), 0644)
+}
+
+// newLazyChunkStore wraps |local| in a ChunkStore that fetches the chunks it's
+// missing from the database described by |upstream|.
+func (sp Spec) newLazyChunkStore(local chunks.ChunkStore, upstream string) chunks.ChunkStore {
+	up, err := ForDatabaseOpts(upstream, sp.Options)
+	d.PanicIfError(err)
+	if up.Protocol == "http" || up.Protocol == "https" {
+		return datas.NewLazyChunkStore(local, datas.NewHTTPBatchStoreTLS(up.Href(), up.Options.Authorization, up.Options.tlsConfig()))
+	}
+	return datas.NewLazyChunkStore(local, up.NewChunkStore())
+}
@@ -0,0 +1,226 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Package s3test provides a local stand-in for an S3-compatible service, like
+// MinIO, for tests that talk to one over HTTP.
+package s3test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server keeps objects in memory and speaks just enough of the S3 REST API,
+// with path-style addressing, to put, get ranges of, list and delete them,
+// including conditional puts with If-Match and If-None-Match. Any bucket
+// exists. It doesn't check credentials, but clients must still send some.
+type Server struct {
+	*httptest.Server
+
+	// MaxKeys is the most keys that one response to a list request holds.
+	MaxKeys int
+
+	// OnPut, if not nil, is called with the key of each object that's about
+	// to be put, before the request's conditions are checked, e.g. so that a
+	// test can make a concurrent change.
+	OnPut func(key string)
+
+	mu      sync.Mutex
+	objects map[string][]byte // "bucket/key" -> data
+}
+
+// NewServer starts a Server. Callers should Close it when they're done.
+func NewServer() *Server {
+	s := &Server{MaxKeys: 1000, objects: map[string][]byte{}}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Objects returns the keys of the objects in |bucket|, sorted.
+func (s *Server) Objects(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []string{}
+	for k := range s.objects {
+		if strings.HasPrefix(k, bucket+"/") {
+			keys = append(keys, strings.TrimPrefix(k, bucket+"/"))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+	if parts[0] == "" {
+		writeError(w, http.StatusBadRequest, "InvalidBucketName", "No bucket")
+		return
+	}
+	if len(parts) == 1 || parts[1] == "" {
+		if req.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", req.Method)
+			return
+		}
+		s.list(w, req, parts[0])
+		return
+	}
+
+	if req.Method == "PUT" && s.OnPut != nil {
+		s.OnPut(parts[1])
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := parts[0] + "/" + parts[1]
+	data, ok := s.objects[name]
+	switch req.Method {
+	case "GET":
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("ETag", etag(data))
+		status := http.StatusOK
+		if rng := req.Header.Get("Range"); rng != "" {
+			start, end, err := parseRange(rng, len(data))
+			if err != nil {
+				writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", err.Error())
+				return
+			}
+			data, status = data[start:end], http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(status)
+		w.Write(data)
+
+	case "PUT":
+		if m := req.Header.Get("If-None-Match"); m == "*" && ok {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+			return
+		}
+		if m := req.Header.Get("If-Match"); m != "" {
+			if !ok {
+				writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+				return
+			} else if m != etag(data) {
+				writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+				return
+			}
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		s.objects[name] = body
+		w.Header().Set("ETag", etag(body))
+		w.WriteHeader(http.StatusOK)
+
+	case "DELETE":
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", req.Method)
+	}
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string
+	Prefix                string
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	Contents              []listEntry
+	NextContinuationToken string `xml:",omitempty"`
+}
+
+type listEntry struct {
+	Key  string
+	Size int
+	ETag string
+}
+
+// list answers a ListObjectsV2 request. The continuation token is simply the
+// last key of the previous page.
+func (s *Server) list(w http.ResponseWriter, req *http.Request, bucket string) {
+	q := req.URL.Query()
+	prefix, after := q.Get("prefix"), q.Get("continuation-token")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []string{}
+	for k := range s.objects {
+		if key := strings.TrimPrefix(k, bucket+"/"); key != k && strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	res := listBucketResult{Name: bucket, Prefix: prefix, MaxKeys: s.MaxKeys}
+	if len(keys) > s.MaxKeys {
+		keys = keys[:s.MaxKeys]
+		res.IsTruncated, res.NextContinuationToken = true, keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		data := s.objects[bucket+"/"+key]
+		res.Contents = append(res.Contents, listEntry{key, len(data), etag(data)})
+	}
+	res.KeyCount = len(res.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(res)
+}
+
+// parseRange parses a Range header of the form "bytes=start-end", where end
+// is inclusive, or "bytes=-n", meaning the last n bytes.
+func parseRange(hdr string, size int) (start, end int, err error) {
+	spec := strings.TrimPrefix(hdr, "bytes=")
+	ends := strings.SplitN(spec, "-", 2)
+	if spec == hdr || len(ends) != 2 {
+		return 0, 0, fmt.Errorf("Bad range %s", hdr)
+	}
+	if ends[0] == "" {
+		n, err := strconv.Atoi(ends[1])
+		if err != nil {
+			return 0, 0, err
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size, nil
+	}
+	if start, err = strconv.Atoi(ends[0]); err != nil {
+		return 0, 0, err
+	}
+	if end, err = strconv.Atoi(ends[1]); err != nil {
+		return 0, 0, err
+	}
+	if start >= size {
+		return 0, 0, fmt.Errorf("Range %s starts past the end of the object", hdr)
+	}
+	if end++; end > size { // like S3, return what there is of the range
+		end = size
+	}
+	return start, end, nil
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Error><Code>%s</Code><Message>%s</Message></Error>", code, msg)
+}
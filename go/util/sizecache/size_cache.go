@@ -27,10 +27,18 @@ type SizeCache struct {
 	mu        sync.Mutex
 	lru       list.List
 	cache     map[interface{}]sizeCacheEntry
+	expireCb  func(key interface{})
 }
 
 func New(maxSize uint64) *SizeCache {
-	return &SizeCache{maxSize: maxSize, cache: map[interface{}]sizeCacheEntry{}}
+	return NewWithExpireCallback(maxSize, nil)
+}
+
+// NewWithExpireCallback returns a SizeCache that calls |expireCb|, if it isn't
+// nil, with the key of each entry that Add() expires to make room for another.
+// It's called with the SizeCache locked, so it mustn't call back into it.
+func NewWithExpireCallback(maxSize uint64, expireCb func(key interface{})) *SizeCache {
+	return &SizeCache{maxSize: maxSize, cache: map[interface{}]sizeCacheEntry{}, expireCb: expireCb}
 }
 
 // entry() checks if the value is in the cache. If not in the cache, it returns an
@@ -88,6 +96,9 @@ func (c *SizeCache) Add(key interface{}, size uint64, value interface{}) {
 			delete(c.cache, key1)
 			c.totalSize -= ce.size
 			c.lru.Remove(el)
+			if c.expireCb != nil {
+				c.expireCb(key1)
+			}
 			el = next
 		}
 	}
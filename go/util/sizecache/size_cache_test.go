@@ -137,3 +137,21 @@ func TestZeroSizeCache(t *testing.T) {
 	_, ok := c.Get(hashFromString("data1"))
 	assert.False(ok)
 }
+
+func TestExpireCallback(t *testing.T) {
+	assert := assert.New(t)
+
+	expired := []string{}
+	c := NewWithExpireCallback(600, func(key interface{}) {
+		expired = append(expired, key.(string))
+	})
+	for _, k := range []string{"data-1", "data-2", "data-3"} {
+		c.Add(k, 200, k)
+	}
+	c.Get("data-1")
+	c.Add("data-4", 400, "data-4")
+	assert.Equal([]string{"data-2", "data-3"}, expired)
+
+	c.Drop("data-1")
+	assert.Equal([]string{"data-2", "data-3"}, expired)
+}